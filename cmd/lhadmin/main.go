@@ -0,0 +1,186 @@
+// lhadmin administers LogHarbour realms: it creates a realm's index and metadata, and issues,
+// rotates and revokes the realm's write and query tokens, as described on the wiki's
+// Access control page. Every operation is logged as a Change entry in the audit index.
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/remiges-tech/logharbour/logharbour"
+	"github.com/spf13/cobra"
+)
+
+// options holds the global flags.
+type options struct {
+	esAddresses   string
+	esUsername    string
+	esPassword    string
+	esCACert      string
+	metadataIndex string
+	auditIndex    string
+	who           string
+}
+
+func getEnv(key, fallback string) string {
+	if value, exists := os.LookupEnv(key); exists {
+		return value
+	}
+	return fallback
+}
+
+func main() {
+	if err := newRootCmd().Execute(); err != nil {
+		os.Exit(1)
+	}
+}
+
+func newRootCmd() *cobra.Command {
+	opts := &options{}
+	root := &cobra.Command{
+		Use:           "lhadmin",
+		Short:         "Administer LogHarbour realms and their access tokens",
+		SilenceUsage:  true,
+		SilenceErrors: false,
+	}
+	flags := root.PersistentFlags()
+	flags.StringVar(&opts.esAddresses, "es-addresses", getEnv("ELASTICSEARCH_ADDRESSES", "http://localhost:9200"), "Elasticsearch addresses (comma-separated)")
+	flags.StringVar(&opts.esUsername, "es-username", getEnv("ELASTICSEARCH_USERNAME", ""), "Elasticsearch username")
+	flags.StringVar(&opts.esPassword, "es-password", getEnv("ELASTICSEARCH_PASSWORD", ""), "Elasticsearch password")
+	flags.StringVar(&opts.esCACert, "es-ca-cert", getEnv("ELASTICSEARCH_CA_CERT", ""), "Path to Elasticsearch CA certificate (for HTTPS)")
+	flags.StringVar(&opts.metadataIndex, "metadata-index", logharbour.DefaultRealmMetadataIndex, "Index holding realm metadata")
+	flags.StringVar(&opts.auditIndex, "audit-index", "logharbour_admin", "Index to which admin operations are logged")
+	flags.StringVar(&opts.who, "who", getEnv("USER", ""), "Operator recorded in the audit log")
+
+	root.AddCommand(newRealmCmd(opts), newTokenCmd(opts))
+	return root
+}
+
+// newAdmin connects to Elasticsearch and returns a RealmAdmin which logs to the audit index.
+func newAdmin(cmd *cobra.Command, opts *options) (*logharbour.RealmAdmin, error) {
+	cfg := elasticsearch.Config{Addresses: strings.Split(opts.esAddresses, ",")}
+	if opts.esPassword != "" {
+		cfg.Username = opts.esUsername
+		cfg.Password = opts.esPassword
+		if cfg.Username == "" {
+			cfg.Username = "elastic"
+		}
+	}
+	if opts.esCACert != "" {
+		transport, err := createTLSTransport(opts.esCACert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create TLS transport: %w", err)
+		}
+		cfg.Transport = transport
+	}
+
+	typedClient, err := elasticsearch.NewTypedClient(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Elasticsearch client: %w", err)
+	}
+	esClient, err := logharbour.NewElasticsearchClient(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Elasticsearch client: %w", err)
+	}
+	exists, err := esClient.IndexExists(opts.auditIndex)
+	if err != nil {
+		return nil, fmt.Errorf("error checking if audit index exists: %w", err)
+	}
+	if !exists {
+		if err := esClient.CreateIndex(opts.auditIndex, logharbour.ESLogsMapping); err != nil {
+			return nil, fmt.Errorf("failed to create audit index: %w", err)
+		}
+	}
+
+	// Audit entries go to stderr if they cannot be indexed, so that no operation goes unrecorded
+	writer := logharbour.NewFallbackWriter(&auditWriter{client: esClient, index: opts.auditIndex}, cmd.ErrOrStderr())
+	logger := logharbour.NewLogger(logharbour.NewLoggerContext(logharbour.Info), "lhadmin", writer).WithWho(opts.who)
+
+	return logharbour.NewRealmAdmin(typedClient,
+		logharbour.WithRealmMetadataIndex(opts.metadataIndex),
+		logharbour.WithRealmAdminLogger(logger)), nil
+}
+
+// auditWriter indexes each log entry written to it into the audit index.
+type auditWriter struct {
+	client *logharbour.ElasticsearchClient
+	index  string
+}
+
+// Write implements io.Writer.
+func (w *auditWriter) Write(p []byte) (int, error) {
+	var entry struct {
+		Id string `json:"id"`
+	}
+	if err := json.Unmarshal(p, &entry); err != nil {
+		return 0, err
+	}
+	if entry.Id == "" {
+		return 0, errors.New("log entry has no id")
+	}
+	if err := w.client.Write(w.index, entry.Id, string(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func createTLSTransport(caCertPath string) (*http.Transport, error) {
+	caCert, err := os.ReadFile(caCertPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA certificate: %w", err)
+	}
+
+	caCertPool := x509.NewCertPool()
+	if !caCertPool.AppendCertsFromPEM(caCert) {
+		return nil, fmt.Errorf("failed to parse CA certificate")
+	}
+
+	return &http.Transport{
+		TLSClientConfig: &tls.Config{
+			RootCAs: caCertPool,
+		},
+	}, nil
+}
+
+// readToken reads a token from the first line of the file path, or of the command's input
+// if path is empty or "-", so that tokens are not passed as arguments, which other users
+// can see in the process list and which are kept in shell history.
+func readToken(cmd *cobra.Command, path string) (string, error) {
+	var data []byte
+	var err error
+	if path == "" || path == "-" {
+		data, err = io.ReadAll(cmd.InOrStdin())
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read token: %w", err)
+	}
+	token, _, _ := strings.Cut(string(data), "\n")
+	if token = strings.TrimSpace(token); token == "" {
+		return "", errors.New("no token given")
+	}
+	return token, nil
+}
+
+// writeOutput writes data to the file path, readable only by its owner since it may hold
+// tokens, or to the command's output if path is empty.
+func writeOutput(cmd *cobra.Command, path string, data []byte) error {
+	if path == "" {
+		_, err := cmd.OutOrStdout().Write(data)
+		return err
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	fmt.Fprintf(cmd.ErrOrStderr(), "Written to %s\n", path)
+	return nil
+}
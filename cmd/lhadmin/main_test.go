@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/remiges-tech/logharbour/logharbour"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeES is an in-memory Elasticsearch answering the requests lhadmin makes. Documents are
+// kept per index and id; searches return the documents of the index which have a short name.
+type fakeES struct {
+	*httptest.Server
+	mu      sync.Mutex
+	indices map[string]map[string]json.RawMessage
+	seqNo   int
+}
+
+func newFakeES(t *testing.T) *fakeES {
+	t.Helper()
+	f := &fakeES{indices: make(map[string]map[string]json.RawMessage)}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeES) serve(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	w.Header().Set("X-Elastic-Product", "Elasticsearch")
+	w.Header().Set("Content-Type", "application/json")
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	index, docs := parts[0], f.indices[parts[0]]
+	written := func(id, result string) {
+		f.seqNo++
+		fmt.Fprintf(w, `{"_index": %q, "_id": %q, "_version": 1, "_seq_no": %d, "_primary_term": 1, "result": %q,
+			"_shards": {"total": 1, "successful": 1, "failed": 0}}`, index, id, f.seqNo, result)
+	}
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodHead:
+		if docs == nil {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	case len(parts) == 1 && r.Method == http.MethodPut:
+		f.indices[index] = make(map[string]json.RawMessage)
+		fmt.Fprintf(w, `{"acknowledged": true, "shards_acknowledged": true, "index": %q}`, index)
+	case len(parts) == 3 && parts[1] == "_doc" && r.Method == http.MethodGet:
+		doc, ok := docs[parts[2]]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, `{"_index": %q, "_id": %q, "found": false}`, index, parts[2])
+			return
+		}
+		fmt.Fprintf(w, `{"_index": %q, "_id": %q, "_version": 1, "_seq_no": %d, "_primary_term": 1, "found": true, "_source": %s}`,
+			index, parts[2], f.seqNo, doc)
+	case len(parts) == 3 && parts[1] == "_doc":
+		docs[parts[2]] = body
+		written(parts[2], "updated")
+	case len(parts) == 3 && parts[1] == "_create":
+		if _, ok := docs[parts[2]]; ok {
+			w.WriteHeader(http.StatusConflict)
+			io.WriteString(w, `{"error": {"type": "version_conflict_engine_exception", "reason": "exists"}, "status": 409}`)
+			return
+		}
+		docs[parts[2]] = body
+		w.WriteHeader(http.StatusCreated)
+		written(parts[2], "created")
+	case len(parts) == 3 && parts[1] == "_update":
+		// The realm id counter: inserted from the upsert, then incremented
+		var req struct {
+			Upsert map[string]int `json:"upsert"`
+		}
+		_ = json.Unmarshal(body, &req)
+		counter := req.Upsert
+		if doc, ok := docs[parts[2]]; ok {
+			_ = json.Unmarshal(doc, &counter)
+			for k := range counter {
+				counter[k]++
+			}
+		}
+		docs[parts[2]], _ = json.Marshal(counter)
+		f.seqNo++
+		fmt.Fprintf(w, `{"_index": %q, "_id": %q, "_version": 1, "_seq_no": %d, "_primary_term": 1, "result": "updated",
+			"_shards": {"total": 1, "successful": 1, "failed": 0}, "get": {"found": true, "_source": %s}}`,
+			index, parts[2], f.seqNo, docs[parts[2]])
+	case len(parts) == 2 && parts[1] == "_search":
+		var realms []logharbour.Realm
+		for _, doc := range docs {
+			var realm logharbour.Realm
+			if json.Unmarshal(doc, &realm) == nil && realm.ShortName != "" {
+				realms = append(realms, realm)
+			}
+		}
+		sort.Slice(realms, func(i, j int) bool { return realms[i].Id < realms[j].Id })
+		if strings.Contains(string(body), `"desc"`) {
+			sort.Slice(realms, func(i, j int) bool { return realms[i].Id > realms[j].Id })
+		}
+		hits := make([]string, len(realms))
+		for i, realm := range realms {
+			source, _ := json.Marshal(realm)
+			hits[i] = fmt.Sprintf(`{"_index": %q, "_id": %q, "_source": %s}`, index, realm.ShortName, source)
+		}
+		fmt.Fprintf(w, `{"took": 1, "timed_out": false, "_shards": {"total": 1, "successful": 1, "skipped": 0, "failed": 0},
+			"hits": {"total": {"value": %d, "relation": "eq"}, "hits": [%s]}}`, len(hits), strings.Join(hits, ","))
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error": {"type": "unexpected_request", "reason": "%s %s"}, "status": 400}`, r.Method, r.URL.Path)
+	}
+}
+
+// doc returns a document stored in the fake.
+func (f *fakeES) doc(index, id string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return string(f.indices[index][id])
+}
+
+// runLhadmin runs lhadmin against es with args, stdin as its input, and returns its output.
+func runLhadmin(t *testing.T, es *fakeES, stdin string, args ...string) (string, error) {
+	t.Helper()
+	cmd := newRootCmd()
+	cmd.SetArgs(append([]string{"--es-addresses", es.URL, "--who", "ops"}, args...))
+	cmd.SetIn(strings.NewReader(stdin))
+	var out, errOut bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.SetErr(&errOut)
+	err := cmd.Execute()
+	return out.String(), err
+}
+
+func TestReadToken(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(path, []byte("from-file\nignored\n"), 0o600))
+
+	tests := []struct {
+		path, stdin, want string
+	}{
+		{"", "from-stdin\n", "from-stdin"},
+		{"-", "  padded \r\n", "padded"},
+		{path, "unused", "from-file"},
+	}
+	for _, tc := range tests {
+		cmd := newRootCmd()
+		cmd.SetIn(strings.NewReader(tc.stdin))
+		token, err := readToken(cmd, tc.path)
+		require.NoError(t, err)
+		require.Equal(t, tc.want, token)
+	}
+
+	cmd := newRootCmd()
+	cmd.SetIn(strings.NewReader("\n"))
+	_, err := readToken(cmd, "")
+	require.Error(t, err)
+	_, err = readToken(cmd, filepath.Join(t.TempDir(), "missing"))
+	require.Error(t, err)
+}
+
+func TestRealmAndTokenCommands(t *testing.T) {
+	es := newFakeES(t)
+
+	out, err := runLhadmin(t, es, "", "realm", "create", "acme", "--longname", "Acme Corporation")
+	require.NoError(t, err)
+	var created realmTokens
+	require.NoError(t, json.Unmarshal([]byte(out), &created))
+	require.Equal(t, "logharbour_acme", created.Index)
+	require.NotEmpty(t, created.WriteToken)
+	require.NotEmpty(t, created.QueryToken)
+
+	// The query token is stored only as its hash, and carries nothing but randomness
+	metadata := es.doc(logharbour.DefaultRealmMetadataIndex, "acme")
+	require.NotContains(t, metadata, created.QueryToken)
+	require.Contains(t, metadata, logharbour.QueryTokenHash(created.QueryToken))
+	require.NotContains(t, created.QueryToken, "acme")
+
+	_, err = runLhadmin(t, es, "", "realm", "create", "acme", "--longname", "Acme again")
+	require.ErrorIs(t, err, logharbour.ErrRealmExists)
+
+	// Tokens to revoke and rotate are read from standard input or a file, not from arguments
+	_, err = runLhadmin(t, es, created.QueryToken, "token", "revoke", "acme", created.QueryToken)
+	require.Error(t, err)
+	out, err = runLhadmin(t, es, created.QueryToken+"\n", "token", "revoke", "acme")
+	require.NoError(t, err)
+	require.Contains(t, out, logharbour.TokenFingerprint(created.QueryToken))
+	require.NotContains(t, out, created.QueryToken)
+
+	tokenFile := filepath.Join(t.TempDir(), "write-token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte(created.WriteToken+"\n"), 0o600))
+	out, err = runLhadmin(t, es, "", "token", "rotate", "acme", "--token-file", tokenFile)
+	require.NoError(t, err)
+	var rotated realmTokens
+	require.NoError(t, json.Unmarshal([]byte(out), &rotated))
+	require.NotEmpty(t, rotated.WriteToken)
+	require.Empty(t, rotated.QueryToken)
+	require.Equal(t, logharbour.TokenFingerprint(created.WriteToken), rotated.Revoked)
+
+	out, err = runLhadmin(t, es, "", "token", "issue", "acme", "--kind", "query")
+	require.NoError(t, err)
+	var issued realmTokens
+	require.NoError(t, json.Unmarshal([]byte(out), &issued))
+	require.NotEmpty(t, issued.QueryToken)
+
+	out, err = runLhadmin(t, es, "", "realm", "export")
+	require.NoError(t, err)
+	var realms []logharbour.Realm
+	require.NoError(t, json.Unmarshal([]byte(out), &realms))
+	require.Len(t, realms, 1)
+	require.Equal(t, 1, realms[0].Id)
+	require.NotContains(t, out, issued.QueryToken)
+
+	registry, err := logharbour.NewRealmRegistry(realms...)
+	require.NoError(t, err)
+	_, err = registry.LookupQueryToken(created.QueryToken)
+	require.ErrorIs(t, err, logharbour.ErrRevokedQueryToken)
+	realm, err := registry.LookupQueryToken(issued.QueryToken)
+	require.NoError(t, err)
+	require.Equal(t, "acme", realm.ShortName)
+	_, err = registry.LookupWriteToken(created.WriteToken)
+	require.ErrorIs(t, err, logharbour.ErrRevokedWriteToken)
+	_, err = registry.LookupWriteToken(rotated.WriteToken)
+	require.NoError(t, err)
+
+	out, err = runLhadmin(t, es, "", "realm", "list")
+	require.NoError(t, err)
+	require.Contains(t, out, "acme")
+	require.NotContains(t, out, rotated.WriteToken)
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/remiges-tech/logharbour/logharbour"
+	"github.com/spf13/cobra"
+)
+
+// realmTokens is the output of realm creation and token commands: what the business
+// application needs to use the realm.
+type realmTokens struct {
+	Realm      string `json:"realm"`
+	Index      string `json:"index"`
+	WriteToken string `json:"write_token,omitempty"`
+	QueryToken string `json:"query_token,omitempty"`
+	Revoked    string `json:"revoked_fingerprint,omitempty"` // TokenFingerprint of the revoked token
+}
+
+func newRealmCmd(opts *options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "realm",
+		Short: "Create, list and export realms",
+	}
+	cmd.AddCommand(newRealmCreateCmd(opts), newRealmListCmd(opts), newRealmExportCmd(opts))
+	return cmd
+}
+
+func newRealmCreateCmd(opts *options) *cobra.Command {
+	var longName, payload, out string
+	cmd := &cobra.Command{
+		Use:   "create <shortname>",
+		Short: "Create a realm with its index, a write token and a query token",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var payloadMap map[string]any
+			if payload != "" {
+				if err := json.Unmarshal([]byte(payload), &payloadMap); err != nil {
+					return fmt.Errorf("invalid --payload: %w", err)
+				}
+			}
+			admin, err := newAdmin(cmd, opts)
+			if err != nil {
+				return err
+			}
+			realm, queryToken, err := admin.CreateRealm(cmd.Context(), args[0], longName, payloadMap)
+			if err != nil {
+				return err
+			}
+			return writeJSON(cmd, out, realmTokens{
+				Realm:      realm.ShortName,
+				Index:      realm.Index,
+				WriteToken: realm.WriteTokens[0],
+				QueryToken: queryToken,
+			})
+		},
+	}
+	cmd.Flags().StringVar(&longName, "longname", "", "Descriptive name of the realm (required)")
+	cmd.Flags().StringVar(&payload, "payload", "", "JSON object stored with the realm's metadata")
+	cmd.Flags().StringVar(&out, "out", "", "File to write the tokens to (default: standard output)")
+	_ = cmd.MarkFlagRequired("longname")
+	return cmd
+}
+
+func newRealmListCmd(opts *options) *cobra.Command {
+	var asJSON bool
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List realms and their token counts",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			admin, err := newAdmin(cmd, opts)
+			if err != nil {
+				return err
+			}
+			realms, err := admin.ListRealms(cmd.Context())
+			if err != nil {
+				return err
+			}
+			if asJSON {
+				// Tokens are not listed; use "realm export" to obtain the registry
+				for i := range realms {
+					realms[i].WriteTokens, realms[i].QueryTokenHashes, realms[i].RevokedTokens = nil, nil, nil
+				}
+				return writeJSON(cmd, "", realms)
+			}
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tSHORTNAME\tLONGNAME\tINDEX\tCREATED\tWRITE\tQUERY\tREVOKED")
+			for _, r := range realms {
+				fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%d\t%d\t%d\n", r.Id, r.ShortName, r.LongName, r.Index,
+					r.CreatedAt.Format(time.RFC3339), len(r.WriteTokens), len(r.QueryTokenHashes), len(r.RevokedTokens))
+			}
+			return w.Flush()
+		},
+	}
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Print the realms as JSON")
+	return cmd
+}
+
+func newRealmExportCmd(opts *options) *cobra.Command {
+	var out string
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export all realms as a realm registry file for logConsumer's --realmRegistry",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			admin, err := newAdmin(cmd, opts)
+			if err != nil {
+				return err
+			}
+			realms, err := admin.ListRealms(cmd.Context())
+			if err != nil {
+				return err
+			}
+			// Validate the way the consumer will before writing the file
+			if _, err := logharbour.NewRealmRegistry(realms...); err != nil {
+				return err
+			}
+			return writeJSON(cmd, out, realms)
+		},
+	}
+	cmd.Flags().StringVar(&out, "out", "", "File to write the registry to (default: standard output)")
+	return cmd
+}
+
+func writeJSON(cmd *cobra.Command, out string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeOutput(cmd, out, append(data, '\n'))
+}
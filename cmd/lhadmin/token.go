@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/remiges-tech/logharbour/logharbour"
+	"github.com/spf13/cobra"
+)
+
+func newTokenCmd(opts *options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "token",
+		Short: "Issue, rotate and revoke realm tokens",
+	}
+	cmd.AddCommand(newTokenIssueCmd(opts), newTokenRotateCmd(opts), newTokenRevokeCmd(opts))
+	return cmd
+}
+
+func newTokenIssueCmd(opts *options) *cobra.Command {
+	var kind, out string
+	cmd := &cobra.Command{
+		Use:   "issue <shortname>",
+		Short: "Issue an additional write or query token for a realm",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			tokenKind := logharbour.TokenKind(kind)
+			if tokenKind != logharbour.TokenWrite && tokenKind != logharbour.TokenQuery {
+				return fmt.Errorf("invalid --kind %q: must be %q or %q", kind, logharbour.TokenWrite, logharbour.TokenQuery)
+			}
+			admin, err := newAdmin(cmd, opts)
+			if err != nil {
+				return err
+			}
+			token, err := admin.IssueToken(cmd.Context(), args[0], tokenKind)
+			if err != nil {
+				return err
+			}
+			return writeTokens(cmd, admin, out, args[0], tokenKind, token, "")
+		},
+	}
+	cmd.Flags().StringVar(&kind, "kind", "", "Token kind: write or query (required)")
+	cmd.Flags().StringVar(&out, "out", "", "File to write the token to (default: standard output)")
+	_ = cmd.MarkFlagRequired("kind")
+	return cmd
+}
+
+func newTokenRotateCmd(opts *options) *cobra.Command {
+	var tokenFile, out string
+	cmd := &cobra.Command{
+		Use:   "rotate <shortname>",
+		Short: "Replace a token with a new one of the same kind and revoke the old one",
+		Long: "Replace a token with a new one of the same kind and revoke the old one.\n" +
+			"The old token is read from --token-file, or from standard input.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			oldToken, err := readToken(cmd, tokenFile)
+			if err != nil {
+				return err
+			}
+			admin, err := newAdmin(cmd, opts)
+			if err != nil {
+				return err
+			}
+			token, kind, err := admin.RotateToken(cmd.Context(), args[0], oldToken)
+			if err != nil {
+				return err
+			}
+			return writeTokens(cmd, admin, out, args[0], kind, token, logharbour.TokenFingerprint(oldToken))
+		},
+	}
+	cmd.Flags().StringVar(&tokenFile, "token-file", "", "File holding the token to rotate (default: standard input)")
+	cmd.Flags().StringVar(&out, "out", "", "File to write the new token to (default: standard output)")
+	return cmd
+}
+
+func newTokenRevokeCmd(opts *options) *cobra.Command {
+	var tokenFile string
+	cmd := &cobra.Command{
+		Use:   "revoke <shortname>",
+		Short: "Revoke a write or query token",
+		Long:  "Revoke a write or query token, read from --token-file or from standard input.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			token, err := readToken(cmd, tokenFile)
+			if err != nil {
+				return err
+			}
+			admin, err := newAdmin(cmd, opts)
+			if err != nil {
+				return err
+			}
+			if err := admin.RevokeToken(cmd.Context(), args[0], token); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Revoked token %s of realm %s\n", logharbour.TokenFingerprint(token), args[0])
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&tokenFile, "token-file", "", "File holding the token to revoke (default: standard input)")
+	return cmd
+}
+
+// writeTokens writes a newly issued token, and the fingerprint of the token it replaces if any.
+func writeTokens(cmd *cobra.Command, admin *logharbour.RealmAdmin, out, shortName string, kind logharbour.TokenKind, token, revoked string) error {
+	realm, err := admin.GetRealm(cmd.Context(), shortName)
+	if err != nil {
+		return err
+	}
+	tokens := realmTokens{Realm: realm.ShortName, Index: realm.Index, Revoked: revoked}
+	if kind == logharbour.TokenQuery {
+		tokens.QueryToken = token
+	} else {
+		tokens.WriteToken = token
+	}
+	return writeJSON(cmd, out, tokens)
+}
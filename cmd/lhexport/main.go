@@ -0,0 +1,339 @@
+// lhexport exports the log entries of a realm matching a set of filters to NDJSON or CSV,
+// for audits and offline analysis. Exports can be compressed with gzip, and an interrupted
+// export can be resumed from its checkpoint file.
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/remiges-tech/logharbour/logharbour"
+	"github.com/spf13/cobra"
+)
+
+// options holds the flags.
+type options struct {
+	esAddresses string
+	esUsername  string
+	esPassword  string
+	esCACert    string
+	queryToken  string
+	registry    string
+
+	format     string
+	gzip       bool
+	out        string
+	checkpoint string
+	resume     bool
+	batchSize  int
+	changes    bool
+
+	app, module, who, class, instance, op string
+	remoteIP, field, traceID, text, query string
+	logType, pri, from, to                string
+	days                                  int
+}
+
+func getEnv(key, fallback string) string {
+	if value, exists := os.LookupEnv(key); exists {
+		return value
+	}
+	return fallback
+}
+
+func main() {
+	if err := newRootCmd().Execute(); err != nil {
+		os.Exit(1)
+	}
+}
+
+func newRootCmd() *cobra.Command {
+	opts := &options{}
+	root := &cobra.Command{
+		Use:   "lhexport",
+		Short: "Export the LogHarbour log entries matching a set of filters",
+		Example: `  lhexport --changes --class invoice --from 2026-07-01 --to 2026-09-30 --format csv --gzip --out q3-invoices.csv.gz
+  lhexport --changes --class invoice --from 2026-07-01 --to 2026-09-30 --format csv --gzip --out q3-invoices.csv.gz --resume`,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runExport(cmd, opts)
+		},
+	}
+	flags := root.Flags()
+	flags.StringVar(&opts.esAddresses, "es-addresses", getEnv("ELASTICSEARCH_ADDRESSES", "http://localhost:9200"), "Elasticsearch addresses (comma-separated)")
+	flags.StringVar(&opts.esUsername, "es-username", getEnv("ELASTICSEARCH_USERNAME", ""), "Elasticsearch username")
+	flags.StringVar(&opts.esPassword, "es-password", getEnv("ELASTICSEARCH_PASSWORD", ""), "Elasticsearch password")
+	flags.StringVar(&opts.esCACert, "es-ca-cert", getEnv("ELASTICSEARCH_CA_CERT", ""), "Path to Elasticsearch CA certificate (for HTTPS)")
+	flags.StringVar(&opts.queryToken, "query-token", getEnv("LOGHARBOUR_QUERY_TOKEN", ""), "Query token of the realm to export")
+	flags.StringVar(&opts.registry, "realm-registry", getEnv("LOGHARBOUR_REALM_REGISTRY", ""), "Realm registry file, in which the query token's realm is looked up (required)")
+
+	flags.StringVar(&opts.format, "format", string(logharbour.ExportNDJSON), "Output format: ndjson or csv")
+	flags.BoolVar(&opts.gzip, "gzip", false, "Compress the output with gzip")
+	flags.StringVar(&opts.out, "out", "", "Output file (default: standard output)")
+	flags.StringVar(&opts.checkpoint, "checkpoint", "", "Checkpoint file (default: --out with .checkpoint appended)")
+	flags.BoolVar(&opts.resume, "resume", false, "Resume the export from its checkpoint file")
+	flags.IntVar(&opts.batchSize, "batch-size", logharbour.DefaultExportBatchSize, "Entries read per search")
+	flags.BoolVar(&opts.changes, "changes", false, "Export data-change entries, selected like the datachange web service")
+
+	flags.StringVar(&opts.app, "app", "", "Filter by app")
+	flags.StringVar(&opts.module, "module", "", "Filter by module")
+	flags.StringVar(&opts.who, "who", "", "Filter by who")
+	flags.StringVar(&opts.class, "class", "", "Filter by class")
+	flags.StringVar(&opts.instance, "instance", "", "Filter by instance")
+	flags.StringVar(&opts.op, "op", "", "Filter by op")
+	flags.StringVar(&opts.remoteIP, "remote-ip", "", "Filter by remote IP")
+	flags.StringVar(&opts.field, "field", "", "Filter by changed field (with --changes)")
+	flags.StringVar(&opts.traceID, "trace-id", "", "Filter by trace id")
+	flags.StringVar(&opts.logType, "type", "", "Filter by type: activity, change or debug")
+	flags.StringVar(&opts.pri, "pri", "", "Filter by priority: this one and higher")
+	flags.StringVar(&opts.from, "from", "", "Start time, RFC 3339 or 2006-01-02")
+	flags.StringVar(&opts.to, "to", "", "End time, RFC 3339 or 2006-01-02 (a date includes the whole day)")
+	flags.IntVar(&opts.days, "days", 0, "Export the last N days, if --from and --to are not set")
+	flags.StringVar(&opts.text, "text", "", "Full-text search in msg, error and activity data")
+	flags.StringVar(&opts.query, "query", "", `Query in the query language, e.g. 'pri>=Warn when:[now-2d TO now]'`)
+	return root
+}
+
+// logParam returns the filters of opts.
+func logParam(opts *options) (logharbour.GetLogsParam, error) {
+	var param logharbour.GetLogsParam
+	optional := func(s string) *string {
+		if s == "" {
+			return nil
+		}
+		return &s
+	}
+	param.App = optional(opts.app)
+	param.Module = optional(opts.module)
+	param.Who = optional(opts.who)
+	param.Class = optional(opts.class)
+	param.Instance = optional(opts.instance)
+	param.Operation = optional(opts.op)
+	param.RemoteIP = optional(opts.remoteIP)
+	param.Field = optional(opts.field)
+	param.TraceID = optional(opts.traceID)
+	param.Text = optional(opts.text)
+	param.Query = optional(opts.query)
+
+	if opts.logType != "" {
+		logType, ok := map[string]logharbour.LogType{
+			"activity": logharbour.Activity, "change": logharbour.Change, "debug": logharbour.Debug,
+		}[strings.ToLower(opts.logType)]
+		if !ok {
+			return param, fmt.Errorf("invalid --type %q: expected activity, change or debug", opts.logType)
+		}
+		param.Type = &logType
+	}
+	if opts.pri != "" {
+		pri, err := logharbour.ParseLogPriority(opts.pri)
+		if err != nil {
+			return param, fmt.Errorf("invalid --pri: %w", err)
+		}
+		param.Priority = &pri
+	}
+	if opts.from != "" {
+		from, err := parseTime(opts.from, false)
+		if err != nil {
+			return param, fmt.Errorf("invalid --from: %w", err)
+		}
+		param.FromTS = &from
+	}
+	if opts.to != "" {
+		to, err := parseTime(opts.to, true)
+		if err != nil {
+			return param, fmt.Errorf("invalid --to: %w", err)
+		}
+		param.ToTS = &to
+	}
+	if opts.days > 0 {
+		param.NDays = &opts.days
+	}
+	return param, nil
+}
+
+// parseTime parses an RFC 3339 time or a date, which stands for the start of the day, or
+// for its end if endOfDay is set.
+func parseTime(s string, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.UTC(), nil
+	}
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither an RFC 3339 time nor a date", s)
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Second)
+	}
+	return t, nil
+}
+
+func runExport(cmd *cobra.Command, opts *options) error {
+	param, err := logParam(opts)
+	if err != nil {
+		return err
+	}
+	exp := logharbour.ExportParam{
+		Format:    logharbour.ExportFormat(opts.format),
+		Changes:   opts.changes,
+		Gzip:      opts.gzip,
+		BatchSize: opts.batchSize,
+	}
+
+	checkpointPath := opts.checkpoint
+	if checkpointPath == "" && opts.out != "" {
+		checkpointPath = opts.out + ".checkpoint"
+	}
+	if opts.resume && (opts.out == "" || checkpointPath == "") {
+		return errors.New("--resume requires --out")
+	}
+
+	var out io.Writer = cmd.OutOrStdout()
+	if opts.out != "" {
+		var f *os.File
+		if opts.resume {
+			f, exp.Resume, err = reopenOutput(opts.out, checkpointPath)
+		} else {
+			f, err = os.Create(opts.out)
+		}
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+		exp.OnCheckpoint = func(cp logharbour.ExportCheckpoint) error {
+			// The output must be on disk before the checkpoint which says it is
+			if err := f.Sync(); err != nil {
+				return err
+			}
+			return saveCheckpoint(checkpointPath, cp)
+		}
+	}
+
+	cfg, err := clientConfig(opts)
+	if err != nil {
+		return err
+	}
+	client, err := elasticsearch.NewTypedClient(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create Elasticsearch client: %w", err)
+	}
+	if opts.registry == "" {
+		return fmt.Errorf("--realm-registry is required to look up the query token's realm")
+	}
+	registry, err := logharbour.LoadRealmRegistry(opts.registry)
+	if err != nil {
+		return err
+	}
+	resolver := logharbour.NewQueryTokenResolver(logharbour.WithQueryTokenRegistry(registry))
+	qc, err := resolver.NewQueryClient(opts.queryToken, client)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	final, err := qc.Export(ctx, out, param, exp)
+	if err != nil {
+		if checkpointPath != "" && final.Cursor != "" {
+			fmt.Fprintf(cmd.ErrOrStderr(), "Export interrupted after %d entries; run again with --resume to continue\n", final.Entries)
+		}
+		return err
+	}
+	if checkpointPath != "" {
+		if err := os.Remove(checkpointPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	fmt.Fprintf(cmd.ErrOrStderr(), "Exported %d entries (%d rows)\n", final.Entries, final.Rows)
+	return nil
+}
+
+// reopenOutput opens the output of an interrupted export for appending, after truncating it
+// to the size it had at its checkpoint.
+func reopenOutput(outPath, checkpointPath string) (*os.File, *logharbour.ExportCheckpoint, error) {
+	data, err := os.ReadFile(checkpointPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+	var cp logharbour.ExportCheckpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse checkpoint %s: %w", checkpointPath, err)
+	}
+	f, err := os.OpenFile(outPath, os.O_WRONLY, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := f.Truncate(cp.Bytes); err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	if _, err := f.Seek(cp.Bytes, io.SeekStart); err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return f, &cp, nil
+}
+
+// saveCheckpoint replaces the checkpoint file, so that it is never left half written.
+func saveCheckpoint(path string, cp logharbour.ExportCheckpoint) error {
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// clientConfig returns the Elasticsearch configuration of the flags.
+func clientConfig(opts *options) (elasticsearch.Config, error) {
+	cfg := elasticsearch.Config{Addresses: strings.Split(opts.esAddresses, ",")}
+	if opts.esPassword != "" {
+		cfg.Username = opts.esUsername
+		cfg.Password = opts.esPassword
+		if cfg.Username == "" {
+			cfg.Username = "elastic"
+		}
+	}
+	if opts.esCACert != "" {
+		transport, err := createTLSTransport(opts.esCACert)
+		if err != nil {
+			return cfg, fmt.Errorf("failed to create TLS transport: %w", err)
+		}
+		cfg.Transport = transport
+	}
+	return cfg, nil
+}
+
+func createTLSTransport(caCertPath string) (*http.Transport, error) {
+	caCert, err := os.ReadFile(caCertPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA certificate: %w", err)
+	}
+
+	caCertPool := x509.NewCertPool()
+	if !caCertPool.AppendCertsFromPEM(caCert) {
+		return nil, fmt.Errorf("failed to parse CA certificate")
+	}
+
+	return &http.Transport{
+		TLSClientConfig: &tls.Config{
+			RootCAs: caCertPool,
+		},
+	}, nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/remiges-tech/logharbour/logharbour"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogParam(t *testing.T) {
+	param, err := logParam(&options{class: "invoice", pri: "warn", from: "2026-07-01", to: "2026-09-30", logType: "change"})
+	require.NoError(t, err)
+	require.Equal(t, "invoice", *param.Class)
+	require.Equal(t, logharbour.Warn, *param.Priority)
+	require.Equal(t, logharbour.Change, *param.Type)
+	require.Equal(t, time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC), *param.FromTS)
+	require.Equal(t, time.Date(2026, 9, 30, 23, 59, 59, 0, time.UTC), *param.ToTS)
+	require.Nil(t, param.App)
+
+	_, err = logParam(&options{from: "July"})
+	require.Error(t, err)
+	_, err = logParam(&options{logType: "audit"})
+	require.Error(t, err)
+}
+
+func TestReopenOutput(t *testing.T) {
+	dir := t.TempDir()
+	out, checkpoint := filepath.Join(dir, "export.ndjson"), filepath.Join(dir, "export.ndjson.checkpoint")
+	require.NoError(t, os.WriteFile(out, []byte("line 1\nline 2\npartial"), 0o600))
+	require.NoError(t, saveCheckpoint(checkpoint, logharbour.ExportCheckpoint{Cursor: "c", Entries: 2, Rows: 2, Bytes: 14}))
+
+	f, cp, err := reopenOutput(out, checkpoint)
+	require.NoError(t, err)
+	require.Equal(t, logharbour.ExportCheckpoint{Cursor: "c", Entries: 2, Rows: 2, Bytes: 14}, *cp)
+	_, err = f.WriteString("line 3\n")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	data, err := os.ReadFile(out)
+	require.NoError(t, err)
+	require.Equal(t, "line 1\nline 2\nline 3\n", string(data))
+}
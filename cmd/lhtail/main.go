@@ -0,0 +1,401 @@
+// lhtail follows the log entries of a realm as they are logged, like tail -f, printing them
+// with colours by priority. Entries are read by polling Elasticsearch, or from the Kafka log
+// topic with --kafka-brokers.
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/remiges-tech/logharbour/logharbour"
+	"github.com/spf13/cobra"
+)
+
+// options holds the flags.
+type options struct {
+	esAddresses   string
+	esUsername    string
+	esPassword    string
+	esCACert      string
+	queryToken    string
+	kafkaBrokers  string
+	kafkaTopic    string
+	realmRegistry string
+
+	since        time.Duration
+	pollInterval time.Duration
+	jsonOutput   bool
+	color        string
+
+	app, module, who, class, instance, op string
+	remoteIP, field, traceID, text, query string
+	logType, pri                          string
+}
+
+func getEnv(key, fallback string) string {
+	if value, exists := os.LookupEnv(key); exists {
+		return value
+	}
+	return fallback
+}
+
+func main() {
+	if err := newRootCmd().Execute(); err != nil {
+		os.Exit(1)
+	}
+}
+
+func newRootCmd() *cobra.Command {
+	opts := &options{}
+	root := &cobra.Command{
+		Use:   "lhtail",
+		Short: "Follow LogHarbour log entries as they are logged",
+		Example: `  lhtail --app billing --pri warn
+  lhtail --since 10m --query 'module:payments AND (pri>=Err OR msg:timeout)'
+  lhtail --kafka-brokers kafka:9092 --realm-registry /etc/logharbour/realms.json --who alice`,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runTail(cmd, opts)
+		},
+	}
+	flags := root.Flags()
+	flags.StringVar(&opts.esAddresses, "es-addresses", getEnv("ELASTICSEARCH_ADDRESSES", "http://localhost:9200"), "Elasticsearch addresses (comma-separated)")
+	flags.StringVar(&opts.esUsername, "es-username", getEnv("ELASTICSEARCH_USERNAME", ""), "Elasticsearch username")
+	flags.StringVar(&opts.esPassword, "es-password", getEnv("ELASTICSEARCH_PASSWORD", ""), "Elasticsearch password")
+	flags.StringVar(&opts.esCACert, "es-ca-cert", getEnv("ELASTICSEARCH_CA_CERT", ""), "Path to Elasticsearch CA certificate (for HTTPS)")
+	flags.StringVar(&opts.queryToken, "query-token", getEnv("LOGHARBOUR_QUERY_TOKEN", ""), "Query token of the realm to follow")
+	flags.StringVar(&opts.kafkaBrokers, "kafka-brokers", getEnv("KAFKA_BROKERS", ""), "Read entries from these Kafka brokers (comma-separated) instead of Elasticsearch")
+	flags.StringVar(&opts.kafkaTopic, "kafka-topic", getEnv("KAFKA_TOPIC", "log_topic"), "Kafka log topic")
+	flags.StringVar(&opts.realmRegistry, "realm-registry", getEnv("LOGHARBOUR_REALM_REGISTRY", ""), "Realm registry file, in which the query token's realm is looked up (required for Elasticsearch; from Kafka, all realms are shown without it)")
+
+	flags.DurationVar(&opts.since, "since", 0, "Start with the entries of this long ago (Elasticsearch only)")
+	flags.DurationVar(&opts.pollInterval, "poll-interval", logharbour.DefaultTailPollInterval, "How often Elasticsearch is searched for new entries")
+	flags.BoolVar(&opts.jsonOutput, "json", false, "Print entries as NDJSON")
+	flags.StringVar(&opts.color, "color", "auto", "Colour output: auto, always or never")
+
+	flags.StringVar(&opts.app, "app", "", "Filter by app")
+	flags.StringVar(&opts.module, "module", "", "Filter by module")
+	flags.StringVar(&opts.who, "who", "", "Filter by who")
+	flags.StringVar(&opts.class, "class", "", "Filter by class")
+	flags.StringVar(&opts.instance, "instance", "", "Filter by instance")
+	flags.StringVar(&opts.op, "op", "", "Filter by op")
+	flags.StringVar(&opts.remoteIP, "remote-ip", "", "Filter by remote IP")
+	flags.StringVar(&opts.field, "field", "", "Filter by changed field")
+	flags.StringVar(&opts.traceID, "trace-id", "", "Filter by trace id")
+	flags.StringVar(&opts.logType, "type", "", "Filter by type: activity, change or debug")
+	flags.StringVar(&opts.pri, "pri", "", "Filter by priority: this one and higher")
+	flags.StringVar(&opts.text, "text", "", "Words searched in msg, error and activity data")
+	flags.StringVar(&opts.query, "query", "", "Query in the query language (Elasticsearch only)")
+	return root
+}
+
+// logParam returns the filters of opts.
+func logParam(opts *options) (logharbour.GetLogsParam, error) {
+	var param logharbour.GetLogsParam
+	optional := func(s string) *string {
+		if s == "" {
+			return nil
+		}
+		return &s
+	}
+	param.App = optional(opts.app)
+	param.Module = optional(opts.module)
+	param.Who = optional(opts.who)
+	param.Class = optional(opts.class)
+	param.Instance = optional(opts.instance)
+	param.Operation = optional(opts.op)
+	param.RemoteIP = optional(opts.remoteIP)
+	param.Field = optional(opts.field)
+	param.TraceID = optional(opts.traceID)
+	param.Text = optional(opts.text)
+	param.Query = optional(opts.query)
+
+	if opts.logType != "" {
+		logType, ok := map[string]logharbour.LogType{
+			"activity": logharbour.Activity, "change": logharbour.Change, "debug": logharbour.Debug,
+		}[strings.ToLower(opts.logType)]
+		if !ok {
+			return param, fmt.Errorf("invalid --type %q: expected activity, change or debug", opts.logType)
+		}
+		param.Type = &logType
+	}
+	if opts.pri != "" {
+		pri, err := logharbour.ParseLogPriority(opts.pri)
+		if err != nil {
+			return param, fmt.Errorf("invalid --pri: %w", err)
+		}
+		param.Priority = &pri
+	}
+	if opts.since > 0 {
+		from := time.Now().UTC().Add(-opts.since)
+		param.FromTS = &from
+	}
+	return param, nil
+}
+
+func runTail(cmd *cobra.Command, opts *options) error {
+	param, err := logParam(opts)
+	if err != nil {
+		return err
+	}
+	colored, err := useColor(opts.color, cmd.OutOrStdout())
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	onError := logharbour.WithTailErrors(func(err error) {
+		fmt.Fprintf(cmd.ErrOrStderr(), "lhtail: %v\n", err)
+	})
+
+	var entries <-chan logharbour.LogEntry
+	if opts.kafkaBrokers != "" {
+		entries, err = tailKafka(ctx, opts, param, onError)
+	} else {
+		entries, err = tailElasticsearch(ctx, opts, param, onError)
+	}
+	if err != nil {
+		return err
+	}
+
+	out := cmd.OutOrStdout()
+	enc := json.NewEncoder(out)
+	for entry := range entries {
+		if opts.jsonOutput {
+			err = enc.Encode(entry)
+		} else {
+			_, err = io.WriteString(out, formatEntry(entry, colored))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tailElasticsearch follows the entries of the query token's realm by polling Elasticsearch.
+func tailElasticsearch(ctx context.Context, opts *options, param logharbour.GetLogsParam, tailOpts ...logharbour.TailOption) (<-chan logharbour.LogEntry, error) {
+	cfg, err := clientConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	client, err := elasticsearch.NewTypedClient(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Elasticsearch client: %w", err)
+	}
+	if opts.realmRegistry == "" {
+		return nil, fmt.Errorf("--realm-registry is required to look up the query token's realm")
+	}
+	registry, err := logharbour.LoadRealmRegistry(opts.realmRegistry)
+	if err != nil {
+		return nil, err
+	}
+	resolver := logharbour.NewQueryTokenResolver(logharbour.WithQueryTokenRegistry(registry))
+	qc, err := resolver.NewQueryClient(opts.queryToken, client)
+	if err != nil {
+		return nil, err
+	}
+	tailOpts = append(tailOpts, logharbour.WithTailPollInterval(opts.pollInterval, logharbour.DefaultTailOverlap))
+	return qc.Tail(ctx, param, tailOpts...)
+}
+
+// tailKafka follows the entries on the Kafka log topic, keeping those of the query token's
+// realm if a realm registry is given.
+func tailKafka(ctx context.Context, opts *options, param logharbour.GetLogsParam, tailOpts ...logharbour.TailOption) (<-chan logharbour.LogEntry, error) {
+	if opts.since > 0 {
+		return nil, fmt.Errorf("--since is not supported with --kafka-brokers")
+	}
+	if opts.realmRegistry != "" {
+		registry, err := logharbour.LoadRealmRegistry(opts.realmRegistry)
+		if err != nil {
+			return nil, err
+		}
+		realm, err := registry.LookupQueryToken(opts.queryToken)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --query-token: %w", err)
+		}
+		tailOpts = append(tailOpts, logharbour.WithTailRealm(registry, realm.ShortName))
+	}
+	brokers := strings.Split(opts.kafkaBrokers, ",")
+	return logharbour.TailConsumer(ctx, func(handler logharbour.MessageHandler) (logharbour.Consumer, error) {
+		return logharbour.NewConsumer(brokers, opts.kafkaTopic, handler, logharbour.OffsetLatest, 0)
+	}, param, tailOpts...)
+}
+
+// useColor reports whether the output is coloured: with --color auto, if it is a terminal and
+// NO_COLOR is not set.
+func useColor(mode string, out io.Writer) (bool, error) {
+	switch mode {
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	case "auto":
+		if _, ok := os.LookupEnv("NO_COLOR"); ok {
+			return false, nil
+		}
+		f, ok := out.(*os.File)
+		if !ok {
+			return false, nil
+		}
+		info, err := f.Stat()
+		return err == nil && info.Mode()&os.ModeCharDevice != 0, nil
+	}
+	return false, fmt.Errorf("invalid --color %q: expected auto, always or never", mode)
+}
+
+const (
+	ansiReset   = "\x1b[0m"
+	ansiDim     = "\x1b[2m"
+	ansiGray    = "\x1b[90m"
+	ansiYellow  = "\x1b[33m"
+	ansiRed     = "\x1b[31m"
+	ansiBoldRed = "\x1b[1;31m"
+	ansiMagenta = "\x1b[1;35m"
+	ansiCyan    = "\x1b[36m"
+)
+
+// priorityColors are the colours of the priorities, from the faintest debug to security alerts.
+var priorityColors = map[logharbour.LogPriority]string{
+	logharbour.Debug2: ansiGray,
+	logharbour.Debug1: ansiGray,
+	logharbour.Debug0: ansiGray,
+	logharbour.Warn:   ansiYellow,
+	logharbour.Err:    ansiRed,
+	logharbour.Crit:   ansiBoldRed,
+	logharbour.Sec:    ansiMagenta,
+}
+
+// escapeControl escapes the control characters and invalid UTF-8 bytes in s as strconv.Quote
+// does, so that logged values cannot move the cursor, change colours or start new lines on
+// the terminal.
+func escapeControl(s string) string {
+	if utf8.ValidString(s) && !strings.ContainsFunc(s, isControl) {
+		return s
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == utf8.RuneError && size == 1:
+			fmt.Fprintf(&sb, `\x%02x`, s[i])
+		case isControl(r):
+			quoted := strconv.QuoteRune(r)
+			sb.WriteString(quoted[1 : len(quoted)-1])
+		default:
+			sb.WriteRune(r)
+		}
+		i += size
+	}
+	return sb.String()
+}
+
+// isControl reports whether r is an ASCII or C1 control character.
+func isControl(r rune) bool {
+	return r < 0x20 || (r >= 0x7f && r < 0xa0)
+}
+
+// formatEntry formats an entry on one line: time, priority, app/module, who, op and the
+// instance operated on, message and error, and the changes of a data-change entry. Logged
+// values are written with their control characters escaped.
+func formatEntry(e logharbour.LogEntry, colored bool) string {
+	paint := func(color, s string) string {
+		if !colored || color == "" || s == "" {
+			return s
+		}
+		return color + s + ansiReset
+	}
+
+	level, levelColor := strings.ToUpper(e.Pri.String()), priorityColors[e.Pri]
+	if e.Type == logharbour.Change {
+		level, levelColor = "CHANGE", ansiCyan
+	}
+	var sb strings.Builder
+	sb.WriteString(paint(ansiDim, e.When.UTC().Format("2006-01-02T15:04:05.000Z")))
+	sb.WriteString(" " + paint(levelColor, fmt.Sprintf("%-6s", level)))
+	sb.WriteString(" " + escapeControl(e.App))
+	if e.Module != "" {
+		sb.WriteString("/" + escapeControl(e.Module))
+	}
+	if e.Who != "" {
+		sb.WriteString(" [" + escapeControl(e.Who) + "]")
+	}
+	if e.Op != "" {
+		sb.WriteString(" " + escapeControl(e.Op))
+	}
+	if e.Class != "" {
+		sb.WriteString(" " + escapeControl(e.Class))
+		if e.InstanceId != "" {
+			sb.WriteString("/" + escapeControl(e.InstanceId))
+		}
+	}
+	msg := escapeControl(e.Msg)
+	if e.Pri >= logharbour.Warn {
+		msg = paint(levelColor, msg)
+	}
+	sb.WriteString(": " + msg)
+	if e.Error != "" {
+		sb.WriteString(" " + paint(ansiRed, "error="+escapeControl(e.Error)))
+	}
+	if e.Data != nil && e.Data.ChangeData != nil {
+		for _, change := range e.Data.ChangeData.Changes {
+			sb.WriteString(fmt.Sprintf(" %s: %s → %s;", paint(ansiCyan, escapeControl(change.Field)),
+				escapeControl(fmt.Sprint(change.OldVal)), escapeControl(fmt.Sprint(change.NewVal))))
+		}
+	}
+	sb.WriteString("\n")
+	return sb.String()
+}
+
+// clientConfig returns the Elasticsearch configuration of the flags.
+func clientConfig(opts *options) (elasticsearch.Config, error) {
+	cfg := elasticsearch.Config{Addresses: strings.Split(opts.esAddresses, ",")}
+	if opts.esPassword != "" {
+		cfg.Username = opts.esUsername
+		cfg.Password = opts.esPassword
+		if cfg.Username == "" {
+			cfg.Username = "elastic"
+		}
+	}
+	if opts.esCACert != "" {
+		transport, err := createTLSTransport(opts.esCACert)
+		if err != nil {
+			return cfg, fmt.Errorf("failed to create TLS transport: %w", err)
+		}
+		cfg.Transport = transport
+	}
+	return cfg, nil
+}
+
+func createTLSTransport(caCertPath string) (*http.Transport, error) {
+	caCert, err := os.ReadFile(caCertPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA certificate: %w", err)
+	}
+
+	caCertPool := x509.NewCertPool()
+	if !caCertPool.AppendCertsFromPEM(caCert) {
+		return nil, fmt.Errorf("failed to parse CA certificate")
+	}
+
+	return &http.Transport{
+		TLSClientConfig: &tls.Config{
+			RootCAs: caCertPool,
+		},
+	}, nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/remiges-tech/logharbour/logharbour"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogParam(t *testing.T) {
+	param, err := logParam(&options{app: "billing", pri: "warn", logType: "activity", since: time.Hour})
+	require.NoError(t, err)
+	require.Equal(t, "billing", *param.App)
+	require.Equal(t, logharbour.Warn, *param.Priority)
+	require.Equal(t, logharbour.Activity, *param.Type)
+	require.WithinDuration(t, time.Now().Add(-time.Hour), *param.FromTS, time.Minute)
+	require.Nil(t, param.Module)
+
+	_, err = logParam(&options{pri: "loud"})
+	require.Error(t, err)
+}
+
+func TestFormatEntry(t *testing.T) {
+	when := time.Date(2026, 1, 2, 10, 0, 0, 123e6, time.UTC)
+	entry := logharbour.LogEntry{
+		App: "billing", Module: "payments", Type: logharbour.Activity, Pri: logharbour.Err, When: when,
+		Who: "alice", Op: "pay", Class: "invoice", InstanceId: "42", Msg: "payment failed", Error: "timeout",
+	}
+	require.Equal(t, "2026-01-02T10:00:00.123Z ERR    billing/payments [alice] pay invoice/42: payment failed error=timeout\n", formatEntry(entry, false))
+
+	colored := formatEntry(entry, true)
+	require.Contains(t, colored, ansiRed+"ERR   "+ansiReset)
+	require.Contains(t, colored, ansiRed+"payment failed"+ansiReset)
+
+	change := logharbour.LogEntry{
+		App: "billing", Type: logharbour.Change, Pri: logharbour.Info, When: when, Msg: "updated",
+		Data: &logharbour.LogData{ChangeData: &logharbour.ChangeInfo{Changes: []logharbour.ChangeDetail{{Field: "amount", OldVal: 100, NewVal: 250}}}},
+	}
+	line := formatEntry(change, false)
+	require.True(t, strings.HasPrefix(line, "2026-01-02T10:00:00.123Z CHANGE billing: updated"), line)
+	require.Contains(t, line, "amount: 100 → 250;")
+}
+
+func TestFormatEntry_EscapesControlCharacters(t *testing.T) {
+	entry := logharbour.LogEntry{
+		App: "billing", Type: logharbour.Change, Pri: logharbour.Info, When: time.Date(2026, 1, 2, 10, 0, 0, 0, time.UTC),
+		Who: "mallory\r", Op: "pay\x7f", Msg: "paid \x1b[2J\x1b[31mfake alert\nsecond line", Error: "bad\tinput",
+		Data: &logharbour.LogData{ChangeData: &logharbour.ChangeInfo{Changes: []logharbour.ChangeDetail{{Field: "note", OldVal: "a\u009b1m\xff", NewVal: "b\x1b]0;title\a"}}}},
+	}
+	line := formatEntry(entry, true)
+	require.Equal(t, 1, strings.Count(line, "\n"), line)
+	require.NotContains(t, line, "\x1b[2J")
+	require.NotContains(t, line, "\r")
+	require.NotContains(t, line, "\x7f")
+	require.NotContains(t, line, "\u009b")
+	require.Contains(t, line, `[mallory\r] pay\x7f: paid \x1b[2J\x1b[31mfake alert\nsecond line`)
+	require.Contains(t, line, `error=bad\tinput`)
+	require.Contains(t, line, `a\u009b1m\xff → b\x1b]0;title\a;`)
+}
+
+func TestUseColor(t *testing.T) {
+	var out bytes.Buffer
+	colored, err := useColor("auto", &out)
+	require.NoError(t, err)
+	require.False(t, colored)
+	colored, err = useColor("always", &out)
+	require.NoError(t, err)
+	require.True(t, colored)
+	_, err = useColor("sometimes", &out)
+	require.Error(t, err)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// newAlertEngine creates the alert engine of the alert config file at path. Alerts produced to
+// kafka sinks go through producer.
+func newAlertEngine(path string, producer sarama.SyncProducer) (*logharbour.AlertEngine, error) {
+	cfg, err := logharbour.LoadAlertConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	return logharbour.NewAlertEngine(cfg,
+		logharbour.WithAlertKafkaProducer(producer),
+		logharbour.WithAlertErrors(func(err error) {
+			logger.Error("Failed to send alert", slog.String("error", err.Error()))
+		}))
+}
+
+// watchAlertConfig reloads the alert config file at path when the process receives SIGHUP, and
+// when the file's size or modification time changes, checked every interval (not at all if
+// interval is 0). A config which fails to load is logged and the previous one is kept.
+func watchAlertConfig(engine *logharbour.AlertEngine, path string, interval time.Duration) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	var tick <-chan time.Time
+	if interval > 0 {
+		tick = time.NewTicker(interval).C
+	}
+
+	var modTime time.Time
+	var size int64
+	stat := func() {
+		if info, err := os.Stat(path); err == nil {
+			modTime, size = info.ModTime(), info.Size()
+		}
+	}
+	stat()
+	go func() {
+		for {
+			select {
+			case <-signals:
+			case <-tick:
+				info, err := os.Stat(path)
+				if err != nil || info.ModTime().Equal(modTime) && info.Size() == size {
+					continue
+				}
+			}
+			stat()
+			if err := engine.Reload(path); err != nil {
+				logger.Error("Failed to reload alert config, keeping the previous one",
+					slog.String("error", err.Error()),
+					slog.String("path", path))
+				continue
+			}
+			logger.Info("Alert config reloaded", slog.String("path", path))
+		}
+	}()
+}
+
+// observeAlerts evaluates the alert rules over the documents of a batch which were indexed.
+func observeAlerts(engine *logharbour.AlertEngine, batch preparedBatch, failed []logharbour.BulkError) {
+	notIndexed := make(map[string]bool, len(failed))
+	for _, docErr := range failed {
+		notIndexed[docErr.DocumentID] = true
+	}
+	for _, index := range batch.indices() {
+		for _, doc := range batch.docsByIndex[index] {
+			if notIndexed[doc.ID] {
+				continue
+			}
+			var entry logharbour.LogEntry
+			if err := json.Unmarshal([]byte(doc.Body), &entry); err != nil {
+				logger.Warn("Failed to decode log entry for alerting",
+					slog.String("error", err.Error()),
+					slog.String("document_id", doc.ID))
+				continue
+			}
+			for _, alert := range engine.Observe(batch.docIDToRealm[doc.ID], &entry) {
+				logger.Info("Alert raised",
+					slog.String("rule", alert.Rule),
+					slog.String("summary", alert.Summary()))
+			}
+		}
+	}
+}
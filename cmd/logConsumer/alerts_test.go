@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/remiges-tech/logharbour/logharbour"
+	"github.com/stretchr/testify/require"
+)
+
+// TestObserveAlerts verifies the alert rules see the indexed documents with their realm
+func TestObserveAlerts(t *testing.T) {
+	setupLogger("info")
+
+	engine, err := logharbour.NewAlertEngine(&logharbour.AlertConfig{Rules: []logharbour.AlertRule{
+		{Name: "acme-errors", Realm: "acme", Count: 2, GroupBy: []string{"app"}},
+	}})
+	require.NoError(t, err)
+	defer engine.Close()
+
+	when := time.Now().UTC().Format(time.RFC3339)
+	entry := func(id string) string {
+		return fmt.Sprintf(`{"id":%q,"app":"crux","pri":"Err","when":%q}`, id, when)
+	}
+	batch := prepareBatch([]*sarama.ConsumerMessage{
+		messageWithToken(1, entry("a"), "acme-w1"),
+		messageWithToken(2, entry("b"), "globex-w1"),
+		messageWithToken(3, entry("c"), "acme-w2"),
+	}, testRealms(t), "logs")
+
+	// c failed to index, so acme has a single entry
+	observeAlerts(engine, batch, []logharbour.BulkError{{DocumentID: "c"}})
+	alerts := engine.Observe("acme", &logharbour.LogEntry{App: "crux", Pri: logharbour.Err, When: time.Now()})
+	require.Len(t, alerts, 1)
+	require.Equal(t, "acme-errors", alerts[0].Rule)
+	require.Equal(t, map[string]string{"app": "crux"}, alerts[0].Group)
+}
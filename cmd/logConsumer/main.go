@@ -3,7 +3,6 @@ package main
 import (
 	"crypto/tls"
 	"crypto/x509"
-	"encoding/json"
 	"flag"
 	"fmt"
 	"io/ioutil"
@@ -185,6 +184,16 @@ func main() {
 	dlqEnabled := flag.Bool("dlqEnabled", getEnv("KAFKA_DLQ_ENABLED", "false") == "true", "Enable Dead Letter Queue for failed messages")
 	dlqTopic := flag.String("dlqTopic", getEnv("KAFKA_DLQ_TOPIC", ""), "DLQ topic name (default: <source_topic>_dlq)")
 
+	realmRegistry := flag.String("realmRegistry", getEnv("REALM_REGISTRY_FILE", ""), "Path to the realm registry JSON file (optional, enables write-token authentication and per-realm indices)")
+
+	alertConfig := flag.String("alertConfig", getEnv("ALERT_CONFIG_FILE", ""), "Path to the alert rules JSON or YAML file (optional, enables alerting)")
+	alertReloadInterval := flag.Duration("alertReloadInterval", func() time.Duration {
+		if duration, err := time.ParseDuration(getEnv("ALERT_RELOAD_INTERVAL", "30s")); err == nil {
+			return duration
+		}
+		return 30 * time.Second
+	}(), "How often the alert rules file is checked for changes (0 disables, SIGHUP always reloads)")
+
 	// Parse flags
 	flag.Parse()
 
@@ -232,7 +241,9 @@ func main() {
 		slog.String("consumer_group_id", *consumerGroup),
 		slog.Bool("elasticsearch_auth_enabled", *esPassword != ""),
 		slog.String("elasticsearch_username", *esUsername),
-		slog.Bool("elasticsearch_tls_ca_provided", *esCACert != ""))
+		slog.Bool("elasticsearch_tls_ca_provided", *esCACert != ""),
+		slog.String("realm_registry", *realmRegistry),
+		slog.String("alert_config", *alertConfig))
 
 	logger.Debug("Creating Elasticsearch client")
 	startTime := time.Now()
@@ -259,6 +270,27 @@ func main() {
 		slog.Duration("duration", time.Since(startTime)),
 		slog.String("index", *esIndex))
 
+	// Without a realm registry, all messages are written to esIndex
+	var realms *logharbour.RealmRegistry
+	if *realmRegistry != "" {
+		realms, err = logharbour.LoadRealmRegistry(*realmRegistry)
+		if err != nil {
+			logger.Error("Failed to load realm registry",
+				slog.String("error", err.Error()),
+				slog.String("path", *realmRegistry))
+			os.Exit(1)
+		}
+		if err := setupRealmIndices(esClient, realms); err != nil {
+			logger.Error("Failed to setup realm indices",
+				slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+		watchRealmRegistry(realms, *realmRegistry, esClient)
+		logger.Info("Write-token authentication enabled",
+			slog.String("realm_registry", *realmRegistry),
+			slog.Any("realm_indices", realms.Indices()))
+	}
+
 	// Set default DLQ topic if not provided
 	if *dlqTopic == "" {
 		*dlqTopic = *kafkaTopic + "_dlq"
@@ -279,16 +311,42 @@ func main() {
 			slog.String("dlq_topic", *dlqTopic))
 	}
 
+	// Without an alert config, no alert rules are evaluated
+	var alerts *logharbour.AlertEngine
+	if *alertConfig != "" {
+		// Alerts produced to kafka sinks use the same producer settings as the DLQ
+		alertProducer, err := createDLQProducer(*kafkaBrokers)
+		if err != nil {
+			logger.Error("Failed to create alert producer",
+				slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+		defer alertProducer.Close()
+		alerts, err = newAlertEngine(*alertConfig, alertProducer)
+		if err != nil {
+			logger.Error("Failed to load alert config",
+				slog.String("error", err.Error()),
+				slog.String("path", *alertConfig))
+			os.Exit(1)
+		}
+		watchAlertConfig(alerts, *alertConfig, *alertReloadInterval)
+		logger.Info("Alerting enabled",
+			slog.String("alert_config", *alertConfig))
+	}
+
 	handler := func(messages []*sarama.ConsumerMessage) error {
 		// Error Handling Overview:
 		// 1. Validation Phase: Invalid messages are logged and skipped (not sent to ES)
-		// 2. Bulk Indexing Phase: Documents are sent to ES in a single bulk request
+		// 2. Bulk Indexing Phase: Documents are sent to ES in one bulk request per target index
 		// 3. Retry Logic: Network/connection failures trigger retries of entire batch
 		// 4. Partial Failures: Some documents may fail (e.g., mapping errors) while others succeed
 		// 5. Error Propagation: Indexing failures return error (without DLQ) or nil (with DLQ)
+		// 6. Alerting: The alert rules are evaluated over the indexed documents of batches which
+		//    are not reprocessed, so that no entry is counted twice
 		//
 		// Error Categories:
-		// - Validation Errors: Bad data that can't be parsed (invalid JSON, missing ID)
+		// - Validation Errors: Bad data that can't be parsed (invalid JSON, missing ID), and with
+		//   a realm registry, messages with a missing, unknown or revoked write token
 		//   Action: Skip message, send to DLQ if enabled, otherwise LOST
 		// - Indexing Errors: Valid data that Elasticsearch rejects (mapping conflicts, doc too large)
 		//   Action: Send to DLQ if enabled, otherwise return error to block offset commit
@@ -304,55 +362,16 @@ func main() {
 			slog.String("topic", messages[0].Topic),
 			slog.Int("partition", int(messages[0].Partition)))
 
-		// Phase 1: Validation - Prepare documents for bulk indexing
-		bulkDocs := make([]logharbour.BulkDocument, 0, batchSize)
-		docIDToMessage := make(map[string]*sarama.ConsumerMessage)
-		validationErrors := 0
-		
-		for i, message := range messages {
-			logger.Debug("Processing message",
-				slog.Int("message_index", i),
-				slog.Int64("offset", message.Offset),
-				slog.Int("partition", int(message.Partition)),
-				slog.Time("timestamp", message.Timestamp),
-				slog.Int("value_size_bytes", len(message.Value)))
-
-			var logEntry map[string]interface{}
-			err := json.Unmarshal(message.Value, &logEntry)
-			if err != nil {
-				// Validation error: Skip this message, it won't be sent to Elasticsearch
-				validationErrors++
-				logger.Warn("Failed to unmarshal log message",
-					slog.String("error", err.Error()),
-					slog.Int64("offset", message.Offset),
-					slog.Int("message_size", len(message.Value)))
-				if dlqProducer != nil {
-					sendToDLQ(dlqProducer, *dlqTopic, message, "json_unmarshal_error: "+err.Error())
-				}
-				continue
-			}
-
-			id, ok := logEntry["id"].(string)
-			if !ok || id == "" {
-				// Validation error: Document must have an ID for Elasticsearch
-				validationErrors++
-				logger.Warn("Missing or invalid 'id' field in log message",
-					slog.Int64("offset", message.Offset),
-					slog.Any("log_entry_keys", getMapKeys(logEntry)))
-				if dlqProducer != nil {
-					sendToDLQ(dlqProducer, *dlqTopic, message, "missing_id_field")
-				}
-				continue
+		// Phase 1: Validation - Prepare documents for bulk indexing, grouped by target index
+		batch := prepareBatch(messages, realms, *esIndex)
+		validationErrors := len(batch.rejected)
+		if dlqProducer != nil {
+			for _, rejected := range batch.rejected {
+				sendToDLQ(dlqProducer, *dlqTopic, rejected.message, rejected.reason)
 			}
-
-			bulkDocs = append(bulkDocs, logharbour.BulkDocument{
-				ID:   id,
-				Body: string(message.Value),
-			})
-			docIDToMessage[id] = message
 		}
 
-		if len(bulkDocs) == 0 {
+		if len(batch.docIDToMessage) == 0 {
 			// All messages failed validation - nothing to send to Elasticsearch
 			logger.Warn("No valid documents to index in batch",
 				slog.Int("batch_size", batchSize),
@@ -360,33 +379,41 @@ func main() {
 			return nil
 		}
 
-		// Phase 2: Bulk Indexing - Send all valid documents to Elasticsearch
+		// Phase 2: Bulk Indexing - Send the documents of each index to Elasticsearch
 		writeStartTime := time.Now()
-		var bulkResult *logharbour.BulkWriteResult
-		err := retryOperation(func() error {
-			var err error
-			bulkResult, err = esClient.BulkWrite(*esIndex, bulkDocs)
+		bulkResult := &logharbour.BulkWriteResult{Errors: make([]logharbour.BulkError, 0)}
+		for _, index := range batch.indices() {
+			bulkDocs := batch.docsByIndex[index]
+			var indexResult *logharbour.BulkWriteResult
+			err := retryOperation(func() error {
+				var err error
+				indexResult, err = esClient.BulkWrite(index, bulkDocs)
+				if err != nil {
+					// Network/connection error - retry entire batch
+					return err
+				}
+				// If all documents failed (e.g., index closed), treat as error for retry
+				if indexResult.Failed == len(bulkDocs) {
+					return fmt.Errorf("all documents failed to index")
+				}
+				return nil
+			}, 10, 1*time.Second)
+
 			if err != nil {
-				// Network/connection error - retry entire batch
+				logger.Error("Failed to bulk write to Elasticsearch after retries",
+					slog.String("error", err.Error()),
+					slog.String("index", index),
+					slog.Int("documents_count", len(bulkDocs)),
+					slog.Duration("write_duration", time.Since(writeStartTime)))
 				return err
 			}
-			// If all documents failed (e.g., index closed), treat as error for retry
-			if bulkResult.Failed == len(bulkDocs) {
-				return fmt.Errorf("all documents failed to index")
-			}
-			return nil
-		}, 10, 1*time.Second)
-		
-		writeDuration := time.Since(writeStartTime)
-		
-		if err != nil {
-			logger.Error("Failed to bulk write to Elasticsearch after retries", 
-				slog.String("error", err.Error()),
-				slog.Int("documents_count", len(bulkDocs)),
-				slog.Duration("write_duration", writeDuration))
-			return err
+			bulkResult.Successful += indexResult.Successful
+			bulkResult.Failed += indexResult.Failed
+			bulkResult.Errors = append(bulkResult.Errors, indexResult.Errors...)
 		}
-		
+
+		writeDuration := time.Since(writeStartTime)
+
 		// Phase 3: Error Analysis - Log results and handle partial failures
 		if bulkResult.Failed > 0 {
 			// Partial failure: Some documents succeeded, some failed
@@ -415,7 +442,7 @@ func main() {
 
 			// Send failed documents to DLQ
 			if dlqProducer != nil {
-				sentToDLQ := handleIndexingFailures(bulkResult.Errors, docIDToMessage, dlqProducer, *dlqTopic)
+				sentToDLQ := handleIndexingFailures(bulkResult.Errors, batch.docIDToMessage, dlqProducer, *dlqTopic)
 				logger.Info("Sent failed documents to DLQ",
 					slog.Int("sent_count", sentToDLQ),
 					slog.Int("failed_count", bulkResult.Failed))
@@ -426,7 +453,7 @@ func main() {
 		logger.Info("Batch processing completed",
 			slog.Int("batch_size", batchSize),
 			slog.Int("validation_errors", validationErrors),
-			slog.Int("documents_sent", len(bulkDocs)),
+			slog.Int("documents_sent", len(batch.docIDToMessage)),
 			slog.Int("success_count", bulkResult.Successful),
 			slog.Int("error_count", bulkResult.Failed),
 			slog.Duration("batch_duration", batchDuration),
@@ -439,6 +466,11 @@ func main() {
 		if bulkResult.Failed > 0 && dlqProducer == nil {
 			return fmt.Errorf("%d documents failed to index", bulkResult.Failed)
 		}
+
+		// Phase 5: Alerting - Evaluate the alert rules over the indexed documents
+		if alerts != nil {
+			observeAlerts(alerts, batch, bulkResult.Errors)
+		}
 		
 		return nil
 	}
@@ -522,6 +554,10 @@ func main() {
 	}
 
 	stopKafkaConsumer(consumer)
+	if alerts != nil {
+		// Send the alerts raised by the last batches
+		alerts.Close()
+	}
 	logger.Info("Consumer stopped gracefully")
 }
 
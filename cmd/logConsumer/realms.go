@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+
+	"github.com/IBM/sarama"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// DLQ reasons for messages rejected by write-token authentication
+const (
+	dlqReasonMissingWriteToken = "missing_write_token"
+	dlqReasonUnknownWriteToken = "unknown_write_token"
+	dlqReasonRevokedWriteToken = "revoked_write_token"
+)
+
+// rejectedMessage is a message which cannot be indexed, with the dlq_reason it is sent to the DLQ with.
+type rejectedMessage struct {
+	message *sarama.ConsumerMessage
+	reason  string
+}
+
+// preparedBatch holds the valid documents of a batch grouped by the index they are written to,
+// the realm of each document (with a realm registry), and the messages which were rejected.
+type preparedBatch struct {
+	docsByIndex    map[string][]logharbour.BulkDocument
+	docIDToMessage map[string]*sarama.ConsumerMessage
+	docIDToRealm   map[string]string
+	rejected       []rejectedMessage
+}
+
+// indices returns the indices of the batch in a stable order.
+func (b preparedBatch) indices() []string {
+	indices := make([]string, 0, len(b.docsByIndex))
+	for index := range b.docsByIndex {
+		indices = append(indices, index)
+	}
+	sort.Strings(indices)
+	return indices
+}
+
+// prepareBatch validates messages and groups them by target index.
+//
+// Without a realm registry, every valid message goes to defaultIndex. With one, each message
+// must carry a write token in the logharbour.WriteTokenHeader header, and goes to the index
+// of the token's realm; messages with a missing, unknown or revoked token are rejected.
+func prepareBatch(messages []*sarama.ConsumerMessage, realms *logharbour.RealmRegistry, defaultIndex string) preparedBatch {
+	batch := preparedBatch{
+		docsByIndex:    make(map[string][]logharbour.BulkDocument),
+		docIDToMessage: make(map[string]*sarama.ConsumerMessage),
+		docIDToRealm:   make(map[string]string),
+	}
+	reject := func(message *sarama.ConsumerMessage, reason string) {
+		batch.rejected = append(batch.rejected, rejectedMessage{message: message, reason: reason})
+	}
+
+	for i, message := range messages {
+		logger.Debug("Processing message",
+			slog.Int("message_index", i),
+			slog.Int64("offset", message.Offset),
+			slog.Int("partition", int(message.Partition)),
+			slog.Time("timestamp", message.Timestamp),
+			slog.Int("value_size_bytes", len(message.Value)))
+
+		index, realmName := defaultIndex, ""
+		if realms != nil {
+			realm, err := realms.LookupWriteToken(writeToken(message))
+			if err != nil {
+				// Authentication error: the message does not belong to any active realm
+				logger.Warn("Rejected log message with invalid write token",
+					slog.String("error", err.Error()),
+					slog.Int64("offset", message.Offset),
+					slog.Int("partition", int(message.Partition)))
+				reject(message, writeTokenDLQReason(err))
+				continue
+			}
+			index, realmName = realm.Index, realm.ShortName
+		}
+
+		var logEntry map[string]interface{}
+		err := json.Unmarshal(message.Value, &logEntry)
+		if err != nil {
+			// Validation error: Skip this message, it won't be sent to Elasticsearch
+			logger.Warn("Failed to unmarshal log message",
+				slog.String("error", err.Error()),
+				slog.Int64("offset", message.Offset),
+				slog.Int("message_size", len(message.Value)))
+			reject(message, "json_unmarshal_error: "+err.Error())
+			continue
+		}
+
+		id, ok := logEntry["id"].(string)
+		if !ok || id == "" {
+			// Validation error: Document must have an ID for Elasticsearch
+			logger.Warn("Missing or invalid 'id' field in log message",
+				slog.Int64("offset", message.Offset),
+				slog.Any("log_entry_keys", getMapKeys(logEntry)))
+			reject(message, "missing_id_field")
+			continue
+		}
+
+		batch.docsByIndex[index] = append(batch.docsByIndex[index], logharbour.BulkDocument{
+			ID:   id,
+			Body: string(message.Value),
+		})
+		batch.docIDToMessage[id] = message
+		if realmName != "" {
+			batch.docIDToRealm[id] = realmName
+		}
+	}
+	return batch
+}
+
+// writeToken returns the write token carried by a message, or "" if there is none.
+func writeToken(message *sarama.ConsumerMessage) string {
+	for _, h := range message.Headers {
+		if h != nil && string(h.Key) == logharbour.WriteTokenHeader {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+// writeTokenDLQReason returns the dlq_reason for a write-token lookup error.
+func writeTokenDLQReason(err error) string {
+	switch {
+	case errors.Is(err, logharbour.ErrMissingWriteToken):
+		return dlqReasonMissingWriteToken
+	case errors.Is(err, logharbour.ErrRevokedWriteToken):
+		return dlqReasonRevokedWriteToken
+	default:
+		return dlqReasonUnknownWriteToken
+	}
+}
+
+// setupRealmIndices creates the index of each realm in the registry if it does not exist.
+func setupRealmIndices(client *logharbour.ElasticsearchClient, realms *logharbour.RealmRegistry) error {
+	for _, index := range realms.Indices() {
+		if err := setupElasticsearchIndex(client, index); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// watchRealmRegistry reloads the realm registry from path when the process receives SIGHUP,
+// so that new realms and revoked tokens take effect without a restart. A registry which
+// fails to load is logged and the previous one is kept.
+func watchRealmRegistry(realms *logharbour.RealmRegistry, path string, client *logharbour.ElasticsearchClient) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	go func() {
+		for range signals {
+			if err := realms.Reload(path); err != nil {
+				logger.Error("Failed to reload realm registry, keeping the previous one",
+					slog.String("error", err.Error()),
+					slog.String("path", path))
+				continue
+			}
+			if err := setupRealmIndices(client, realms); err != nil {
+				logger.Error("Failed to setup realm indices",
+					slog.String("error", err.Error()))
+			}
+			logger.Info("Realm registry reloaded",
+				slog.String("path", path),
+				slog.Any("realm_indices", realms.Indices()))
+		}
+	}()
+}
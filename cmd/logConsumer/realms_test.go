@@ -0,0 +1,84 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/IBM/sarama"
+	"github.com/remiges-tech/logharbour/logharbour"
+	"github.com/stretchr/testify/require"
+)
+
+func messageWithToken(offset int64, value, token string) *sarama.ConsumerMessage {
+	msg := &sarama.ConsumerMessage{Value: []byte(value), Topic: "log_topic", Offset: offset}
+	if token != "" {
+		msg.Headers = []*sarama.RecordHeader{{Key: []byte(logharbour.WriteTokenHeader), Value: []byte(token)}}
+	}
+	return msg
+}
+
+func testRealms(t *testing.T) *logharbour.RealmRegistry {
+	realms, err := logharbour.NewRealmRegistry(
+		logharbour.Realm{ShortName: "acme", Index: "logs_acme", WriteTokens: []string{"acme-w1", "acme-w2"}, RevokedTokens: []string{"acme-old"}},
+		logharbour.Realm{ShortName: "globex", Index: "logs_globex", WriteTokens: []string{"globex-w1"}},
+	)
+	require.NoError(t, err)
+	return realms
+}
+
+// TestPrepareBatch_RoutesByRealm verifies documents are grouped by the index of their token's realm
+func TestPrepareBatch_RoutesByRealm(t *testing.T) {
+	setupLogger("info")
+
+	batch := prepareBatch([]*sarama.ConsumerMessage{
+		messageWithToken(1, `{"id":"a"}`, "acme-w1"),
+		messageWithToken(2, `{"id":"b"}`, "globex-w1"),
+		messageWithToken(3, `{"id":"c"}`, "acme-w2"),
+	}, testRealms(t), "logs")
+
+	require.Empty(t, batch.rejected)
+	require.Equal(t, []string{"logs_acme", "logs_globex"}, batch.indices())
+	require.Equal(t, []logharbour.BulkDocument{{ID: "a", Body: `{"id":"a"}`}, {ID: "c", Body: `{"id":"c"}`}}, batch.docsByIndex["logs_acme"])
+	require.Len(t, batch.docsByIndex["logs_globex"], 1)
+	require.Len(t, batch.docIDToMessage, 3)
+	require.Equal(t, map[string]string{"a": "acme", "b": "globex", "c": "acme"}, batch.docIDToRealm)
+}
+
+// TestPrepareBatch_RejectsInvalidTokens verifies each kind of invalid token gets its own DLQ reason
+func TestPrepareBatch_RejectsInvalidTokens(t *testing.T) {
+	setupLogger("info")
+
+	batch := prepareBatch([]*sarama.ConsumerMessage{
+		messageWithToken(1, `{"id":"a"}`, ""),
+		messageWithToken(2, `{"id":"b"}`, "nobody"),
+		messageWithToken(3, `{"id":"c"}`, "acme-old"),
+		messageWithToken(4, `not json`, "acme-w1"),
+		messageWithToken(5, `{"id":"e"}`, "acme-w1"),
+	}, testRealms(t), "logs")
+
+	reasons := make(map[int64]string)
+	for _, r := range batch.rejected {
+		reasons[r.message.Offset] = r.reason
+	}
+	require.Equal(t, dlqReasonMissingWriteToken, reasons[1])
+	require.Equal(t, dlqReasonUnknownWriteToken, reasons[2])
+	require.Equal(t, dlqReasonRevokedWriteToken, reasons[3])
+	require.Contains(t, reasons[4], "json_unmarshal_error")
+	require.Len(t, batch.docIDToMessage, 1)
+	require.Len(t, batch.docsByIndex["logs_acme"], 1)
+}
+
+// TestPrepareBatch_NoRegistry verifies all messages go to the default index without a realm registry
+func TestPrepareBatch_NoRegistry(t *testing.T) {
+	setupLogger("info")
+
+	batch := prepareBatch([]*sarama.ConsumerMessage{
+		messageWithToken(1, `{"id":"a"}`, ""),
+		messageWithToken(2, `{"id":"b"}`, "anything"),
+		messageWithToken(3, `{"app":"x"}`, ""),
+	}, nil, "logs")
+
+	require.Equal(t, []string{"logs"}, batch.indices())
+	require.Len(t, batch.docsByIndex["logs"], 2)
+	require.Len(t, batch.rejected, 1)
+	require.Equal(t, "missing_id_field", batch.rejected[0].reason)
+}
@@ -0,0 +1,742 @@
+package logharbour
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// DefaultAlertWindow is the window of alert rules which do not set one.
+	DefaultAlertWindow = time.Minute
+	// DefaultAlertMaxAge is how old an entry may be when it is observed, see WithAlertMaxAge.
+	DefaultAlertMaxAge = time.Hour
+
+	defaultAlertQueue  = 100
+	alertSendTimeout   = 10 * time.Second
+	alertPruneInterval = 1000 // Observed entries between two prunings of idle windows
+)
+
+// Alert sink types of AlertSinkConfig.Type
+const (
+	AlertSinkWebhook = "webhook"
+	AlertSinkSMTP    = "smtp"
+	AlertSinkKafka   = "kafka"
+)
+
+// ErrInvalidAlertConfig is returned for alert configurations with an invalid rule or sink.
+var ErrInvalidAlertConfig = errors.New("invalid alert config")
+
+// AlertGroupAttributes are the attributes alert rules may count entries by, see AlertRule.GroupBy.
+var AlertGroupAttributes = []string{app, system, module, who, op, class, instance, remote_ip, pri, status}
+
+// AlertConfig is the alerting configuration read from a file by LoadAlertConfig.
+//
+// Example YAML file:
+//
+//	sinks:
+//	  - name: ops
+//	    type: webhook
+//	    url: https://hooks.example.com/logharbour
+//	  - name: oncall
+//	    type: smtp
+//	    addr: smtp.example.com:587
+//	    username: alerts
+//	    password_env: SMTP_PASSWORD
+//	    from: logharbour@example.com
+//	    to: [oncall@example.com]
+//	rules:
+//	  - name: billing-errors        # more than 50 Err entries of billing in 5 minutes
+//	    app: billing
+//	    pri: Err
+//	    count: 51
+//	    window: 5m
+//	    sinks: [ops]
+//	  - name: security              # any Sec entry, at most one alert a minute per app
+//	    pri: Sec
+//	    group_by: [app]
+//	  - name: repeated-login-failures
+//	    op: login
+//	    status: failure
+//	    count: 3
+//	    window: 10m
+//	    group_by: [who]
+//	    cooldown: 1h
+type AlertConfig struct {
+	Sinks []AlertSinkConfig `json:"sinks,omitempty" yaml:"sinks,omitempty"`
+	Rules []AlertRule       `json:"rules" yaml:"rules"`
+}
+
+// AlertSinkConfig configures a sink alerts are sent to. Type is AlertSinkWebhook, AlertSinkSMTP
+// or AlertSinkKafka; the other fields are those of the type.
+type AlertSinkConfig struct {
+	Name string `json:"name" yaml:"name"`
+	Type string `json:"type" yaml:"type"`
+
+	URL     string            `json:"url,omitempty" yaml:"url,omitempty"`         // webhook: URL the alerts are posted to
+	Headers map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"` // webhook: headers of the requests
+
+	Addr        string   `json:"addr,omitempty" yaml:"addr,omitempty"`                 // smtp: host:port of the server
+	Username    string   `json:"username,omitempty" yaml:"username,omitempty"`         // smtp: PLAIN authentication, if set
+	Password    string   `json:"password,omitempty" yaml:"password,omitempty"`         // smtp
+	PasswordEnv string   `json:"password_env,omitempty" yaml:"password_env,omitempty"` // smtp: environment variable holding the password
+	From        string   `json:"from,omitempty" yaml:"from,omitempty"`                 // smtp
+	To          []string `json:"to,omitempty" yaml:"to,omitempty"`                     // smtp
+
+	Topic string `json:"topic,omitempty" yaml:"topic,omitempty"` // kafka: topic the alerts are produced to
+}
+
+// AlertRule raises an alert when Count entries matching its filters are logged within Window.
+// The filters which are set must all match; Pri matches that priority and higher.
+//
+// With GroupBy, entries are counted separately for each value of the attributes, e.g. per who,
+// and the alerts of a group are de-duplicated: once an alert is raised, further alerts of the
+// group are suppressed for Cooldown, and counted in the next alert.
+type AlertRule struct {
+	Name   string       `json:"name" yaml:"name"`
+	Realm  string       `json:"realm,omitempty" yaml:"realm,omitempty"` // Entries of this realm only, if set
+	App    string       `json:"app,omitempty" yaml:"app,omitempty"`
+	Module string       `json:"module,omitempty" yaml:"module,omitempty"`
+	Who    string       `json:"who,omitempty" yaml:"who,omitempty"`
+	Class  string       `json:"class,omitempty" yaml:"class,omitempty"`
+	Op     string       `json:"op,omitempty" yaml:"op,omitempty"`
+	Type   string       `json:"type,omitempty" yaml:"type,omitempty"` // A, C or D
+	Pri    *LogPriority `json:"pri,omitempty" yaml:"pri,omitempty"`
+	Status string       `json:"status,omitempty" yaml:"status,omitempty"` // success or failure
+	Text   string       `json:"text,omitempty" yaml:"text,omitempty"`     // Words all found in msg, error or activity data
+
+	Count    int      `json:"count,omitempty" yaml:"count,omitempty"`       // 1 if not set
+	Window   string   `json:"window,omitempty" yaml:"window,omitempty"`     // DefaultAlertWindow if not set
+	GroupBy  []string `json:"group_by,omitempty" yaml:"group_by,omitempty"` // See AlertGroupAttributes
+	Cooldown string   `json:"cooldown,omitempty" yaml:"cooldown,omitempty"` // Window if not set
+	Sinks    []string `json:"sinks,omitempty" yaml:"sinks,omitempty"`       // All sinks if not set
+}
+
+// LoadAlertConfig reads an AlertConfig from a file. Files with a .yaml or .yml extension are
+// decoded as YAML, all others as JSON.
+func LoadAlertConfig(path string) (*AlertConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read alert config: %w", err)
+	}
+	var cfg AlertConfig
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &cfg)
+	default:
+		err = json.Unmarshal(data, &cfg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse alert config %s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+// Alert is raised by an AlertRule.
+type Alert struct {
+	Rule       string            `json:"rule"`
+	Realm      string            `json:"realm,omitempty"`
+	Group      map[string]string `json:"group,omitempty"` // Values of the rule's GroupBy attributes
+	Count      int               `json:"count"`           // Matching entries in the window
+	Window     string            `json:"window"`          // Window of the rule, e.g. "5m0s"
+	First      time.Time         `json:"first"`           // Time of the first entry counted
+	Last       time.Time         `json:"last"`            // Time of the last entry counted
+	Suppressed int               `json:"suppressed"`      // Alerts of the rule and group suppressed since the previous one
+	Entry      LogEntry          `json:"entry"`           // The entry which raised the alert
+}
+
+// Summary returns a one-line description of the alert, e.g.
+// "billing-errors: 51 entries in 5m0s (app=billing)". Alerts raised by a single entry are
+// described by its message.
+func (a Alert) Summary() string {
+	var sb strings.Builder
+	if a.Count == 1 {
+		fmt.Fprintf(&sb, "%s: %s", a.Rule, a.Entry.Msg)
+	} else {
+		fmt.Fprintf(&sb, "%s: %d entries in %s", a.Rule, a.Count, a.Window)
+	}
+	if len(a.Group) > 0 {
+		keys := make([]string, 0, len(a.Group))
+		for k := range a.Group {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for i, k := range keys {
+			keys[i] = k + "=" + a.Group[k]
+		}
+		fmt.Fprintf(&sb, " (%s)", strings.Join(keys, ", "))
+	}
+	if a.Realm != "" {
+		fmt.Fprintf(&sb, " in realm %s", a.Realm)
+	}
+	if a.Suppressed > 0 {
+		fmt.Fprintf(&sb, ", %d similar alerts suppressed", a.Suppressed)
+	}
+	return sb.String()
+}
+
+// AlertSink sends alerts, e.g. to a webhook, by mail or to a Kafka topic.
+type AlertSink interface {
+	SendAlert(ctx context.Context, alert Alert) error
+}
+
+// WebhookSink posts alerts in JSON to a URL.
+type WebhookSink struct {
+	URL     string
+	Headers map[string]string
+	Client  *http.Client // http.DefaultClient if nil
+}
+
+// SendAlert posts the alert. Responses other than 2xx are errors.
+func (s *WebhookSink) SendAlert(ctx context.Context, alert Alert) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range s.Headers {
+		req.Header.Set(k, v)
+	}
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook %s returned %s", s.URL, resp.Status)
+	}
+	return nil
+}
+
+// SMTPSink mails alerts, with the summary as subject and the entry which raised the alert
+// in the body.
+type SMTPSink struct {
+	Addr string    // host:port of the server
+	Auth smtp.Auth // No authentication if nil
+	From string
+	To   []string
+
+	sendMail func(addr string, a smtp.Auth, from string, to []string, msg []byte) error // smtp.SendMail if nil
+}
+
+// SendAlert mails the alert. The context is not used: net/smtp does not support one.
+func (s *SMTPSink) SendAlert(ctx context.Context, alert Alert) error {
+	entry, err := json.MarshalIndent(alert.Entry, "", "  ")
+	if err != nil {
+		return err
+	}
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", s.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(s.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mailSubject(alert))
+	fmt.Fprintf(&msg, "Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	fmt.Fprintf(&msg, "%s\r\n\r\nFirst entry: %s\r\nLast entry: %s\r\n\r\n%s\r\n",
+		alert.Summary(), alert.First.Format(time.RFC3339), alert.Last.Format(time.RFC3339), entry)
+
+	sendMail := s.sendMail
+	if sendMail == nil {
+		sendMail = smtp.SendMail
+	}
+	return sendMail(s.Addr, s.Auth, s.From, s.To, msg.Bytes())
+}
+
+// mailSubject returns the Subject header value of the mail of an alert. The summary may hold
+// a logged message or group values, so line breaks are removed lest they add headers, and
+// non-ASCII text is encoded.
+func mailSubject(alert Alert) string {
+	subject := strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ").Replace("[logharbour] " + alert.Summary())
+	return mime.QEncoding.Encode("utf-8", subject)
+}
+
+// KafkaSink produces alerts in JSON to a Kafka topic, keyed by rule name.
+type KafkaSink struct {
+	Producer sarama.SyncProducer
+	Topic    string
+}
+
+// SendAlert produces the alert. The context is not used: sarama does not support one.
+func (s *KafkaSink) SendAlert(ctx context.Context, alert Alert) error {
+	value, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	_, _, err = s.Producer.SendMessage(&sarama.ProducerMessage{
+		Topic: s.Topic,
+		Key:   sarama.StringEncoder(alert.Rule),
+		Value: sarama.ByteEncoder(value),
+	})
+	return err
+}
+
+// AlertEngine evaluates alert rules over a stream of log entries, such as the one of a Kafka
+// consumer, and sends the alerts raised to sinks in the background.
+//
+// Entries are counted in sliding windows by the time they were logged, so that a consumer
+// catching up does not count a backlog as a burst; entries older than the max age are ignored,
+// so that replaying a topic does not raise old alerts.
+//
+// Example:
+//
+//	cfg, err := logharbour.LoadAlertConfig("/etc/logharbour/alerts.yaml")
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	engine, err := logharbour.NewAlertEngine(cfg, logharbour.WithAlertErrors(func(err error) { log.Print(err) }))
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	defer engine.Close()
+//	...
+//	engine.Observe(realm, &entry)
+type AlertEngine struct {
+	mu          sync.Mutex // Guards rules, sinks and observed
+	rules       []*alertRule
+	sinks       map[string]AlertSink
+	customSinks map[string]AlertSink
+	observed    int
+
+	maxAge   time.Duration
+	producer sarama.SyncProducer
+	onError  func(error)
+	now      func() time.Time
+
+	queue     chan alertDelivery
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// AlertOption configures an AlertEngine.
+type AlertOption func(*AlertEngine)
+
+// WithAlertMaxAge sets how old an entry may be when it is observed (DefaultAlertMaxAge by default).
+// Older entries are ignored.
+func WithAlertMaxAge(maxAge time.Duration) AlertOption {
+	return func(e *AlertEngine) {
+		e.maxAge = maxAge
+	}
+}
+
+// WithAlertSink adds a sink, which rules can name like the sinks of the configuration.
+func WithAlertSink(name string, sink AlertSink) AlertOption {
+	return func(e *AlertEngine) {
+		e.customSinks[name] = sink
+	}
+}
+
+// WithAlertKafkaProducer sets the producer of the kafka sinks of the configuration.
+// Configurations with kafka sinks are invalid without one.
+func WithAlertKafkaProducer(producer sarama.SyncProducer) AlertOption {
+	return func(e *AlertEngine) {
+		e.producer = producer
+	}
+}
+
+// WithAlertErrors sets a function which receives the errors of sending alerts, and the alerts
+// dropped because the sinks are too slow. Errors are discarded by default.
+func WithAlertErrors(onError func(error)) AlertOption {
+	return func(e *AlertEngine) {
+		e.onError = onError
+	}
+}
+
+// alertRule is a validated AlertRule with its windows.
+type alertRule struct {
+	AlertRule
+	match    func(*LogEntry) bool
+	window   time.Duration
+	cooldown time.Duration
+	count    int
+	windows  map[string]*alertWindow // By realm and group values
+}
+
+// alertWindow holds the recent matching entries of a rule and group.
+type alertWindow struct {
+	group      map[string]string
+	times      []time.Time // Sorted times of the latest matching entries, at most the rule's count
+	firedAt    time.Time   // Time of the entry which raised the last alert
+	suppressed int
+	latest     time.Time
+}
+
+type alertDelivery struct {
+	alert Alert
+	sinks []string
+}
+
+// NewAlertEngine returns an AlertEngine with the rules and sinks of cfg, which starts sending
+// alerts. Close stops it.
+func NewAlertEngine(cfg *AlertConfig, opts ...AlertOption) (*AlertEngine, error) {
+	e := &AlertEngine{
+		customSinks: make(map[string]AlertSink),
+		maxAge:      DefaultAlertMaxAge,
+		onError:     func(error) {},
+		now:         time.Now,
+		queue:       make(chan alertDelivery, defaultAlertQueue),
+		done:        make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	if err := e.Apply(cfg); err != nil {
+		return nil, err
+	}
+	go e.dispatch()
+	return e, nil
+}
+
+// Reload replaces the rules and sinks of the engine with those of a configuration file.
+// If the file cannot be read or is invalid, the engine is left unchanged.
+func (e *AlertEngine) Reload(path string) error {
+	cfg, err := LoadAlertConfig(path)
+	if err != nil {
+		return err
+	}
+	return e.Apply(cfg)
+}
+
+// Apply replaces the rules and sinks of the engine. The configuration is validated first, so
+// an invalid one changes nothing. Rules which are unchanged keep their windows.
+func (e *AlertEngine) Apply(cfg *AlertConfig) error {
+	sinks := make(map[string]AlertSink, len(cfg.Sinks)+len(e.customSinks))
+	for name, sink := range e.customSinks {
+		sinks[name] = sink
+	}
+	for _, sc := range cfg.Sinks {
+		if _, ok := sinks[sc.Name]; ok || sc.Name == "" {
+			return fmt.Errorf("%w: sink name %q is empty or used twice", ErrInvalidAlertConfig, sc.Name)
+		}
+		sink, err := e.newSink(sc)
+		if err != nil {
+			return fmt.Errorf("%w: sink %q: %v", ErrInvalidAlertConfig, sc.Name, err)
+		}
+		sinks[sc.Name] = sink
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	previous := make(map[string]*alertRule, len(e.rules))
+	for _, r := range e.rules {
+		previous[r.Name] = r
+	}
+	rules := make([]*alertRule, 0, len(cfg.Rules))
+	names := make(map[string]bool, len(cfg.Rules))
+	for _, rule := range cfg.Rules {
+		if rule.Name == "" || names[rule.Name] {
+			return fmt.Errorf("%w: rule name %q is empty or used twice", ErrInvalidAlertConfig, rule.Name)
+		}
+		names[rule.Name] = true
+		r, err := newAlertRule(rule, sinks)
+		if err != nil {
+			return fmt.Errorf("%w: rule %q: %v", ErrInvalidAlertConfig, rule.Name, err)
+		}
+		if old, ok := previous[rule.Name]; ok && reflect.DeepEqual(old.AlertRule, r.AlertRule) {
+			r.windows = old.windows
+		}
+		rules = append(rules, r)
+	}
+	e.rules, e.sinks = rules, sinks
+	return nil
+}
+
+// newSink returns the sink of a configuration.
+func (e *AlertEngine) newSink(sc AlertSinkConfig) (AlertSink, error) {
+	switch sc.Type {
+	case AlertSinkWebhook:
+		if sc.URL == "" {
+			return nil, errors.New("no url")
+		}
+		return &WebhookSink{URL: sc.URL, Headers: sc.Headers}, nil
+	case AlertSinkSMTP:
+		if sc.Addr == "" || sc.From == "" || len(sc.To) == 0 {
+			return nil, errors.New("addr, from and to are required")
+		}
+		sink := &SMTPSink{Addr: sc.Addr, From: sc.From, To: sc.To}
+		if sc.Username != "" {
+			host, _, err := net.SplitHostPort(sc.Addr)
+			if err != nil {
+				return nil, err
+			}
+			password := sc.Password
+			if sc.PasswordEnv != "" {
+				password = os.Getenv(sc.PasswordEnv)
+			}
+			sink.Auth = smtp.PlainAuth("", sc.Username, password, host)
+		}
+		return sink, nil
+	case AlertSinkKafka:
+		if sc.Topic == "" {
+			return nil, errors.New("no topic")
+		}
+		if e.producer == nil {
+			return nil, errors.New("no Kafka producer")
+		}
+		return &KafkaSink{Producer: e.producer, Topic: sc.Topic}, nil
+	}
+	return nil, fmt.Errorf("unknown type %q", sc.Type)
+}
+
+// newAlertRule validates a rule.
+func newAlertRule(rule AlertRule, sinks map[string]AlertSink) (*alertRule, error) {
+	r := &alertRule{AlertRule: rule, count: rule.Count, window: DefaultAlertWindow, windows: make(map[string]*alertWindow)}
+	if r.count < 0 {
+		return nil, fmt.Errorf("negative count %d", r.count)
+	}
+	if r.count == 0 {
+		r.count = 1
+	}
+	var err error
+	if rule.Window != "" {
+		if r.window, err = time.ParseDuration(rule.Window); err != nil || r.window <= 0 {
+			return nil, fmt.Errorf("invalid window %q", rule.Window)
+		}
+	}
+	r.cooldown = r.window
+	if rule.Cooldown != "" {
+		if r.cooldown, err = time.ParseDuration(rule.Cooldown); err != nil || r.cooldown < 0 {
+			return nil, fmt.Errorf("invalid cooldown %q", rule.Cooldown)
+		}
+	}
+	for _, attr := range rule.GroupBy {
+		if !slices.Contains(AlertGroupAttributes, attr) {
+			return nil, fmt.Errorf("invalid group_by attribute %q", attr)
+		}
+	}
+	for _, name := range rule.Sinks {
+		if _, ok := sinks[name]; !ok {
+			return nil, fmt.Errorf("unknown sink %q", name)
+		}
+	}
+
+	optional := func(s string) *string {
+		if s == "" {
+			return nil
+		}
+		return &s
+	}
+	param := GetLogsParam{
+		App: optional(rule.App), Module: optional(rule.Module), Who: optional(rule.Who),
+		Class: optional(rule.Class), Operation: optional(rule.Op), Priority: rule.Pri, Text: optional(rule.Text),
+	}
+	if rule.Type != "" {
+		var logType LogType
+		if err := logType.UnmarshalJSON([]byte(`"` + rule.Type + `"`)); err != nil {
+			return nil, err
+		}
+		param.Type = &logType
+	}
+	var wantStatus *Status
+	switch strings.ToLower(rule.Status) {
+	case "":
+	case "success":
+		s := Success
+		wantStatus = &s
+	case "failure":
+		s := Failure
+		wantStatus = &s
+	default:
+		return nil, fmt.Errorf("invalid status %q", rule.Status)
+	}
+	match, err := MatchLogParam(param)
+	if err != nil {
+		return nil, err
+	}
+	r.match = func(entry *LogEntry) bool {
+		return (wantStatus == nil || entry.Status == *wantStatus) && match(entry)
+	}
+	return r, nil
+}
+
+// Observe evaluates the rules over an entry of a realm ("" without realms), and returns the
+// alerts it raises, which are also queued to be sent. Observe does not wait for the sinks: if
+// the queue is full, the alerts are dropped and reported to the error function.
+func (e *AlertEngine) Observe(realm string, entry *LogEntry) []Alert {
+	now := e.now()
+	if e.maxAge > 0 && now.Sub(entry.When) > e.maxAge {
+		return nil
+	}
+
+	e.mu.Lock()
+	var alerts []Alert
+	var deliveries []alertDelivery
+	for _, r := range e.rules {
+		if r.Realm != "" && r.Realm != realm || !r.match(entry) {
+			continue
+		}
+		if alert, ok := r.observe(realm, entry); ok {
+			alerts = append(alerts, alert)
+			deliveries = append(deliveries, alertDelivery{alert: alert, sinks: r.Sinks})
+		}
+	}
+	e.observed++
+	if e.observed%alertPruneInterval == 0 {
+		for _, r := range e.rules {
+			r.prune(now)
+		}
+	}
+	e.mu.Unlock()
+
+	for _, d := range deliveries {
+		select {
+		case e.queue <- d:
+		default:
+			e.onError(fmt.Errorf("alert queue full, dropped alert %s", d.alert.Summary()))
+		}
+	}
+	return alerts
+}
+
+// observe counts a matching entry in its window, and returns the alert it raises, if any.
+func (r *alertRule) observe(realm string, entry *LogEntry) (Alert, bool) {
+	group := make(map[string]string, len(r.GroupBy))
+	key := realm
+	for _, attr := range r.GroupBy {
+		value := alertGroupValue(entry, attr)
+		group[attr] = value
+		key += "\x00" + value
+	}
+	w, ok := r.windows[key]
+	if !ok {
+		w = &alertWindow{group: group}
+		r.windows[key] = w
+	}
+
+	i := sort.Search(len(w.times), func(i int) bool { return w.times[i].After(entry.When) })
+	w.times = append(w.times, time.Time{})
+	copy(w.times[i+1:], w.times[i:])
+	w.times[i] = entry.When
+	if entry.When.After(w.latest) {
+		w.latest = entry.When
+	}
+	cutoff := w.latest.Add(-r.window)
+	drop := sort.Search(len(w.times), func(i int) bool { return w.times[i].After(cutoff) })
+	drop = max(drop, len(w.times)-r.count)
+	w.times = append(w.times[:0], w.times[drop:]...)
+	if len(w.times) < r.count {
+		return Alert{}, false
+	}
+
+	first, last := w.times[0], w.times[len(w.times)-1]
+	count := len(w.times)
+	w.times = w.times[:0]
+	if !w.firedAt.IsZero() && entry.When.Before(w.firedAt.Add(r.cooldown)) {
+		w.suppressed++
+		return Alert{}, false
+	}
+	alert := Alert{
+		Rule: r.Name, Realm: realm, Count: count, Window: r.window.String(), First: first, Last: last,
+		Suppressed: w.suppressed, Entry: *entry,
+	}
+	if len(w.group) > 0 {
+		alert.Group = w.group
+	}
+	w.firedAt, w.suppressed = entry.When, 0
+	return alert, true
+}
+
+// prune drops the windows without entries within the window and cooldown before now.
+func (r *alertRule) prune(now time.Time) {
+	idle := now.Add(-max(r.window, r.cooldown))
+	for key, w := range r.windows {
+		if w.latest.Before(idle) {
+			delete(r.windows, key)
+		}
+	}
+}
+
+// alertGroupValue returns the value of one of AlertGroupAttributes of an entry.
+func alertGroupValue(entry *LogEntry, attr string) string {
+	switch attr {
+	case app:
+		return entry.App
+	case system:
+		return entry.System
+	case module:
+		return entry.Module
+	case who:
+		return entry.Who
+	case op:
+		return entry.Op
+	case class:
+		return entry.Class
+	case instance:
+		return entry.InstanceId
+	case remote_ip:
+		return entry.RemoteIP
+	case pri:
+		return entry.Pri.String()
+	case status:
+		if entry.Status == Failure {
+			return "failure"
+		}
+		return "success"
+	}
+	return ""
+}
+
+// dispatch sends the queued alerts until the engine is closed.
+func (e *AlertEngine) dispatch() {
+	defer close(e.done)
+	for d := range e.queue {
+		e.mu.Lock()
+		names := d.sinks
+		if len(names) == 0 {
+			names = make([]string, 0, len(e.sinks))
+			for name := range e.sinks {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+		}
+		sinks := make(map[string]AlertSink, len(names))
+		for _, name := range names {
+			// A sink removed by a reload since the alert was raised is skipped
+			if sink, ok := e.sinks[name]; ok {
+				sinks[name] = sink
+			}
+		}
+		e.mu.Unlock()
+
+		for _, name := range names {
+			sink, ok := sinks[name]
+			if !ok {
+				continue
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), alertSendTimeout)
+			if err := sink.SendAlert(ctx, d.alert); err != nil {
+				e.onError(fmt.Errorf("failed to send alert %s to sink %s: %w", d.alert.Rule, name, err))
+			}
+			cancel()
+		}
+	}
+}
+
+// Close sends the queued alerts and stops the engine. Entries must not be observed afterwards.
+func (e *AlertEngine) Close() error {
+	e.closeOnce.Do(func() { close(e.queue) })
+	<-e.done
+	return nil
+}
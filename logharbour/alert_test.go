@@ -0,0 +1,239 @@
+package logharbour
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+)
+
+// recordingSink records the alerts sent to it.
+type recordingSink struct {
+	mu     sync.Mutex
+	alerts []Alert
+}
+
+func (s *recordingSink) SendAlert(ctx context.Context, alert Alert) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.alerts = append(s.alerts, alert)
+	return nil
+}
+
+func TestAlertEngine_Observe(t *testing.T) {
+	base := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	sink := &recordingSink{}
+	engine, err := NewAlertEngine(&AlertConfig{Rules: []AlertRule{
+		{Name: "login-failures", Op: "login", Status: "failure", Count: 3, Window: "5m", GroupBy: []string{who}, Cooldown: "1h"},
+		{Name: "security", Pri: func() *LogPriority { p := Sec; return &p }(), Realm: "acme"},
+	}}, WithAlertSink("rec", sink))
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := base.Add(30 * time.Minute)
+	engine.now = func() time.Time { return now }
+
+	failure := func(who string, minutes int) *LogEntry {
+		return &LogEntry{App: "crux", Op: "login", Who: who, Status: Failure, Pri: Warn, When: base.Add(time.Duration(minutes) * time.Minute), Msg: "login failed"}
+	}
+	observe := func(entry *LogEntry) []Alert { return engine.Observe("acme", entry) }
+
+	// Failures more than 5 minutes apart and failures of other users are not counted together
+	for _, e := range []*LogEntry{failure("alice", 0), failure("alice", 6), failure("bob", 7), failure("alice", 8)} {
+		if alerts := observe(e); len(alerts) != 0 {
+			t.Fatalf("unexpected alert %+v", alerts)
+		}
+	}
+	success := failure("alice", 9)
+	success.Status = Success
+	if alerts := observe(success); len(alerts) != 0 {
+		t.Fatalf("success raised %+v", alerts)
+	}
+	alerts := observe(failure("alice", 10))
+	if len(alerts) != 1 {
+		t.Fatalf("expected an alert on the third failure in 5 minutes, got %+v", alerts)
+	}
+	a := alerts[0]
+	if a.Rule != "login-failures" || a.Count != 3 || a.Group[who] != "alice" || a.Realm != "acme" ||
+		!a.First.Equal(base.Add(6*time.Minute)) || !a.Last.Equal(base.Add(10*time.Minute)) || a.Window != "5m0s" {
+		t.Errorf("alert = %+v", a)
+	}
+
+	// Within the cooldown, alerts are suppressed and counted in the next one
+	for m := 11; m < 17; m++ {
+		if alerts := observe(failure("alice", m)); len(alerts) != 0 {
+			t.Fatalf("alert during cooldown %+v", alerts)
+		}
+	}
+	now = base.Add(100 * time.Minute)
+	for m := 80; m < 83; m++ {
+		alerts = observe(failure("alice", m))
+	}
+	if len(alerts) != 1 || alerts[0].Suppressed != 2 {
+		t.Fatalf("expected an alert after the cooldown with 2 suppressed, got %+v", alerts)
+	}
+	if !strings.Contains(alerts[0].Summary(), "3 entries in 5m0s (who=alice) in realm acme, 2 similar alerts suppressed") {
+		t.Errorf("summary = %q", alerts[0].Summary())
+	}
+
+	// Rules of a realm ignore the entries of other realms, and old entries are ignored
+	sec := &LogEntry{App: "crux", Pri: Sec, When: base.Add(90 * time.Minute), Msg: "token replay"}
+	if alerts := engine.Observe("globex", sec); len(alerts) != 0 {
+		t.Errorf("rule of realm acme raised %+v for realm globex", alerts)
+	}
+	old := *sec
+	old.When = base
+	if alerts := observe(&old); len(alerts) != 0 {
+		t.Errorf("entry older than the max age raised %+v", alerts)
+	}
+	if alerts := observe(sec); len(alerts) != 1 || alerts[0].Summary() != "security: token replay in realm acme" {
+		t.Errorf("expected an alert for a Sec entry, got %+v", alerts)
+	}
+
+	if err := engine.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(sink.alerts) != 3 {
+		t.Errorf("expected the sink to receive 3 alerts, got %d", len(sink.alerts))
+	}
+}
+
+func TestAlertEngine_Sinks(t *testing.T) {
+	var webhook Alert
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		if err := json.NewDecoder(r.Body).Decode(&webhook); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer server.Close()
+	producer := mocks.NewSyncProducer(t, nil)
+	producer.ExpectSendMessageWithCheckerFunctionAndSucceed(func(value []byte) error {
+		if !strings.Contains(string(value), `"rule":"sec"`) {
+			return errors.New("unexpected message " + string(value))
+		}
+		return nil
+	})
+	var errs []error
+
+	engine, err := NewAlertEngine(&AlertConfig{
+		Sinks: []AlertSinkConfig{
+			{Name: "hook", Type: AlertSinkWebhook, URL: server.URL, Headers: map[string]string{"Authorization": "Bearer x"}},
+			{Name: "mail", Type: AlertSinkSMTP, Addr: "smtp.example.com:25", From: "lh@example.com", To: []string{"ops@example.com"}},
+			{Name: "topic", Type: AlertSinkKafka, Topic: "alerts"},
+		},
+		Rules: []AlertRule{{Name: "sec", App: "crux"}},
+	}, WithAlertKafkaProducer(producer), WithAlertErrors(func(err error) { errs = append(errs, err) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mail string
+	engine.sinks["mail"].(*SMTPSink).sendMail = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		mail = string(msg)
+		return nil
+	}
+
+	engine.Observe("", &LogEntry{App: "crux", Pri: Sec, When: time.Now(), Msg: "token replay"})
+	if err := engine.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	if webhook.Rule != "sec" || webhook.Entry.Msg != "token replay" || authorization != "Bearer x" {
+		t.Errorf("webhook received %+v with authorization %q", webhook, authorization)
+	}
+	if !strings.Contains(mail, "Subject: [logharbour] sec: token replay\r\n") || !strings.Contains(mail, "To: ops@example.com") {
+		t.Errorf("mail = %q", mail)
+	}
+}
+
+func TestAlertEngine_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "alerts.yaml")
+	write := func(content string) {
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("rules:\n  - name: errors\n    pri: err\n    count: 2\n")
+	cfg, err := LoadAlertConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine, err := NewAlertEngine(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close()
+	entry := &LogEntry{App: "crux", Pri: Err, When: time.Now()}
+	engine.Observe("", entry)
+
+	// Invalid configurations leave the rules unchanged
+	for _, content := range []string{
+		"rules:\n  - name: errors\n    group_by: [colour]\n",
+		"rules:\n  - name: errors\n    window: soon\n",
+		"rules:\n  - name: errors\n    sinks: [nowhere]\n",
+		"sinks:\n  - name: topic\n    type: kafka\n    topic: alerts\nrules: []\n",
+		"rules:\n  - name: errors\n  - name: errors\n",
+	} {
+		write(content)
+		if err := engine.Reload(path); !errors.Is(err, ErrInvalidAlertConfig) {
+			t.Errorf("expected ErrInvalidAlertConfig for %q, got %v", content, err)
+		}
+	}
+
+	// An unchanged rule keeps its window across a reload
+	write("rules:\n  - name: errors\n    pri: err\n    count: 2\n  - name: warnings\n    pri: warn\n")
+	if err := engine.Reload(path); err != nil {
+		t.Fatal(err)
+	}
+	if alerts := engine.Observe("", entry); len(alerts) != 2 || alerts[0].Rule != "errors" || alerts[0].Count != 2 {
+		t.Errorf("alerts after reload = %+v", alerts)
+	}
+}
+
+func TestKafkaSink_SendAlert(t *testing.T) {
+	producer := mocks.NewSyncProducer(t, nil)
+	producer.ExpectSendMessageAndFail(sarama.ErrOutOfBrokers)
+	sink := &KafkaSink{Producer: producer, Topic: "alerts"}
+	if err := sink.SendAlert(context.Background(), Alert{Rule: "sec"}); !errors.Is(err, sarama.ErrOutOfBrokers) {
+		t.Errorf("expected the producer's error, got %v", err)
+	}
+}
+
+func TestSMTPSink_SendAlert(t *testing.T) {
+	var mail string
+	sink := &SMTPSink{Addr: "smtp.example.com:25", From: "lh@example.com", To: []string{"ops@example.com"},
+		sendMail: func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+			mail = string(msg)
+			return nil
+		}}
+	alert := Alert{Rule: "sec", Count: 1, Entry: LogEntry{Msg: "token replay\r\nBcc: attacker@example.com\r\n\r\nforged body"}}
+	if err := sink.SendAlert(context.Background(), alert); err != nil {
+		t.Fatal(err)
+	}
+	headers, _, _ := strings.Cut(mail, "\r\n\r\n")
+	if strings.Contains(headers, "\r\nBcc:") || !strings.Contains(headers, "Subject: [logharbour] sec: token replay Bcc: attacker@example.com  forged body") {
+		t.Errorf("line breaks of the message reached the headers: %q", headers)
+	}
+
+	alert.Entry.Msg = "paiement refusé"
+	if err := sink.SendAlert(context.Background(), alert); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(mail, "Subject: =?utf-8?q?[logharbour]_sec:_paiement_refus=C3=A9?=\r\n") {
+		t.Errorf("expected a Q-encoded subject, got %q", mail)
+	}
+}
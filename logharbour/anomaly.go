@@ -0,0 +1,474 @@
+package logharbour
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/oschwald/geoip2-golang"
+)
+
+const (
+	// DefaultAnomalyDays is the number of days of history the baselines are learnt from.
+	DefaultAnomalyDays = 30
+	// DefaultAnomalyRecentHours is the number of hours, up to now, checked against the baselines.
+	DefaultAnomalyRecentHours = 24
+	// DefaultAnomalyMaxSpeed is the speed, in km/h, above which travel between the locations of
+	// two consecutive IP addresses is impossible; about that of an airliner.
+	DefaultAnomalyMaxSpeed = 1000.0
+	// DefaultAnomalyMaxEntries is the number of entries GetAnomalies reads at most.
+	DefaultAnomalyMaxEntries = 100000
+
+	anomalyBatchSize     = 1000
+	anomalyMaxEvidence   = 10   // Evidence entries of an anomaly, the latest ones
+	anomalyMinBaseline   = 5    // Baseline entries below which a user has no baseline of countries
+	anomalyMinHourlyBase = 20   // Baseline entries below which a user has no baseline of hours
+	anomalyRareHourShare = 0.02 // Share of the baseline entries below which an hour of day is unusual
+	anomalyMinTravelKm   = 100  // Distance below which consecutive locations may be the same place
+	anomalyMinChanges    = 10   // Recent change entries below which there is no spike
+	anomalySpikeRatio    = 5.0  // Ratio of recent to expected change entries from which there is a spike
+)
+
+// Kinds of anomalies
+const (
+	AnomalyNewCountry       = "new_country"
+	AnomalyImpossibleTravel = "impossible_travel"
+	AnomalyUnusualHour      = "unusual_hour"
+	AnomalyChangeSpike      = "change_spike"
+)
+
+// ErrInvalidAnomalyParam is returned by GetAnomalies for parameters out of range.
+var ErrInvalidAnomalyParam = errors.New("invalid anomaly parameter")
+
+// GetAnomaliesParam selects the users whose recent behaviour GetAnomalies compares with their
+// baseline, and the periods compared.
+type GetAnomaliesParam struct {
+	App         *string
+	Who         *string  // One user; all the users of App if nil
+	NDays       *int     // Days of history, including the recent hours; DefaultAnomalyDays if nil
+	RecentHours *int     // Hours up to now which are checked; DefaultAnomalyRecentHours if nil
+	LoginOp     *string  // Op of the entries checked for new countries and travel; all entries with a remote IP if nil
+	TimeZone    *string  // IANA time zone of the hours of day; UTC if nil
+	MaxSpeed    *float64 // DefaultAnomalyMaxSpeed if nil
+	MaxEntries  *int     // DefaultAnomalyMaxEntries if nil; the oldest entries are not read beyond it
+}
+
+// AnomalyReport is the result of GetAnomalies.
+type AnomalyReport struct {
+	Users []UserAnomalies `json:"users"` // Highest score first
+	// Truncated is set if MaxEntries was reached before the start of the NDays, so that the
+	// baselines were learnt from the entries since From only.
+	Truncated bool      `json:"truncated"`
+	From      time.Time `json:"from"` // Start of the history read
+}
+
+// Anomaly is a departure of a user's recent entries from the user's baseline.
+type Anomaly struct {
+	Kind      string       `json:"kind"`
+	Score     float64      `json:"score"` // From 0 to 1
+	Reason    string       `json:"reason"`
+	Locations []IPLocation `json:"locations,omitempty"` // Locations of the IP addresses of the evidence, for new_country and impossible_travel
+	Evidence  []LogEntry   `json:"evidence"`            // The recent entries which are anomalous, latest first
+}
+
+// UserAnomalies holds the anomalies of a user, with a score combining theirs.
+type UserAnomalies struct {
+	Who       string    `json:"who"`
+	Score     float64   `json:"score"` // 1 - (1 - s1)(1 - s2)...: the higher, the more anomalies and the stronger
+	Anomalies []Anomaly `json:"anomalies"`
+}
+
+// GetAnomalies compares the recent entries of each user (who) of an app with the entries of
+// the user's previous days, and reports the users with anomalies, highest score first:
+//   - new_country: an entry from a country the user had no entries from (needs geoLiteDb)
+//   - impossible_travel: consecutive entries from places too far apart for the time between
+//     them (needs geoLiteDb)
+//   - unusual_hour: entries at hours of the day the user is rarely active at
+//   - change_spike: many more data-change entries than the user's usual rate
+//
+// geoLiteDb may be nil, in which case the checks of locations are skipped.
+// It queries the realm of queryToken with a QueryClient; see QueryClient.GetAnomalies.
+func GetAnomalies(queryToken string, client *elasticsearch.TypedClient, geoLiteDb *geoip2.Reader, param GetAnomaliesParam) (AnomalyReport, error) {
+	qc, err := NewQueryClientForToken(queryToken, client)
+	if err != nil {
+		return AnomalyReport{}, err
+	}
+	return qc.GetAnomalies(context.Background(), geoLiteDb, param)
+}
+
+// anomalyConfig holds the validated parameters of a detection.
+type anomalyConfig struct {
+	recentStart time.Time
+	baseline    time.Duration // Length of the baseline period, before recentStart
+	recent      time.Duration
+	loginOp     *string
+	location    *time.Location
+	maxSpeed    float64
+}
+
+// GetAnomalies compares the recent entries of each user with the user's baseline; see the
+// GetAnomalies function.
+func (qc *QueryClient) GetAnomalies(ctx context.Context, geoLiteDb *geoip2.Reader, param GetAnomaliesParam) (AnomalyReport, error) {
+	nDays, recentHours, maxEntries := DefaultAnomalyDays, DefaultAnomalyRecentHours, DefaultAnomalyMaxEntries
+	if param.NDays != nil {
+		nDays = *param.NDays
+	}
+	if param.RecentHours != nil {
+		recentHours = *param.RecentHours
+	}
+	if param.MaxEntries != nil {
+		maxEntries = *param.MaxEntries
+	}
+	cfg := anomalyConfig{loginOp: param.LoginOp, location: time.UTC, maxSpeed: DefaultAnomalyMaxSpeed}
+	if param.MaxSpeed != nil {
+		cfg.maxSpeed = *param.MaxSpeed
+	}
+	if recentHours <= 0 || nDays*24 <= recentHours || maxEntries <= 0 || cfg.maxSpeed <= 0 {
+		return AnomalyReport{}, fmt.Errorf("%w: RecentHours, NDays, MaxSpeed and MaxEntries must be positive, with NDays longer than RecentHours", ErrInvalidAnomalyParam)
+	}
+	if param.TimeZone != nil {
+		loc, err := time.LoadLocation(*param.TimeZone)
+		if err != nil {
+			return AnomalyReport{}, fmt.Errorf("%w: time zone %q", ErrInvalidAnomalyParam, *param.TimeZone)
+		}
+		cfg.location = loc
+	}
+	now := time.Now().UTC()
+	from := now.Add(-time.Duration(nDays) * 24 * time.Hour)
+	cfg.recent = time.Duration(recentHours) * time.Hour
+	cfg.recentStart = now.Add(-cfg.recent)
+	cfg.baseline = cfg.recentStart.Sub(from)
+
+	// Entries are read latest first, so that the oldest are left out beyond maxEntries
+	batchSize := min(anomalyBatchSize, maxEntries)
+	logParam := GetLogsParam{App: param.App, Who: param.Who, FromTS: &from, PageSize: &batchSize}
+	var entries []LogEntry
+	report := AnomalyReport{From: from}
+	for {
+		page, err := qc.GetLogsPage(ctx, logParam)
+		if err != nil {
+			return AnomalyReport{}, err
+		}
+		entries = append(entries, page.Entries...)
+		if page.NextCursor == "" {
+			break
+		}
+		if len(entries) >= maxEntries {
+			_ = qc.ReleaseCursor(ctx, page.NextCursor)
+			report.Truncated = true
+			break
+		}
+		logParam.Cursor = &page.NextCursor
+	}
+	if report.Truncated {
+		// The baselines only cover the entries read, so rates are taken over their period
+		report.From = entries[len(entries)-1].When.UTC()
+		cfg.baseline = cfg.recentStart.Sub(report.From)
+	}
+
+	var locate func(ip string) (IPLocation, string, bool)
+	if geoLiteDb != nil {
+		locate = func(ip string) (IPLocation, string, bool) {
+			return geoLocate(ip, geoLiteDb)
+		}
+	}
+	report.Users = detectAnomalies(entries, locate, cfg)
+	return report, nil
+}
+
+// geoLocate returns the location of an IP address and the ISO code of its country, if the
+// GeoLite database has them.
+func geoLocate(ip string, geoLiteDb *geoip2.Reader) (IPLocation, string, bool) {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return IPLocation{}, "", false
+	}
+	record, err := geoLiteDb.City(parsed)
+	if err != nil || record.Country.IsoCode == "" {
+		return IPLocation{}, "", false
+	}
+	return IPLocation{
+		IPAddress: ip,
+		City:      record.City.Names[DEFAULT_LOCALE],
+		Country:   record.Country.Names[DEFAULT_LOCALE],
+		Latitude:  record.Location.Latitude,
+		Longitude: record.Location.Longitude,
+	}, record.Country.IsoCode, true
+}
+
+// locatedEntry is an entry with the location of its remote IP.
+type locatedEntry struct {
+	entry    *LogEntry
+	location IPLocation
+	country  string
+}
+
+// detectAnomalies runs the detectors over the entries of each user. locate returns the
+// location and country code of an IP address; the location checks are skipped if it is nil.
+func detectAnomalies(entries []LogEntry, locate func(ip string) (IPLocation, string, bool), cfg anomalyConfig) []UserAnomalies {
+	byWho := make(map[string][]*LogEntry)
+	for i := range entries {
+		if e := &entries[i]; e.Who != "" {
+			byWho[e.Who] = append(byWho[e.Who], e)
+		}
+	}
+
+	var located map[string]locatedEntry
+	if locate != nil {
+		located = make(map[string]locatedEntry)
+	}
+	result := []UserAnomalies{}
+	for who, userEntries := range byWho {
+		sort.SliceStable(userEntries, func(i, j int) bool { return userEntries[i].When.Before(userEntries[j].When) })
+		var anomalies []Anomaly
+		if locate != nil {
+			var logins []locatedEntry
+			for _, e := range userEntries {
+				if e.RemoteIP == "" || cfg.loginOp != nil && e.Op != *cfg.loginOp {
+					continue
+				}
+				l, ok := located[e.RemoteIP]
+				if !ok {
+					// Addresses which cannot be located have no country, and are skipped
+					l.location, l.country, _ = locate(e.RemoteIP)
+					located[e.RemoteIP] = l
+				}
+				if l.country != "" {
+					logins = append(logins, locatedEntry{entry: e, location: l.location, country: l.country})
+				}
+			}
+			anomalies = append(anomalies, newCountries(logins, cfg)...)
+			anomalies = append(anomalies, impossibleTravels(logins, cfg)...)
+		}
+		if a, ok := unusualHours(userEntries, cfg); ok {
+			anomalies = append(anomalies, a)
+		}
+		if a, ok := changeSpike(userEntries, cfg); ok {
+			anomalies = append(anomalies, a)
+		}
+		if len(anomalies) == 0 {
+			continue
+		}
+
+		sort.SliceStable(anomalies, func(i, j int) bool { return anomalies[i].Score > anomalies[j].Score })
+		normal := 1.0
+		for _, a := range anomalies {
+			normal *= 1 - a.Score
+		}
+		result = append(result, UserAnomalies{Who: who, Score: roundScore(1 - normal), Anomalies: anomalies})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Score != result[j].Score {
+			return result[i].Score > result[j].Score
+		}
+		return result[i].Who < result[j].Who
+	})
+	return result
+}
+
+// newCountries returns an anomaly for each country of the recent logins the user has no
+// earlier login from.
+func newCountries(logins []locatedEntry, cfg anomalyConfig) []Anomaly {
+	known := make(map[string]bool)
+	var baseline int
+	for _, l := range logins {
+		if l.entry.When.Before(cfg.recentStart) {
+			known[l.country] = true
+			baseline++
+		}
+	}
+	if baseline < anomalyMinBaseline {
+		return nil
+	}
+	byCountry := make(map[string][]locatedEntry)
+	var countries []string
+	for _, l := range logins {
+		if l.entry.When.Before(cfg.recentStart) || known[l.country] {
+			continue
+		}
+		if _, ok := byCountry[l.country]; !ok {
+			countries = append(countries, l.country)
+		}
+		byCountry[l.country] = append(byCountry[l.country], l)
+	}
+	anomalies := make([]Anomaly, 0, len(countries))
+	for _, country := range countries {
+		ls := byCountry[country]
+		// The more countries the user is known to log in from, the less a new one stands out
+		score := 0.8 / math.Sqrt(float64(len(known)))
+		anomalies = append(anomalies, Anomaly{
+			Kind:  AnomalyNewCountry,
+			Score: roundScore(max(score, 0.3)),
+			Reason: fmt.Sprintf("%d entries from %s, a country without entries in the %d before (from %d countries)",
+				len(ls), ls[0].location.Country, baseline, len(known)),
+			Locations: evidenceLocations(ls),
+			Evidence:  evidence(ls),
+		})
+	}
+	return anomalies
+}
+
+// impossibleTravels returns an anomaly for each recent login too far from the previous one for
+// the time between them.
+func impossibleTravels(logins []locatedEntry, cfg anomalyConfig) []Anomaly {
+	var anomalies []Anomaly
+	for i := 1; i < len(logins); i++ {
+		prev, cur := logins[i-1], logins[i]
+		if cur.entry.When.Before(cfg.recentStart) || prev.entry.RemoteIP == cur.entry.RemoteIP {
+			continue
+		}
+		km := haversineKm(prev.location, cur.location)
+		if km < anomalyMinTravelKm {
+			continue
+		}
+		hours := cur.entry.When.Sub(prev.entry.When).Hours()
+		speed := math.Inf(1)
+		if hours > 0 {
+			speed = km / hours
+		}
+		if speed <= cfg.maxSpeed {
+			continue
+		}
+		ls := []locatedEntry{prev, cur}
+		anomalies = append(anomalies, Anomaly{
+			Kind:  AnomalyImpossibleTravel,
+			Score: roundScore(0.6 + 0.4*(1-cfg.maxSpeed/speed)),
+			Reason: fmt.Sprintf("%.0f km from %s to %s in %s",
+				km, placeName(prev.location), placeName(cur.location), cur.entry.When.Sub(prev.entry.When).Round(time.Second)),
+			Locations: evidenceLocations(ls),
+			Evidence:  evidence(ls),
+		})
+	}
+	return anomalies
+}
+
+// unusualHours returns an anomaly for the recent entries at hours of the day which have less
+// than anomalyRareHourShare of the user's earlier entries.
+func unusualHours(entries []*LogEntry, cfg anomalyConfig) (Anomaly, bool) {
+	var hours [24]int
+	var baseline int
+	for _, e := range entries {
+		if e.When.Before(cfg.recentStart) {
+			hours[e.When.In(cfg.location).Hour()]++
+			baseline++
+		}
+	}
+	if baseline < anomalyMinHourlyBase {
+		return Anomaly{}, false
+	}
+	var unusual []locatedEntry
+	rarest := 1.0
+	rareHours := make(map[int]bool)
+	for _, e := range entries {
+		if e.When.Before(cfg.recentStart) {
+			continue
+		}
+		hour := e.When.In(cfg.location).Hour()
+		share := float64(hours[hour]) / float64(baseline)
+		if share < anomalyRareHourShare {
+			unusual = append(unusual, locatedEntry{entry: e})
+			rareHours[hour] = true
+			rarest = min(rarest, share)
+		}
+	}
+	if len(unusual) == 0 {
+		return Anomaly{}, false
+	}
+	hourList := make([]int, 0, len(rareHours))
+	for h := range rareHours {
+		hourList = append(hourList, h)
+	}
+	sort.Ints(hourList)
+	return Anomaly{
+		Kind: AnomalyUnusualHour,
+		// 0.6 for hours never seen before, down to 0.3 for hours at the threshold
+		Score: roundScore(0.6 - 0.3*rarest/anomalyRareHourShare),
+		Reason: fmt.Sprintf("%d entries at hours %v (%s), which had %.1f%% or less of the %d entries before",
+			len(unusual), hourList, cfg.location, 100*rarest, baseline),
+		Evidence: evidence(unusual),
+	}, true
+}
+
+// changeSpike returns an anomaly if the user has many more recent data-change entries than
+// the user's rate before would give. There is no rate if no entries before the recent hours
+// were read.
+func changeSpike(entries []*LogEntry, cfg anomalyConfig) (Anomaly, bool) {
+	var baseline int
+	var recent []locatedEntry
+	for _, e := range entries {
+		if e.Type != Change {
+			continue
+		}
+		if e.When.Before(cfg.recentStart) {
+			baseline++
+		} else {
+			recent = append(recent, locatedEntry{entry: e})
+		}
+	}
+	if len(recent) < anomalyMinChanges || cfg.baseline <= 0 {
+		return Anomaly{}, false
+	}
+	// A user without changes before is expected to make at most one
+	expected := max(float64(baseline)*cfg.recent.Hours()/cfg.baseline.Hours(), 1)
+	ratio := float64(len(recent)) / expected
+	if ratio < anomalySpikeRatio {
+		return Anomaly{}, false
+	}
+	return Anomaly{
+		Kind:  AnomalyChangeSpike,
+		Score: roundScore(min(1, 0.5+0.1*math.Log2(ratio))),
+		Reason: fmt.Sprintf("%d data-change entries in the last %s, %.1f times the %.1f expected from the %d before",
+			len(recent), cfg.recent, ratio, expected, baseline),
+		Evidence: evidence(recent),
+	}, true
+}
+
+// evidence returns the latest anomalyMaxEvidence entries of ls, latest first.
+func evidence(ls []locatedEntry) []LogEntry {
+	n := min(len(ls), anomalyMaxEvidence)
+	entries := make([]LogEntry, 0, n)
+	for i := len(ls) - 1; i >= len(ls)-n; i-- {
+		entries = append(entries, *ls[i].entry)
+	}
+	return entries
+}
+
+// evidenceLocations returns the distinct locations of the evidence of ls.
+func evidenceLocations(ls []locatedEntry) []IPLocation {
+	var locations []IPLocation
+	seen := make(map[string]bool)
+	for i := len(ls) - 1; i >= 0 && i >= len(ls)-anomalyMaxEvidence; i-- {
+		if l := ls[i].location; !seen[l.IPAddress] {
+			seen[l.IPAddress] = true
+			locations = append(locations, l)
+		}
+	}
+	return locations
+}
+
+// placeName returns the city and country of a location, or the country if the city is unknown.
+func placeName(l IPLocation) string {
+	if l.City == "" {
+		return l.Country
+	}
+	return l.City + ", " + l.Country
+}
+
+// haversineKm returns the great-circle distance between two locations in km.
+func haversineKm(a, b IPLocation) float64 {
+	const earthRadiusKm = 6371
+	rad := func(deg float64) float64 { return deg * math.Pi / 180 }
+	dLat, dLon := rad(b.Latitude-a.Latitude), rad(b.Longitude-a.Longitude)
+	h := math.Pow(math.Sin(dLat/2), 2) + math.Cos(rad(a.Latitude))*math.Cos(rad(b.Latitude))*math.Pow(math.Sin(dLon/2), 2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(h))
+}
+
+// roundScore rounds a score to two decimals.
+func roundScore(score float64) float64 {
+	return math.Round(score*100) / 100
+}
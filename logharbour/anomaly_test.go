@@ -0,0 +1,137 @@
+package logharbour
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDetectAnomalies(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	cfg := anomalyConfig{
+		recentStart: now.Add(-24 * time.Hour), baseline: 29 * 24 * time.Hour, recent: 24 * time.Hour,
+		location: time.UTC, maxSpeed: DefaultAnomalyMaxSpeed,
+	}
+	places := map[string]struct {
+		location IPLocation
+		country  string
+	}{
+		"10.0.0.1": {IPLocation{IPAddress: "10.0.0.1", City: "Mumbai", Country: "India", Latitude: 19.07, Longitude: 72.87}, "IN"},
+		"10.0.0.2": {IPLocation{IPAddress: "10.0.0.2", City: "Pune", Country: "India", Latitude: 18.52, Longitude: 73.85}, "IN"},
+		"10.0.0.9": {IPLocation{IPAddress: "10.0.0.9", City: "Berlin", Country: "Germany", Latitude: 52.52, Longitude: 13.40}, "DE"},
+	}
+	locate := func(ip string) (IPLocation, string, bool) {
+		p, ok := places[ip]
+		return p.location, p.country, ok
+	}
+
+	var entries []LogEntry
+	add := func(who, ip string, when time.Time, logType LogType) {
+		entries = append(entries, LogEntry{Id: who + when.Format(time.RFC3339), Who: who, RemoteIP: ip, When: when, Type: logType, Op: "login"})
+	}
+	for day := 2; day < 28; day++ {
+		// alice logs in from Mumbai or Pune at 10:00 and carol from Pune at 09:00, every day
+		ip := "10.0.0.1"
+		if day%2 == 0 {
+			ip = "10.0.0.2"
+		}
+		add("alice", ip, now.Add(-time.Duration(day)*24*time.Hour).Truncate(24*time.Hour).Add(10*time.Hour), Activity)
+		add("carol", "10.0.0.2", now.Add(-time.Duration(day)*24*time.Hour).Truncate(24*time.Hour).Add(9*time.Hour), Activity)
+		if day%7 == 0 {
+			add("bob", "", now.Add(-time.Duration(day)*24*time.Hour), Change)
+		}
+	}
+	// Recently, alice logs in from Mumbai, then from Berlin 30 minutes later at 03:00
+	add("alice", "10.0.0.1", time.Date(2026, 3, 1, 2, 30, 0, 0, time.UTC), Activity)
+	add("alice", "10.0.0.9", time.Date(2026, 3, 1, 3, 0, 0, 0, time.UTC), Activity)
+	add("carol", "10.0.0.2", time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC), Activity)
+	// and bob makes 40 changes in an hour, against 3 in the month before
+	for i := 0; i < 40; i++ {
+		add("bob", "", now.Add(-time.Hour+time.Duration(i)*time.Minute), Change)
+	}
+
+	users := detectAnomalies(entries, locate, cfg)
+	if len(users) != 2 || users[0].Who != "alice" || users[1].Who != "bob" {
+		t.Fatalf("users = %+v", users)
+	}
+	kinds := make(map[string]Anomaly)
+	for _, a := range users[0].Anomalies {
+		kinds[a.Kind] = a
+	}
+	if a := kinds[AnomalyNewCountry]; len(a.Evidence) != 1 || a.Evidence[0].RemoteIP != "10.0.0.9" || a.Locations[0].Country != "Germany" {
+		t.Errorf("new country = %+v", a)
+	}
+	if a := kinds[AnomalyImpossibleTravel]; len(a.Evidence) != 2 || a.Score < 0.9 || !strings.Contains(a.Reason, "from Mumbai, India to Berlin, Germany in 30m0s") {
+		t.Errorf("impossible travel = %+v", a)
+	}
+	if a := kinds[AnomalyUnusualHour]; len(a.Evidence) != 2 || a.Score != 0.6 || !strings.Contains(a.Reason, "hours [2 3]") {
+		t.Errorf("unusual hour = %+v", a)
+	}
+	if users[0].Score <= kinds[AnomalyImpossibleTravel].Score || users[0].Score > 1 {
+		t.Errorf("combined score %v", users[0].Score)
+	}
+
+	if a := users[1].Anomalies; len(a) != 1 || a[0].Kind != AnomalyChangeSpike || len(a[0].Evidence) != anomalyMaxEvidence ||
+		!a[0].Evidence[0].When.Equal(now.Add(-time.Hour+39*time.Minute)) || a[0].Score != 1 {
+		t.Errorf("change spike = %+v", a)
+	}
+
+	// Without a GeoLite database, only the hours and changes are checked
+	users = detectAnomalies(entries, nil, cfg)
+	if len(users) != 2 || len(users[1].Anomalies) != 1 || users[1].Anomalies[0].Kind != AnomalyUnusualHour {
+		t.Errorf("users without locations = %+v", users)
+	}
+}
+
+func TestQueryClient_GetAnomalies(t *testing.T) {
+	f, client := newFakeSearchServer(t, fakeExportPage2)
+	qc := NewQueryClient(client, "logharbour_acme")
+	appName, days, zone := "billing", 1, "Mars/Olympus"
+
+	if _, err := qc.GetAnomalies(context.Background(), nil, GetAnomaliesParam{App: &appName, NDays: &days}); !errors.Is(err, ErrInvalidAnomalyParam) {
+		t.Errorf("expected ErrInvalidAnomalyParam for a history no longer than the recent hours, got %v", err)
+	}
+	if _, err := qc.GetAnomalies(context.Background(), nil, GetAnomaliesParam{App: &appName, TimeZone: &zone}); !errors.Is(err, ErrInvalidAnomalyParam) {
+		t.Errorf("expected ErrInvalidAnomalyParam for an unknown time zone, got %v", err)
+	}
+
+	report, err := qc.GetAnomalies(context.Background(), nil, GetAnomaliesParam{App: &appName})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Users) != 0 || report.Truncated {
+		t.Errorf("expected no anomalies for entries without who, got %+v", report)
+	}
+	if len(f.requests) != 1 || f.requests[0]["size"] != float64(anomalyBatchSize) {
+		t.Errorf("requests = %v", f.requests)
+	}
+
+	// A full page at MaxEntries cuts the history short at its oldest entry
+	maxEntries := 1
+	report, err = qc.GetAnomalies(context.Background(), nil, GetAnomaliesParam{App: &appName, MaxEntries: &maxEntries})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Truncated || !report.From.Equal(time.Date(2025, 12, 31, 23, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected a history truncated at the entry read, got %+v", report)
+	}
+}
+
+func TestChangeSpike_NoBaselinePeriod(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	cfg := anomalyConfig{recentStart: now.Add(-24 * time.Hour), recent: 24 * time.Hour, location: time.UTC}
+	var entries []*LogEntry
+	for i := 0; i < 40; i++ {
+		entries = append(entries, &LogEntry{Who: "bob", Type: Change, When: now.Add(-time.Duration(i) * time.Minute)})
+	}
+	// When truncation leaves no entries before the recent hours, there is no rate to compare with
+	if a, ok := changeSpike(entries, cfg); ok {
+		t.Errorf("unexpected change spike without a baseline period: %+v", a)
+	}
+	cfg.baseline = 24 * time.Hour
+	if _, ok := changeSpike(entries, cfg); !ok {
+		t.Error("expected a change spike against an empty baseline of a day")
+	}
+}
@@ -0,0 +1,330 @@
+package logharbour
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultAsyncQueueSize = 10000
+	defaultAsyncWorkers   = 1
+	asyncFlushPollPeriod  = 5 * time.Millisecond
+)
+
+var (
+	// ErrAsyncWriterClosed is returned by AsyncWriter.Write after Close has been called.
+	ErrAsyncWriterClosed = errors.New("async writer is closed")
+	// ErrFlushTimeout is returned by AsyncWriter.Flush and AsyncWriter.Close when the
+	// queue could not be drained before the deadline.
+	ErrFlushTimeout = errors.New("timed out waiting for async writer to drain")
+)
+
+// OverflowPolicy decides what AsyncWriter.Write does when the queue is full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock makes Write wait until there is room in the queue.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropNewest discards the entry being written.
+	OverflowDropNewest
+	// OverflowDropOldest discards the oldest queued entry to make room for the new one.
+	OverflowDropOldest
+	// OverflowDropBelowPriority discards the entry being written if its priority is below
+	// the threshold set with WithDropBelowPriority, and otherwise blocks like OverflowBlock.
+	OverflowDropBelowPriority
+)
+
+// AsyncWriterStats holds the counters of an AsyncWriter.
+type AsyncWriterStats struct {
+	Enqueued uint64 // Entries accepted into the queue.
+	Written  uint64 // Entries successfully written to the underlying writer.
+	Dropped  uint64 // Entries discarded because of the overflow policy or a drain deadline.
+	Failed   uint64 // Entries for which the underlying writer returned an error.
+}
+
+// AsyncWriter is an io.Writer which queues log entries in a bounded in-memory queue
+// and writes them to an underlying writer (typically a KafkaWriter or FallbackWriter)
+// from background goroutines. This keeps a slow underlying writer off the request path
+// of the application.
+//
+// Write copies the entry into the queue and returns immediately, unless the queue is full,
+// in which case the OverflowPolicy decides whether it blocks or drops an entry. Dropped
+// entries are not reported as errors to the caller; use Stats to monitor them.
+// Errors from the underlying writer are counted in Stats and passed to the error handler,
+// which writes them to stderr by default.
+//
+// With more than one worker, entries may reach the underlying writer out of order.
+//
+// Example:
+//
+//	kw, _ := logharbour.NewKafkaWriter(kafkaConfig)
+//	aw := logharbour.NewAsyncWriter(logharbour.NewFallbackWriter(kw, os.Stdout),
+//		logharbour.WithAsyncQueueSize(50000),
+//		logharbour.WithOverflowPolicy(logharbour.OverflowDropOldest))
+//	defer aw.Close(5 * time.Second)
+//	logger := logharbour.NewLogger(lctx, "billing", aw)
+type AsyncWriter struct {
+	writer       io.Writer
+	queue        chan []byte
+	policy       OverflowPolicy
+	dropBelow    LogPriority
+	workers      int
+	errorHandler func(err error, p []byte)
+
+	mu      sync.RWMutex // Held for reading while enqueueing, and for writing while closing.
+	closed  bool
+	done    chan struct{} // Closed by Close to tell workers to drain and exit.
+	abort   int32         // atomic, set when Close times out so workers stop writing
+	wg      sync.WaitGroup
+	pending int64 // atomic, entries enqueued but not yet written, failed or dropped
+
+	closeOnce sync.Once
+	closeErr  error // Result of the first Close
+
+	enqueued uint64 // atomic
+	written  uint64 // atomic
+	dropped  uint64 // atomic
+	failed   uint64 // atomic
+}
+
+// AsyncWriterOption configures an AsyncWriter.
+type AsyncWriterOption func(*AsyncWriter)
+
+// WithAsyncQueueSize sets the maximum number of entries held in the queue.
+func WithAsyncQueueSize(size int) AsyncWriterOption {
+	return func(aw *AsyncWriter) {
+		if size > 0 {
+			aw.queue = make(chan []byte, size)
+		}
+	}
+}
+
+// WithAsyncWorkers sets the number of goroutines writing to the underlying writer.
+func WithAsyncWorkers(n int) AsyncWriterOption {
+	return func(aw *AsyncWriter) {
+		if n > 0 {
+			aw.workers = n
+		}
+	}
+}
+
+// WithOverflowPolicy sets the policy applied when the queue is full.
+func WithOverflowPolicy(policy OverflowPolicy) AsyncWriterOption {
+	return func(aw *AsyncWriter) {
+		aw.policy = policy
+	}
+}
+
+// WithDropBelowPriority sets the OverflowDropBelowPriority policy with the given threshold.
+// When the queue is full, entries with a priority below pri are dropped and the others block.
+func WithDropBelowPriority(pri LogPriority) AsyncWriterOption {
+	return func(aw *AsyncWriter) {
+		aw.policy = OverflowDropBelowPriority
+		aw.dropBelow = pri
+	}
+}
+
+// WithAsyncErrorHandler sets the function called when the underlying writer returns an error.
+func WithAsyncErrorHandler(handler func(err error, p []byte)) AsyncWriterOption {
+	return func(aw *AsyncWriter) {
+		aw.errorHandler = handler
+	}
+}
+
+// NewAsyncWriter creates an AsyncWriter writing to w and starts its background workers.
+// By default the queue holds 10000 entries, one worker is used and Write blocks when the queue is full.
+func NewAsyncWriter(w io.Writer, opts ...AsyncWriterOption) *AsyncWriter {
+	aw := &AsyncWriter{
+		writer:  w,
+		queue:   make(chan []byte, defaultAsyncQueueSize),
+		policy:  OverflowBlock,
+		workers: defaultAsyncWorkers,
+		done:    make(chan struct{}),
+		errorHandler: func(err error, p []byte) {
+			fmt.Fprintf(os.Stderr, "Error: %v, LogEntry: %s", err, p)
+		},
+	}
+	for _, opt := range opts {
+		opt(aw)
+	}
+	for i := 0; i < aw.workers; i++ {
+		aw.wg.Add(1)
+		go aw.work()
+	}
+	return aw
+}
+
+// Write queues a copy of p for writing by the background workers. It implements io.Writer.
+func (aw *AsyncWriter) Write(p []byte) (n int, err error) {
+	entry := make([]byte, len(p))
+	copy(entry, p)
+
+	aw.mu.RLock()
+	defer aw.mu.RUnlock()
+	if aw.closed {
+		return 0, ErrAsyncWriterClosed
+	}
+
+	atomic.AddInt64(&aw.pending, 1)
+	if aw.enqueue(entry) {
+		atomic.AddUint64(&aw.enqueued, 1)
+	} else {
+		atomic.AddInt64(&aw.pending, -1)
+		atomic.AddUint64(&aw.dropped, 1)
+	}
+	return len(p), nil
+}
+
+// enqueue puts the entry in the queue according to the overflow policy.
+// It returns false if the entry was dropped.
+func (aw *AsyncWriter) enqueue(entry []byte) bool {
+	select {
+	case aw.queue <- entry:
+		return true
+	default:
+	}
+
+	switch aw.policy {
+	case OverflowDropNewest:
+		return false
+	case OverflowDropOldest:
+		for {
+			select {
+			case aw.queue <- entry:
+				return true
+			default:
+			}
+			select {
+			case <-aw.queue:
+				atomic.AddInt64(&aw.pending, -1)
+				atomic.AddUint64(&aw.dropped, 1)
+			default:
+			}
+		}
+	case OverflowDropBelowPriority:
+		if entryPriority(entry) < aw.dropBelow {
+			return false
+		}
+	}
+	aw.queue <- entry
+	return true
+}
+
+// entryPriority extracts the priority from a JSON-encoded LogEntry.
+// Entries whose priority cannot be determined are treated as the highest priority
+// so that they are never dropped for being unimportant.
+func entryPriority(entry []byte) LogPriority {
+	var e struct {
+		Pri LogPriority `json:"pri"`
+	}
+	if err := json.Unmarshal(entry, &e); err != nil || e.Pri == 0 {
+		return Sec
+	}
+	return e.Pri
+}
+
+// work writes queued entries to the underlying writer until Close is called,
+// and then drains what is left in the queue.
+func (aw *AsyncWriter) work() {
+	defer aw.wg.Done()
+	for {
+		select {
+		case entry := <-aw.queue:
+			aw.writeEntry(entry)
+		case <-aw.done:
+			for {
+				select {
+				case entry := <-aw.queue:
+					aw.writeEntry(entry)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// writeEntry writes a single entry to the underlying writer and updates the counters.
+func (aw *AsyncWriter) writeEntry(entry []byte) {
+	defer atomic.AddInt64(&aw.pending, -1)
+	if atomic.LoadInt32(&aw.abort) == 1 {
+		atomic.AddUint64(&aw.dropped, 1)
+		return
+	}
+	if _, err := aw.writer.Write(entry); err != nil {
+		atomic.AddUint64(&aw.failed, 1)
+		if aw.errorHandler != nil {
+			aw.errorHandler(err, entry)
+		}
+		return
+	}
+	atomic.AddUint64(&aw.written, 1)
+}
+
+// Flush waits until every entry queued so far has been handed to the underlying writer,
+// or until the timeout expires, in which case it returns ErrFlushTimeout.
+func (aw *AsyncWriter) Flush(timeout time.Duration) error {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(asyncFlushPollPeriod)
+	defer ticker.Stop()
+	for atomic.LoadInt64(&aw.pending) > 0 {
+		select {
+		case <-deadline.C:
+			return ErrFlushTimeout
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// Close stops accepting new entries and drains the queue to the underlying writer.
+// If the queue cannot be drained within the timeout, the remaining entries are dropped
+// and ErrFlushTimeout is returned. Otherwise, if the underlying writer implements io.Closer,
+// it is closed as well. Only the first call does this; later calls return its result.
+func (aw *AsyncWriter) Close(timeout time.Duration) error {
+	aw.closeOnce.Do(func() {
+		aw.closeErr = aw.close(timeout)
+	})
+	return aw.closeErr
+}
+
+func (aw *AsyncWriter) close(timeout time.Duration) error {
+	finished := make(chan struct{})
+	go func() {
+		aw.mu.Lock()
+		aw.closed = true
+		close(aw.done)
+		aw.mu.Unlock()
+		aw.wg.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+	case <-time.After(timeout):
+		atomic.StoreInt32(&aw.abort, 1)
+		return ErrFlushTimeout
+	}
+
+	if closer, ok := aw.writer.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// Stats returns a snapshot of the AsyncWriter's counters.
+func (aw *AsyncWriter) Stats() AsyncWriterStats {
+	return AsyncWriterStats{
+		Enqueued: atomic.LoadUint64(&aw.enqueued),
+		Written:  atomic.LoadUint64(&aw.written),
+		Dropped:  atomic.LoadUint64(&aw.dropped),
+		Failed:   atomic.LoadUint64(&aw.failed),
+	}
+}
@@ -0,0 +1,229 @@
+package logharbour
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// gatedWriter blocks every Write until the gate channel is closed.
+type gatedWriter struct {
+	gate chan struct{}
+	mu   sync.Mutex
+	buf  bytes.Buffer
+}
+
+func newGatedWriter() *gatedWriter {
+	return &gatedWriter{gate: make(chan struct{})}
+}
+
+func (gw *gatedWriter) Write(p []byte) (int, error) {
+	<-gw.gate
+	gw.mu.Lock()
+	defer gw.mu.Unlock()
+	return gw.buf.Write(p)
+}
+
+func (gw *gatedWriter) String() string {
+	gw.mu.Lock()
+	defer gw.mu.Unlock()
+	return gw.buf.String()
+}
+
+func entryWithPriority(t *testing.T, msg string, pri LogPriority) []byte {
+	t.Helper()
+	b, err := json.Marshal(LogEntry{Id: msg, Msg: msg, Pri: pri})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append(b, '\n')
+}
+
+func TestAsyncWriter_WritesThroughLogger(t *testing.T) {
+	var buf bytes.Buffer
+	aw := NewAsyncWriter(&buf)
+	logger := NewLogger(NewLoggerContext(Info), "TestApp", aw)
+
+	logger.Log("first")
+	logger.Log("second")
+
+	if err := aw.Close(time.Second); err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+	if !strings.Contains(buf.String(), "first") || !strings.Contains(buf.String(), "second") {
+		t.Errorf("expected both entries to be written, got %s", buf.String())
+	}
+	stats := aw.Stats()
+	if stats.Enqueued != 2 || stats.Written != 2 || stats.Dropped != 0 || stats.Failed != 0 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+	if _, err := aw.Write([]byte("late")); !errors.Is(err, ErrAsyncWriterClosed) {
+		t.Errorf("expected ErrAsyncWriterClosed after Close, got %v", err)
+	}
+}
+
+func TestAsyncWriter_OverflowPolicies(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        []AsyncWriterOption
+		wantWritten []string
+		wantDropped uint64
+	}{
+		{
+			name:        "drop newest",
+			opts:        []AsyncWriterOption{WithOverflowPolicy(OverflowDropNewest)},
+			wantWritten: []string{"e0", "e1", "e2"},
+			wantDropped: 2,
+		},
+		{
+			name:        "drop oldest",
+			opts:        []AsyncWriterOption{WithOverflowPolicy(OverflowDropOldest)},
+			wantWritten: []string{"e0", "e3", "e4"},
+			wantDropped: 2,
+		},
+		{
+			name:        "drop below priority",
+			opts:        []AsyncWriterOption{WithDropBelowPriority(Err)},
+			wantWritten: []string{"e0", "e1", "e2"},
+			wantDropped: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gw := newGatedWriter()
+			aw := NewAsyncWriter(gw, append(tt.opts, WithAsyncQueueSize(2))...)
+
+			// e0 is taken by the worker, which then blocks on the gate; e1 and e2 fill the queue.
+			aw.Write(entryWithPriority(t, "e0", Info))
+			time.Sleep(20 * time.Millisecond)
+			aw.Write(entryWithPriority(t, "e1", Info))
+			aw.Write(entryWithPriority(t, "e2", Info))
+			aw.Write(entryWithPriority(t, "e3", Info))
+			aw.Write(entryWithPriority(t, "e4", Info))
+
+			close(gw.gate)
+			if err := aw.Close(time.Second); err != nil {
+				t.Fatalf("Close returned error: %v", err)
+			}
+
+			out := gw.String()
+			for _, msg := range tt.wantWritten {
+				if !strings.Contains(out, `"msg":"`+msg+`"`) {
+					t.Errorf("expected %s to be written, got %s", msg, out)
+				}
+			}
+			if stats := aw.Stats(); stats.Dropped != tt.wantDropped {
+				t.Errorf("expected %d dropped entries, got %+v", tt.wantDropped, stats)
+			}
+		})
+	}
+}
+
+func TestAsyncWriter_DropBelowPriorityKeepsImportantEntries(t *testing.T) {
+	gw := newGatedWriter()
+	aw := NewAsyncWriter(gw, WithAsyncQueueSize(1), WithDropBelowPriority(Err))
+
+	aw.Write(entryWithPriority(t, "e0", Info))
+	time.Sleep(20 * time.Millisecond)
+	aw.Write(entryWithPriority(t, "e1", Info))
+
+	written := make(chan struct{})
+	go func() {
+		aw.Write(entryWithPriority(t, "crit", Crit))
+		close(written)
+	}()
+	select {
+	case <-written:
+		t.Fatal("expected Write of a Crit entry to block while the queue is full")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(gw.gate)
+	<-written
+	if err := aw.Close(time.Second); err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+	if !strings.Contains(gw.String(), `"msg":"crit"`) {
+		t.Errorf("expected Crit entry to be written, got %s", gw.String())
+	}
+}
+
+func TestAsyncWriter_FailedWrites(t *testing.T) {
+	var handled int
+	aw := NewAsyncWriter(&FailWriter{}, WithAsyncErrorHandler(func(err error, p []byte) {
+		handled++
+	}))
+
+	aw.Write([]byte("entry\n"))
+	if err := aw.Flush(time.Second); err != nil {
+		t.Fatalf("Flush returned error: %v", err)
+	}
+	aw.Close(time.Second)
+
+	if stats := aw.Stats(); stats.Failed != 1 || stats.Written != 0 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+	if handled != 1 {
+		t.Errorf("expected error handler to be called once, got %d", handled)
+	}
+}
+
+func TestAsyncWriter_CloseTimeout(t *testing.T) {
+	gw := newGatedWriter()
+	aw := NewAsyncWriter(gw)
+
+	aw.Write([]byte("stuck\n"))
+	aw.Write([]byte("queued\n"))
+
+	if err := aw.Flush(20 * time.Millisecond); !errors.Is(err, ErrFlushTimeout) {
+		t.Errorf("expected ErrFlushTimeout from Flush, got %v", err)
+	}
+	if err := aw.Close(20 * time.Millisecond); !errors.Is(err, ErrFlushTimeout) {
+		t.Errorf("expected ErrFlushTimeout from Close, got %v", err)
+	}
+
+	close(gw.gate)
+	if err := aw.Flush(time.Second); err != nil {
+		t.Fatalf("Flush returned error: %v", err)
+	}
+	if stats := aw.Stats(); stats.Written != 1 || stats.Dropped != 1 {
+		t.Errorf("expected the in-flight entry to be written and the queued one dropped, got %+v", stats)
+	}
+}
+
+// closeCountingWriter counts the calls to Close and fails all but the first.
+type closeCountingWriter struct {
+	bytes.Buffer
+	closes int
+}
+
+func (cw *closeCountingWriter) Close() error {
+	cw.closes++
+	if cw.closes > 1 {
+		return errors.New("closed twice")
+	}
+	return nil
+}
+
+func TestAsyncWriter_CloseTwice(t *testing.T) {
+	cw := &closeCountingWriter{}
+	aw := NewAsyncWriter(cw)
+	aw.Write([]byte("entry\n"))
+
+	for i := 0; i < 2; i++ {
+		if err := aw.Close(time.Second); err != nil {
+			t.Fatalf("Close %d returned error: %v", i+1, err)
+		}
+	}
+	if cw.closes != 1 {
+		t.Errorf("underlying writer closed %d times, want 1", cw.closes)
+	}
+	if cw.String() != "entry\n" {
+		t.Errorf("got %q", cw.String())
+	}
+}
@@ -2,19 +2,15 @@ package logharbour
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
-	"reflect"
 	"regexp"
 	"slices"
 	"time"
 
 	"github.com/elastic/go-elasticsearch/v8"
-	"github.com/elastic/go-elasticsearch/v8/typedapi/core/search"
-	"github.com/elastic/go-elasticsearch/v8/typedapi/some"
 	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
-	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/sortorder"
 	"github.com/oschwald/geoip2-golang"
 )
 
@@ -43,11 +39,10 @@ const (
 )
 
 var (
-	Index                     = "logharbour"
-	LOGHARBOUR_GETLOGS_MAXREC = 5
-	res                       *search.Response
-	Priority                  = []string{"Debug2", "Debug1", "Debug0", "Info", "Warn", "Err", "Crit", "Sec"}
-	requiredPri               []string
+	Priority = []string{"Debug2", "Debug1", "Debug0", "Info", "Warn", "Err", "Crit", "Sec"}
+
+	// errNoFilter is returned for a query without any filter, which would match every entry
+	errNoFilter = errors.New("no Filter param")
 )
 
 type GetLogsParam struct {
@@ -64,9 +59,15 @@ type GetLogsParam struct {
 	RemoteIP         *string
 	Priority         *LogPriority
 	SearchAfterTS    *string
-	SearchAfterDocID *string
+	SearchAfterDocID *string // Only with SearchAfterTS
 	Field            *string
 	TraceID          *string
+	PageSize         *int          // Entries per page, at most MaxPageSize; the QueryClient's page size if nil
+	Cursor           *string       // NextCursor of the previous page; replaces SearchAfterTS and SearchAfterDocID
+	Text             *string       // Text searched in msg, error and activity data: words, "phrases", prefix*, | (or), - (not), (groups)
+	Changes          *ChangeSearch // Search of the old and new values of changes
+	Highlight        bool          // Highlight the matches of Text and Changes, see LogPage.Highlights
+	Query            *string       // Query in the query language of ParseQuery
 }
 
 type GetUnusualIPParam struct {
@@ -98,17 +99,25 @@ type IPLocation struct {
 }
 
 // GetLogs retrieves an slice of logEntry from Elasticsearch based on the fields provided in logParam.
+// It queries the realm of querytoken with a QueryClient; see QueryClient.GetLogs.
 func GetLogs(querytoken string, client *elasticsearch.TypedClient, logParam GetLogsParam) ([]LogEntry, int, error) {
+	qc, err := NewQueryClientForToken(querytoken, client)
+	if err != nil {
+		return nil, 0, err
+	}
+	return qc.GetLogs(context.Background(), logParam)
+}
 
+// getLogsQuery forms the query of GetLogs from the fields provided in logParam.
+func getLogsQuery(logParam GetLogsParam) (*types.Query, error) {
 	var queries []types.Query
-	var logEntries []LogEntry
 
 	ok, ranges, err := rangeQueryForTimestamp(logParam.FromTS, logParam.ToTS, logParam.NDays)
 	if ok {
 		queries = append(queries, ranges)
 	}
 	if err != nil {
-		return nil, 0, err
+		return nil, err
 	}
 
 	if ok, app := termQueryForField(app, logParam.App); ok {
@@ -149,126 +158,40 @@ func GetLogs(querytoken string, client *elasticsearch.TypedClient, logParam GetL
 	}
 
 	if logParam.Priority != nil {
-		priStr := logParam.Priority.String()
-		priFrom := slices.Index(Priority, priStr)
-		if priFrom > 0 {
-			requiredPri = Priority[priFrom:]
-		}
-		if ok, pri := termQueryForField(pri, nil, requiredPri...); ok {
+		if ok, pri := termQueryForField(pri, nil, priorityAtLeast(*logParam.Priority)...); ok {
 			queries = append(queries, pri)
 		}
 	}
 
+	// full-text searches select entries along with the filters
+	must, err := searchQueries(logParam)
+	if err != nil {
+		return nil, err
+	}
+
 	// creating elastic search bool query
 	query := &types.Query{
 		Bool: &types.BoolQuery{
 			Filter: queries,
+			Must:   must,
 		},
 	}
 
-	if len(queries) == 0 {
-		return nil, 0, fmt.Errorf("no Filter param")
+	if len(queries) == 0 && len(must) == 0 {
+		return nil, errNoFilter
 	}
-
-	// sorting record on base of when
-	sortByWhen := types.SortOptions{
-		SortOptions: map[string]types.FieldSort{
-			when: {Order: &sortorder.Desc},
-			// "_doc": {Order: &sortorder.Desc},
-		},
-	}
-
-	//  calling search query when SearchAfterTS and SearchAfterDocID given
-	if logParam.SearchAfterTS != nil && logParam.SearchAfterDocID != nil {
-		res, err = client.Search().Index(Index).Request(&search.Request{
-			Size:        &LOGHARBOUR_GETLOGS_MAXREC,
-			Query:       query,
-			SearchAfter: []types.FieldValue{logParam.SearchAfterTS, logParam.SearchAfterDocID},
-			Sort:        []types.SortCombinations{sortByWhen},
-		}).Do(context.Background())
-		//  calling search query when SearchAfterTS is given
-	} else if logParam.SearchAfterTS != nil && logParam.SearchAfterDocID == nil {
-		res, err = client.Search().Index(Index).Request(&search.Request{
-			Size:        &LOGHARBOUR_GETLOGS_MAXREC,
-			Query:       query,
-			SearchAfter: []types.FieldValue{logParam.SearchAfterTS},
-			Sort:        []types.SortCombinations{sortByWhen},
-		}).Do(context.Background())
-		//  calling search query when is SearchAfterDocID
-	} else if logParam.SearchAfterTS == nil && logParam.SearchAfterDocID != nil {
-		res, err = client.Search().Index(Index).Request(&search.Request{
-			Size:        &LOGHARBOUR_GETLOGS_MAXREC,
-			Query:       query,
-			SearchAfter: []types.FieldValue{logParam.SearchAfterDocID},
-			Sort:        []types.SortCombinations{sortByWhen},
-		}).Do(context.Background())
-	} else {
-		//  calling search query when SearchAfterTS and SearchAfterDocID not given
-		res, err = client.Search().Index(Index).Request(&search.Request{
-			Size:  &LOGHARBOUR_GETLOGS_MAXREC,
-			Query: query,
-			Sort:  []types.SortCombinations{sortByWhen},
-		}).Do(context.Background())
-	}
-	if err != nil {
-		return nil, 0, fmt.Errorf("Error while searching document in es:%v", err)
-	}
-
-	// Unmarshalling hit.source into LogEntry
-	if res != nil {
-		for _, hit := range res.Hits.Hits {
-			var logEntery LogEntry
-			if err := json.Unmarshal([]byte(hit.Source_), &logEntery); err != nil {
-				return nil, 0, fmt.Errorf("error while unmarshalling response:%v", err)
-			}
-			logEntries = append(logEntries, logEntery)
-		}
-	}
-	return logEntries, int(res.Hits.Total.Value), nil
+	return query, nil
 }
 
 // GetUnusualIP will go through the logs of the last ndays days which match the search criteria, and pull out all the
 // remote IP addresses which account for a low enough percentage of the total to be treated as unusual or suspicious.
+// It queries the realm of queryToken with a QueryClient; see QueryClient.GetUnusualIP.
 func GetUnusualIP(queryToken string, client *elasticsearch.TypedClient, unusualPercent float64, logParam GetUnusualIPParam) ([]string, error) {
-	unusualIPs := []string{}
-
-	if unusualPercent < 0.5 || unusualPercent > 50 {
-		return nil, fmt.Errorf("unusualPercent is not between 0.5 to 50")
-	}
-
-	aggregatedIPs, err := GetSet(queryToken, client, remote_ip, GetSetParam{
-		App:   logParam.App,
-		Who:   logParam.Who,
-		Class: logParam.Class,
-		Op:    logParam.Operation,
-		Ndays: logParam.NDays,
-	})
-	if err != nil {
-		return nil, err
-	}
-	//   Calculate total number of logs to find what 1% represents
-	var count int64 = 0
-	for _, v := range aggregatedIPs {
-		count += v
-	}
-	percentThreshold := float64(count) * unusualPercent / 100
-
-	localIp, err := GetLocalIPAddress()
+	qc, err := NewQueryClientForToken(queryToken, client)
 	if err != nil {
 		return nil, err
 	}
-
-	if percentThreshold > 1 {
-		for ip, count := range aggregatedIPs {
-			if count <= int64(percentThreshold) {
-				if ip != localIp {
-					unusualIPs = append(unusualIPs, ip)
-				}
-			}
-		}
-	}
-	return unusualIPs, nil
-
+	return qc.GetUnusualIP(context.Background(), unusualPercent, logParam)
 }
 
 // GetLocalIPAddress returns the local IPv4 address of the system.
@@ -291,74 +214,13 @@ func GetLocalIPAddress() (string, error) {
 
 // GetSet gets a set of values for an attribute from the log entries specified.
 // This is a faceted search for one attribute.
+// It queries the realm of queryToken with a QueryClient; see QueryClient.GetSet.
 func GetSet(queryToken string, client *elasticsearch.TypedClient, setAttr string, setParam GetSetParam) (map[string]int64, error) {
-
-	var (
-		query           *types.Query
-		dataMap         = make(map[string]int64)
-		aggResponseSize = 1000
-		logSize         = 0
-	)
-
-	// Validate setAttr
-	_, err := isValidSetAttribute(setAttr)
+	qc, err := NewQueryClientForToken(queryToken, client)
 	if err != nil {
 		return nil, err
 	}
-
-	// Call getQuery function which will return a query for valid method parameters
-	query, err = getQuery(setParam)
-	if err != nil {
-		return nil, fmt.Errorf("error while calling getQuery : %v ", err)
-
-	}
-
-	// Create a context with a timeout
-	ctx, cancel := context.WithTimeout(context.Background(), DIALTIMEOUT)
-	defer cancel()
-
-	// To Serach data
-	// This will return a set of unique values for an attribute based on method parameters
-	res, err := client.Search().Index(Index).Request(&search.Request{
-		Query: query,
-		Size:  &logSize,
-		Aggregations: map[string]types.Aggregations{
-			logSet: {
-				Terms: &types.TermsAggregation{
-					Field: some.String(setAttr),
-					Size:  &aggResponseSize,
-					Order: map[string]sortorder.SortOrder{"_count": sortorder.SortOrder{"asc"}},
-				},
-			},
-		},
-	}).Do(ctx)
-
-	if err != nil {
-		return nil, fmt.Errorf("error runnning search query: %s", err)
-	}
-
-	// To assert if response contains aggregation response and it must be type of *types.StringTermsAggregate
-	logSetAgg, ok := res.Aggregations[logSet].(*types.StringTermsAggregate)
-	if !ok || logSetAgg == nil {
-		return nil, fmt.Errorf("services aggregation is not present or not of type *types.StringTermsAggregate")
-	}
-	// To extract bucket_key and bucket_count from Buckets which must be type of types.BucketsStringTermsBucket and append it to dataMap
-	bucketsSlice, ok := logSetAgg.Buckets.([]types.StringTermsBucket)
-	if ok {
-		for _, bucket := range bucketsSlice {
-			// Ensuring bucket key is a string.
-			// It proceeds to extract the key as a string and assign it to bucketKeyString.
-			if bucketKeyString, ok := bucket.Key.(string); ok {
-				dataMap[bucketKeyString] = bucket.DocCount
-			} else {
-				return nil, fmt.Errorf("the bucket key is not a string")
-			}
-		}
-	} else {
-		return nil, fmt.Errorf("services aggregation Buckets field has Unknown type: %v , valid type is :%v", reflect.TypeOf(logSetAgg.Buckets), "[]types.StringTermsBucket")
-	}
-
-	return dataMap, nil
+	return qc.GetSet(context.Background(), setAttr, setParam)
 }
 
 // To form a query based on valid method parameters
@@ -370,7 +232,6 @@ func getQuery(param GetSetParam) (*types.Query, error) {
 		activity    = "A"
 		debug       = "D"
 		query       *types.Query
-		Priority    = []string{"Debug2", "Debug1", "Debug0", "Info", "Warn", "Err", "Crit", "Sec"}
 	)
 
 	ok, ranges, err := rangeQueryForTimestamp(param.Fromts, param.Tots, param.Ndays)
@@ -447,12 +308,7 @@ func getQuery(param GetSetParam) (*types.Query, error) {
 
 	// pri specifies that only logs of priority equal to or higher than the value given here will be returned.
 	if param.Pri != nil {
-		priStr := param.Pri.String()
-		priFrom := slices.Index(Priority, priStr)
-		if priFrom > 0 {
-			requiredPri = Priority[priFrom:]
-		}
-		if ok, pri := termQueryForField(pri, nil, requiredPri...); ok {
+		if ok, pri := termQueryForField(pri, nil, priorityAtLeast(*param.Pri)...); ok {
 			termQueries = append(termQueries, pri)
 		}
 	}
@@ -503,19 +359,20 @@ func isValidSetAttribute(setAttr string) (bool, error) {
 
 // GetApps is used  to retrieve the list of apps
 func GetApps(querytoken string, client *elasticsearch.TypedClient) (apps []string, err error) {
-
-	// Calling GetSet() for getting  all unique values for apps
-	setvalues, err := GetSet(querytoken, client, app, GetSetParam{})
-
+	qc, err := NewQueryClientForToken(querytoken, client)
 	if err != nil {
-		return apps, fmt.Errorf("error at calling GetSet() : %w", err)
+		return nil, err
 	}
+	return qc.GetApps(context.Background())
+}
 
-	// Extracting keys from setValues
-	for app := range setvalues {
-		apps = append(apps, app)
+// priorityAtLeast returns the names of the priorities equal to or higher than p. It returns
+// nil for the lowest priority, since no filter is needed then.
+func priorityAtLeast(p LogPriority) []string {
+	if priFrom := slices.Index(Priority, p.String()); priFrom > 0 {
+		return Priority[priFrom:]
 	}
-	return apps, nil
+	return nil
 }
 
 // termQueryForField constructs and returns a term query for a specified field and its corresponding value.
@@ -608,17 +465,25 @@ func rangeQueryForTimestamp(fromTS, toTS *time.Time, nDays *int) (bool, types.Qu
 }
 
 // GetChanges retrieves an slice of logEntry from Elasticsearch based on the fields provided in logParam.
+// It queries the realm of querytoken with a QueryClient; see QueryClient.GetChanges.
 func GetChanges(querytoken string, client *elasticsearch.TypedClient, logParam GetLogsParam) ([]LogEntry, int, error) {
+	qc, err := NewQueryClientForToken(querytoken, client)
+	if err != nil {
+		return nil, 0, err
+	}
+	return qc.GetChanges(context.Background(), logParam)
+}
 
+// getChangesQuery forms the query of GetChanges from the fields provided in logParam.
+func getChangesQuery(logParam GetLogsParam) (*types.Query, error) {
 	var queries []types.Query
-	var logEntries []LogEntry
 
 	ok, ranges, err := rangeQueryForTimestamp(logParam.FromTS, logParam.ToTS, logParam.NDays)
 	if ok {
 		queries = append(queries, ranges)
 	}
 	if err != nil {
-		return nil, 0, err
+		return nil, err
 	}
 
 	if ok, app := termQueryForField(app, logParam.App); ok {
@@ -661,102 +526,38 @@ func GetChanges(querytoken string, client *elasticsearch.TypedClient, logParam G
 	}
 
 	if logParam.Priority != nil {
-		priStr := logParam.Priority.String()
-		priFrom := slices.Index(Priority, priStr)
-		if priFrom > 0 {
-			requiredPri = Priority[priFrom:]
-		}
-		if ok, pri := termQueryForField(pri, nil, requiredPri...); ok {
+		if ok, pri := termQueryForField(pri, nil, priorityAtLeast(*logParam.Priority)...); ok {
 			queries = append(queries, pri)
 		}
 	}
 
+	// full-text searches select entries along with the filters
+	must, err := searchQueries(logParam)
+	if err != nil {
+		return nil, err
+	}
+
 	// creating elastic search bool query
 	query := &types.Query{
 		Bool: &types.BoolQuery{
 			Filter: queries,
+			Must:   must,
 		},
 	}
 
-	if len(queries) == 0 {
-		return nil, 0, fmt.Errorf("no Filter param")
-	}
-
-	// sorting record on base of when
-	sortByWhen := types.SortOptions{
-		SortOptions: map[string]types.FieldSort{
-			when: {Order: &sortorder.Desc},
-			// "_doc": {Order: &sortorder.Desc},
-		},
-	}
-
-	//  calling search query when SearchAfterTS and SearchAfterDocID given
-	if logParam.SearchAfterTS != nil && logParam.SearchAfterDocID != nil {
-		res, err = client.Search().Index(Index).Request(&search.Request{
-			Size:        &LOGHARBOUR_GETLOGS_MAXREC,
-			Query:       query,
-			SearchAfter: []types.FieldValue{logParam.SearchAfterTS, logParam.SearchAfterDocID},
-			Sort:        []types.SortCombinations{sortByWhen},
-		}).Do(context.Background())
-		//  calling search query when SearchAfterTS is given
-	} else if logParam.SearchAfterTS != nil && logParam.SearchAfterDocID == nil {
-		res, err = client.Search().Index(Index).Request(&search.Request{
-			Size:        &LOGHARBOUR_GETLOGS_MAXREC,
-			Query:       query,
-			SearchAfter: []types.FieldValue{logParam.SearchAfterTS},
-			Sort:        []types.SortCombinations{sortByWhen},
-		}).Do(context.Background())
-		//  calling search query when is SearchAfterDocID
-	} else if logParam.SearchAfterTS == nil && logParam.SearchAfterDocID != nil {
-		res, err = client.Search().Index(Index).Request(&search.Request{
-			Size:        &LOGHARBOUR_GETLOGS_MAXREC,
-			Query:       query,
-			SearchAfter: []types.FieldValue{logParam.SearchAfterDocID},
-			Sort:        []types.SortCombinations{sortByWhen},
-		}).Do(context.Background())
-	} else {
-		//  calling search query when SearchAfterTS and SearchAfterDocID not given
-		res, err = client.Search().Index(Index).Request(&search.Request{
-			Size:  &LOGHARBOUR_GETLOGS_MAXREC,
-			Query: query,
-			Sort:  []types.SortCombinations{sortByWhen},
-		}).Do(context.Background())
-	}
-	if err != nil {
-		return nil, 0, fmt.Errorf("Error while searching document in es:%v", err)
-	}
-	var logEnter LogEntry
-
-	// Unmarshalling hit.source into LogEntry
-	if res != nil {
-		for _, hit := range res.Hits.Hits {
-			if err := json.Unmarshal([]byte(hit.Source_), &logEnter); err != nil {
-				return nil, 0, fmt.Errorf("error while unmarshalling response:%v", err)
-			}
-			logEntries = append(logEntries, logEnter)
-		}
+	if len(queries) == 0 && len(must) == 0 {
+		return nil, errNoFilter
 	}
-	return logEntries, int(res.Hits.Total.Value), nil
+	return query, nil
 }
 
 // This function gives a list of unusual IPS with it's geographical location details
 func ListUnusualIPs(queryToken string, client *elasticsearch.TypedClient, geoLiteDb *geoip2.Reader, unusualPercent float64, logParam GetUnusualIPParam) ([]IPLocation, error) {
-	unusualIPList := []IPLocation{}
-
-	// calling GetUnusualIP() to get all unsualIPS based on app and ndays
-	unusualIPs, err := GetUnusualIP(queryToken, client, unusualPercent, GetUnusualIPParam{App: logParam.App, NDays: logParam.NDays})
+	qc, err := NewQueryClientForToken(queryToken, client)
 	if err != nil {
 		return nil, err
 	}
-	// getting IPLocation details for each IP address
-	for _, ip := range unusualIPs {
-		iplocation := getIPLocation(ip, geoLiteDb)
-		unusualIPList = append(unusualIPList, iplocation)
-
-	}
-
-	return unusualIPList, nil
-
+	return qc.ListUnusualIPs(context.Background(), geoLiteDb, unusualPercent, logParam)
 }
 
 // This function is used to retrieves the geographical location details of a given IP address using a GeoLite database.
@@ -0,0 +1,244 @@
+package logharbour
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const defaultConfigPollInterval = 10 * time.Second
+
+// LogConfig is the logging configuration read from a file by LoadLogConfig.
+// Fields which are not present in the file are left unchanged when the configuration is applied.
+// An empty logconfig list removes all filter rules.
+//
+// Example JSON file:
+//
+//	{
+//	    "min_priority": "info",
+//	    "debug_mode": false,
+//	    "logconfig": [
+//	        {"svr": "zeus", "app": "sms", "module": "*", "pri": "info"},
+//	        {"svr": "*", "app": "*", "module": "*", "pri": "crit"}
+//	    ]
+//	}
+type LogConfig struct {
+	MinPriority *LogPriority `json:"min_priority,omitempty" yaml:"min_priority,omitempty"`
+	DebugMode   *bool        `json:"debug_mode,omitempty" yaml:"debug_mode,omitempty"`
+	FilterRules []FilterRule `json:"logconfig,omitempty" yaml:"logconfig,omitempty"`
+}
+
+// LoadLogConfig reads a LogConfig from a file. Files with a .yaml or .yml extension are
+// decoded as YAML, all others as JSON.
+func LoadLogConfig(path string) (*LogConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read log config: %w", err)
+	}
+	var cfg LogConfig
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &cfg)
+	default:
+		err = json.Unmarshal(data, &cfg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse log config %s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+// Apply applies the configuration to a LoggerContext with SetFilterRules, ChangeMinLogPriority
+// and SetDebugMode. The filter rules are validated first, so an invalid configuration changes nothing.
+// Nil FilterRules leave the rules of the context unchanged; empty FilterRules clear them.
+func (cfg *LogConfig) Apply(lctx *LoggerContext) error {
+	if cfg.MinPriority != nil && (*cfg.MinPriority < Debug2 || *cfg.MinPriority > Sec) {
+		return fmt.Errorf("invalid min_priority %d", *cfg.MinPriority)
+	}
+	if cfg.FilterRules != nil {
+		if err := lctx.SetFilterRules(cfg.FilterRules); err != nil {
+			return err
+		}
+	}
+	if cfg.MinPriority != nil {
+		lctx.ChangeMinLogPriority(*cfg.MinPriority)
+	}
+	if cfg.DebugMode != nil {
+		lctx.SetDebugMode(*cfg.DebugMode)
+	}
+	return nil
+}
+
+// ConfigReloader keeps a LoggerContext in sync with a configuration file.
+// It implements the wiki's log_configreload(): the file is reloaded when Reload is called,
+// when the process receives SIGUSR2 (on platforms which have it), and when the file's size
+// or modification time changes, which is checked by polling.
+//
+// If a reload fails, the previous configuration stays in effect and a Warn entry is logged.
+//
+// Example:
+//
+//	lctx := logharbour.NewLoggerContext(logharbour.Info)
+//	logger := logharbour.NewLogger(lctx, "billing", os.Stdout)
+//	reloader, err := logharbour.NewConfigReloader(lctx, "/etc/billing/logconfig.yaml", logger)
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	defer reloader.Stop()
+type ConfigReloader struct {
+	lctx         *LoggerContext
+	path         string
+	logger       *Logger
+	pollInterval time.Duration
+	signals      []os.Signal
+
+	mu      sync.Mutex // Serializes reloads, and guards modTime and size.
+	modTime time.Time
+	size    int64
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// ConfigReloaderOption configures a ConfigReloader.
+type ConfigReloaderOption func(*ConfigReloader)
+
+// WithConfigPollInterval sets how often the configuration file is checked for changes.
+// A zero or negative interval disables polling.
+func WithConfigPollInterval(interval time.Duration) ConfigReloaderOption {
+	return func(cr *ConfigReloader) {
+		cr.pollInterval = interval
+	}
+}
+
+// WithConfigReloadSignals sets the signals which trigger a reload, replacing the default
+// SIGUSR2. Passing no signals disables signal handling.
+func WithConfigReloadSignals(signals ...os.Signal) ConfigReloaderOption {
+	return func(cr *ConfigReloader) {
+		cr.signals = signals
+	}
+}
+
+// NewConfigReloader loads the configuration file at path, applies it to lctx, and starts
+// watching the file for changes. Reload failures are logged with logger.
+// By default the file is polled every 10 seconds and SIGUSR2 triggers a reload.
+// An error is returned if the initial load fails.
+func NewConfigReloader(lctx *LoggerContext, path string, logger *Logger, opts ...ConfigReloaderOption) (*ConfigReloader, error) {
+	cr := &ConfigReloader{
+		lctx:         lctx,
+		path:         path,
+		logger:       logger,
+		pollInterval: defaultConfigPollInterval,
+		signals:      defaultReloadSignals,
+		stop:         make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(cr)
+	}
+
+	if err := cr.load(); err != nil {
+		return nil, err
+	}
+
+	if cr.pollInterval > 0 || len(cr.signals) > 0 {
+		// Register for signals before returning, so that no signal sent afterwards is missed.
+		var sigCh chan os.Signal
+		if len(cr.signals) > 0 {
+			sigCh = make(chan os.Signal, 1)
+			signal.Notify(sigCh, cr.signals...)
+		}
+		cr.wg.Add(1)
+		go cr.watch(sigCh)
+	}
+	return cr, nil
+}
+
+// Reload reads the configuration file and applies it. On failure, the previous configuration
+// stays in effect, a Warn entry is logged and the error is returned.
+func (cr *ConfigReloader) Reload() error {
+	if err := cr.load(); err != nil {
+		cr.logger.WithOp("log_configreload").WithStatus(Failure).Error(err).Warn().
+			LogActivity("Failed to reload log configuration, keeping the previous one", map[string]any{"path": cr.path})
+		return err
+	}
+	return nil
+}
+
+// load reads and applies the configuration file, and records its size and modification time.
+func (cr *ConfigReloader) load() error {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	// Record the file's state even if loading fails, so that polling does not retry a broken
+	// file until it changes again.
+	if info, err := os.Stat(cr.path); err == nil {
+		cr.modTime, cr.size = info.ModTime(), info.Size()
+	} else {
+		cr.modTime, cr.size = time.Time{}, -1
+	}
+	cfg, err := LoadLogConfig(cr.path)
+	if err != nil {
+		return err
+	}
+	if err := cfg.Apply(cr.lctx); err != nil {
+		return fmt.Errorf("failed to apply log config %s: %w", cr.path, err)
+	}
+	return nil
+}
+
+// changed reports whether the configuration file differs from the one last loaded.
+// A file which cannot be read is reported as changed once, so that the failure is logged.
+func (cr *ConfigReloader) changed() bool {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	info, err := os.Stat(cr.path)
+	if err != nil {
+		if cr.size == -1 {
+			return false
+		}
+		cr.modTime, cr.size = time.Time{}, -1
+		return true
+	}
+	return !info.ModTime().Equal(cr.modTime) || info.Size() != cr.size
+}
+
+// watch reloads the configuration when a signal arrives or the file changes, until Stop is called.
+func (cr *ConfigReloader) watch(sigCh chan os.Signal) {
+	defer cr.wg.Done()
+	if sigCh != nil {
+		defer signal.Stop(sigCh)
+	}
+
+	var tick <-chan time.Time
+	if cr.pollInterval > 0 {
+		ticker := time.NewTicker(cr.pollInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-cr.stop:
+			return
+		case <-sigCh:
+			cr.Reload()
+		case <-tick:
+			if cr.changed() {
+				cr.Reload()
+			}
+		}
+	}
+}
+
+// Stop stops watching the configuration file and handling signals.
+func (cr *ConfigReloader) Stop() {
+	cr.stopOnce.Do(func() { close(cr.stop) })
+	cr.wg.Wait()
+}
@@ -0,0 +1,154 @@
+package logharbour
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func writeConfigFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadLogConfig(t *testing.T) {
+	dir := t.TempDir()
+	jsonPath := filepath.Join(dir, "logconfig.json")
+	writeConfigFile(t, jsonPath, `{
+		"min_priority": "warn",
+		"debug_mode": true,
+		"logconfig": [
+			{"svr": "zeus", "app": "sms", "module": "*", "pri": "info"},
+			{"svr": "*", "app": "*", "module": "*", "pri": "crit"}
+		]
+	}`)
+	yamlPath := filepath.Join(dir, "logconfig.yaml")
+	writeConfigFile(t, yamlPath, `
+min_priority: warn
+debug_mode: true
+logconfig:
+  - {svr: zeus, app: sms, module: "*", pri: info}
+  - {svr: "*", app: "*", module: "*", pri: crit}
+`)
+
+	for _, path := range []string{jsonPath, yamlPath} {
+		t.Run(filepath.Ext(path), func(t *testing.T) {
+			cfg, err := LoadLogConfig(path)
+			if err != nil {
+				t.Fatalf("LoadLogConfig failed: %v", err)
+			}
+			lctx := NewLoggerContext(Info)
+			if err := cfg.Apply(lctx); err != nil {
+				t.Fatalf("Apply failed: %v", err)
+			}
+			if pri := LogPriority(atomic.LoadInt32(&lctx.minLogPriority)); pri != Warn {
+				t.Errorf("expected min priority Warn, got %v", pri)
+			}
+			if !lctx.IsDebugModeSet() {
+				t.Error("expected debug mode to be set")
+			}
+			rules := lctx.FilterRules()
+			if len(rules) != 2 || rules[0] != (FilterRule{System: "zeus", App: "sms", Module: "*", Pri: Info}) {
+				t.Errorf("unexpected filter rules: %+v", rules)
+			}
+		})
+	}
+}
+
+func TestLogConfig_ApplyFilterRules(t *testing.T) {
+	dir := t.TempDir()
+	for _, tc := range []struct {
+		file, content string
+		rules         int
+	}{
+		{"absent.json", `{"min_priority": "warn"}`, 1},
+		{"absent.yaml", "min_priority: warn\n", 1},
+		{"empty.json", `{"logconfig": []}`, 0},
+		{"empty.yaml", "logconfig: []\n", 0},
+	} {
+		lctx := NewLoggerContext(Info)
+		if err := lctx.SetFilterRules([]FilterRule{{System: "*", App: "*", Module: "*", Pri: Crit}}); err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, tc.file)
+		writeConfigFile(t, path, tc.content)
+		cfg, err := LoadLogConfig(path)
+		if err != nil {
+			t.Fatalf("LoadLogConfig %s failed: %v", tc.file, err)
+		}
+		if err := cfg.Apply(lctx); err != nil {
+			t.Fatalf("Apply %s failed: %v", tc.file, err)
+		}
+		if rules := lctx.FilterRules(); len(rules) != tc.rules {
+			t.Errorf("%s: got filter rules %+v, want %d", tc.file, rules, tc.rules)
+		}
+	}
+}
+
+func TestConfigReloader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logconfig.json")
+	writeConfigFile(t, path, `{"min_priority": "info"}`)
+
+	var buf bytes.Buffer
+	lctx := NewLoggerContext(Debug0)
+	reloader, err := NewConfigReloader(lctx, path, NewLogger(lctx, "TestApp", &buf),
+		WithConfigPollInterval(10*time.Millisecond), WithConfigReloadSignals())
+	if err != nil {
+		t.Fatalf("NewConfigReloader failed: %v", err)
+	}
+	defer reloader.Stop()
+
+	if pri := LogPriority(atomic.LoadInt32(&lctx.minLogPriority)); pri != Info {
+		t.Fatalf("expected initial min priority Info, got %v", pri)
+	}
+
+	// A change of the file is picked up by polling.
+	writeConfigFile(t, path, `{"min_priority": "warn", "debug_mode": true}`)
+	waitFor(t, func() bool {
+		return LogPriority(atomic.LoadInt32(&lctx.minLogPriority)) == Warn && lctx.IsDebugModeSet()
+	})
+
+	// An invalid file keeps the previous configuration and logs a warning.
+	writeConfigFile(t, path, `{"min_priority": "loud"}`)
+	if err := reloader.Reload(); err == nil {
+		t.Fatal("expected Reload to fail for an invalid file")
+	}
+	if pri := LogPriority(atomic.LoadInt32(&lctx.minLogPriority)); pri != Warn {
+		t.Errorf("expected previous min priority to be kept, got %v", pri)
+	}
+	reloader.Stop()
+	var entry LogEntry
+	if err := json.Unmarshal(bytes.SplitN(buf.Bytes(), []byte("\n"), 2)[0], &entry); err != nil {
+		t.Fatalf("expected a warning entry, got %q: %v", buf.String(), err)
+	}
+	if entry.Pri != Warn || entry.Op != "log_configreload" || !strings.Contains(entry.Error, "loud") {
+		t.Errorf("unexpected warning entry: %+v", entry)
+	}
+}
+
+func TestNewConfigReloader_InitialLoadFails(t *testing.T) {
+	lctx := NewLoggerContext(Info)
+	_, err := NewConfigReloader(lctx, filepath.Join(t.TempDir(), "missing.json"), NewLogger(lctx, "TestApp", &bytes.Buffer{}))
+	if err == nil {
+		t.Error("expected error for a missing file")
+	}
+}
+
+// waitFor polls cond until it is true, failing the test after a second.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met within 1s")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !windows
+
+package logharbour
+
+import (
+	"os"
+	"syscall"
+)
+
+// defaultReloadSignals are the signals which make a ConfigReloader reload its file,
+// as the wiki prescribes for daemons.
+var defaultReloadSignals = []os.Signal{syscall.SIGUSR2}
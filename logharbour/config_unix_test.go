@@ -0,0 +1,31 @@
+//go:build !windows
+
+package logharbour
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"testing"
+)
+
+func TestConfigReloader_Signal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logconfig.json")
+	writeConfigFile(t, path, `{"min_priority": "info"}`)
+
+	lctx := NewLoggerContext(Debug0)
+	reloader, err := NewConfigReloader(lctx, path, NewLogger(lctx, "TestApp", &bytes.Buffer{}),
+		WithConfigPollInterval(0), WithConfigReloadSignals(syscall.SIGUSR2))
+	if err != nil {
+		t.Fatalf("NewConfigReloader failed: %v", err)
+	}
+	defer reloader.Stop()
+
+	writeConfigFile(t, path, `{"min_priority": "crit"}`)
+	if err := syscall.Kill(os.Getpid(), syscall.SIGUSR2); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return LogPriority(atomic.LoadInt32(&lctx.minLogPriority)) == Crit })
+}
@@ -0,0 +1,8 @@
+//go:build windows
+
+package logharbour
+
+import "os"
+
+// defaultReloadSignals is empty on Windows, which has no SIGUSR2.
+var defaultReloadSignals []os.Signal
@@ -0,0 +1,107 @@
+package logharbour
+
+import "context"
+
+// contextKey is the type of the keys under which logharbour stores values in a context.Context.
+// Using an unexported type prevents collisions with keys defined in other packages.
+type contextKey int
+
+const (
+	loggerContextKey contextKey = iota
+	traceIDContextKey
+	spanIDContextKey
+	whoContextKey
+	remoteIPContextKey
+	requestWhoContextKey
+)
+
+// NewContext returns a copy of ctx which carries the given Logger.
+// Middleware typically stores a Logger built with WithHTTPRequest, so that handlers deep in
+// the call stack can retrieve it with FromContext.
+func NewContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, loggerContextKey, l)
+}
+
+// FromContext returns the Logger stored in ctx by NewContext, or nil if there is none.
+func FromContext(ctx context.Context) *Logger {
+	l, _ := ctx.Value(loggerContextKey).(*Logger)
+	return l
+}
+
+// ContextWithTraceID returns a copy of ctx which carries the given trace ID.
+func ContextWithTraceID(ctx context.Context, traceID string) context.Context {
+	return context.WithValue(ctx, traceIDContextKey, traceID)
+}
+
+// ContextWithSpanID returns a copy of ctx which carries the given span ID.
+func ContextWithSpanID(ctx context.Context, spanID string) context.Context {
+	return context.WithValue(ctx, spanIDContextKey, spanID)
+}
+
+// ContextWithWho returns a copy of ctx which carries the given user or service identity.
+func ContextWithWho(ctx context.Context, who string) context.Context {
+	return context.WithValue(ctx, whoContextKey, who)
+}
+
+// ContextWithRemoteIP returns a copy of ctx which carries the given remote IP address.
+func ContextWithRemoteIP(ctx context.Context, remoteIP string) context.Context {
+	return context.WithValue(ctx, remoteIPContextKey, remoteIP)
+}
+
+// WithContext returns a new Logger with the trace ID, span ID, who and remote IP fields
+// taken from ctx.
+//
+// Each field is looked up first among the values set with the ContextWith* functions,
+// and then in the Logger stored with NewContext. Fields which are not found in ctx keep
+// the value they have in l.
+func (l *Logger) WithContext(ctx context.Context) *Logger {
+	newLogger := l.clone()
+	stored := FromContext(ctx)
+	newLogger.traceId = valueFromContext(ctx, traceIDContextKey, stored, func(s *Logger) string { return s.traceId }, l.traceId)
+	newLogger.spanId = valueFromContext(ctx, spanIDContextKey, stored, func(s *Logger) string { return s.spanId }, l.spanId)
+	newLogger.who = valueFromContext(ctx, whoContextKey, stored, func(s *Logger) string { return s.who }, l.who)
+	newLogger.remoteIP = valueFromContext(ctx, remoteIPContextKey, stored, func(s *Logger) string { return s.remoteIP }, l.remoteIP)
+	return newLogger
+}
+
+// valueFromContext returns the non-empty string stored in ctx under key, or else the non-empty
+// field of the stored Logger, or else the fallback.
+func valueFromContext(ctx context.Context, key contextKey, stored *Logger, field func(*Logger) string, fallback string) string {
+	if v, ok := ctx.Value(key).(string); ok && v != "" {
+		return v
+	}
+	if stored != nil {
+		if v := field(stored); v != "" {
+			return v
+		}
+	}
+	return fallback
+}
+
+// LogActivityCtx is a variant of LogActivity which takes the trace ID, span ID, who and
+// remote IP from ctx. See WithContext.
+func (l *Logger) LogActivityCtx(ctx context.Context, message string, data ActivityInfo) {
+	if !l.shouldLog(l.pri) {
+		return
+	}
+	l.WithContext(ctx).LogActivity(message, data)
+}
+
+// LogDataChangeCtx is a variant of LogDataChange which takes the trace ID, span ID, who and
+// remote IP from ctx. See WithContext.
+func (l *Logger) LogDataChangeCtx(ctx context.Context, message string, data ChangeInfo) {
+	if !l.shouldLog(l.pri) {
+		return
+	}
+	l.WithContext(ctx).LogDataChange(message, data)
+}
+
+// LogDebugCtx is a variant of LogDebug which takes the trace ID, span ID, who and
+// remote IP from ctx. See WithContext.
+func (l *Logger) LogDebugCtx(ctx context.Context, message string, data any) {
+	if !l.context.IsDebugModeSet() || !l.shouldLog(l.pri) {
+		return
+	}
+	// skip = 3 means the caller of LogDebugCtx, see logDebug
+	l.WithContext(ctx).logDebug(message, data, 3)
+}
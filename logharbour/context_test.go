@@ -0,0 +1,163 @@
+package logharbour
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFromContext(t *testing.T) {
+	if l := FromContext(context.Background()); l != nil {
+		t.Errorf("expected nil logger from empty context, got %v", l)
+	}
+
+	logger := NewLogger(NewLoggerContext(Info), "TestApp", &bytes.Buffer{})
+	ctx := NewContext(context.Background(), logger)
+	if got := FromContext(ctx); got != logger {
+		t.Errorf("expected stored logger, got %v", got)
+	}
+}
+
+func TestWithContext(t *testing.T) {
+	logger := NewLogger(NewLoggerContext(Info), "TestApp", &bytes.Buffer{}).
+		WithWho("original").
+		WithTraceID("original-trace")
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(HeaderTraceID, "request-trace")
+	req.Header.Set("X-Real-IP", "10.1.2.3")
+	ctx := NewContext(context.Background(), logger.WithHTTPRequest(req))
+
+	tests := []struct {
+		name         string
+		ctx          context.Context
+		wantTrace    string
+		wantSpan     string
+		wantWho      string
+		wantRemoteIP string
+	}{
+		{
+			name:      "empty context keeps logger fields",
+			ctx:       context.Background(),
+			wantTrace: "original-trace",
+			wantWho:   "original",
+		},
+		{
+			name:         "fields taken from stored logger",
+			ctx:          ctx,
+			wantTrace:    "request-trace",
+			wantWho:      "original",
+			wantRemoteIP: "10.1.2.3",
+		},
+		{
+			name:         "explicit values override stored logger",
+			ctx:          ContextWithSpanID(ContextWithWho(ContextWithTraceID(ctx, "explicit-trace"), "alice"), "span-1"),
+			wantTrace:    "explicit-trace",
+			wantSpan:     "span-1",
+			wantWho:      "alice",
+			wantRemoteIP: "10.1.2.3",
+		},
+		{
+			name:         "remote IP without stored logger",
+			ctx:          ContextWithRemoteIP(context.Background(), "192.168.0.9"),
+			wantTrace:    "original-trace",
+			wantWho:      "original",
+			wantRemoteIP: "192.168.0.9",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := logger.WithContext(tt.ctx)
+			if got.traceId != tt.wantTrace || got.spanId != tt.wantSpan ||
+				got.who != tt.wantWho || got.remoteIP != tt.wantRemoteIP {
+				t.Errorf("got trace=%q span=%q who=%q remoteIP=%q", got.traceId, got.spanId, got.who, got.remoteIP)
+			}
+		})
+	}
+
+	if logger.who != "original" || logger.traceId != "original-trace" {
+		t.Error("WithContext must not modify the original logger")
+	}
+}
+
+func TestLogCtxMethods(t *testing.T) {
+	ctx := ContextWithSpanID(ContextWithWho(ContextWithTraceID(context.Background(), "trace-1"), "alice"), "span-1")
+
+	tests := []struct {
+		name     string
+		logFunc  func(l *Logger)
+		wantType LogType
+	}{
+		{
+			name:     "LogActivityCtx",
+			logFunc:  func(l *Logger) { l.LogActivityCtx(ctx, "activity", map[string]any{"k": "v"}) },
+			wantType: Activity,
+		},
+		{
+			name: "LogDataChangeCtx",
+			logFunc: func(l *Logger) {
+				l.LogDataChangeCtx(ctx, "change", *NewChangeInfo("User", "Update").AddChange("email", "a", "b"))
+			},
+			wantType: Change,
+		},
+		{
+			name:     "LogDebugCtx",
+			logFunc:  func(l *Logger) { l.LogDebugCtx(ctx, "debug", "data") },
+			wantType: Debug,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			lctx := NewLoggerContext(Info)
+			lctx.SetDebugMode(true)
+			tt.logFunc(NewLogger(lctx, "TestApp", &buf))
+
+			var entry LogEntry
+			if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+				t.Fatalf("Failed to unmarshal logged message: %v", err)
+			}
+			if entry.Type != tt.wantType {
+				t.Errorf("expected type %v, got %v", tt.wantType, entry.Type)
+			}
+			if entry.TraceId != "trace-1" || entry.SpanId != "span-1" || entry.Who != "alice" {
+				t.Errorf("context values not applied: trace=%q span=%q who=%q", entry.TraceId, entry.SpanId, entry.Who)
+			}
+		})
+	}
+}
+
+func TestLogDebugCtx_ReportsCaller(t *testing.T) {
+	var buf bytes.Buffer
+	lctx := NewLoggerContext(Info)
+	lctx.SetDebugMode(true)
+
+	NewLogger(lctx, "TestApp", &buf).LogDebugCtx(context.Background(), "debug", nil)
+
+	var entry LogEntry
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("Failed to unmarshal logged message: %v", err)
+	}
+	if !strings.HasSuffix(entry.Data.DebugData.FunctionName, "TestLogDebugCtx_ReportsCaller") {
+		t.Errorf("expected caller to be the test function, got %q", entry.Data.DebugData.FunctionName)
+	}
+}
+
+func TestLogCtx_SkippedWhenFiltered(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(NewLoggerContext(Warn), "TestApp", &buf)
+
+	logger.LogActivityCtx(context.Background(), "should not appear", nil)
+	logger.LogDataChangeCtx(context.Background(), "should not appear", *NewChangeInfo("User", "Update"))
+	logger.Warn().LogDebugCtx(context.Background(), "should not appear", nil)
+
+	if buf.Len() != 0 {
+		t.Errorf("expected no output, got %s", buf.String())
+	}
+}
@@ -0,0 +1,172 @@
+package logharbour
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/core/closepointintime"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+)
+
+// ErrInvalidCursor is returned for a page cursor which cannot be decoded, or which was
+// returned for a query other than the one it is passed back with.
+var ErrInvalidCursor = errors.New("invalid page cursor")
+
+// LogPage is a page of log entries returned by GetLogsPage or GetChangesPage.
+type LogPage struct {
+	Entries    []LogEntry
+	Total      int    // Number of entries matching the query, on all pages
+	NextCursor string // Pass as GetLogsParam.Cursor to get the next page; empty on the last page
+
+	// Highlights holds, by entry id, the highlighted snippets of each field matched by
+	// GetLogsParam.Text or Changes, if GetLogsParam.Highlight is set. Snippets of change
+	// values are under data.change_data.changes.old_value and .new_value.
+	Highlights map[string]map[string][]string
+}
+
+// pageCursor is the content of a page cursor: where the next page starts in the sort order
+// (when, id), and the point in time the pages are read from, if any. A cursor is the
+// base64-encoded JSON encoding of a pageCursor.
+type pageCursor struct {
+	SearchAfter []types.FieldValue `json:"a"`
+	Query       string             `json:"q"` // queryFingerprint of the query the cursor belongs to
+	PitId       string             `json:"p,omitempty"`
+	KeepAlive   string             `json:"k,omitempty"`
+}
+
+func encodeCursor(c pageCursor) (string, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodeCursor decodes a cursor and checks that it belongs to the query with fingerprint.
+func decodeCursor(cursor, fingerprint string) (*pageCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+	}
+	var c pageCursor
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber() // keeps sort values such as timestamps in milliseconds exact
+	if err := dec.Decode(&c); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+	}
+	if len(c.SearchAfter) == 0 {
+		return nil, fmt.Errorf("%w: no position", ErrInvalidCursor)
+	}
+	if fingerprint != "" && c.Query != fingerprint {
+		return nil, fmt.Errorf("%w: cursor belongs to another query", ErrInvalidCursor)
+	}
+	return &c, nil
+}
+
+// queryFingerprint identifies a query, so that a cursor cannot be used to page through the
+// results of another one.
+func queryFingerprint(query *types.Query) (string, error) {
+	data, err := json.Marshal(query)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8]), nil
+}
+
+// WithPointInTime makes GetLogsPage and GetChangesPage read all the pages of a query from an
+// Elasticsearch point in time, so that a paginated view stays consistent while new log
+// entries keep arriving. The point in time is kept open for keepAlive between pages, and
+// closed when the last page has been read or by ReleaseCursor.
+func WithPointInTime(keepAlive time.Duration) QueryClientOption {
+	return func(qc *QueryClient) {
+		qc.pitKeepAlive = keepAlive
+	}
+}
+
+// keepAliveString formats d the way Elasticsearch expects time units.
+func keepAliveString(d time.Duration) string {
+	if d%time.Minute == 0 {
+		return fmt.Sprintf("%dm", d/time.Minute)
+	}
+	return fmt.Sprintf("%ds", (d+time.Second-1)/time.Second)
+}
+
+// openPointInTime opens a point in time on the QueryClient's index.
+func (qc *QueryClient) openPointInTime(ctx context.Context, keepAlive string) (string, error) {
+	ctx, cancel := qc.withTimeout(ctx)
+	defer cancel()
+	res, err := qc.target.Client.OpenPointInTime(qc.target.Index).KeepAlive(keepAlive).Do(ctx)
+	if err != nil {
+		return "", fmt.Errorf("error opening point in time: %w", err)
+	}
+	return res.Id, nil
+}
+
+// closePointInTime closes a point in time. Errors are ignored: the point in time expires
+// by itself after its keep-alive.
+func (qc *QueryClient) closePointInTime(ctx context.Context, pitId string) {
+	ctx, cancel := qc.withTimeout(ctx)
+	defer cancel()
+	_, _ = qc.target.Client.ClosePointInTime().Request(&closepointintime.Request{Id: pitId}).Do(ctx)
+}
+
+// ReleaseCursor frees the point in time held by a cursor of a query which will not be read
+// to its last page. It does nothing for a cursor without a point in time.
+func (qc *QueryClient) ReleaseCursor(ctx context.Context, cursor string) error {
+	c, err := decodeCursor(cursor, "")
+	if err != nil {
+		return err
+	}
+	if c.PitId != "" {
+		qc.closePointInTime(ctx, c.PitId)
+	}
+	return nil
+}
+
+// GetLogsPage retrieves a page of log entries like GetLogs, with a cursor for the next page.
+func (qc *QueryClient) GetLogsPage(ctx context.Context, logParam GetLogsParam) (LogPage, error) {
+	query, err := getLogsQuery(logParam)
+	if err != nil {
+		return LogPage{}, err
+	}
+	return qc.searchLogs(ctx, query, logParam, true)
+}
+
+// GetChangesPage retrieves a page of data-change log entries like GetChanges, with a cursor
+// for the next page.
+func (qc *QueryClient) GetChangesPage(ctx context.Context, logParam GetLogsParam) (LogPage, error) {
+	query, err := getChangesQuery(logParam)
+	if err != nil {
+		return LogPage{}, err
+	}
+	return qc.searchLogs(ctx, query, logParam, true)
+}
+
+// GetLogsPage retrieves a page of log entries with a cursor for the next page.
+// It queries the realm of querytoken with a QueryClient; see QueryClient.GetLogsPage.
+func GetLogsPage(querytoken string, client *elasticsearch.TypedClient, logParam GetLogsParam) (LogPage, error) {
+	qc, err := NewQueryClientForToken(querytoken, client)
+	if err != nil {
+		return LogPage{}, err
+	}
+	return qc.GetLogsPage(context.Background(), logParam)
+}
+
+// GetChangesPage retrieves a page of data-change log entries with a cursor for the next page.
+// It queries the realm of querytoken with a QueryClient; see QueryClient.GetChangesPage.
+func GetChangesPage(querytoken string, client *elasticsearch.TypedClient, logParam GetLogsParam) (LogPage, error) {
+	qc, err := NewQueryClientForToken(querytoken, client)
+	if err != nil {
+		return LogPage{}, err
+	}
+	return qc.GetChangesPage(context.Background(), logParam)
+}
@@ -0,0 +1,120 @@
+package logharbour
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+)
+
+const fakePageResponse = `{"took": 1, "timed_out": false, "_shards": {"total": 1, "successful": 1, "skipped": 0, "failed": 0},
+	"pit_id": "pit-2",
+	"hits": {"total": {"value": 3, "relation": "eq"}, "hits": [
+		{"_index": "logharbour_acme", "_id": "b", "_source": {"id": "b", "app": "billing"}, "sort": [1767225600000, "b"]},
+		{"_index": "logharbour_acme", "_id": "a", "_source": {"id": "a", "app": "billing"}, "sort": [1767225600000, "a"]}]}}`
+
+func TestQueryClient_GetLogsPage(t *testing.T) {
+	f, client := newFakeSearchServer(t, fakePageResponse)
+	qc := NewQueryClient(client, "logharbour_acme", WithPageSize(2))
+	app := "billing"
+
+	page, err := qc.GetLogsPage(context.Background(), GetLogsParam{App: &app})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 3 || len(page.Entries) != 2 || page.NextCursor == "" {
+		t.Fatalf("unexpected first page %+v", page)
+	}
+	if sort, _ := json.Marshal(f.requests[0]["sort"]); string(sort) != `[{"when":{"order":"desc"}},{"id":{"order":"desc"}}]` {
+		t.Errorf("sort = %s, want when then id", sort)
+	}
+
+	if _, err := qc.GetLogsPage(context.Background(), GetLogsParam{App: &app, Cursor: &page.NextCursor}); err != nil {
+		t.Fatal(err)
+	}
+	if after, _ := json.Marshal(f.requests[1]["search_after"]); string(after) != `[1767225600000,"a"]` {
+		t.Errorf("search_after = %s, want the sort values of the last entry", after)
+	}
+
+	other := "crux"
+	if _, err := qc.GetLogsPage(context.Background(), GetLogsParam{App: &other, Cursor: &page.NextCursor}); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("expected ErrInvalidCursor for a cursor of another query, got %v", err)
+	}
+	garbage := "not a cursor"
+	if _, err := qc.GetLogsPage(context.Background(), GetLogsParam{App: &app, Cursor: &garbage}); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("expected ErrInvalidCursor, got %v", err)
+	}
+
+	// A short page is the last one
+	size := 5
+	page, err = qc.GetLogsPage(context.Background(), GetLogsParam{App: &app, PageSize: &size})
+	if err != nil || page.NextCursor != "" {
+		t.Errorf("expected no cursor after the last page, got %q, %v", page.NextCursor, err)
+	}
+}
+
+func TestQueryClient_GetLogsPage_PointInTime(t *testing.T) {
+	f, client := newFakeSearchServer(t, fakePageResponse)
+	qc := NewQueryClient(client, "logharbour_acme", WithPageSize(2), WithPointInTime(2*time.Minute))
+	app := "billing"
+
+	page, err := qc.GetLogsPage(context.Background(), GetLogsParam{App: &app})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.paths[0] != "/logharbour_acme/_pit" || f.paths[1] != "/_search" {
+		t.Errorf("requests = %v, want a point in time then a search without an index", f.paths)
+	}
+	if pit, _ := json.Marshal(f.requests[1]["pit"]); string(pit) != `{"id":"pit-1","keep_alive":"2m"}` {
+		t.Errorf("pit = %s", pit)
+	}
+
+	// The next page uses the point in time id returned by the last search
+	if _, err := qc.GetLogsPage(context.Background(), GetLogsParam{App: &app, Cursor: &page.NextCursor}); err != nil {
+		t.Fatal(err)
+	}
+	if pit, _ := json.Marshal(f.requests[2]["pit"]); string(pit) != `{"id":"pit-2","keep_alive":"2m"}` {
+		t.Errorf("pit = %s", pit)
+	}
+
+	// A short page is the last one, and closes the point in time
+	size := 5
+	if _, err := qc.GetLogsPage(context.Background(), GetLogsParam{App: &app, Cursor: &page.NextCursor, PageSize: &size}); err != nil {
+		t.Fatal(err)
+	}
+	if last := f.paths[len(f.paths)-1]; last != "/_pit" {
+		t.Errorf("last request %s, want /_pit", last)
+	}
+
+	if err := qc.ReleaseCursor(context.Background(), page.NextCursor); err != nil {
+		t.Fatal(err)
+	}
+	if last := f.paths[len(f.paths)-1]; last != "/_pit" {
+		t.Errorf("ReleaseCursor made request %s, want /_pit", last)
+	}
+}
+
+func TestCursor_RoundTrip(t *testing.T) {
+	cursor, err := encodeCursor(pageCursor{SearchAfter: []types.FieldValue{int64(1767225600123), "id"}, Query: "q"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := decodeCursor(cursor, "q")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := json.Marshal(c.SearchAfter); string(got) != `[1767225600123,"id"]` {
+		t.Errorf("search_after = %s", got)
+	}
+}
+
+func TestKeepAliveString(t *testing.T) {
+	for d, want := range map[time.Duration]string{time.Minute: "1m", 5 * time.Minute: "5m", 90 * time.Second: "90s", 1500 * time.Millisecond: "2s"} {
+		if got := keepAliveString(d); got != want {
+			t.Errorf("keepAliveString(%v) = %s, want %s", d, got, want)
+		}
+	}
+}
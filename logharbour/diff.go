@@ -0,0 +1,290 @@
+package logharbour
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// diffIgnoreTag is the value of the logharbour struct tag which excludes a field from diffs.
+const diffIgnoreTag = "-"
+
+// Diff compares two values of the same struct or map type and returns one ChangeDetail per
+// field which differs, with values converted to strings as by NewChangeDetail.
+//
+// Nested structs, maps, slices and arrays are compared element by element, and the field of
+// each ChangeDetail is the dotted path to the element, e.g. "address.city" or "phones.1".
+// Struct fields are named by their json tag, and fields tagged `json:"-"` or `logharbour:"-"`
+// are ignored. Values of fields tagged `logharbour:"redact"` or `logharbour:"mask=..."` are
+// redacted as by convertToString; LogDataChangeDiff redacts them with the Redactor of the logger.
+//
+// Either value may be nil, e.g. when an entity is created or deleted; every field of the
+// other value is then reported as changed from or to null. Types with their own JSON
+// encoding, such as time.Time, are compared as a whole. Unexported fields, including embedded
+// structs of unexported types, are ignored. Cyclic values are compared up to the point where
+// the same values are compared again.
+//
+// Example:
+//
+//	changes := logharbour.Diff(oldUser, newUser)
+//	// [{Field: "email", OldVal: "a@example.com", NewVal: "b@example.com"},
+//	//  {Field: "address.city", OldVal: "Pune", NewVal: "Mumbai"}]
+func Diff(before, after any) []ChangeDetail {
+	return diff(before, after, markRedacted)
+}
+
+// diff is Diff with the values of fields tagged `logharbour:"redact"` replaced by redact.
+func diff(before, after any, redact redactFunc) []ChangeDetail {
+	d := differ{redact: redact, changes: []ChangeDetail{}, visiting: make(map[diffVisit]bool)}
+	d.values("", "", reflect.ValueOf(before), reflect.ValueOf(after))
+	return d.changes
+}
+
+// differ holds the state of a Diff.
+type differ struct {
+	redact   redactFunc
+	changes  []ChangeDetail
+	visiting map[diffVisit]bool
+}
+
+// diffVisit identifies two values being compared by their addresses and type, as in
+// reflect.DeepEqual. An address is 0 for a missing value.
+type diffVisit struct {
+	a, b uintptr
+	typ  reflect.Type
+}
+
+// enter marks a and b, of type typ, as being compared, and returns false if they already
+// are further up the recursion, so that cyclic values terminate. Unlike reflect.DeepEqual,
+// values are only marked while being compared, so that values shared by several fields are
+// reported at each of their paths. If enter returns true, leave must be called afterwards.
+func (d *differ) enter(a, b reflect.Value, typ reflect.Type) (leave func(), ok bool) {
+	visit := diffVisit{addressOf(a), addressOf(b), typ}
+	if visit.a == 0 && visit.b == 0 {
+		// Values which are not addressable cannot be reached again
+		return func() {}, true
+	}
+	if d.visiting[visit] {
+		return nil, false
+	}
+	d.visiting[visit] = true
+	return func() { delete(d.visiting, visit) }, true
+}
+
+// addressOf returns the address of the value v, or of the elements of map or slice v, or 0
+// for invalid and non-addressable values.
+func addressOf(v reflect.Value) uintptr {
+	switch {
+	case !v.IsValid():
+		return 0
+	case v.Kind() == reflect.Map || v.Kind() == reflect.Slice:
+		return v.Pointer()
+	case v.CanAddr():
+		return v.UnsafeAddr()
+	}
+	return 0
+}
+
+// AddDiff adds one change per differing field of before and after to the ChangeInfo. See Diff.
+func (ci *ChangeInfo) AddDiff(before, after any) *ChangeInfo {
+	ci.Changes = append(ci.Changes, Diff(before, after)...)
+	return ci
+}
+
+// LogDataChangeDiff logs a data change event whose changes are the differences between
+// before and after, as computed by Diff.
+//
+// Example:
+//
+//	logger.LogDataChangeDiff("User updated", "User", "Update", oldUser, newUser)
+func (l *Logger) LogDataChangeDiff(message, entity, op string, before, after any) {
+	if !l.shouldLog(l.pri) {
+		return
+	}
+	changes := NewChangeInfo(entity, op)
+	changes.Changes = diff(before, after, l.context.redactFunc())
+	l.LogDataChange(message, *changes)
+}
+
+// values appends the differences between a and b, found at path, to the changes.
+// An invalid reflect.Value stands for a missing or nil value. tag is the logharbour struct
+// tag of the field holding the values, if any.
+func (d *differ) values(path, tag string, a, b reflect.Value) {
+	a, b = derefValue(a), derefValue(b)
+	if !a.IsValid() && !b.IsValid() {
+		return
+	}
+
+	var typ reflect.Type
+	if !a.IsValid() {
+		typ = b.Type()
+	} else if typ = a.Type(); b.IsValid() && b.Type() != typ {
+		d.addLeafChange(path, tag, a, b)
+		return
+	}
+
+	if tag != "" || isDiffLeaf(typ) {
+		if !a.IsValid() || !b.IsValid() || !reflect.DeepEqual(a.Interface(), b.Interface()) {
+			d.addLeafChange(path, tag, a, b)
+		}
+		return
+	}
+
+	switch typ.Kind() {
+	case reflect.Struct:
+		d.structs(path, typ, a, b)
+		return
+	}
+	leave, ok := d.enter(a, b, typ)
+	if !ok {
+		return
+	}
+	defer leave()
+	switch typ.Kind() {
+	case reflect.Map:
+		keys := make(map[string]reflect.Value)
+		for _, m := range []reflect.Value{a, b} {
+			if m.IsValid() {
+				for _, k := range m.MapKeys() {
+					keys[mapKeyString(k)] = k
+				}
+			}
+		}
+		names := make([]string, 0, len(keys))
+		for name := range keys {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			d.values(joinDiffPath(path, name), "", mapIndex(a, keys[name]), mapIndex(b, keys[name]))
+		}
+	case reflect.Slice, reflect.Array:
+		n := max(lenOf(a), lenOf(b))
+		for i := 0; i < n; i++ {
+			d.values(joinDiffPath(path, strconv.Itoa(i)), "", indexOf(a, i), indexOf(b, i))
+		}
+	}
+}
+
+// structs compares the fields of two structs of type typ, either of which may be invalid.
+// Fields of embedded structs without a JSON name are promoted, as encoding/json does.
+func (d *differ) structs(path string, typ reflect.Type, a, b reflect.Value) {
+	leave, ok := d.enter(a, b, typ)
+	if !ok {
+		return
+	}
+	defer leave()
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		tag := f.Tag.Get(redactTagName)
+		if name == "-" || tag == diffIgnoreTag {
+			continue
+		}
+		if !f.IsExported() {
+			// This includes embedded structs of unexported types, whose fields cannot be read
+			// through reflection.
+			continue
+		}
+		fa, fb := fieldOf(a, i), fieldOf(b, i)
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct && !isDiffLeaf(ft) {
+				d.structs(path, ft, derefValue(fa), derefValue(fb))
+				continue
+			}
+		}
+		if name == "" {
+			name = f.Name
+		}
+		d.values(joinDiffPath(path, name), tag, fa, fb)
+	}
+}
+
+// addLeafChange appends a change from a to b at path, redacting the values according to tag.
+func (d *differ) addLeafChange(path, tag string, a, b reflect.Value) {
+	d.changes = append(d.changes, ChangeDetail{
+		Field:  path,
+		OldVal: convertRedacted(d.leafValue(tag, a), d.redact),
+		NewVal: convertRedacted(d.leafValue(tag, b), d.redact),
+	})
+}
+
+func (d *differ) leafValue(tag string, v reflect.Value) any {
+	if !v.IsValid() {
+		return nil
+	}
+	if tag != "" {
+		return redactByTag(tag, v, d.redact)
+	}
+	return v.Interface()
+}
+
+// isDiffLeaf reports whether values of type t are compared as a whole rather than element by element.
+func isDiffLeaf(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Struct:
+		return t.Implements(jsonMarshalerType) || reflect.PointerTo(t).Implements(jsonMarshalerType) ||
+			t.Implements(textMarshalerType) || reflect.PointerTo(t).Implements(textMarshalerType)
+	case reflect.Map:
+		return false
+	case reflect.Slice, reflect.Array:
+		// Byte slices are encoded as a single base64 string.
+		return t.Elem().Kind() == reflect.Uint8
+	}
+	return true
+}
+
+// derefValue follows pointers and interfaces, returning an invalid Value for nil.
+func derefValue(v reflect.Value) reflect.Value {
+	for v.IsValid() && (v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	if v.IsValid() && (v.Kind() == reflect.Map || v.Kind() == reflect.Slice) && v.IsNil() {
+		return reflect.Value{}
+	}
+	return v
+}
+
+func fieldOf(v reflect.Value, i int) reflect.Value {
+	if !v.IsValid() {
+		return v
+	}
+	return v.Field(i)
+}
+
+func mapIndex(m, k reflect.Value) reflect.Value {
+	if !m.IsValid() {
+		return m
+	}
+	return m.MapIndex(k)
+}
+
+func lenOf(v reflect.Value) int {
+	if !v.IsValid() {
+		return 0
+	}
+	return v.Len()
+}
+
+func indexOf(v reflect.Value, i int) reflect.Value {
+	if i >= lenOf(v) {
+		return reflect.Value{}
+	}
+	return v.Index(i)
+}
+
+// joinDiffPath appends a field name or index to a dotted path.
+func joinDiffPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
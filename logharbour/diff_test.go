@@ -0,0 +1,175 @@
+package logharbour
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// DiffAudit is exported because Diff, unlike encoding/json, cannot read the fields of
+// embedded structs of unexported types.
+type DiffAudit struct {
+	UpdatedBy string `json:"updated_by"`
+}
+
+type diffAddress struct {
+	City string `json:"city"`
+	Zip  string `json:"zip,omitempty"`
+}
+
+type diffUser struct {
+	DiffAudit
+	Name      string            `json:"name"`
+	Email     string            `json:"email"`
+	Password  string            `json:"password" logharbour:"redact"`
+	Card      string            `json:"card" logharbour:"mask=last4"`
+	Version   int               `json:"version" logharbour:"-"`
+	Internal  string            `json:"-"`
+	Created   time.Time         `json:"created"`
+	Address   *diffAddress      `json:"address"`
+	Phones    []string          `json:"phones"`
+	Prefs     map[string]string `json:"prefs"`
+	NoJSONTag bool
+}
+
+func TestDiff(t *testing.T) {
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	before := diffUser{
+		DiffAudit: DiffAudit{UpdatedBy: "alice"},
+		Name:      "Kiran",
+		Email:     "kiran@example.com",
+		Password:  "old-secret",
+		Card:      "4111111111111111",
+		Version:   1,
+		Internal:  "a",
+		Created:   created,
+		Address:   &diffAddress{City: "Pune", Zip: "411001"},
+		Phones:    []string{"111", "222"},
+		Prefs:     map[string]string{"lang": "en", "theme": "dark"},
+	}
+	after := before
+	after.DiffAudit.UpdatedBy = "bob"
+	after.Email = "kiran@example.org"
+	after.Password = "new-secret"
+	after.Card = "4111111111112222"
+	after.Version = 2
+	after.Internal = "b"
+	after.Created = created.Add(time.Hour)
+	after.Address = &diffAddress{City: "Mumbai", Zip: "411001"}
+	after.Phones = []string{"111", "333", "444"}
+	after.Prefs = map[string]string{"lang": "en", "tz": "IST"}
+	after.NoJSONTag = true
+
+	got := Diff(before, &after)
+	want := []ChangeDetail{
+		{Field: "updated_by", OldVal: "alice", NewVal: "bob"},
+		{Field: "email", OldVal: "kiran@example.com", NewVal: "kiran@example.org"},
+		{Field: "password", OldVal: DefaultRedactMarker, NewVal: DefaultRedactMarker},
+		{Field: "card", OldVal: "************1111", NewVal: "************2222"},
+		{Field: "created", OldVal: `"2024-01-01T00:00:00Z"`, NewVal: `"2024-01-01T01:00:00Z"`},
+		{Field: "address.city", OldVal: "Pune", NewVal: "Mumbai"},
+		{Field: "phones.1", OldVal: "222", NewVal: "333"},
+		{Field: "phones.2", OldVal: "null", NewVal: "444"},
+		{Field: "prefs.theme", OldVal: "dark", NewVal: "null"},
+		{Field: "prefs.tz", OldVal: "null", NewVal: "IST"},
+		{Field: "NoJSONTag", OldVal: "false", NewVal: "true"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected diff:\n got %+v\nwant %+v", got, want)
+	}
+}
+
+func TestDiff_CreateAndDelete(t *testing.T) {
+	user := &diffUser{Name: "Kiran", Address: &diffAddress{City: "Pune"}}
+
+	created := Diff(nil, user)
+	fields := make(map[string]ChangeDetail)
+	for _, c := range created {
+		fields[c.Field] = c
+	}
+	if c := fields["address.city"]; c.OldVal != "null" || c.NewVal != "Pune" {
+		t.Errorf("unexpected change for address.city: %+v", c)
+	}
+	if c := fields["name"]; c.OldVal != "null" || c.NewVal != "Kiran" {
+		t.Errorf("unexpected change for name: %+v", c)
+	}
+
+	deleted := Diff(user, nil)
+	if len(deleted) != len(created) {
+		t.Errorf("expected delete to report the same fields as create, got %d and %d", len(deleted), len(created))
+	}
+}
+
+func TestDiff_Equal(t *testing.T) {
+	user := diffUser{Name: "Kiran", Phones: []string{"1"}, Prefs: map[string]string{}}
+	same := diffUser{Name: "Kiran", Phones: []string{"1"}}
+	if got := Diff(user, same); len(got) != 0 {
+		t.Errorf("expected no changes, got %+v", got)
+	}
+}
+
+func TestDiff_Maps(t *testing.T) {
+	before := map[string]any{"a": 1, "nested": map[string]any{"x": "1"}}
+	after := map[string]any{"a": 2, "nested": map[string]any{"x": "2"}}
+	want := []ChangeDetail{
+		{Field: "a", OldVal: "1", NewVal: "2"},
+		{Field: "nested.x", OldVal: "1", NewVal: "2"},
+	}
+	if got := Diff(before, after); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+type diffNode struct {
+	Name     string         `json:"name"`
+	Next     *diffNode      `json:"next"`
+	Children []*diffNode    `json:"children"`
+	Attrs    map[string]any `json:"attrs"`
+}
+
+func TestDiff_Cycles(t *testing.T) {
+	before := &diffNode{Name: "a", Attrs: map[string]any{"x": 1}}
+	before.Next = before
+	before.Children = []*diffNode{before}
+	before.Attrs["self"] = before.Attrs
+	after := &diffNode{Name: "b", Attrs: map[string]any{"x": 2}}
+	after.Next = after
+	after.Children = []*diffNode{after}
+	after.Attrs["self"] = after.Attrs
+
+	want := []ChangeDetail{
+		{Field: "name", OldVal: "a", NewVal: "b"},
+		{Field: "attrs.x", OldVal: "1", NewVal: "2"},
+	}
+	if got := Diff(before, after); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if got := Diff(before, nil); len(got) == 0 {
+		t.Error("expected the fields of a deleted cyclic value to be reported")
+	}
+
+	// Values shared by several fields are not cycles, and are reported at each path
+	shared := &diffNode{Name: "shared"}
+	got := Diff(&diffNode{Next: shared, Children: []*diffNode{shared}}, &diffNode{})
+	if len(got) != 2 || got[0].Field != "next.name" || got[1].Field != "children.0.name" {
+		t.Errorf("unexpected changes: %+v", got)
+	}
+}
+
+func TestLogDataChangeDiff(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(NewLoggerContext(Info), "TestApp", &buf)
+	logger.LogDataChangeDiff("User updated", "User", "Update",
+		diffUser{Name: "Kiran"}, diffUser{Name: "Kiran", Email: "k@example.com"})
+
+	entries := decodeEntries(t, &buf)
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(entries))
+	}
+	change := entries[0].Data.ChangeData
+	if entries[0].Type != Change || change.Entity != "User" || change.Op != "Update" ||
+		len(change.Changes) != 1 || change.Changes[0].Field != "email" {
+		t.Errorf("unexpected entry: %+v", entries[0])
+	}
+}
@@ -17,6 +17,17 @@ package logharbour
 //
 // This adds the new fields to existing indices. Documents without these fields
 // will simply have null values when queried.
+//
+// The integrity chain fields (see IntegrityChain) are added the same way:
+//
+//	PUT /<index_name>/_mapping
+//	{
+//	  "properties": {
+//	    "seq": { "type": "long" },
+//	    "prev_hash": { "type": "keyword" },
+//	    "hash": { "type": "keyword" }
+//	  }
+//	}
 const ESLogsMapping = `{
   "mappings": {
     "properties": {
@@ -68,6 +79,15 @@ const ESLogsMapping = `{
       "span_id": {
         "type": "keyword"
       },
+      "seq": {
+        "type": "long"
+      },
+      "prev_hash": {
+        "type": "keyword"
+      },
+      "hash": {
+        "type": "keyword"
+      },
       "msg": {
         "type": "text"
       },
@@ -0,0 +1,303 @@
+package logharbour
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8"
+)
+
+// ExportFormat is the format in which Export writes log entries.
+type ExportFormat string
+
+const (
+	// ExportNDJSON writes one LogEntry per line, in its JSON encoding.
+	ExportNDJSON ExportFormat = "ndjson"
+	// ExportCSV writes a header and one row per log entry, or per change of a data-change
+	// entry, see ExportCSVHeader.
+	ExportCSV ExportFormat = "csv"
+)
+
+const (
+	// DefaultExportBatchSize is the number of entries Export reads per search.
+	DefaultExportBatchSize = 1000
+	// DefaultExportKeepAlive is how long the point in time of an export is kept open between
+	// two batches, unless the QueryClient was created with WithPointInTime.
+	DefaultExportKeepAlive = 5 * time.Minute
+)
+
+// ErrInvalidExportFormat is returned by Export for a format other than ExportNDJSON and ExportCSV.
+var ErrInvalidExportFormat = errors.New("invalid export format")
+
+// ExportCSVHeader are the columns written by ExportCSV. The changes of a data-change entry
+// are flattened into entity, change_op, field, old_value and new_value, with one row per
+// change; the other columns are repeated on each row. debug_data holds the JSON encoding of
+// the debug information, and old_value and new_value that of values which are not strings.
+var ExportCSVHeader = []string{
+	id, app, system, module, typeConst, pri, when, who, op, class, instance, status, "error", remote_ip,
+	"msg", trace_id, "span_id", "activity_data", "debug_data", "entity", "change_op", "field", "old_value", "new_value",
+}
+
+// ExportParam describes how Export writes the entries.
+type ExportParam struct {
+	Format    ExportFormat
+	Changes   bool // Select entries like GetChanges rather than GetLogs
+	Gzip      bool // Compress the output, see Export
+	BatchSize int  // Entries read per search; DefaultExportBatchSize if 0
+
+	// Resume continues an export from the last checkpoint passed to OnCheckpoint. The output
+	// must then be the output of the interrupted export, truncated to Resume.Bytes.
+	Resume *ExportCheckpoint
+	// OnCheckpoint is called after each batch, once it has been written. An export stops with
+	// the error returned by OnCheckpoint, if any.
+	OnCheckpoint func(ExportCheckpoint) error
+}
+
+// ExportCheckpoint is the progress of an export, from which it can be resumed.
+type ExportCheckpoint struct {
+	Cursor  string `json:"cursor"`  // Position after the last exported entry; empty when the export is complete
+	Entries int64  `json:"entries"` // Entries exported
+	Rows    int64  `json:"rows"`    // Lines or rows written, not counting the CSV header
+	Bytes   int64  `json:"bytes"`   // Bytes written to the output
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// Export writes every log entry matching the filters of logParam to w, latest first. Entries
+// are selected as by GetLogs, or by GetChanges if exp.Changes is set, so that an export
+// holds what the web services show; the paging fields of logParam are ignored.
+//
+// The entries are read in batches from a point in time, so that entries logged during the
+// export do not shift the batches. A checkpoint is passed to exp.OnCheckpoint after each batch;
+// an interrupted export can be resumed from it with exp.Resume, even after the point in time
+// has expired. With exp.Gzip, each batch is written as a gzip member of its own, so that the
+// output is a valid gzip file at every checkpoint and a resumed export can be appended to it.
+//
+// Export returns the final checkpoint, which holds the counts of the whole export.
+func (qc *QueryClient) Export(ctx context.Context, w io.Writer, logParam GetLogsParam, exp ExportParam) (ExportCheckpoint, error) {
+	if exp.Format != ExportNDJSON && exp.Format != ExportCSV {
+		return ExportCheckpoint{}, fmt.Errorf("%w: %q", ErrInvalidExportFormat, exp.Format)
+	}
+	buildQuery := getLogsQuery
+	if exp.Changes {
+		buildQuery = getChangesQuery
+	}
+	query, err := buildQuery(logParam)
+	if err != nil {
+		return ExportCheckpoint{}, err
+	}
+
+	exporter := *qc
+	if exporter.pitKeepAlive == 0 {
+		exporter.pitKeepAlive = DefaultExportKeepAlive
+	}
+	batchSize := exp.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultExportBatchSize
+	}
+	logParam.PageSize = &batchSize
+	logParam.Cursor, logParam.SearchAfterTS, logParam.SearchAfterDocID = nil, nil, nil
+	logParam.Highlight = false
+
+	var checkpoint ExportCheckpoint
+	header := exp.Format == ExportCSV
+	if exp.Resume != nil {
+		checkpoint = *exp.Resume
+		if checkpoint.Cursor == "" {
+			return checkpoint, nil // already complete
+		}
+		logParam.Cursor = &checkpoint.Cursor
+		header = false
+	}
+	cw := &countingWriter{w: w, n: checkpoint.Bytes}
+
+	// pitCursor is the last cursor read, which holds the point in time to release on errors
+	var pitCursor string
+	fail := func(err error) (ExportCheckpoint, error) {
+		if pitCursor != "" {
+			_ = exporter.ReleaseCursor(ctx, pitCursor)
+		}
+		return checkpoint, err
+	}
+
+	for {
+		page, err := exporter.searchLogs(ctx, query, logParam, true)
+		if err != nil {
+			return fail(err)
+		}
+		pitCursor = page.NextCursor
+
+		rows, err := writeBatch(cw, exp, header, page.Entries)
+		if err != nil {
+			return fail(fmt.Errorf("error writing export: %w", err))
+		}
+		header = false
+		checkpoint.Entries += int64(len(page.Entries))
+		checkpoint.Rows += rows
+		checkpoint.Bytes = cw.n
+
+		if page.NextCursor == "" {
+			checkpoint.Cursor = ""
+			return checkpoint, nil
+		}
+		// The checkpoint does without the point in time, which may have expired on resumption.
+		// Entries logged since come before the position in the sort order, so a resumed
+		// export still only holds entries older than those already exported.
+		if checkpoint.Cursor, err = cursorWithoutPointInTime(page.NextCursor); err != nil {
+			return fail(err)
+		}
+		if exp.OnCheckpoint != nil {
+			if err := exp.OnCheckpoint(checkpoint); err != nil {
+				return fail(err)
+			}
+		}
+		logParam.Cursor = &page.NextCursor
+	}
+}
+
+// cursorWithoutPointInTime returns cursor without its point in time. Searches with a point in
+// time are sorted after when and id by the implicit _shard_doc tiebreaker, whose value is
+// dropped too, since a search without one is sorted by when and id alone.
+func cursorWithoutPointInTime(cursor string) (string, error) {
+	c, err := decodeCursor(cursor, "")
+	if err != nil {
+		return "", err
+	}
+	c.PitId, c.KeepAlive = "", ""
+	if len(c.SearchAfter) > 2 {
+		c.SearchAfter = c.SearchAfter[:2]
+	}
+	return encodeCursor(*c)
+}
+
+// writeBatch writes entries to w in the format of exp, preceded by the CSV header if header is
+// set, and returns the number of rows written.
+func writeBatch(w io.Writer, exp ExportParam, header bool, entries []LogEntry) (int64, error) {
+	var zw *gzip.Writer
+	if exp.Gzip {
+		zw = gzip.NewWriter(w)
+		w = zw
+	}
+	var rows int64
+	switch exp.Format {
+	case ExportNDJSON:
+		enc := json.NewEncoder(w)
+		for _, entry := range entries {
+			if err := enc.Encode(entry); err != nil {
+				return rows, err
+			}
+			rows++
+		}
+	case ExportCSV:
+		cw := csv.NewWriter(w)
+		if header {
+			if err := cw.Write(ExportCSVHeader); err != nil {
+				return rows, err
+			}
+		}
+		for _, entry := range entries {
+			records, err := csvRecords(entry)
+			if err != nil {
+				return rows, err
+			}
+			if err := cw.WriteAll(records); err != nil {
+				return rows, err
+			}
+			rows += int64(len(records))
+		}
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			return rows, err
+		}
+	}
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			return rows, err
+		}
+	}
+	return rows, nil
+}
+
+// csvRecords returns the CSV rows of a log entry, one per change for a data-change entry.
+func csvRecords(entry LogEntry) ([][]string, error) {
+	record := []string{
+		entry.Id, entry.App, entry.System, entry.Module, entry.Type.String(), entry.Pri.String(),
+		entry.When.Format(time.RFC3339Nano), entry.Who, entry.Op, entry.Class, entry.InstanceId,
+		strconv.Itoa(int(entry.Status)), entry.Error, entry.RemoteIP, entry.Msg, entry.TraceId, entry.SpanId,
+	}
+	var activityData, debugData string
+	var changes *ChangeInfo
+	if entry.Data != nil {
+		activityData = entry.Data.ActivityData
+		if entry.Data.DebugData != nil {
+			data, err := json.Marshal(entry.Data.DebugData)
+			if err != nil {
+				return nil, err
+			}
+			debugData = string(data)
+		}
+		changes = entry.Data.ChangeData
+	}
+	record = append(record, activityData, debugData)
+
+	if changes == nil || len(changes.Changes) == 0 {
+		var entity, changeOp string
+		if changes != nil {
+			entity, changeOp = changes.Entity, changes.Op
+		}
+		return [][]string{append(record, entity, changeOp, "", "", "")}, nil
+	}
+	records := make([][]string, 0, len(changes.Changes))
+	for _, change := range changes.Changes {
+		oldValue, err := csvValue(change.OldVal)
+		if err != nil {
+			return nil, err
+		}
+		newValue, err := csvValue(change.NewVal)
+		if err != nil {
+			return nil, err
+		}
+		row := append(append([]string(nil), record...), changes.Entity, changes.Op, change.Field, oldValue, newValue)
+		records = append(records, row)
+	}
+	return records, nil
+}
+
+// csvValue returns a change value as a CSV field: strings as they are, other values in JSON.
+func csvValue(v any) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	}
+	data, err := json.Marshal(v)
+	return string(data), err
+}
+
+// Export writes every log entry matching the filters of logParam to w.
+// It queries the realm of querytoken with a QueryClient; see QueryClient.Export.
+func Export(querytoken string, client *elasticsearch.TypedClient, w io.Writer, logParam GetLogsParam, exp ExportParam) (ExportCheckpoint, error) {
+	qc, err := NewQueryClientForToken(querytoken, client)
+	if err != nil {
+		return ExportCheckpoint{}, err
+	}
+	return qc.Export(context.Background(), w, logParam, exp)
+}
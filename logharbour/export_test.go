@@ -0,0 +1,147 @@
+package logharbour
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const (
+	// fakeExportPage1 is read with a point in time, so its sort values end with the implicit
+	// _shard_doc tiebreaker
+	fakeExportPage1 = `{"took": 1, "timed_out": false, "pit_id": "pit-1", "_shards": {"total": 1, "successful": 1, "skipped": 0, "failed": 0},
+		"hits": {"total": {"value": 3, "relation": "eq"}, "hits": [
+			{"_index": "logharbour_acme", "_id": "c1", "sort": [1767229200000, "c1", 4], "_source": {"id": "c1", "app": "billing", "type": "C",
+			 "when": "2026-01-01T01:00:00Z", "class": "invoice", "data": {"change_data": {"entity": "invoice", "op": "update",
+			 "changes": [{"field": "amount", "old_value": 100, "new_value": 250}, {"field": "note", "old_value": "a, b", "new_value": null}]}}}},
+			{"_index": "logharbour_acme", "_id": "a1", "sort": [1767225600000, "a1", 3], "_source": {"id": "a1", "app": "billing", "type": "A",
+			 "pri": "Info", "when": "2026-01-01T00:00:00Z", "msg": "paid", "data": {"activity_data": "{\"n\":1}"}}}]}}`
+	fakeExportPage2 = `{"took": 1, "timed_out": false, "_shards": {"total": 1, "successful": 1, "skipped": 0, "failed": 0},
+		"hits": {"total": {"value": 3, "relation": "eq"}, "hits": [
+			{"_index": "logharbour_acme", "_id": "a0", "sort": [1767222000000, "a0"], "_source": {"id": "a0", "app": "billing", "type": "A",
+			 "pri": "Warn", "when": "2025-12-31T23:00:00Z", "msg": "late"}}]}}`
+)
+
+func readGzipCSV(t *testing.T, data []byte) [][]string {
+	t.Helper()
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(bytes.NewReader(plain)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
+
+func TestQueryClient_Export(t *testing.T) {
+	f, client := newFakeSearchServer(t, fakeExportPage1, fakeExportPage2)
+	qc := NewQueryClient(client, "logharbour_acme")
+	appName := "billing"
+	var out bytes.Buffer
+	var checkpoints []ExportCheckpoint
+
+	final, err := qc.Export(context.Background(), &out, GetLogsParam{App: &appName}, ExportParam{
+		Format:       ExportCSV,
+		Gzip:         true,
+		BatchSize:    2,
+		OnCheckpoint: func(cp ExportCheckpoint) error { checkpoints = append(checkpoints, cp); return nil },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if final.Entries != 3 || final.Rows != 4 || final.Cursor != "" || final.Bytes != int64(out.Len()) {
+		t.Errorf("final checkpoint = %+v", final)
+	}
+	if len(checkpoints) != 1 || checkpoints[0].Entries != 2 || checkpoints[0].Rows != 3 {
+		t.Fatalf("checkpoints = %+v", checkpoints)
+	}
+	if c, err := decodeCursor(checkpoints[0].Cursor, ""); err != nil || c.PitId != "" || len(c.SearchAfter) != 2 {
+		t.Errorf("checkpoint cursor %+v, %v: want a position without point in time or its tiebreaker", c, err)
+	}
+	if after, _ := f.requests[2]["search_after"].([]any); len(after) != 3 || f.requests[2]["pit"] == nil {
+		t.Errorf("expected the second batch to be read after the tiebreaker from the point in time, got %v", f.requests[2])
+	}
+	if f.paths[0] != "/logharbour_acme/_pit" {
+		t.Errorf("expected the export to open a point in time, got %v", f.paths)
+	}
+
+	records := readGzipCSV(t, out.Bytes())
+	if len(records) != 5 || !reflect.DeepEqual(records[0], ExportCSVHeader) {
+		t.Fatalf("records = %v", records)
+	}
+	column := func(row []string, name string) string {
+		for i, h := range ExportCSVHeader {
+			if h == name {
+				return row[i]
+			}
+		}
+		t.Fatalf("no column %s", name)
+		return ""
+	}
+	if column(records[1], "field") != "amount" || column(records[1], "old_value") != "100" || column(records[1], "new_value") != "250" ||
+		column(records[2], "old_value") != "a, b" || column(records[2], "new_value") != "" || column(records[2], id) != "c1" {
+		t.Errorf("change rows = %v", records[1:3])
+	}
+	if column(records[3], "activity_data") != `{"n":1}` || column(records[3], pri) != "Info" || column(records[4], "msg") != "late" {
+		t.Errorf("activity rows = %v", records[3:])
+	}
+
+	// Resuming from the checkpoint appends the last batch to the output of the first one
+	f, client = newFakeSearchServer(t, fakeExportPage2)
+	qc = NewQueryClient(client, "logharbour_acme")
+	resumed := bytes.NewBuffer(out.Bytes()[:checkpoints[0].Bytes])
+	final, err = qc.Export(context.Background(), resumed, GetLogsParam{App: &appName}, ExportParam{
+		Format: ExportCSV, Gzip: true, BatchSize: 2, Resume: &checkpoints[0],
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if final.Entries != 3 || final.Rows != 4 || final.Bytes != int64(resumed.Len()) {
+		t.Errorf("final checkpoint after resuming = %+v", final)
+	}
+	if after, _ := f.requests[0]["search_after"].([]any); len(f.paths) != 1 || !strings.HasSuffix(f.paths[0], "/_search") || len(after) != 2 {
+		t.Errorf("expected a search after the checkpoint's when and id, got %v %v", f.paths, f.requests)
+	}
+	if !reflect.DeepEqual(readGzipCSV(t, resumed.Bytes()), records) {
+		t.Error("resumed export differs from the uninterrupted one")
+	}
+
+	// A checkpoint cannot resume an export with other filters
+	otherApp := "crux"
+	if _, err := qc.Export(context.Background(), io.Discard, GetLogsParam{App: &otherApp}, ExportParam{
+		Format: ExportCSV, Resume: &checkpoints[0],
+	}); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("expected ErrInvalidCursor, got %v", err)
+	}
+}
+
+func TestQueryClient_Export_NDJSON(t *testing.T) {
+	_, client := newFakeSearchServer(t, fakeExportPage2)
+	qc := NewQueryClient(client, "logharbour_acme")
+	appName := "billing"
+	var out bytes.Buffer
+
+	if _, err := qc.Export(context.Background(), &out, GetLogsParam{App: &appName}, ExportParam{Format: "xml"}); !errors.Is(err, ErrInvalidExportFormat) {
+		t.Errorf("expected ErrInvalidExportFormat, got %v", err)
+	}
+	final, err := qc.Export(context.Background(), &out, GetLogsParam{App: &appName}, ExportParam{Format: ExportNDJSON})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if final.Rows != 1 || len(lines) != 1 || !strings.Contains(lines[0], `"msg":"late"`) {
+		t.Errorf("export = %q, %+v", out.String(), final)
+	}
+}
@@ -0,0 +1,99 @@
+package logharbour
+
+import (
+	"errors"
+	"fmt"
+)
+
+// FilterWildcard matches any value in the system, app or module field of a FilterRule.
+const FilterWildcard = "*"
+
+// FilterRule is one entry of the logconfig array described in the wiki's "Log filtering"
+// section: a (svr, app, module, pri) 4-tuple. Entries of a Logger whose system, app and
+// module match the rule are written if their priority is pri or higher.
+// Any of System, App and Module may be FilterWildcard.
+type FilterRule struct {
+	System string      `json:"svr" yaml:"svr"`
+	App    string      `json:"app" yaml:"app"`
+	Module string      `json:"module" yaml:"module"`
+	Pri    LogPriority `json:"pri" yaml:"pri"`
+}
+
+// matches reports whether the rule applies to entries of the given system, app and module.
+func (r FilterRule) matches(system, app, module string) bool {
+	return matchFilterField(r.System, system) && matchFilterField(r.App, app) && matchFilterField(r.Module, module)
+}
+
+func matchFilterField(pattern, value string) bool {
+	return pattern == FilterWildcard || pattern == value
+}
+
+// validate checks that every field of the rule is set and that the priority is known.
+func (r FilterRule) validate() error {
+	if r.System == "" || r.App == "" || r.Module == "" {
+		return errors.New("svr, app and module must not be empty; use \"*\" to match any value")
+	}
+	if r.Pri < Debug2 || r.Pri > Sec {
+		return fmt.Errorf("invalid priority %d", r.Pri)
+	}
+	return nil
+}
+
+// SetFilterRules replaces the filter rules of the LoggerContext.
+//
+// When rules are set, they decide which entries are written instead of the minimum log
+// priority: for each entry, the rules are checked in order against the Logger's system, app
+// and module, and the first matching rule decides whether the entry's priority is high enough.
+// Entries which match no rule are not written, so the last rule should normally be a
+// catch-all rule with FilterWildcard in all three fields.
+//
+// The new rules are swapped in atomically, so loggers in other goroutines are never blocked
+// and always see either the old or the new rule set. Passing no rules restores filtering by
+// the minimum log priority.
+//
+// Example:
+//
+//	err := lctx.SetFilterRules([]logharbour.FilterRule{
+//		{System: "zeus", App: "sms", Module: "*", Pri: logharbour.Info},
+//		{System: "athena", App: "*", Module: "*", Pri: logharbour.Err},
+//		{System: "*", App: "*", Module: "*", Pri: logharbour.Crit},
+//	})
+func (lc *LoggerContext) SetFilterRules(rules []FilterRule) error {
+	if len(rules) == 0 {
+		lc.filterRules.Store(nil)
+		return nil
+	}
+	for i, rule := range rules {
+		if err := rule.validate(); err != nil {
+			return fmt.Errorf("invalid filter rule %d: %w", i, err)
+		}
+	}
+	// Copy the rules, so that the caller cannot modify them after they are published.
+	rs := append([]FilterRule(nil), rules...)
+	lc.filterRules.Store(&rs)
+	return nil
+}
+
+// FilterRules returns a copy of the filter rules of the LoggerContext, or nil if none are set.
+func (lc *LoggerContext) FilterRules() []FilterRule {
+	rs := lc.filterRules.Load()
+	if rs == nil {
+		return nil
+	}
+	return append([]FilterRule(nil), *rs...)
+}
+
+// allows reports whether an entry with the given system, app, module and priority passes the
+// filter rules. The second return value is false if no rules are set.
+func (lc *LoggerContext) allows(system, app, module string, p LogPriority) (allowed, ruled bool) {
+	rs := lc.filterRules.Load()
+	if rs == nil {
+		return false, false
+	}
+	for _, rule := range *rs {
+		if rule.matches(system, app, module) {
+			return p >= rule.Pri, true
+		}
+	}
+	return false, true
+}
@@ -0,0 +1,123 @@
+package logharbour
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+	"testing"
+)
+
+func TestFilterRules(t *testing.T) {
+	lctx := NewLoggerContext(Debug2)
+	err := lctx.SetFilterRules([]FilterRule{
+		{System: "zeus", App: "sms", Module: "*", Pri: Info},
+		{System: "athena", App: "*", Module: "*", Pri: Err},
+		{System: "*", App: "*", Module: "auth", Pri: Debug1},
+		{System: "*", App: "*", Module: "*", Pri: Crit},
+	})
+	if err != nil {
+		t.Fatalf("SetFilterRules failed: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		system string
+		app    string
+		module string
+		pri    LogPriority
+		want   bool
+	}{
+		{"first rule matches", "zeus", "sms", "sender", Info, true},
+		{"first rule below pri", "zeus", "sms", "sender", Debug0, false},
+		{"first match wins over later rule", "athena", "sms", "auth", Warn, false},
+		{"second rule", "athena", "billing", "core", Err, true},
+		{"module rule", "hermes", "billing", "auth", Debug1, true},
+		{"catch-all", "hermes", "billing", "core", Err, false},
+		{"catch-all passes", "hermes", "billing", "core", Crit, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewLogger(lctx, tt.app, &bytes.Buffer{}).WithSystem(tt.system).WithModule(tt.module)
+			if got := l.shouldLog(tt.pri); got != tt.want {
+				t.Errorf("shouldLog(%v) = %v, want %v", tt.pri, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterRules_NoMatchIsDropped(t *testing.T) {
+	var buf bytes.Buffer
+	lctx := NewLoggerContext(Debug2)
+	if err := lctx.SetFilterRules([]FilterRule{{System: "*", App: "sms", Module: "*", Pri: Debug2}}); err != nil {
+		t.Fatalf("SetFilterRules failed: %v", err)
+	}
+
+	NewLogger(lctx, "billing", &buf).Sec().LogActivity("not matched", nil)
+	if buf.Len() != 0 {
+		t.Errorf("expected entry matching no rule to be dropped, got %s", buf.String())
+	}
+
+	// Clearing the rules restores the minimum log priority.
+	lctx.SetFilterRules(nil)
+	NewLogger(lctx, "billing", &buf).LogActivity("logged", nil)
+	if buf.Len() == 0 {
+		t.Error("expected entry to be logged after clearing the rules")
+	}
+}
+
+func TestSetFilterRules_Invalid(t *testing.T) {
+	lctx := NewLoggerContext(Info)
+	rules := []FilterRule{{System: "*", App: "*", Module: "*", Pri: Info}}
+	if err := lctx.SetFilterRules(rules); err != nil {
+		t.Fatalf("SetFilterRules failed: %v", err)
+	}
+
+	for _, bad := range []FilterRule{
+		{System: "", App: "*", Module: "*", Pri: Info},
+		{System: "*", App: "*", Module: "*"},
+	} {
+		if err := lctx.SetFilterRules([]FilterRule{bad}); err == nil {
+			t.Errorf("expected error for rule %+v", bad)
+		}
+	}
+	if got := lctx.FilterRules(); len(got) != 1 || got[0] != rules[0] {
+		t.Errorf("invalid rules must not replace the current ones, got %+v", got)
+	}
+}
+
+func TestFilterRule_UnmarshalJSON(t *testing.T) {
+	// The format of the wiki's logconfig array.
+	data := `[{"svr": "zeus", "app": "sms", "module": "*", "pri": "info"},
+		{"svr": "*", "app": "*", "module": "*", "pri": "crit"}]`
+	var rules []FilterRule
+	if err := json.Unmarshal([]byte(data), &rules); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	want := []FilterRule{
+		{System: "zeus", App: "sms", Module: "*", Pri: Info},
+		{System: "*", App: "*", Module: "*", Pri: Crit},
+	}
+	if len(rules) != len(want) || rules[0] != want[0] || rules[1] != want[1] {
+		t.Errorf("got %+v, want %+v", rules, want)
+	}
+}
+
+func TestFilterRules_ConcurrentSwap(t *testing.T) {
+	lctx := NewLoggerContext(Info)
+	logger := NewLogger(lctx, "TestApp", &bytes.Buffer{})
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			lctx.SetFilterRules([]FilterRule{{System: "*", App: "*", Module: "*", Pri: LogPriority(i%8 + 1)}})
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			logger.shouldLog(Warn)
+		}
+	}()
+	wg.Wait()
+}
@@ -0,0 +1,260 @@
+package logharbour
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/core/search"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/some"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/calendarinterval"
+)
+
+const (
+	logHistogram = "loghistogram"
+	logSplit     = "logsplit"
+)
+
+// MaxHistogramBuckets is the largest number of buckets a histogram may have. Requests whose
+// time range holds more intervals are refused with ErrInvalidInterval.
+const MaxHistogramBuckets = 10000
+
+var (
+	// ErrInvalidInterval is returned for a histogram interval which is neither a calendar
+	// interval nor a fixed one, or which would split the time range into more than
+	// MaxHistogramBuckets buckets.
+	ErrInvalidInterval = errors.New("invalid histogram interval")
+	// ErrInvalidSplitAttribute is returned for a histogram split by an attribute other than
+	// those in HistogramSplitAttributes.
+	ErrInvalidSplitAttribute = errors.New("invalid histogram split attribute")
+)
+
+// HistogramSplitAttributes are the attributes by which histogram buckets can be split.
+var HistogramSplitAttributes = []string{pri, app, module, op, status}
+
+// calendarIntervals are the calendar-aware intervals, by name and by single unit quantity.
+var calendarIntervals = map[string]calendarinterval.CalendarInterval{
+	"minute": calendarinterval.Minute, "1m": calendarinterval.Minute,
+	"hour": calendarinterval.Hour, "1h": calendarinterval.Hour,
+	"day": calendarinterval.Day, "1d": calendarinterval.Day,
+	"week": calendarinterval.Week, "1w": calendarinterval.Week,
+	"month": calendarinterval.Month, "1M": calendarinterval.Month,
+	"quarter": calendarinterval.Quarter, "1q": calendarinterval.Quarter,
+	"year": calendarinterval.Year, "1y": calendarinterval.Year,
+}
+
+// calendarIntervalLengths are the shortest lengths of the calendar intervals.
+var calendarIntervalLengths = map[calendarinterval.CalendarInterval]time.Duration{
+	calendarinterval.Minute:  time.Minute,
+	calendarinterval.Hour:    time.Hour,
+	calendarinterval.Day:     23 * time.Hour,
+	calendarinterval.Week:    7*24*time.Hour - time.Hour,
+	calendarinterval.Month:   28*24*time.Hour - time.Hour,
+	calendarinterval.Quarter: 90*24*time.Hour - time.Hour,
+	calendarinterval.Year:    365*24*time.Hour - time.Hour,
+}
+
+// fixedIntervalPattern matches fixed intervals, a number of seconds, minutes, hours or days.
+var fixedIntervalPattern = regexp.MustCompile(`^[1-9][0-9]*[smhd]$`)
+
+// fixedIntervalUnits are the units of fixed intervals.
+var fixedIntervalUnits = map[byte]time.Duration{'s': time.Second, 'm': time.Minute, 'h': time.Hour, 'd': 24 * time.Hour}
+
+// fixedIntervalLength returns the length of a fixed interval matching fixedIntervalPattern.
+func fixedIntervalLength(interval string) (time.Duration, error) {
+	unit := fixedIntervalUnits[interval[len(interval)-1]]
+	n, err := strconv.ParseInt(interval[:len(interval)-1], 10, 64)
+	if err != nil || n > math.MaxInt64/int64(unit) {
+		return 0, fmt.Errorf("%w: %q is too long", ErrInvalidInterval, interval)
+	}
+	return time.Duration(n) * unit, nil
+}
+
+// HistogramParam describes the buckets of a histogram.
+type HistogramParam struct {
+	// Interval is the width of a bucket: a calendar interval (minute, hour, day, week, month,
+	// quarter, year, or 1m, 1h, 1d, 1w, 1M, 1q, 1y), which follows daylight saving time and
+	// month lengths, or a fixed interval such as 30m, 12h or 7d.
+	Interval string
+	SplitBy  *string // Counts each bucket by the values of one of HistogramSplitAttributes
+	TimeZone *string // Time zone of the bucket boundaries, such as Asia/Kolkata or +05:30; UTC if nil
+}
+
+// HistogramBucket is the number of log entries in one interval of a histogram.
+type HistogramBucket struct {
+	Start time.Time
+	Count int64
+	Split map[string]int64 // Counts by value of HistogramParam.SplitBy, if set
+}
+
+// histogramAggregation returns the date histogram of histParam over the time range of
+// setParam. Intervals without entries are returned with a count of 0, so histograms over a
+// time range with more than MaxHistogramBuckets intervals are refused.
+func histogramAggregation(histParam HistogramParam, setParam GetSetParam) (types.Aggregations, error) {
+	hist := &types.DateHistogramAggregation{
+		Field:       some.String(when),
+		MinDocCount: some.Int(0),
+		TimeZone:    histParam.TimeZone,
+	}
+	var length time.Duration
+	if ci, ok := calendarIntervals[histParam.Interval]; ok {
+		hist.CalendarInterval = &ci
+		length = calendarIntervalLengths[ci]
+	} else if fixedIntervalPattern.MatchString(histParam.Interval) {
+		hist.FixedInterval = histParam.Interval
+		var err error
+		if length, err = fixedIntervalLength(histParam.Interval); err != nil {
+			return types.Aggregations{}, err
+		}
+	} else {
+		return types.Aggregations{}, fmt.Errorf("%w: %q", ErrInvalidInterval, histParam.Interval)
+	}
+	if span, ok := histogramSpan(setParam, time.Now()); ok && span/length >= MaxHistogramBuckets {
+		return types.Aggregations{}, fmt.Errorf("%w: %q splits the time range into more than %d buckets",
+			ErrInvalidInterval, histParam.Interval, MaxHistogramBuckets)
+	}
+
+	// Extend the histogram to the whole time range, so that intervals at its ends without
+	// entries are returned too
+	var bounds types.ExtendedBoundsFieldDateMath
+	switch {
+	case setParam.Fromts != nil:
+		bounds.Min = setParam.Fromts.Format(layout)
+	case setParam.Ndays != nil && *setParam.Ndays > 0:
+		bounds.Min = fmt.Sprintf("now-%dd/d", *setParam.Ndays)
+	}
+	if bounds.Min != nil {
+		bounds.Max = "now"
+		if setParam.Tots != nil {
+			bounds.Max = setParam.Tots.Format(layout)
+		}
+		hist.ExtendedBounds = &bounds
+	}
+
+	agg := types.Aggregations{DateHistogram: hist}
+	if histParam.SplitBy != nil {
+		splitBy := *histParam.SplitBy
+		if !slices.Contains(HistogramSplitAttributes, splitBy) {
+			return types.Aggregations{}, fmt.Errorf("%w: %q", ErrInvalidSplitAttribute, splitBy)
+		}
+		agg.Aggregations = map[string]types.Aggregations{
+			logSplit: {Terms: &types.TermsAggregation{Field: some.String(splitBy), Size: some.Int(1000)}},
+		}
+	}
+	return agg, nil
+}
+
+// histogramSpan returns the length of the time range of setParam, up to now, and whether it
+// has a lower bound. Without one, the histogram only spans the entries found, and
+// Elasticsearch's own limit on the number of buckets applies.
+func histogramSpan(setParam GetSetParam, now time.Time) (time.Duration, bool) {
+	to := now
+	if setParam.Tots != nil {
+		to = *setParam.Tots
+	}
+	switch {
+	case setParam.Fromts != nil:
+		return to.Sub(*setParam.Fromts), true
+	case setParam.Ndays != nil && *setParam.Ndays > 0:
+		// now-Nd/d starts at midnight, up to one day earlier
+		return to.Sub(now.AddDate(0, 0, -*setParam.Ndays-1)), true
+	}
+	return 0, false
+}
+
+// GetHistogram counts the log entries specified by setParam in each interval of time given
+// by histParam, optionally split by the values of an attribute, e.g. Err and higher
+// priority entries per app per hour. Buckets are returned in time order.
+func (qc *QueryClient) GetHistogram(ctx context.Context, histParam HistogramParam, setParam GetSetParam) ([]HistogramBucket, error) {
+	agg, err := histogramAggregation(histParam, setParam)
+	if err != nil {
+		return nil, err
+	}
+	query, err := getQuery(setParam)
+	if err != nil {
+		return nil, fmt.Errorf("error while calling getQuery : %w", err)
+	}
+
+	res, err := qc.search(ctx, &search.Request{
+		Query:        query,
+		Size:         some.Int(0),
+		Aggregations: map[string]types.Aggregations{logHistogram: agg},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error runnning search query: %w", err)
+	}
+
+	histAgg, ok := res.Aggregations[logHistogram].(*types.DateHistogramAggregate)
+	if !ok || histAgg == nil {
+		return nil, fmt.Errorf("histogram aggregation is not present or not of type *types.DateHistogramAggregate")
+	}
+	bucketsSlice, ok := histAgg.Buckets.([]types.DateHistogramBucket)
+	if !ok {
+		return nil, fmt.Errorf("histogram aggregation Buckets field has Unknown type: %v , valid type is :%v", reflect.TypeOf(histAgg.Buckets), "[]types.DateHistogramBucket")
+	}
+
+	buckets := make([]HistogramBucket, 0, len(bucketsSlice))
+	for _, b := range bucketsSlice {
+		bucket := HistogramBucket{Start: time.UnixMilli(b.Key).UTC(), Count: b.DocCount}
+		if histParam.SplitBy != nil {
+			bucket.Split, err = splitCounts(b.Aggregations[logSplit])
+			if err != nil {
+				return nil, err
+			}
+		}
+		buckets = append(buckets, bucket)
+	}
+	return buckets, nil
+}
+
+// splitCounts returns the counts of a terms aggregation by key. Keys of numeric attributes
+// such as status are returned in decimal.
+func splitCounts(agg types.Aggregate) (map[string]int64, error) {
+	counts := make(map[string]int64)
+	switch terms := agg.(type) {
+	case *types.StringTermsAggregate:
+		buckets, ok := terms.Buckets.([]types.StringTermsBucket)
+		if !ok {
+			return nil, fmt.Errorf("split aggregation Buckets field has Unknown type: %v", reflect.TypeOf(terms.Buckets))
+		}
+		for _, b := range buckets {
+			key, ok := b.Key.(string)
+			if !ok {
+				return nil, fmt.Errorf("the bucket key is not a string")
+			}
+			counts[key] = b.DocCount
+		}
+	case *types.LongTermsAggregate:
+		buckets, ok := terms.Buckets.([]types.LongTermsBucket)
+		if !ok {
+			return nil, fmt.Errorf("split aggregation Buckets field has Unknown type: %v", reflect.TypeOf(terms.Buckets))
+		}
+		for _, b := range buckets {
+			counts[strconv.FormatInt(b.Key, 10)] = b.DocCount
+		}
+	case *types.UnmappedTermsAggregate:
+		// no entry has the attribute
+	default:
+		return nil, fmt.Errorf("split aggregation is not present or has Unknown type: %v", reflect.TypeOf(agg))
+	}
+	return counts, nil
+}
+
+// GetHistogram counts the log entries specified by setParam in each interval of time given
+// by histParam, optionally split by the values of an attribute.
+// It queries the realm of queryToken with a QueryClient; see QueryClient.GetHistogram.
+func GetHistogram(queryToken string, client *elasticsearch.TypedClient, histParam HistogramParam, setParam GetSetParam) ([]HistogramBucket, error) {
+	qc, err := NewQueryClientForToken(queryToken, client)
+	if err != nil {
+		return nil, err
+	}
+	return qc.GetHistogram(context.Background(), histParam, setParam)
+}
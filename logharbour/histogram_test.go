@@ -0,0 +1,80 @@
+package logharbour
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestQueryClient_GetHistogram(t *testing.T) {
+	f, client := newFakeSearchServer(t, `{"took": 1, "timed_out": false, "_shards": {"total": 1, "successful": 1, "skipped": 0, "failed": 0},
+		"hits": {"total": {"value": 5, "relation": "eq"}, "hits": []},
+		"aggregations": {"date_histogram#loghistogram": {"buckets": [
+			{"key": 1767225600000, "key_as_string": "2026-01-01T00:00:00.000Z", "doc_count": 5,
+			 "sterms#logsplit": {"doc_count_error_upper_bound": 0, "sum_other_doc_count": 0,
+				"buckets": [{"key": "billing", "doc_count": 3}, {"key": "crux", "doc_count": 2}]}},
+			{"key": 1767229200000, "key_as_string": "2026-01-01T01:00:00.000Z", "doc_count": 0,
+			 "sterms#logsplit": {"doc_count_error_upper_bound": 0, "sum_other_doc_count": 0, "buckets": []}}]}}}`)
+	qc := NewQueryClient(client, "logharbour_acme")
+	splitBy, pri, days := app, Err, 2
+
+	buckets, err := qc.GetHistogram(context.Background(), HistogramParam{Interval: "hour", SplitBy: &splitBy}, GetSetParam{Pri: &pri, Ndays: &days})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []HistogramBucket{
+		{Start: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), Count: 5, Split: map[string]int64{"billing": 3, "crux": 2}},
+		{Start: time.Date(2026, 1, 1, 1, 0, 0, 0, time.UTC), Count: 0, Split: map[string]int64{}},
+	}
+	if !reflect.DeepEqual(buckets, want) {
+		t.Errorf("GetHistogram() = %+v, want %+v", buckets, want)
+	}
+
+	aggs, _ := json.Marshal(f.requests[0]["aggregations"])
+	wantAggs := `{"loghistogram":{"aggregations":{"logsplit":{"terms":{"field":"app","size":1000}}},` +
+		`"date_histogram":{"calendar_interval":"hour","extended_bounds":{"max":"now","min":"now-2d/d"},"field":"when","min_doc_count":0}}}`
+	if string(aggs) != wantAggs {
+		t.Errorf("aggregations =\n%s\nwant\n%s", aggs, wantAggs)
+	}
+}
+
+func TestHistogramAggregation_Errors(t *testing.T) {
+	if _, err := histogramAggregation(HistogramParam{Interval: "fortnight"}, GetSetParam{}); !errors.Is(err, ErrInvalidInterval) {
+		t.Errorf("expected ErrInvalidInterval, got %v", err)
+	}
+	splitBy := "msg"
+	if _, err := histogramAggregation(HistogramParam{Interval: "30m", SplitBy: &splitBy}, GetSetParam{}); !errors.Is(err, ErrInvalidSplitAttribute) {
+		t.Errorf("expected ErrInvalidSplitAttribute, got %v", err)
+	}
+}
+
+func TestHistogramAggregation_MaxBuckets(t *testing.T) {
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	week, oneDay := from.AddDate(0, 0, 7), 1
+	tests := []struct {
+		interval string
+		setParam GetSetParam
+		ok       bool
+	}{
+		{"1m", GetSetParam{Fromts: &from, Tots: &week}, false}, // 10080 buckets
+		{"2m", GetSetParam{Fromts: &from, Tots: &week}, true},
+		{"minute", GetSetParam{Fromts: &from, Tots: &week}, false},
+		{"hour", GetSetParam{Fromts: &from, Tots: &week}, true},
+		{"1s", GetSetParam{Ndays: &oneDay}, false},
+		{"1h", GetSetParam{Ndays: &oneDay}, true},
+		{"1s", GetSetParam{}, true}, // spans only the entries found
+		{"99999999999999999999d", GetSetParam{}, false},
+	}
+	for _, tt := range tests {
+		_, err := histogramAggregation(HistogramParam{Interval: tt.interval}, tt.setParam)
+		if tt.ok && err != nil {
+			t.Errorf("%s: unexpected error %v", tt.interval, err)
+		}
+		if !tt.ok && !errors.Is(err, ErrInvalidInterval) {
+			t.Errorf("%s: expected ErrInvalidInterval, got %v", tt.interval, err)
+		}
+	}
+}
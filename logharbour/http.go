@@ -1,6 +1,9 @@
 package logharbour
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
 	"net"
 	"net/http"
 	"strings"
@@ -11,12 +14,95 @@ import (
 // HeaderTraceID is the HTTP header name for trace ID.
 const HeaderTraceID = "X-Trace-ID"
 
-// WithHTTPRequest returns a new Logger with trace ID and client IP extracted
+// W3C Trace Context header names, see https://www.w3.org/TR/trace-context/.
+const (
+	HeaderTraceparent = "traceparent"
+	HeaderTracestate  = "tracestate"
+)
+
+// defaultTraceFlags is used in outgoing traceparent headers when the Logger has no trace flags,
+// e.g. when the trace and span IDs were set with WithTraceID and WithSpanID.
+const defaultTraceFlags = "00"
+
+// TraceParent holds the fields of a W3C traceparent header.
+type TraceParent struct {
+	Version  string // 2 hex digits, "00" for the current version of the spec
+	TraceID  string // 32 lowercase hex digits
+	ParentID string // 16 lowercase hex digits, the span ID of the caller
+	Flags    string // 2 hex digits, "01" if the caller sampled the trace
+}
+
+// ParseTraceParent parses a W3C traceparent header value of the form
+// "version-traceid-parentid-flags", e.g. "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01".
+func ParseTraceParent(header string) (TraceParent, error) {
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) < 4 {
+		return TraceParent{}, fmt.Errorf("invalid traceparent %q: expected 4 fields", header)
+	}
+	tp := TraceParent{Version: parts[0], TraceID: parts[1], ParentID: parts[2], Flags: parts[3]}
+	switch {
+	case !isLowerHex(tp.Version, 2) || tp.Version == "ff":
+		return TraceParent{}, fmt.Errorf("invalid traceparent %q: bad version", header)
+	case tp.Version == "00" && len(parts) != 4:
+		return TraceParent{}, fmt.Errorf("invalid traceparent %q: version 00 must have 4 fields", header)
+	case !IsValidTraceID(tp.TraceID):
+		return TraceParent{}, fmt.Errorf("invalid traceparent %q: bad trace ID", header)
+	case !IsValidSpanID(tp.ParentID):
+		return TraceParent{}, fmt.Errorf("invalid traceparent %q: bad parent ID", header)
+	case !isLowerHex(tp.Flags, 2):
+		return TraceParent{}, fmt.Errorf("invalid traceparent %q: bad flags", header)
+	}
+	return tp, nil
+}
+
+// String formats the TraceParent as a traceparent header value.
+func (tp TraceParent) String() string {
+	return tp.Version + "-" + tp.TraceID + "-" + tp.ParentID + "-" + tp.Flags
+}
+
+// IsValidTraceID reports whether id is a valid W3C trace ID: 32 lowercase hex digits, not all zero.
+func IsValidTraceID(id string) bool {
+	return isLowerHex(id, 32) && strings.Trim(id, "0") != ""
+}
+
+// IsValidSpanID reports whether id is a valid W3C span (parent) ID: 16 lowercase hex digits, not all zero.
+func IsValidSpanID(id string) bool {
+	return isLowerHex(id, 16) && strings.Trim(id, "0") != ""
+}
+
+// isLowerHex reports whether s consists of exactly n lowercase hex digits.
+func isLowerHex(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for _, c := range s {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// newSpanID generates a random W3C span ID.
+func newSpanID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		// crypto/rand does not fail on supported platforms; fall back to KSUID payload bytes just in case
+		copy(b, ksuid.New().Payload())
+	}
+	return hex.EncodeToString(b)
+}
+
+// WithHTTPRequest returns a new Logger with trace ID, span ID and client IP extracted
 // from the HTTP request.
 //
-// Trace ID is extracted from the X-Trace-ID header. If not present, a new KSUID
-// is generated. This allows distributed tracing across services when the upstream
-// service passes along the trace ID.
+// If the request carries a valid W3C traceparent header, its trace ID is used, a new span ID
+// is generated for the work done by this service, and the trace flags and tracestate header
+// are kept so that they can be propagated with InjectTraceHeaders or TraceTransport.
+// Otherwise the trace ID is extracted from the X-Trace-ID header, and if that is not present
+// either, a new KSUID is generated; the span ID, trace flags and tracestate of l are dropped.
+// This allows distributed tracing across services when the upstream service passes along
+// the trace ID.
 //
 // Client IP is extracted in this order:
 //   - X-Forwarded-For header (first IP) - standard header set by proxies/load balancers
@@ -26,9 +112,20 @@ const HeaderTraceID = "X-Trace-ID"
 // When behind a reverse proxy, configure the proxy to set X-Forwarded-For or X-Real-IP,
 // otherwise RemoteAddr will contain the proxy's IP instead of the client's IP.
 func (l *Logger) WithHTTPRequest(r *http.Request) *Logger {
-	return l.
-		WithTraceID(extractOrGenerateTraceID(r)).
-		WithRemoteIP(extractClientIP(r))
+	newLogger := l.WithRemoteIP(extractClientIP(r))
+	if tp, err := ParseTraceParent(r.Header.Get(HeaderTraceparent)); err == nil {
+		newLogger.traceId = tp.TraceID
+		newLogger.spanId = newSpanID()
+		newLogger.traceFlags = tp.Flags
+		newLogger.traceState = r.Header.Get(HeaderTracestate)
+		return newLogger
+	}
+	// The span, flags and tracestate of the Logger's own trace do not belong to this one
+	newLogger.traceId = extractOrGenerateTraceID(r)
+	newLogger.spanId = ""
+	newLogger.traceFlags = ""
+	newLogger.traceState = ""
+	return newLogger
 }
 
 // extractOrGenerateTraceID gets trace ID from X-Trace-ID header.
@@ -70,3 +167,63 @@ func extractClientIP(r *http.Request) string {
 	}
 	return host
 }
+
+// InjectTraceHeaders sets the trace headers for an outgoing HTTP request made on behalf
+// of the Logger's current trace, so that the downstream service logs under the same trace ID.
+//
+// X-Trace-ID is always set when the Logger has a trace ID. The traceparent header is set only
+// when the trace ID and span ID are valid W3C IDs, since KSUID trace IDs cannot be represented
+// in it; the tracestate header is passed on unchanged when present.
+func (l *Logger) InjectTraceHeaders(h http.Header) {
+	if l.traceId == "" {
+		return
+	}
+	h.Set(HeaderTraceID, l.traceId)
+	if !IsValidTraceID(l.traceId) || !IsValidSpanID(l.spanId) {
+		return
+	}
+	flags := l.traceFlags
+	if flags == "" {
+		flags = defaultTraceFlags
+	}
+	h.Set(HeaderTraceparent, TraceParent{Version: "00", TraceID: l.traceId, ParentID: l.spanId, Flags: flags}.String())
+	if l.traceState != "" {
+		h.Set(HeaderTracestate, l.traceState)
+	}
+}
+
+// TraceTransport is an http.RoundTripper which adds trace headers to outgoing requests.
+//
+// The headers are taken from the Logger stored in the request context with NewContext,
+// combined with any values set with the ContextWith* functions (see Logger.WithContext).
+// If the context has no Logger, the Logger field is used instead; if that is nil as well,
+// the request is sent unchanged.
+//
+// Example:
+//
+//	client := &http.Client{Transport: &logharbour.TraceTransport{}}
+//	req, _ := http.NewRequestWithContext(r.Context(), http.MethodGet, url, nil)
+//	resp, err := client.Do(req)
+type TraceTransport struct {
+	Base   http.RoundTripper // Transport used to send the request; http.DefaultTransport if nil.
+	Logger *Logger           // Logger used when the request context has none.
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *TraceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	l := FromContext(req.Context())
+	if l == nil {
+		l = t.Logger
+	}
+	if l == nil {
+		return base.RoundTrip(req)
+	}
+	// A RoundTripper must not modify the request it was given.
+	outReq := req.Clone(req.Context())
+	l.WithContext(req.Context()).InjectTraceHeaders(outReq.Header)
+	return base.RoundTrip(outReq)
+}
@@ -1,11 +1,14 @@
 package logharbour
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+
+	"go.opentelemetry.io/otel/trace"
 )
 
 func TestExtractOrGenerateTraceID(t *testing.T) {
@@ -264,3 +267,174 @@ func ExampleLogger_WithHTTPRequest() {
 	// has trace_id: true
 	// has remote_ip: true
 }
+
+func TestParseTraceParent(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		want    TraceParent
+		wantErr bool
+	}{
+		{
+			name:   "valid header",
+			header: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			want:   TraceParent{Version: "00", TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", ParentID: "00f067aa0ba902b7", Flags: "01"},
+		},
+		{
+			name:   "future version with extra fields",
+			header: "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+			want:   TraceParent{Version: "01", TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", ParentID: "00f067aa0ba902b7", Flags: "01"},
+		},
+		{name: "empty", header: "", wantErr: true},
+		{name: "invalid version ff", header: "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", wantErr: true},
+		{name: "version 00 with extra fields", header: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", wantErr: true},
+		{name: "all zero trace ID", header: "00-00000000000000000000000000000000-00f067aa0ba902b7-01", wantErr: true},
+		{name: "all zero parent ID", header: "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", wantErr: true},
+		{name: "uppercase trace ID", header: "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", wantErr: true},
+		{name: "short parent ID", header: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa-01", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseTraceParent(tt.header)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestWithHTTPRequest_Traceparent(t *testing.T) {
+	logger := NewLogger(NewLoggerContext(Info), "test-app", nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(HeaderTraceparent, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req.Header.Set(HeaderTracestate, "vendor=value")
+	req.Header.Set(HeaderTraceID, "ignored-when-traceparent-present")
+
+	newLogger := logger.WithHTTPRequest(req)
+
+	if newLogger.traceId != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("expected trace ID from traceparent, got %q", newLogger.traceId)
+	}
+	if !IsValidSpanID(newLogger.spanId) || newLogger.spanId == "00f067aa0ba902b7" {
+		t.Errorf("expected a new span ID for this service, got %q", newLogger.spanId)
+	}
+
+	h := http.Header{}
+	newLogger.InjectTraceHeaders(h)
+	want := "00-4bf92f3577b34da6a3ce929d0e0e4736-" + newLogger.spanId + "-01"
+	if got := h.Get(HeaderTraceparent); got != want {
+		t.Errorf("expected traceparent %q, got %q", want, got)
+	}
+	if got := h.Get(HeaderTracestate); got != "vendor=value" {
+		t.Errorf("expected tracestate to be propagated, got %q", got)
+	}
+	if got := h.Get(HeaderTraceID); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("expected X-Trace-ID to be propagated, got %q", got)
+	}
+}
+
+func TestWithHTTPRequest_DropsParentTrace(t *testing.T) {
+	parent := NewLogger(NewLoggerContext(Info), "test-app", nil)
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(HeaderTraceparent, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	req.Header.Set(HeaderTracestate, "vendor=value")
+	parent = parent.WithHTTPRequest(req)
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(HeaderTraceID, "0af7651916cd43dd8448eb211c80319c")
+	newLogger := parent.WithHTTPRequest(req)
+
+	if newLogger.traceId != "0af7651916cd43dd8448eb211c80319c" {
+		t.Errorf("expected trace ID from X-Trace-ID, got %q", newLogger.traceId)
+	}
+	if newLogger.spanId != "" || newLogger.traceFlags != "" || newLogger.traceState != "" {
+		t.Errorf("expected the parent's span, flags and tracestate to be dropped, got %q %q %q",
+			newLogger.spanId, newLogger.traceFlags, newLogger.traceState)
+	}
+	h := http.Header{}
+	newLogger.InjectTraceHeaders(h)
+	if got := h.Get(HeaderTraceparent); got != "" {
+		t.Errorf("expected no traceparent without a span, got %q", got)
+	}
+	if got := h.Get(HeaderTracestate); got != "" {
+		t.Errorf("expected no tracestate, got %q", got)
+	}
+}
+
+func TestInjectTraceHeaders_NonW3CTraceID(t *testing.T) {
+	logger := NewLogger(NewLoggerContext(Info), "test-app", nil).WithTraceID("ksuid-trace").WithSpanID("00f067aa0ba902b7")
+
+	h := http.Header{}
+	logger.InjectTraceHeaders(h)
+
+	if got := h.Get(HeaderTraceID); got != "ksuid-trace" {
+		t.Errorf("expected X-Trace-ID %q, got %q", "ksuid-trace", got)
+	}
+	if got := h.Get(HeaderTraceparent); got != "" {
+		t.Errorf("expected no traceparent for a non-W3C trace ID, got %q", got)
+	}
+}
+
+func TestWithSpanID(t *testing.T) {
+	var buf strings.Builder
+	logger := NewLogger(NewLoggerContext(Info), "test-app", &buf)
+
+	logger.WithSpanID("00f067aa0ba902b7").Log("test message")
+
+	if logger.spanId != "" {
+		t.Errorf("original logger spanId should be empty, got %q", logger.spanId)
+	}
+	if !strings.Contains(buf.String(), `"span_id":"00f067aa0ba902b7"`) {
+		t.Errorf("expected span_id in output, got: %s", buf.String())
+	}
+}
+
+func TestWithOTelSpan(t *testing.T) {
+	logger := NewLogger(NewLoggerContext(Info), "test-app", nil).WithTraceID("unchanged")
+
+	if got := logger.WithOTelSpan(context.Background()); got.traceId != "unchanged" {
+		t.Errorf("expected trace ID to be unchanged without a span, got %q", got.traceId)
+	}
+
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	sc := trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID, TraceFlags: trace.FlagsSampled})
+	ctx := trace.ContextWithSpanContext(context.Background(), sc)
+
+	got := logger.WithOTelSpan(ctx)
+	if got.traceId != "4bf92f3577b34da6a3ce929d0e0e4736" || got.spanId != "00f067aa0ba902b7" || got.traceFlags != "01" {
+		t.Errorf("unexpected trace fields: trace=%q span=%q flags=%q", got.traceId, got.spanId, got.traceFlags)
+	}
+}
+
+func TestTraceTransport(t *testing.T) {
+	var received http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+	}))
+	defer server.Close()
+
+	logger := NewLogger(NewLoggerContext(Info), "test-app", nil).
+		WithTraceID("4bf92f3577b34da6a3ce929d0e0e4736").
+		WithSpanID("00f067aa0ba902b7")
+	client := &http.Client{Transport: &TraceTransport{}}
+
+	req, _ := http.NewRequestWithContext(NewContext(context.Background(), logger), http.MethodGet, server.URL, nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if got := received.Get(HeaderTraceparent); got != "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00" {
+		t.Errorf("unexpected traceparent %q", got)
+	}
+	if req.Header.Get(HeaderTraceID) != "" {
+		t.Error("TraceTransport must not modify the original request")
+	}
+}
@@ -0,0 +1,326 @@
+package logharbour
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"sync"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/core/search"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/sortorder"
+)
+
+// IntegrityChain makes log entries tamper-evident by chaining them with hashes.
+//
+// Entries are grouped into streams, one per app and system. Within a stream, each entry gets
+// a sequence number starting at 1 (Seq), the hash of the previous entry (PrevHash), and its
+// own hash (Hash), computed over the canonical JSON encoding of the entry without the Hash
+// field.
+// If a key is given, the hash is an HMAC-SHA256 under that key, typically one key per realm,
+// so that someone with write access to the index but without the key cannot forge a
+// consistent chain. Otherwise it is a plain SHA-256.
+//
+// Editing, deleting or reordering documents in the log repository then breaks the chain,
+// which VerifyChain and ChainVerifier detect.
+//
+// Each stream must be written by a single process: two processes with the same app and
+// system would produce two interleaved chains. A restarted process starts a new chain at
+// sequence number 1 unless it resumes with ResumeStream.
+//
+// An IntegrityChain takes effect once it is set on a LoggerContext with SetIntegrityChain.
+type IntegrityChain struct {
+	key     []byte
+	mu      sync.Mutex
+	streams map[chainStreamKey]*chainStream
+}
+
+// chainStreamKey identifies a stream of chained entries.
+type chainStreamKey struct {
+	app    string
+	system string
+}
+
+// chainStream holds the position of a stream. Its mutex is held while an entry is sealed
+// and written, so that entries reach the writer in sequence order.
+type chainStream struct {
+	mu       sync.Mutex
+	seq      uint64
+	prevHash string
+	prevWhen time.Time
+}
+
+// NewIntegrityChain creates an IntegrityChain which signs entries with key, or only hashes
+// them if key is empty.
+func NewIntegrityChain(key []byte) *IntegrityChain {
+	return &IntegrityChain{
+		key:     key,
+		streams: make(map[chainStreamKey]*chainStream),
+	}
+}
+
+// SetIntegrityChain sets the IntegrityChain applied to the entries of all loggers sharing
+// this context. Passing nil disables chaining.
+func (lc *LoggerContext) SetIntegrityChain(c *IntegrityChain) {
+	lc.integrity.Store(c)
+}
+
+// ResumeStream sets the position of the stream of app and system, so that a restarted
+// process continues the chain after the entry with sequence number seq and hash lastHash,
+// e.g. as found with GetLogs, instead of starting a new chain.
+func (c *IntegrityChain) ResumeStream(app, system string, seq uint64, lastHash string) {
+	s := c.stream(app, system)
+	s.mu.Lock()
+	s.seq, s.prevHash = seq, lastHash
+	s.mu.Unlock()
+}
+
+// stream returns the stream of app and system, creating it if needed.
+func (c *IntegrityChain) stream(app, system string) *chainStream {
+	key := chainStreamKey{app: app, system: system}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.streams[key]
+	if !ok {
+		s = &chainStream{}
+		c.streams[key] = s
+	}
+	return s
+}
+
+// writeChained assigns the next sequence number and the hashes to entry and passes it to
+// write. The stream only advances if sealing succeeds; a write error leaves a gap, which
+// the verifier reports, rather than hiding the loss of the entry.
+//
+// An entry is timestamped before it gets here, so an entry logged concurrently with the
+// previous one may be dated before it. Its timestamp is then moved up to that of the
+// previous entry, so that the order by timestamp and sequence number in which VerifyChain
+// reads a chain is the order it was written in.
+func (c *IntegrityChain) writeChained(entry *LogEntry, write func(LogEntry) error) error {
+	s := c.stream(entry.App, entry.System)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if entry.When.Before(s.prevWhen) {
+		entry.When = s.prevWhen
+	}
+	entry.Seq = s.seq + 1
+	entry.PrevHash = s.prevHash
+	entryHash, err := ComputeEntryHash(*entry, c.key)
+	if err != nil {
+		return fmt.Errorf("failed to hash log entry: %w", err)
+	}
+	entry.Hash = entryHash
+	s.seq, s.prevHash, s.prevWhen = entry.Seq, entryHash, entry.When
+	return write(*entry)
+}
+
+// ComputeEntryHash returns the hash of entry as set by IntegrityChain: the hex-encoded
+// SHA-256, or HMAC-SHA256 if key is not empty, of the canonical JSON encoding of the entry
+// with its Hash field cleared.
+//
+// The encoding is canonical in that object keys are sorted and numbers are kept as written,
+// so that an entry read back from the log repository, where debug data and change values
+// become generic maps, hashes the same as when it was written.
+func ComputeEntryHash(entry LogEntry, key []byte) (string, error) {
+	entry.Hash = ""
+	data, err := canonicalJSON(entry)
+	if err != nil {
+		return "", err
+	}
+	var h hash.Hash
+	if len(key) > 0 {
+		h = hmac.New(sha256.New, key)
+	} else {
+		h = sha256.New()
+	}
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// canonicalJSON encodes v as JSON with the keys of all objects sorted.
+func canonicalJSON(v any) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var generic any
+	if err := dec.Decode(&generic); err != nil {
+		return nil, err
+	}
+	return json.Marshal(generic)
+}
+
+// ChainIssueKind classifies the problems found by ChainVerifier.
+type ChainIssueKind string
+
+const (
+	// ChainGap means entries are missing before the reported one.
+	ChainGap ChainIssueKind = "gap"
+	// ChainModified means the entry's hash does not match its content.
+	ChainModified ChainIssueKind = "modified"
+	// ChainReordered means the entry's previous hash belongs to an entry other than its predecessor.
+	ChainReordered ChainIssueKind = "reordered"
+	// ChainBrokenLink means the entry's previous hash matches no entry seen, e.g. because the
+	// predecessor was modified and its hash recomputed without the key.
+	ChainBrokenLink ChainIssueKind = "broken_link"
+	// ChainDuplicate means the sequence number was already seen.
+	ChainDuplicate ChainIssueKind = "duplicate"
+	// ChainRestart means a new chain starts at the entry, normally because the writing
+	// process was restarted.
+	ChainRestart ChainIssueKind = "restart"
+)
+
+// ChainIssue is a problem found in a chain of entries.
+type ChainIssue struct {
+	Kind   ChainIssueKind `json:"kind"`
+	Seq    uint64         `json:"seq"`
+	Id     string         `json:"id"`
+	Detail string         `json:"detail,omitempty"`
+}
+
+// ChainReport is the result of verifying a chain of entries.
+type ChainReport struct {
+	Checked  int          `json:"checked"`
+	FirstSeq uint64       `json:"first_seq"`
+	LastSeq  uint64       `json:"last_seq"`
+	Issues   []ChainIssue `json:"issues"`
+}
+
+// OK reports whether no issues other than chain restarts were found.
+func (r ChainReport) OK() bool {
+	for _, issue := range r.Issues {
+		if issue.Kind != ChainRestart {
+			return false
+		}
+	}
+	return true
+}
+
+// ChainVerifier checks the entries of one stream, fed to Add in the order they were written,
+// i.e. by ascending timestamp and sequence number.
+type ChainVerifier struct {
+	key      []byte
+	report   ChainReport
+	prev     *LogEntry
+	seenHash map[string]uint64 // Hash of each entry seen, to tell reorderings from broken links.
+}
+
+// NewChainVerifier creates a ChainVerifier for entries chained with key.
+func NewChainVerifier(key []byte) *ChainVerifier {
+	return &ChainVerifier{key: key, seenHash: make(map[string]uint64), report: ChainReport{Issues: []ChainIssue{}}}
+}
+
+// Add checks the next entry of the stream.
+func (v *ChainVerifier) Add(entry LogEntry) {
+	v.report.Checked++
+	if v.report.FirstSeq == 0 {
+		v.report.FirstSeq = entry.Seq
+	}
+	v.report.LastSeq = entry.Seq
+
+	if computed, err := ComputeEntryHash(entry, v.key); err != nil || !hmac.Equal([]byte(computed), []byte(entry.Hash)) {
+		v.addIssue(ChainModified, entry, "hash does not match content")
+	}
+
+	if v.prev != nil {
+		switch {
+		case entry.Seq == 1 && entry.PrevHash == "":
+			v.addIssue(ChainRestart, entry, "")
+		case entry.Seq == v.prev.Seq:
+			v.addIssue(ChainDuplicate, entry, "")
+		case entry.Seq < v.prev.Seq:
+			v.addIssue(ChainReordered, entry, fmt.Sprintf("seq %d follows seq %d", entry.Seq, v.prev.Seq))
+		case entry.Seq > v.prev.Seq+1:
+			v.addIssue(ChainGap, entry, fmt.Sprintf("%d entries missing after seq %d", entry.Seq-v.prev.Seq-1, v.prev.Seq))
+		case entry.PrevHash != v.prev.Hash:
+			if seq, ok := v.seenHash[entry.PrevHash]; ok {
+				v.addIssue(ChainReordered, entry, fmt.Sprintf("previous hash belongs to seq %d", seq))
+			} else {
+				v.addIssue(ChainBrokenLink, entry, "previous hash does not match the preceding entry")
+			}
+		}
+	} else if entry.Seq > 1 && entry.PrevHash == "" {
+		v.addIssue(ChainBrokenLink, entry, "missing previous hash")
+	}
+
+	v.seenHash[entry.Hash] = entry.Seq
+	prev := entry
+	v.prev = &prev
+}
+
+func (v *ChainVerifier) addIssue(kind ChainIssueKind, entry LogEntry, detail string) {
+	v.report.Issues = append(v.report.Issues, ChainIssue{Kind: kind, Seq: entry.Seq, Id: entry.Id, Detail: detail})
+}
+
+// Report returns the result of the checks so far.
+func (v *ChainVerifier) Report() ChainReport {
+	return v.report
+}
+
+// chainVerifyPageSize is the number of entries fetched per search by VerifyChain.
+var chainVerifyPageSize = 1000
+
+// VerifyChain walks the integrity chain of appName and systemName in the log repository, oldest
+// entry first, and reports gaps, reorderings and modified entries. key is the key the
+// entries were chained with, or nil if they were only hashed. Entries written without an
+// IntegrityChain are skipped. It queries the realm of querytoken; see QueryClient.VerifyChain.
+func VerifyChain(querytoken string, client *elasticsearch.TypedClient, appName, systemName string, key []byte) (ChainReport, error) {
+	qc, err := NewQueryClientForToken(querytoken, client)
+	if err != nil {
+		return ChainReport{}, err
+	}
+	return qc.VerifyChain(context.Background(), appName, systemName, key)
+}
+
+// VerifyChain walks the integrity chain of appName and systemName in the QueryClient's index;
+// see the function VerifyChain.
+func (qc *QueryClient) VerifyChain(ctx context.Context, appName, systemName string, key []byte) (ChainReport, error) {
+	_, appQuery := termQueryForField(app, &appName)
+	_, systemQuery := termQueryForField(system, &systemName)
+	query := &types.Query{
+		Bool: &types.BoolQuery{
+			Filter: []types.Query{appQuery, systemQuery, {Exists: &types.ExistsQuery{Field: "seq"}}},
+		},
+	}
+	sortByWhen := types.SortOptions{
+		SortOptions: map[string]types.FieldSort{when: {Order: &sortorder.Asc}},
+	}
+	sortBySeq := types.SortOptions{
+		SortOptions: map[string]types.FieldSort{"seq": {Order: &sortorder.Asc}},
+	}
+
+	verifier := NewChainVerifier(key)
+	var searchAfter []types.FieldValue
+	for {
+		res, err := qc.search(ctx, &search.Request{
+			Size:        &chainVerifyPageSize,
+			Query:       query,
+			Sort:        []types.SortCombinations{sortByWhen, sortBySeq},
+			SearchAfter: searchAfter,
+		})
+		if err != nil {
+			return ChainReport{}, fmt.Errorf("error while searching document in es: %w", err)
+		}
+		for _, hit := range res.Hits.Hits {
+			var entry LogEntry
+			if err := json.Unmarshal(hit.Source_, &entry); err != nil {
+				return ChainReport{}, fmt.Errorf("error while unmarshalling response: %w", err)
+			}
+			verifier.Add(entry)
+		}
+		if len(res.Hits.Hits) < chainVerifyPageSize {
+			return verifier.Report(), nil
+		}
+		searchAfter = res.Hits.Hits[len(res.Hits.Hits)-1].Sort
+	}
+}
@@ -0,0 +1,174 @@
+package logharbour
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"testing"
+	"time"
+)
+
+// chainedEntries logs n activity and debug entries through an IntegrityChain and returns them as read
+// back from the output.
+func chainedEntries(t *testing.T, key []byte, n int) []LogEntry {
+	t.Helper()
+	var buf bytes.Buffer
+	lctx := NewLoggerContext(Info)
+	lctx.SetDebugMode(true)
+	lctx.SetIntegrityChain(NewIntegrityChain(key))
+	logger := NewLogger(lctx, "TestApp", &buf).WithSystem("node1")
+	for i := 0; i < n; i++ {
+		if i%2 == 0 {
+			logger.LogActivity("login", map[string]any{"attempt": i})
+		} else {
+			logger.LogDebug("state", map[string]any{"b": 2, "a": []int{i}})
+		}
+	}
+	return decodeEntries(t, &buf)
+}
+
+func issueKinds(r ChainReport) []ChainIssueKind {
+	kinds := []ChainIssueKind{}
+	for _, issue := range r.Issues {
+		kinds = append(kinds, issue.Kind)
+	}
+	return kinds
+}
+
+func verify(key []byte, entries []LogEntry) ChainReport {
+	v := NewChainVerifier(key)
+	for _, e := range entries {
+		v.Add(e)
+	}
+	return v.Report()
+}
+
+func TestIntegrityChain_Seal(t *testing.T) {
+	key := []byte("realm key")
+	entries := chainedEntries(t, key, 4)
+	if len(entries) != 4 {
+		t.Fatalf("expected 4 entries, got %d", len(entries))
+	}
+	for i, e := range entries {
+		if e.Seq != uint64(i+1) || e.Hash == "" {
+			t.Errorf("entry %d: unexpected seq %d or hash %q", i, e.Seq, e.Hash)
+		}
+		if i > 0 && e.PrevHash != entries[i-1].Hash {
+			t.Errorf("entry %d: previous hash does not link to entry %d", i, i-1)
+		}
+	}
+	if entries[0].PrevHash != "" {
+		t.Errorf("expected the first entry to have no previous hash, got %q", entries[0].PrevHash)
+	}
+
+	report := verify(key, entries)
+	if !report.OK() || report.Checked != 4 || report.FirstSeq != 1 || report.LastSeq != 4 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+	if report := verify([]byte("wrong key"), entries); len(report.Issues) != 4 {
+		t.Errorf("expected every entry to fail with the wrong key, got %+v", report)
+	}
+}
+
+func TestChainVerifier_Tampering(t *testing.T) {
+	key := []byte("realm key")
+	tests := []struct {
+		name   string
+		tamper func([]LogEntry) []LogEntry
+		want   []ChainIssueKind
+	}{
+		{"gap", func(e []LogEntry) []LogEntry {
+			return append(e[:2:2], e[3:]...)
+		}, []ChainIssueKind{ChainGap}},
+		{"modified", func(e []LogEntry) []LogEntry {
+			e[1].Msg = "nothing to see"
+			return e
+		}, []ChainIssueKind{ChainModified}},
+		{"rehashed without key", func(e []LogEntry) []LogEntry {
+			e[1].Msg = "nothing to see"
+			e[1].Hash, _ = ComputeEntryHash(e[1], nil)
+			return e
+		}, []ChainIssueKind{ChainModified, ChainBrokenLink}},
+		{"reordered", func(e []LogEntry) []LogEntry {
+			e[1], e[2] = e[2], e[1]
+			return e
+		}, []ChainIssueKind{ChainGap, ChainReordered, ChainGap}},
+		{"duplicate", func(e []LogEntry) []LogEntry {
+			return append(e[:2:2], e[1:]...)
+		}, []ChainIssueKind{ChainDuplicate}},
+		{"restart", func(e []LogEntry) []LogEntry {
+			return append(e, chainedEntries(t, key, 1)...)
+		}, []ChainIssueKind{ChainRestart}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := verify(key, tt.tamper(chainedEntries(t, key, 5)))
+			got := issueKinds(report)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got issues %v, want %v", report.Issues, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("got issues %v, want %v", report.Issues, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestComputeEntryHash_RoundTrip(t *testing.T) {
+	entries := chainedEntries(t, nil, 2)
+	for _, e := range entries {
+		// Entries read back from Elasticsearch are decoded and re-encoded once more.
+		data, err := json.Marshal(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded LogEntry
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := ComputeEntryHash(decoded, nil); got != e.Hash {
+			t.Errorf("hash changed after a round trip: %s != %s", got, e.Hash)
+		}
+	}
+}
+
+func TestIntegrityChain_ResumeStream(t *testing.T) {
+	var buf bytes.Buffer
+	lctx := NewLoggerContext(Info)
+	chain := NewIntegrityChain(nil)
+	chain.ResumeStream("TestApp", "node1", 41, "abc")
+	lctx.SetIntegrityChain(chain)
+	NewLogger(lctx, "TestApp", &buf).WithSystem("node1").LogActivity("resumed", nil)
+
+	entries := decodeEntries(t, &buf)
+	if len(entries) != 1 || entries[0].Seq != 42 || entries[0].PrevHash != "abc" {
+		t.Errorf("unexpected entries: %+v", entries)
+	}
+}
+
+func TestIntegrityChain_ConcurrentTimestamps(t *testing.T) {
+	chain := NewIntegrityChain(nil)
+	var written []LogEntry
+	write := func(e LogEntry) error { written = append(written, e); return nil }
+
+	// The second entry was timestamped first, but took the stream's lock last
+	late := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	for _, when := range []time.Time{late, late.Add(-time.Millisecond)} {
+		if err := chain.writeChained(&LogEntry{App: "TestApp", When: when}, write); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !written[1].When.Equal(late) {
+		t.Errorf("expected the second entry to be dated %v, got %v", late, written[1].When)
+	}
+
+	// Read back by timestamp and sequence number, as VerifyChain does, the chain is intact
+	sort.SliceStable(written, func(i, j int) bool {
+		return written[i].When.Before(written[j].When) || written[i].When.Equal(written[j].When) && written[i].Seq < written[j].Seq
+	})
+	if r := verify(nil, written); len(r.Issues) != 0 {
+		t.Errorf("unexpected issues: %+v", r.Issues)
+	}
+}
@@ -0,0 +1,96 @@
+package logharbour
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/oschwald/geoip2-golang"
+)
+
+// ErrInvalidIP is returned by GetLogsForIP for an IP which is not an IPv4 or IPv6 address or
+// CIDR range.
+var ErrInvalidIP = errors.New("invalid IP address or CIDR range")
+
+// GetLogsForIPParam selects the log entries of a remote IP address or range.
+type GetLogsForIPParam struct {
+	App      *string
+	IP       string  // IPv4 or IPv6 address, e.g. 203.0.113.7, or CIDR range, e.g. 203.0.113.0/24 or 2001:db8::/32
+	NDays    *int    // Entries of the last NDays days; all entries if nil
+	PageSize *int    // Entries per page; the QueryClient's page size if nil
+	Cursor   *string // NextCursor of the previous page
+}
+
+// IPLogPage is a page of the log entries of an IP address or range, with the location of
+// each remote IP of the page.
+type IPLogPage struct {
+	LogPage
+	Locations map[string]IPLocation // By remote IP; IPs which the GeoLite database cannot locate are left out
+}
+
+// ParseIPFilter validates an IPv4 or IPv6 address or CIDR range, and returns it in canonical
+// form, e.g. "2001:db8::1" for "2001:0db8:0:0::1" and "10.1.0.0/16" for "10.1.2.3/16".
+func ParseIPFilter(ip string) (string, error) {
+	ip = strings.TrimSpace(ip)
+	if strings.Contains(ip, "/") {
+		_, ipNet, err := net.ParseCIDR(ip)
+		if err != nil {
+			return "", fmt.Errorf("%w: %q", ErrInvalidIP, ip)
+		}
+		return ipNet.String(), nil
+	}
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return "", fmt.Errorf("%w: %q", ErrInvalidIP, ip)
+	}
+	return parsed.String(), nil
+}
+
+// GetLogsForIP retrieves a page of the log entries from an IP address or range, latest first,
+// so that an unusual IP of GetUnusualIP can be followed to its activity. geoLiteDb may be nil,
+// in which case the page has no locations.
+// It queries the realm of queryToken with a QueryClient; see QueryClient.GetLogsForIP.
+func GetLogsForIP(queryToken string, client *elasticsearch.TypedClient, geoLiteDb *geoip2.Reader, param GetLogsForIPParam) (IPLogPage, error) {
+	qc, err := NewQueryClientForToken(queryToken, client)
+	if err != nil {
+		return IPLogPage{}, err
+	}
+	return qc.GetLogsForIP(context.Background(), geoLiteDb, param)
+}
+
+// GetLogsForIP retrieves a page of the log entries from an IP address or range; see the
+// GetLogsForIP function.
+func (qc *QueryClient) GetLogsForIP(ctx context.Context, geoLiteDb *geoip2.Reader, param GetLogsForIPParam) (IPLogPage, error) {
+	ip, err := ParseIPFilter(param.IP)
+	if err != nil {
+		return IPLogPage{}, err
+	}
+	// remote_ip is mapped as an ip, so a term query on a range matches the addresses in it
+	page, err := qc.GetLogsPage(ctx, GetLogsParam{
+		App:      param.App,
+		RemoteIP: &ip,
+		NDays:    param.NDays,
+		PageSize: param.PageSize,
+		Cursor:   param.Cursor,
+	})
+	if err != nil {
+		return IPLogPage{}, err
+	}
+
+	result := IPLogPage{LogPage: page, Locations: make(map[string]IPLocation)}
+	if geoLiteDb == nil {
+		return result, nil
+	}
+	for _, entry := range page.Entries {
+		if _, ok := result.Locations[entry.RemoteIP]; ok || entry.RemoteIP == "" {
+			continue
+		}
+		if location, _, ok := geoLocate(entry.RemoteIP, geoLiteDb); ok {
+			result.Locations[entry.RemoteIP] = location
+		}
+	}
+	return result, nil
+}
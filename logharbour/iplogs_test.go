@@ -0,0 +1,58 @@
+package logharbour
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestParseIPFilter(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want string
+	}{
+		{"203.0.113.7", "203.0.113.7"},
+		{" 2001:0db8:0:0::1 ", "2001:db8::1"},
+		{"10.1.2.3/16", "10.1.0.0/16"},
+		{"2001:db8::/32", "2001:db8::/32"},
+		{"::ffff:192.0.2.1", "192.0.2.1"},
+	}
+	for _, tt := range tests {
+		got, err := ParseIPFilter(tt.ip)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseIPFilter(%q) = %q, %v; want %q", tt.ip, got, err, tt.want)
+		}
+	}
+	for _, ip := range []string{"", "localhost", "300.1.1.1", "10.0.0.0/33", "10.0.0.1/", "2001:db8::g"} {
+		if _, err := ParseIPFilter(ip); !errors.Is(err, ErrInvalidIP) {
+			t.Errorf("expected ErrInvalidIP for %q, got %v", ip, err)
+		}
+	}
+}
+
+func TestQueryClient_GetLogsForIP(t *testing.T) {
+	f, client := newFakeSearchServer(t, fakeExportPage2)
+	qc := NewQueryClient(client, "logharbour_acme")
+	appName := "billing"
+
+	if _, err := qc.GetLogsForIP(context.Background(), nil, GetLogsForIPParam{App: &appName, IP: "10.0.0"}); !errors.Is(err, ErrInvalidIP) {
+		t.Errorf("expected ErrInvalidIP, got %v", err)
+	}
+	page, err := qc.GetLogsForIP(context.Background(), nil, GetLogsForIPParam{App: &appName, IP: "10.1.2.3/16"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Entries) != 1 || page.Entries[0].Id != "a0" || len(page.Locations) != 0 {
+		t.Errorf("page = %+v", page)
+	}
+
+	var term any
+	for _, filter := range f.requests[0]["query"].(map[string]any)["bool"].(map[string]any)["filter"].([]any) {
+		if t, ok := filter.(map[string]any)["term"].(map[string]any)["remote_ip"]; ok {
+			term = t
+		}
+	}
+	if term == nil || term.(map[string]any)["value"] != "10.1.0.0/16" {
+		t.Errorf("expected a term query on the range, got %v", f.requests[0]["query"])
+	}
+}
@@ -46,6 +46,15 @@ func WithPoolSize(size int) KafkaWriterOption {
 	}
 }
 
+// WithWriteToken sets the write token of the realm the log entries belong to. It is sent in
+// the WriteTokenHeader header of each message, so that the consumer can route the entries to
+// the realm's index.
+func WithWriteToken(token string) KafkaWriterOption {
+	return func(kw *kafkaWriter) {
+		kw.writeToken = token
+	}
+}
+
 func NewKafkaWriter(kafkaConfig KafkaConfig, opts ...KafkaWriterOption) (KafkaWriter, error) {
 	pool, err := newKafkaConnectionPool(defaultPoolSize, kafkaConfig)
 	if err != nil {
@@ -62,8 +71,9 @@ func NewKafkaWriter(kafkaConfig KafkaConfig, opts ...KafkaWriterOption) (KafkaWr
 }
 
 type kafkaWriter struct {
-	pool  *kafkaConnectionPool
-	topic string
+	pool       *kafkaConnectionPool
+	topic      string
+	writeToken string
 }
 
 // Write sends a message to a Kafka topic. It implements io.Writer.
@@ -77,6 +87,9 @@ func (kw *kafkaWriter) Write(p []byte) (n int, err error) {
 		Topic: kw.topic,
 		Value: sarama.ByteEncoder(p),
 	}
+	if kw.writeToken != "" {
+		msg.Headers = []sarama.RecordHeader{{Key: []byte(WriteTokenHeader), Value: []byte(kw.writeToken)}}
+	}
 
 	_, _, err = producer.SendMessage(msg)
 	if err != nil {
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"reflect"
 	"runtime"
 	"sync"
 	"sync/atomic"
@@ -19,10 +20,15 @@ const DefaultPriority = Info
 // LoggerContext provides a shared context (state) for instances of Logger.
 // It contains a minLogPriority field that determines the minimum log priority level
 // that should be logged by any Logger using this context.
-// Both minLogPriority and debugMode use atomic operations for lock-free access.
+// It may also hold filter rules, see SetFilterRules, which take precedence over minLogPriority.
+// minLogPriority, debugMode and the filter rules use atomic operations for lock-free access.
 type LoggerContext struct {
 	minLogPriority int32 // atomic, stores LogPriority value
 	debugMode      int32 // atomic, represents boolean flag
+	filterRules    atomic.Pointer[[]FilterRule]
+	sampler        atomic.Pointer[Sampler]
+	redactor       atomic.Pointer[Redactor]
+	integrity      atomic.Pointer[IntegrityChain]
 	mu             sync.Mutex
 }
 
@@ -50,42 +56,50 @@ func NewLoggerContext(minLogPriority LogPriority) *LoggerContext {
 // This approach provides a flexible way to create a new Logger with specific settings,
 // without having to provide all settings at once or change the settings of an existing Logger.
 type Logger struct {
-	context    *LoggerContext      // Context for the logger. It is shared by all clones of the logger.
-	app        string              // Name of the application.
-	system     string              // System where the application is running.
-	module     string              // Module or subsystem within the application.
-	pri        LogPriority         // Priority level of the log messages.
-	who        string              // User or service performing the operation.
-	op         string              // Operation being performed.
-	class      string              // Class of the object instance involved.
-	instanceId string              // Unique ID of the object instance.
-	status     Status              // Status of the operation.
-	err        string              // Error associated with the operation.
-	remoteIP   string              // IP address of the remote endpoint.
-	traceId    string              // Trace ID for distributed tracing.
-	writer     io.Writer           // Writer interface for log entries.
-	validator  *validator.Validate // Validator for log entries.
-	mu         sync.Mutex          // Mutex for thread-safe operations.
+	context      *LoggerContext      // Context for the logger. It is shared by all clones of the logger.
+	app          string              // Name of the application.
+	system       string              // System where the application is running.
+	module       string              // Module or subsystem within the application.
+	pri          LogPriority         // Priority level of the log messages.
+	who          string              // User or service performing the operation.
+	op           string              // Operation being performed.
+	class        string              // Class of the object instance involved.
+	instanceId   string              // Unique ID of the object instance.
+	status       Status              // Status of the operation.
+	err          string              // Error associated with the operation.
+	remoteIP     string              // IP address of the remote endpoint.
+	traceId      string              // Trace ID for distributed tracing.
+	spanId       string              // Span ID for distributed tracing.
+	traceFlags   string              // W3C trace flags, propagated in outgoing traceparent headers.
+	traceState   string              // W3C tracestate, propagated in outgoing tracestate headers.
+	writer       io.Writer           // Writer interface for log entries.
+	validator    *validator.Validate // Validator for log entries.
+	skipSampling bool                // Set for the Sampler's own summary entries.
+	mu           sync.Mutex          // Mutex for thread-safe operations.
 }
 
 // clone creates and returns a new Logger with the same values as the original.
 func (l *Logger) clone() *Logger {
 	return &Logger{
-		context:    l.context,
-		app:        l.app,
-		system:     l.system,
-		module:     l.module,
-		pri:        l.pri,
-		who:        l.who,
-		op:         l.op,
-		class:      l.class,
-		instanceId: l.instanceId,
-		status:     l.status,
-		err:        l.err,
-		remoteIP:   l.remoteIP,
-		traceId:    l.traceId,
-		writer:     l.writer,
-		validator:  l.validator,
+		context:      l.context,
+		app:          l.app,
+		system:       l.system,
+		module:       l.module,
+		pri:          l.pri,
+		who:          l.who,
+		op:           l.op,
+		class:        l.class,
+		instanceId:   l.instanceId,
+		status:       l.status,
+		err:          l.err,
+		remoteIP:     l.remoteIP,
+		traceId:      l.traceId,
+		spanId:       l.spanId,
+		traceFlags:   l.traceFlags,
+		traceState:   l.traceState,
+		writer:       l.writer,
+		validator:    l.validator,
+		skipSampling: l.skipSampling,
 	}
 }
 
@@ -129,6 +143,14 @@ func (l *Logger) WithModule(module string) *Logger {
 	return newLogger
 }
 
+// WithSystem returns a new Logger with the 'system' field set to the specified value.
+// By default the system is the host name of the machine.
+func (l *Logger) WithSystem(system string) *Logger {
+	newLogger := l.clone()
+	newLogger.system = system
+	return newLogger
+}
+
 // WithOp returns a new Logger with the 'op' field set to the specified value.
 func (l *Logger) WithOp(op string) *Logger {
 	newLogger := l.clone()
@@ -202,6 +224,14 @@ func (l *Logger) WithTraceID(traceId string) *Logger {
 	return newLogger
 }
 
+// WithSpanID returns a new Logger with the 'spanId' field set to the specified value.
+// Span ID identifies the unit of work within a trace which produced the log entries.
+func (l *Logger) WithSpanID(spanId string) *Logger {
+	newLogger := l.clone()
+	newLogger.spanId = spanId
+	return newLogger
+}
+
 // log writes a log entry. It locks the Logger's mutex to prevent concurrent write operations.
 // If there's a problem with writing the log entry or if the log entry is invalid,
 // it attempts to write the error and the log entry to the fallback writer (if available).
@@ -215,6 +245,13 @@ func (l *Logger) log(entry LogEntry) {
 	if !l.shouldLog(entry.Pri) {
 		return
 	}
+	if sampler := l.context.sampler.Load(); sampler != nil && !l.skipSampling &&
+		!sampler.allow(entry.Pri, entry.Module, entry.Op, entry.Msg) {
+		return
+	}
+	if redactor := l.context.redactor.Load(); redactor != nil {
+		redactor.apply(&entry)
+	}
 
 	entry.Id = ksuid.New().String()
 
@@ -231,13 +268,25 @@ func (l *Logger) log(entry LogEntry) {
 		}
 		return
 	}
+	if chain := l.context.integrity.Load(); chain != nil {
+		err := chain.writeChained(&entry, func(e LogEntry) error { return formatAndWriteEntry(l.writer, e) })
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v, LogEntry: %+v\n", err, entry)
+		}
+		return
+	}
 	if err := formatAndWriteEntry(l.writer, entry); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v, LogEntry: %+v\n", err, entry)
 	}
 }
 
 // shouldLog determines whether a log entry should be written based on its priority.
+// If the context has filter rules, the first rule matching the Logger's system, app and
+// module decides; otherwise the priority is compared with the context's minimum log priority.
 func (l *Logger) shouldLog(p LogPriority) bool {
+	if allowed, ruled := l.context.allows(l.system, l.app, l.module, p); ruled {
+		return allowed
+	}
 	minPri := LogPriority(atomic.LoadInt32(&l.context.minLogPriority))
 	return p >= minPri
 }
@@ -269,6 +318,7 @@ func (l *Logger) newLogEntry(message string, data *LogData) LogEntry {
 		Error:      l.err,
 		RemoteIP:   l.remoteIP,
 		TraceId:    l.traceId,
+		SpanId:     l.spanId,
 		Msg:        message,
 		Data:       data,
 	}
@@ -276,7 +326,7 @@ func (l *Logger) newLogEntry(message string, data *LogData) LogEntry {
 
 // Deprecated: WithSpanAndTrace does not follow the fluent pattern.
 // It logs an empty entry immediately instead of returning a configured Logger.
-// Use WithTraceID() and WithHTTPRequest() instead.
+// Use WithTraceID(), WithSpanID() and WithHTTPRequest() instead.
 func (l *Logger) WithSpanAndTrace(spanId, traceID string) {
 	entry := LogEntry{
 		App:        l.app,
@@ -303,10 +353,15 @@ func (l *Logger) LogDataChange(message string, data ChangeInfo) {
 	if !l.shouldLog(l.pri) {
 		return
 	}
-	for i := range data.Changes {
-		data.Changes[i].OldVal = convertToString(data.Changes[i].OldVal)
-		data.Changes[i].NewVal = convertToString(data.Changes[i].NewVal)
+	// The changes are copied, since their slice is shared with the caller
+	redact := l.context.redactFunc()
+	changes := make([]ChangeDetail, len(data.Changes))
+	for i, change := range data.Changes {
+		change.OldVal = convertRedacted(change.OldVal, redact)
+		change.NewVal = convertRedacted(change.NewVal, redact)
+		changes[i] = change
 	}
+	data.Changes = changes
 
 	logData := LogData{
 		ChangeData: &data,
@@ -324,7 +379,7 @@ func (l *Logger) LogActivity(message string, data ActivityInfo) {
 	var logData LogData
 	var entry LogEntry
 	if data != nil {
-		activityData := convertToString(data)
+		activityData := convertRedacted(data, l.context.redactFunc())
 		logData = LogData{
 			ActivityData: activityData,
 		}
@@ -341,6 +396,17 @@ func (l *Logger) LogDebug(message string, data any) {
 	if !l.context.IsDebugModeSet() || !l.shouldLog(l.pri) {
 		return
 	}
+	// skip = 3 means the caller of LogDebug, see logDebug
+	l.logDebug(message, data, 3)
+}
+
+// logDebug builds and writes a debug log entry. The 'skip' parameter is passed to GetDebugInfo
+// to pick the stack frame reported in DebugInfo:
+// skip = 0 means GetDebugInfo itself
+// skip = 1 means logDebug
+// skip = 2 means the exported method that called logDebug, e.g. LogDebug
+// skip = 3 means the function that called that method, which is what we want to add to DebugInfo
+func (l *Logger) logDebug(message string, data any, skip int) {
 	debugInfo := DebugInfo{
 		Pid:          os.Getpid(),
 		Runtime:      runtime.Version(),
@@ -348,14 +414,11 @@ func (l *Logger) LogDebug(message string, data any) {
 		LineNumber:   0,
 		FunctionName: "",
 		StackTrace:   "",
-		Data:         convertToString(data), // Convert the entire data to a JSON string
+		Data:         convertRedacted(data, l.context.redactFunc()), // Convert the entire data to a JSON string
 	}
 
 	// Populate file name, line number, function name, and stack trace
-	// skip = 0 means GetDebugInfo itself
-	// skip = 1 means the caller of GetDebugInfo i.e. LogDebug
-	// skip = 2 means the caller of LogDebug i.e. the function that called LogDebug which we will add to DebugInfo
-	debugInfo.FileName, debugInfo.LineNumber, debugInfo.FunctionName, debugInfo.StackTrace = GetDebugInfo(2)
+	debugInfo.FileName, debugInfo.LineNumber, debugInfo.FunctionName, debugInfo.StackTrace = GetDebugInfo(skip)
 
 	logData := LogData{
 		DebugData: &debugInfo,
@@ -438,12 +501,23 @@ func (l *Logger) Sec() *Logger {
 // using convertToString() in utils.go. This design allows for flexibility in logging changes without enforcing
 // a strict type constraint on the values being logged. It ensures that regardless of the original value type,
 // the change details are stored as strings, which is required for storing it in logharbour storage.
+// Values with fields tagged `logharbour:"..."` are kept until they are logged, so that the tagged
+// fields are redacted by the Redactor of the logger.
 func NewChangeDetail(field string, oldValue, newValue any) ChangeDetail {
 	return ChangeDetail{
 		Field:  field,
-		OldVal: convertToString(oldValue),
-		NewVal: convertToString(newValue),
+		OldVal: changeValue(oldValue),
+		NewVal: changeValue(newValue),
+	}
+}
+
+// changeValue converts a change value to a string, except for values with logharbour struct
+// tags, which are wrapped in a taggedValue.
+func changeValue(value any) any {
+	if value != nil && hasRedactTags(reflect.TypeOf(value)) {
+		return taggedValue{value}
 	}
+	return convertToString(value)
 }
 
 // AddChange adds a new change to the ChangeInfo struct. It accepts a field name and old/new values of any type.
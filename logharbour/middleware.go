@@ -0,0 +1,293 @@
+package logharbour
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestActivity is the activity data logged by the HTTP middleware for each request.
+type RequestActivity struct {
+	Method    string  `json:"method"`
+	Path      string  `json:"path"`
+	Route     string  `json:"route,omitempty"`
+	Status    int     `json:"status"`
+	LatencyMs float64 `json:"latency_ms"`
+	Bytes     int64   `json:"bytes"`
+	UserAgent string  `json:"user_agent,omitempty"`
+}
+
+// middlewareConfig holds the settings of HTTPMiddleware and GinMiddleware.
+type middlewareConfig struct {
+	excludedPaths     []string
+	successSampleRate float64
+	whoFunc           func(r *http.Request) string
+	priority          LogPriority
+}
+
+// MiddlewareOption configures HTTPMiddleware and GinMiddleware.
+type MiddlewareOption func(*middlewareConfig)
+
+// WithExcludedPaths excludes requests from activity logging. Each entry matches a request
+// path exactly, or, if it ends with "*", matches every path starting with the rest of the entry.
+// Excluded requests still get a Logger in their context.
+func WithExcludedPaths(paths ...string) MiddlewareOption {
+	return func(cfg *middlewareConfig) {
+		cfg.excludedPaths = append(cfg.excludedPaths, paths...)
+	}
+}
+
+// WithSuccessSampleRate logs only the given fraction (0 to 1) of successful requests,
+// i.e. requests with a status code below 400. Failed requests are always logged.
+func WithSuccessSampleRate(rate float64) MiddlewareOption {
+	return func(cfg *middlewareConfig) {
+		cfg.successSampleRate = rate
+	}
+}
+
+// WithWhoFunc sets the function used to find the user identity of a request.
+// By default the identity is the one set with SetRequestWho, or else the one carried by the
+// request context, see WithContext.
+func WithWhoFunc(whoFunc func(r *http.Request) string) MiddlewareOption {
+	return func(cfg *middlewareConfig) {
+		cfg.whoFunc = whoFunc
+	}
+}
+
+// WithMiddlewarePriority sets the priority of the activity entries. The default is Debug0.
+func WithMiddlewarePriority(pri LogPriority) MiddlewareOption {
+	return func(cfg *middlewareConfig) {
+		cfg.priority = pri
+	}
+}
+
+func newMiddlewareConfig(opts []MiddlewareOption) *middlewareConfig {
+	cfg := &middlewareConfig{
+		successSampleRate: 1,
+		whoFunc: func(r *http.Request) string {
+			if holder, ok := r.Context().Value(requestWhoContextKey).(*requestWho); ok {
+				if who := holder.get(); who != "" {
+					return who
+				}
+			}
+			return valueFromContext(r.Context(), whoContextKey, FromContext(r.Context()), func(s *Logger) string { return s.who }, "")
+		},
+		priority: Debug0,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// requestWho holds the user identity of a request, set by its handler with SetRequestWho.
+type requestWho struct {
+	mu  sync.Mutex
+	who string
+}
+
+func (h *requestWho) get() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.who
+}
+
+// SetRequestWho sets the user identity logged in the activity entry of the request whose
+// context is ctx, or of which ctx is derived, by HTTPMiddleware or GinMiddleware. Handlers
+// usually learn the identity after the middleware has started, e.g. once a token has been
+// checked, and a context they derive with ContextWithWho does not reach the middleware with
+// net/http. It reports false if ctx is not the context of such a request.
+func SetRequestWho(ctx context.Context, who string) bool {
+	holder, ok := ctx.Value(requestWhoContextKey).(*requestWho)
+	if !ok {
+		return false
+	}
+	holder.mu.Lock()
+	holder.who = who
+	holder.mu.Unlock()
+	return true
+}
+
+// newRequestContext returns the context of a request handled by the middleware: ctx with the
+// request's Logger and a holder for its identity.
+func newRequestContext(ctx context.Context, reqLogger *Logger) context.Context {
+	return context.WithValue(NewContext(ctx, reqLogger), requestWhoContextKey, &requestWho{})
+}
+
+// isExcluded reports whether activity logging is disabled for the path.
+func (cfg *middlewareConfig) isExcluded(path string) bool {
+	for _, p := range cfg.excludedPaths {
+		if prefix, ok := strings.CutSuffix(p, "*"); ok {
+			if strings.HasPrefix(path, prefix) {
+				return true
+			}
+		} else if path == p {
+			return true
+		}
+	}
+	return false
+}
+
+// sampled reports whether a request which ended with the given status code should be logged.
+func (cfg *middlewareConfig) sampled(statusCode int) bool {
+	if statusCode >= http.StatusBadRequest || cfg.successSampleRate >= 1 {
+		return true
+	}
+	return rand.Float64() < cfg.successSampleRate
+}
+
+// logRequest writes the activity entry for a completed request.
+func (cfg *middlewareConfig) logRequest(l *Logger, r *http.Request, activity RequestActivity) {
+	l = l.WithPriority(cfg.priority)
+	if !l.shouldLog(l.pri) || !cfg.sampled(activity.Status) {
+		return
+	}
+	status := Success
+	if activity.Status >= http.StatusInternalServerError {
+		status = Failure
+	}
+	op := activity.Route
+	if op == "" {
+		op = activity.Path
+	}
+	l = l.WithOp(r.Method + " " + op).WithStatus(status)
+	if who := cfg.whoFunc(r); who != "" {
+		l = l.WithWho(who)
+	}
+	l.LogActivity(fmt.Sprintf("%s %s %d", activity.Method, activity.Path, activity.Status), activity)
+}
+
+// HTTPMiddleware returns net/http middleware which logs one Activity entry per request,
+// as the wiki requires for the entry and exit of every web service call.
+//
+// For each request, it builds a Logger with WithHTTPRequest and stores it in the request
+// context with NewContext, so that handlers can retrieve it with FromContext. When the
+// handler returns, it logs the method, path, status code, latency, response size and user
+// identity, with Status set to Failure for 5xx responses. Handlers set the identity with
+// SetRequestWho.
+//
+// The ResponseWriter passed to handlers supports http.Flusher and http.Hijacker if the
+// server's does, so that server-sent events and websocket upgrades work behind the middleware.
+//
+// Example:
+//
+//	mux := http.NewServeMux()
+//	mux.HandleFunc("/users", listUsers)
+//	handler := logharbour.HTTPMiddleware(logger, logharbour.WithExcludedPaths("/health"))(mux)
+func HTTPMiddleware(l *Logger, opts ...MiddlewareOption) func(http.Handler) http.Handler {
+	cfg := newMiddlewareConfig(opts)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			reqLogger := l.WithHTTPRequest(r)
+			r = r.WithContext(newRequestContext(r.Context(), reqLogger))
+			rw := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+			next.ServeHTTP(rw, r)
+
+			if cfg.isExcluded(r.URL.Path) {
+				return
+			}
+			cfg.logRequest(reqLogger, r, RequestActivity{
+				Method:    r.Method,
+				Path:      r.URL.Path,
+				Status:    rw.status,
+				LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+				Bytes:     rw.bytes,
+				UserAgent: r.UserAgent(),
+			})
+		})
+	}
+}
+
+// GinMiddleware returns gin middleware equivalent to HTTPMiddleware.
+// The per-request Logger is stored in the context of c.Request, and the gin route
+// (c.FullPath()) is used as the op of the entry.
+func GinMiddleware(l *Logger, opts ...MiddlewareOption) gin.HandlerFunc {
+	cfg := newMiddlewareConfig(opts)
+	return func(c *gin.Context) {
+		start := time.Now()
+		reqLogger := l.WithHTTPRequest(c.Request)
+		c.Request = c.Request.WithContext(newRequestContext(c.Request.Context(), reqLogger))
+
+		c.Next()
+
+		if cfg.isExcluded(c.Request.URL.Path) {
+			return
+		}
+		bytes := int64(c.Writer.Size())
+		if bytes < 0 {
+			bytes = 0
+		}
+		cfg.logRequest(reqLogger, c.Request, RequestActivity{
+			Method:    c.Request.Method,
+			Path:      c.Request.URL.Path,
+			Route:     c.FullPath(),
+			Status:    c.Writer.Status(),
+			LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+			Bytes:     bytes,
+			UserAgent: c.Request.UserAgent(),
+		})
+	}
+}
+
+// statusRecorder is an http.ResponseWriter which records the status code and the number
+// of bytes written.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+func (rw *statusRecorder) WriteHeader(code int) {
+	if !rw.wroteHeader {
+		rw.status = code
+		rw.wroteHeader = true
+	}
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *statusRecorder) Write(p []byte) (int, error) {
+	rw.wroteHeader = true
+	n, err := rw.ResponseWriter.Write(p)
+	rw.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap returns the underlying ResponseWriter, so that http.ResponseController can
+// reach optional interfaces such as http.Flusher.
+func (rw *statusRecorder) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// Flush implements http.Flusher for handlers which stream their response, such as
+// server-sent events. It does nothing if the underlying ResponseWriter cannot flush.
+func (rw *statusRecorder) Flush() {
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		rw.wroteHeader = true
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker for handlers which take over the connection, such as
+// websocket upgrades. The request is then logged with status 101 Switching Protocols.
+func (rw *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := rw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("%T does not support hijacking", rw.ResponseWriter)
+	}
+	conn, brw, err := h.Hijack()
+	if err == nil && !rw.wroteHeader {
+		rw.status, rw.wroteHeader = http.StatusSwitchingProtocols, true
+	}
+	return conn, brw, err
+}
@@ -0,0 +1,213 @@
+package logharbour
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func decodeEntries(t *testing.T, buf *bytes.Buffer) []LogEntry {
+	t.Helper()
+	var entries []LogEntry
+	dec := json.NewDecoder(buf)
+	for dec.More() {
+		var entry LogEntry
+		if err := dec.Decode(&entry); err != nil {
+			t.Fatalf("Failed to unmarshal logged message: %v", err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestHTTPMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(NewLoggerContext(Debug0), "TestApp", &buf)
+
+	var handlerLogger *Logger
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
+		handlerLogger = FromContext(r.Context())
+		w.Write([]byte("hello"))
+	})
+	mux.HandleFunc("/fail", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	})
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {})
+
+	handler := HTTPMiddleware(logger,
+		WithExcludedPaths("/health"),
+		WithWhoFunc(func(r *http.Request) string { return r.Header.Get("X-User") }))(mux)
+
+	for _, path := range []string{"/ok", "/fail", "/health"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set(HeaderTraceID, "trace"+path)
+		req.Header.Set("X-User", "alice")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	if handlerLogger == nil || handlerLogger.traceId != "trace/ok" {
+		t.Fatalf("expected request logger in context with trace ID, got %+v", handlerLogger)
+	}
+
+	entries := decodeEntries(t, &buf)
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries (health excluded), got %d", len(entries))
+	}
+
+	ok, fail := entries[0], entries[1]
+	if ok.Type != Activity || ok.Pri != Debug0 || ok.Status != Success || ok.Who != "alice" ||
+		ok.Op != "GET /ok" || ok.TraceId != "trace/ok" {
+		t.Errorf("unexpected entry for /ok: %+v", ok)
+	}
+	var activity RequestActivity
+	if err := json.Unmarshal([]byte(ok.Data.ActivityData), &activity); err != nil {
+		t.Fatalf("Failed to unmarshal activity data: %v", err)
+	}
+	if activity.Status != http.StatusOK || activity.Bytes != 5 || activity.Method != http.MethodGet || activity.Path != "/ok" {
+		t.Errorf("unexpected activity data: %+v", activity)
+	}
+	if fail.Status != Failure {
+		t.Errorf("expected Failure status for 5xx, got %v", fail.Status)
+	}
+}
+
+func TestHTTPMiddleware_WhoAndStreaming(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(NewLoggerContext(Debug0), "TestApp", &buf)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		// The identity is known once the handler has authenticated the request
+		if !SetRequestWho(r.Context(), "carol") {
+			t.Error("expected the request context to have an identity holder")
+		}
+		w.Write([]byte("data: 1\n\n"))
+		w.(http.Flusher).Flush()
+	})
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\n")
+		rw.Flush()
+	})
+	served := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		HTTPMiddleware(logger)(mux).ServeHTTP(w, r)
+		close(served)
+	}))
+	defer server.Close()
+
+	recorder := httptest.NewRecorder()
+	HTTPMiddleware(logger)(mux).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/events", nil))
+	if !recorder.Flushed {
+		t.Error("expected the flush to reach the underlying ResponseWriter")
+	}
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/ws", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		t.Errorf("expected the upgrade to go through the middleware, got %s", res.Status)
+	}
+	<-served
+
+	entries := decodeEntries(t, &buf)
+	if len(entries) != 2 || entries[0].Who != "carol" || entries[1].Op != "GET /ws" {
+		t.Fatalf("unexpected entries: %+v", entries)
+	}
+	var activity RequestActivity
+	if err := json.Unmarshal([]byte(entries[1].Data.ActivityData), &activity); err != nil {
+		t.Fatal(err)
+	}
+	if activity.Status != http.StatusSwitchingProtocols {
+		t.Errorf("expected the hijacked request to be logged with status 101, got %d", activity.Status)
+	}
+	if SetRequestWho(context.Background(), "carol") {
+		t.Error("expected SetRequestWho to fail outside of a request")
+	}
+}
+
+func TestHTTPMiddleware_Sampling(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(NewLoggerContext(Debug0), "TestApp", &buf)
+	status := http.StatusOK
+	handler := HTTPMiddleware(logger, WithSuccessSampleRate(0))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if buf.Len() != 0 {
+		t.Fatalf("expected successful request to be sampled out, got %s", buf.String())
+	}
+
+	status = http.StatusNotFound
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if entries := decodeEntries(t, &buf); len(entries) != 1 {
+		t.Errorf("expected failed request to always be logged, got %d entries", len(entries))
+	}
+}
+
+func TestExcludedPaths(t *testing.T) {
+	cfg := newMiddlewareConfig([]MiddlewareOption{WithExcludedPaths("/health", "/static/*")})
+	tests := map[string]bool{
+		"/health":        true,
+		"/health/deep":   false,
+		"/static/app.js": true,
+		"/api/users":     false,
+	}
+	for path, want := range tests {
+		if got := cfg.isExcluded(path); got != want {
+			t.Errorf("isExcluded(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestGinMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var buf bytes.Buffer
+	logger := NewLogger(NewLoggerContext(Debug0), "TestApp", &buf)
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		// An authentication middleware running after the logging middleware.
+		c.Request = c.Request.WithContext(ContextWithWho(c.Request.Context(), "bob"))
+	})
+	r.Use(GinMiddleware(logger))
+	r.GET("/users/:id", func(c *gin.Context) {
+		if FromContext(c.Request.Context()) == nil {
+			t.Error("expected request logger in context")
+		}
+		c.String(http.StatusBadGateway, "upstream down")
+	})
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/42", nil))
+
+	entries := decodeEntries(t, &buf)
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(entries))
+	}
+	entry := entries[0]
+	if entry.Op != "GET /users/:id" || entry.Who != "bob" || entry.Status != Failure {
+		t.Errorf("unexpected entry: %+v", entry)
+	}
+	var activity RequestActivity
+	if err := json.Unmarshal([]byte(entry.Data.ActivityData), &activity); err != nil {
+		t.Fatalf("Failed to unmarshal activity data: %v", err)
+	}
+	if activity.Status != http.StatusBadGateway || activity.Route != "/users/:id" || activity.Bytes != int64(len("upstream down")) {
+		t.Errorf("unexpected activity data: %+v", activity)
+	}
+}
@@ -0,0 +1,23 @@
+package logharbour
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// WithOTelSpan returns a new Logger with the trace ID, span ID, trace flags and tracestate
+// taken from the OpenTelemetry span in ctx, so that log entries can be correlated with the
+// traces recorded by OpenTelemetry. If ctx has no valid span, the fields are left unchanged.
+func (l *Logger) WithOTelSpan(ctx context.Context) *Logger {
+	newLogger := l.clone()
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return newLogger
+	}
+	newLogger.traceId = sc.TraceID().String()
+	newLogger.spanId = sc.SpanID().String()
+	newLogger.traceFlags = sc.TraceFlags().String()
+	newLogger.traceState = sc.TraceState().String()
+	return newLogger
+}
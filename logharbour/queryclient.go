@@ -0,0 +1,352 @@
+package logharbour
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/core/search"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/some"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/sortorder"
+	"github.com/oschwald/geoip2-golang"
+)
+
+// DefaultPageSize is the number of log entries GetLogs and GetChanges return per page unless
+// set otherwise with WithPageSize or GetLogsParam.PageSize.
+const DefaultPageSize = 5
+
+// MaxPageSize is the largest number of log entries GetLogs and GetChanges return per page.
+// Larger page sizes are reduced to it. It is Elasticsearch's default limit on search results.
+const MaxPageSize = 10000
+
+// QueryClient queries the log repository of one realm. It holds no per-query state, so one
+// QueryClient can be shared by any number of goroutines.
+type QueryClient struct {
+	target       QueryTarget
+	pageSize     int
+	timeout      time.Duration
+	pitKeepAlive time.Duration // Zero unless pages are read from a point in time
+}
+
+// QueryClientOption configures a QueryClient.
+type QueryClientOption func(*QueryClient)
+
+// WithPageSize sets the default number of log entries GetLogs and GetChanges return per page.
+func WithPageSize(n int) QueryClientOption {
+	return func(qc *QueryClient) {
+		if n > 0 {
+			qc.pageSize = n
+		}
+	}
+}
+
+// WithQueryTimeout sets the time limit of each request to Elasticsearch. The limit applies in
+// addition to the deadline of the context passed to the query methods. Zero means no limit.
+func WithQueryTimeout(d time.Duration) QueryClientOption {
+	return func(qc *QueryClient) {
+		qc.timeout = d
+	}
+}
+
+// NewQueryClient creates a QueryClient which searches index with client.
+func NewQueryClient(client *elasticsearch.TypedClient, index string, opts ...QueryClientOption) *QueryClient {
+	return newQueryClient(QueryTarget{Index: index, Client: client}, opts)
+}
+
+// NewQueryClient creates a QueryClient for the realm of a query token; see Resolve.
+func (r *QueryTokenResolver) NewQueryClient(token string, client *elasticsearch.TypedClient, opts ...QueryClientOption) (*QueryClient, error) {
+	target, err := r.Resolve(token, client)
+	if err != nil {
+		return nil, err
+	}
+	return newQueryClient(*target, opts), nil
+}
+
+// NewQueryClientForToken creates a QueryClient for the realm of a query token, resolved with
+// the default resolver.
+func NewQueryClientForToken(token string, client *elasticsearch.TypedClient, opts ...QueryClientOption) (*QueryClient, error) {
+	return DefaultQueryTokenResolver().NewQueryClient(token, client, opts...)
+}
+
+func newQueryClient(target QueryTarget, opts []QueryClientOption) *QueryClient {
+	qc := &QueryClient{target: target, pageSize: DefaultPageSize, timeout: DIALTIMEOUT}
+	for _, opt := range opts {
+		opt(qc)
+	}
+	return qc
+}
+
+// Index returns the index the QueryClient searches.
+func (qc *QueryClient) Index() string {
+	return qc.target.Index
+}
+
+// withTimeout applies the QueryClient's time limit to ctx.
+func (qc *QueryClient) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if qc.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, qc.timeout)
+}
+
+// search runs a search request on the QueryClient's index.
+func (qc *QueryClient) search(ctx context.Context, req *search.Request) (*search.Response, error) {
+	ctx, cancel := qc.withTimeout(ctx)
+	defer cancel()
+	s := qc.target.Client.Search()
+	if req.Pit == nil {
+		// A search of a point in time must not name the index
+		s = s.Index(qc.target.Index)
+	}
+	return s.Request(req).Do(ctx)
+}
+
+// GetLogs retrieves a page of log entries matching the fields provided in logParam, latest
+// first, and the total number of matching entries. Use GetLogsPage to get a cursor for the
+// next page as well.
+func (qc *QueryClient) GetLogs(ctx context.Context, logParam GetLogsParam) ([]LogEntry, int, error) {
+	query, err := getLogsQuery(logParam)
+	if err != nil {
+		return nil, 0, err
+	}
+	page, err := qc.searchLogs(ctx, query, logParam, false)
+	return page.Entries, page.Total, err
+}
+
+// GetChanges retrieves a page of data-change log entries matching the fields provided in
+// logParam, latest first, and the total number of matching entries.
+func (qc *QueryClient) GetChanges(ctx context.Context, logParam GetLogsParam) ([]LogEntry, int, error) {
+	query, err := getChangesQuery(logParam)
+	if err != nil {
+		return nil, 0, err
+	}
+	page, err := qc.searchLogs(ctx, query, logParam, false)
+	return page.Entries, page.Total, err
+}
+
+// searchLogs returns the page of entries matching query selected by the paging fields of
+// logParam, sorted by when and then id, latest first. A point in time is opened for the
+// pages if paged is true and the QueryClient is configured to use one.
+func (qc *QueryClient) searchLogs(ctx context.Context, query *types.Query, logParam GetLogsParam, paged bool) (LogPage, error) {
+	sortByWhenAndId := []types.SortCombinations{
+		types.SortOptions{SortOptions: map[string]types.FieldSort{when: {Order: &sortorder.Desc}}},
+		types.SortOptions{SortOptions: map[string]types.FieldSort{id: {Order: &sortorder.Desc}}},
+	}
+	size := qc.pageSize
+	if logParam.PageSize != nil && *logParam.PageSize > 0 {
+		size = *logParam.PageSize
+	}
+	size = min(size, MaxPageSize)
+	fingerprint, err := queryFingerprint(query)
+	if err != nil {
+		return LogPage{}, err
+	}
+	req := &search.Request{
+		Size:  &size,
+		Query: query,
+		Sort:  sortByWhenAndId,
+	}
+
+	var pitId, keepAlive string
+	switch {
+	case logParam.Cursor != nil:
+		cursor, err := decodeCursor(*logParam.Cursor, fingerprint)
+		if err != nil {
+			return LogPage{}, err
+		}
+		req.SearchAfter, pitId, keepAlive = cursor.SearchAfter, cursor.PitId, cursor.KeepAlive
+	case logParam.SearchAfterTS != nil:
+		// An empty id sorts before every other, so without one the page starts with the
+		// entries older than SearchAfterTS
+		docId := ""
+		if logParam.SearchAfterDocID != nil {
+			docId = *logParam.SearchAfterDocID
+		}
+		req.SearchAfter = []types.FieldValue{*logParam.SearchAfterTS, docId}
+	case logParam.SearchAfterDocID != nil:
+		return LogPage{}, fmt.Errorf("SearchAfterDocID requires SearchAfterTS")
+	case paged && qc.pitKeepAlive > 0:
+		keepAlive = keepAliveString(qc.pitKeepAlive)
+		if pitId, err = qc.openPointInTime(ctx, keepAlive); err != nil {
+			return LogPage{}, err
+		}
+	}
+	if pitId != "" {
+		req.Pit = &types.PointInTimeReference{Id: pitId, KeepAlive: keepAlive}
+	}
+	if logParam.Highlight {
+		req.Highlight = highlightRequest()
+	}
+
+	res, err := qc.search(ctx, req)
+	if err != nil {
+		return LogPage{}, fmt.Errorf("Error while searching document in es:%w", err)
+	}
+
+	// Unmarshalling hit.source into LogEntry
+	page := LogPage{Total: int(res.Hits.Total.Value)}
+	for _, hit := range res.Hits.Hits {
+		var logEntry LogEntry
+		if err := json.Unmarshal(hit.Source_, &logEntry); err != nil {
+			return LogPage{}, fmt.Errorf("error while unmarshalling response:%v", err)
+		}
+		page.Entries = append(page.Entries, logEntry)
+		if snippets := hitHighlights(hit); snippets != nil {
+			if page.Highlights == nil {
+				page.Highlights = make(map[string]map[string][]string)
+			}
+			page.Highlights[logEntry.Id] = snippets
+		}
+	}
+
+	if res.PitId != nil {
+		pitId = *res.PitId
+	}
+	// A full page may be followed by more entries; anything less is the last page
+	if hits := res.Hits.Hits; len(hits) == size {
+		page.NextCursor, err = encodeCursor(pageCursor{
+			SearchAfter: hits[len(hits)-1].Sort,
+			Query:       fingerprint,
+			PitId:       pitId,
+			KeepAlive:   keepAlive,
+		})
+		if err != nil {
+			return LogPage{}, err
+		}
+	} else if pitId != "" {
+		qc.closePointInTime(ctx, pitId)
+	}
+	return page, nil
+}
+
+// GetSet gets a set of values for an attribute from the log entries specified, with the
+// number of entries having each value. This is a faceted search for one attribute.
+func (qc *QueryClient) GetSet(ctx context.Context, setAttr string, setParam GetSetParam) (map[string]int64, error) {
+	var (
+		dataMap         = make(map[string]int64)
+		aggResponseSize = 1000
+		logSize         = 0
+	)
+
+	// Validate setAttr
+	_, err := isValidSetAttribute(setAttr)
+	if err != nil {
+		return nil, err
+	}
+
+	// Call getQuery function which will return a query for valid method parameters
+	query, err := getQuery(setParam)
+	if err != nil {
+		return nil, fmt.Errorf("error while calling getQuery : %v ", err)
+	}
+
+	// This will return a set of unique values for an attribute based on method parameters
+	res, err := qc.search(ctx, &search.Request{
+		Query: query,
+		Size:  &logSize,
+		Aggregations: map[string]types.Aggregations{
+			logSet: {
+				Terms: &types.TermsAggregation{
+					Field: some.String(setAttr),
+					Size:  &aggResponseSize,
+					Order: map[string]sortorder.SortOrder{"_count": sortorder.Asc},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error runnning search query: %w", err)
+	}
+
+	// To assert if response contains aggregation response and it must be type of *types.StringTermsAggregate
+	logSetAgg, ok := res.Aggregations[logSet].(*types.StringTermsAggregate)
+	if !ok || logSetAgg == nil {
+		return nil, fmt.Errorf("services aggregation is not present or not of type *types.StringTermsAggregate")
+	}
+	// To extract bucket_key and bucket_count from Buckets which must be type of types.BucketsStringTermsBucket and append it to dataMap
+	bucketsSlice, ok := logSetAgg.Buckets.([]types.StringTermsBucket)
+	if !ok {
+		return nil, fmt.Errorf("services aggregation Buckets field has Unknown type: %v , valid type is :%v", reflect.TypeOf(logSetAgg.Buckets), "[]types.StringTermsBucket")
+	}
+	for _, bucket := range bucketsSlice {
+		bucketKeyString, ok := bucket.Key.(string)
+		if !ok {
+			return nil, fmt.Errorf("the bucket key is not a string")
+		}
+		dataMap[bucketKeyString] = bucket.DocCount
+	}
+	return dataMap, nil
+}
+
+// GetApps retrieves the list of apps which have log entries.
+func (qc *QueryClient) GetApps(ctx context.Context) ([]string, error) {
+	setvalues, err := qc.GetSet(ctx, app, GetSetParam{})
+	if err != nil {
+		return nil, fmt.Errorf("error at calling GetSet() : %w", err)
+	}
+	var apps []string
+	for app := range setvalues {
+		apps = append(apps, app)
+	}
+	return apps, nil
+}
+
+// GetUnusualIP goes through the logs of the last ndays days which match the search criteria,
+// and pulls out all the remote IP addresses which account for no more than unusualPercent of
+// the total.
+func (qc *QueryClient) GetUnusualIP(ctx context.Context, unusualPercent float64, logParam GetUnusualIPParam) ([]string, error) {
+	unusualIPs := []string{}
+
+	if unusualPercent < 0.5 || unusualPercent > 50 {
+		return nil, fmt.Errorf("unusualPercent is not between 0.5 to 50")
+	}
+
+	aggregatedIPs, err := qc.GetSet(ctx, remote_ip, GetSetParam{
+		App:   logParam.App,
+		Who:   logParam.Who,
+		Class: logParam.Class,
+		Op:    logParam.Operation,
+		Ndays: logParam.NDays,
+	})
+	if err != nil {
+		return nil, err
+	}
+	//   Calculate total number of logs to find what 1% represents
+	var count int64 = 0
+	for _, v := range aggregatedIPs {
+		count += v
+	}
+	percentThreshold := float64(count) * unusualPercent / 100
+
+	localIp, err := GetLocalIPAddress()
+	if err != nil {
+		return nil, err
+	}
+
+	if percentThreshold > 1 {
+		for ip, count := range aggregatedIPs {
+			if count <= int64(percentThreshold) && ip != localIp {
+				unusualIPs = append(unusualIPs, ip)
+			}
+		}
+	}
+	return unusualIPs, nil
+}
+
+// ListUnusualIPs returns the unusual IPs of GetUnusualIP with their geographical location.
+func (qc *QueryClient) ListUnusualIPs(ctx context.Context, geoLiteDb *geoip2.Reader, unusualPercent float64, logParam GetUnusualIPParam) ([]IPLocation, error) {
+	unusualIPList := []IPLocation{}
+
+	unusualIPs, err := qc.GetUnusualIP(ctx, unusualPercent, GetUnusualIPParam{App: logParam.App, NDays: logParam.NDays})
+	if err != nil {
+		return nil, err
+	}
+	for _, ip := range unusualIPs {
+		unusualIPList = append(unusualIPList, getIPLocation(ip, geoLiteDb))
+	}
+	return unusualIPList, nil
+}
@@ -0,0 +1,160 @@
+package logharbour
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8"
+)
+
+// fakeSearchServer answers the searches with responses in turn, repeating the last one, and
+// point in time requests with pit-1. It records the request bodies and paths.
+type fakeSearchServer struct {
+	mu       sync.Mutex
+	paths    []string
+	requests []map[string]any
+	searches int
+}
+
+func newFakeSearchServer(t *testing.T, responses ...string) (*fakeSearchServer, *elasticsearch.TypedClient) {
+	t.Helper()
+	f := &fakeSearchServer{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var req map[string]any
+		_ = json.Unmarshal(body, &req)
+		f.mu.Lock()
+		f.paths = append(f.paths, r.URL.Path)
+		f.requests = append(f.requests, req)
+		response := responses[min(f.searches, len(responses)-1)]
+		if strings.HasSuffix(r.URL.Path, "/_search") {
+			f.searches++
+		}
+		f.mu.Unlock()
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/_pit") && r.Method == http.MethodDelete:
+			io.WriteString(w, `{"succeeded": true, "num_freed": 1}`)
+		case strings.HasSuffix(r.URL.Path, "/_pit"):
+			io.WriteString(w, `{"id": "pit-1"}`)
+		default:
+			io.WriteString(w, response)
+		}
+	}))
+	t.Cleanup(server.Close)
+	client, err := elasticsearch.NewTypedClient(elasticsearch.Config{Addresses: []string{server.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f, client
+}
+
+const fakeLogsResponse = `{"took": 1, "timed_out": false, "_shards": {"total": 1, "successful": 1, "skipped": 0, "failed": 0},
+	"hits": {"total": {"value": 7, "relation": "eq"}, "hits": [
+		{"_index": "logharbour_acme", "_id": "1", "_source": {"id": "1", "app": "billing", "msg": "first"}},
+		{"_index": "logharbour_acme", "_id": "2", "_source": {"id": "2", "app": "billing", "msg": "second"}}]}}`
+
+func TestQueryClient_GetLogs(t *testing.T) {
+	f, client := newFakeSearchServer(t, fakeLogsResponse)
+	qc := NewQueryClient(client, "logharbour_acme", WithPageSize(20), WithQueryTimeout(time.Minute))
+	app, ts, id := "billing", "2026-01-01T00:00:00Z", "abc"
+
+	entries, total, err := qc.GetLogs(context.Background(), GetLogsParam{App: &app, SearchAfterTS: &ts, SearchAfterDocID: &id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 7 || len(entries) != 2 || entries[1].Msg != "second" {
+		t.Errorf("got %d entries of %d: %+v", len(entries), total, entries)
+	}
+	if f.paths[0] != "/logharbour_acme/_search" {
+		t.Errorf("searched %s", f.paths[0])
+	}
+	req := f.requests[0]
+	if req["size"] != float64(20) {
+		t.Errorf("size = %v, want the client's page size", req["size"])
+	}
+	if after, _ := json.Marshal(req["search_after"]); string(after) != `["2026-01-01T00:00:00Z","abc"]` {
+		t.Errorf("search_after = %s", after)
+	}
+
+	if _, _, err := qc.GetLogs(context.Background(), GetLogsParam{}); err == nil {
+		t.Error("expected an error without any filter")
+	}
+
+	huge := 1 << 30
+	if _, _, err := qc.GetLogs(context.Background(), GetLogsParam{App: &app, PageSize: &huge}); err != nil {
+		t.Fatal(err)
+	}
+	if size := f.requests[len(f.requests)-1]["size"]; size != float64(MaxPageSize) {
+		t.Errorf("size = %v, want MaxPageSize", size)
+	}
+}
+
+func TestQueryClient_ConcurrentPageSizes(t *testing.T) {
+	f, client := newFakeSearchServer(t, fakeLogsResponse)
+	qc := NewQueryClient(client, "logharbour_acme")
+	app := "billing"
+
+	var wg sync.WaitGroup
+	for n := 1; n <= 10; n++ {
+		n := n
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pri := Warn
+			if _, _, err := qc.GetLogs(context.Background(), GetLogsParam{App: &app, Priority: &pri, PageSize: &n}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	sizes := make(map[float64]bool)
+	for _, req := range f.requests {
+		sizes[req["size"].(float64)] = true
+		if query, _ := json.Marshal(req["query"]); !strings.Contains(string(query), `"pri":["Warn","Err","Crit","Sec"]`) {
+			t.Errorf("unexpected priority filter in %s", query)
+		}
+	}
+	if len(sizes) != 10 {
+		t.Errorf("each call should use its own page size, got %v", sizes)
+	}
+}
+
+func TestQueryClient_GetSet(t *testing.T) {
+	_, client := newFakeSearchServer(t, `{"took": 1, "timed_out": false, "_shards": {"total": 1, "successful": 1, "skipped": 0, "failed": 0},
+		"hits": {"total": {"value": 5, "relation": "eq"}, "hits": []},
+		"aggregations": {"sterms#logset": {"doc_count_error_upper_bound": 0, "sum_other_doc_count": 0,
+			"buckets": [{"key": "billing", "doc_count": 2}, {"key": "crux", "doc_count": 3}]}}}`)
+	qc := NewQueryClient(client, "logharbour_acme")
+
+	set, err := qc.GetSet(context.Background(), app, GetSetParam{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(set) != 2 || set["billing"] != 2 || set["crux"] != 3 {
+		t.Errorf("GetSet() = %v", set)
+	}
+	if _, err := qc.GetSet(context.Background(), "msg", GetSetParam{}); err == nil {
+		t.Error("expected an error for an attribute which is not enumerated")
+	}
+}
+
+func TestQueryClient_Cancelled(t *testing.T) {
+	_, client := newFakeSearchServer(t, fakeLogsResponse)
+	qc := NewQueryClient(client, "logharbour_acme")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	app := "billing"
+	if _, _, err := qc.GetLogs(ctx, GetLogsParam{App: &app}); err == nil {
+		t.Error("expected an error for a cancelled context")
+	}
+}
@@ -0,0 +1,551 @@
+package logharbour
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/textquerytype"
+)
+
+// QuerySyntaxError reports an error in a query passed to ParseQuery. Pos is the 1-based byte
+// position in the query of Token, the offending token.
+type QuerySyntaxError struct {
+	Pos   int
+	Token string
+	Msg   string
+}
+
+func (e *QuerySyntaxError) Error() string {
+	if e.Token == "" {
+		return fmt.Sprintf("query syntax error at position %d: %s", e.Pos, e.Msg)
+	}
+	return fmt.Sprintf("query syntax error at position %d near %q: %s", e.Pos, e.Token, e.Msg)
+}
+
+// queryFieldKind is the kind of a field of the query language, which determines the values
+// and operators it accepts.
+type queryFieldKind int
+
+const (
+	keywordQueryField queryFieldKind = iota // exact values, with * and ? wildcards
+	textQueryField                          // words and phrases
+	priQueryField                           // priority names, ordered
+	typeQueryField                          // log types
+	statusQueryField                        // success or failure
+	whenQueryField                          // dates, ordered
+	ipQueryField                            // IP addresses and CIDR ranges
+)
+
+// queryField is a field of the query language: the field of the log entry it stands for,
+// and whether that field is inside the nested changes of a data-change entry.
+type queryField struct {
+	path   string
+	kind   queryFieldKind
+	nested bool
+}
+
+// queryFields are the fields which can be named in a query.
+var queryFields = map[string]queryField{
+	id:              {id, keywordQueryField, false},
+	app:             {app, keywordQueryField, false},
+	system:          {system, keywordQueryField, false},
+	module:          {module, keywordQueryField, false},
+	typeConst:       {typeConst, typeQueryField, false},
+	pri:             {pri, priQueryField, false},
+	when:            {when, whenQueryField, false},
+	who:             {who, keywordQueryField, false},
+	op:              {op, keywordQueryField, false},
+	class:           {class, keywordQueryField, false},
+	instance:        {instance, keywordQueryField, false},
+	status:          {status, statusQueryField, false},
+	remote_ip:       {remote_ip, ipQueryField, false},
+	trace_id:        {trace_id, keywordQueryField, false},
+	"span_id":       {"span_id", keywordQueryField, false},
+	"msg":           {"msg", textQueryField, false},
+	"error":         {"error", textQueryField, false},
+	"activity_data": {"data.activity_data", textQueryField, false},
+	"entity":        {"data.change_data.entity", keywordQueryField, false},
+	"field":         {field, keywordQueryField, true},
+	"old_value":     {oldValueField, textQueryField, true},
+	"new_value":     {newValueField, textQueryField, true},
+}
+
+// dateMathPattern matches Elasticsearch date math relative to now, e.g. now-2d or now/d.
+var dateMathPattern = regexp.MustCompile(`^now([+-][0-9]+[yMwdhHms])*(/[yMwdhHms])?$`)
+
+// ParseQuery parses a query in LogHarbour's query language into an Elasticsearch query.
+//
+// A query is a list of conditions which must all hold, such as
+//
+//	app:billing pri>=Warn who:alice when:[now-2d TO now] msg:"timeout"
+//
+// A condition is field:value, or field>=value, field>value, field<=value and field<value for
+// pri and when. Values with spaces are quoted. Keyword fields such as app, who or op accept
+// * and ? wildcards; the text fields msg, error and activity_data match words, and phrases
+// when quoted. when takes dates (2026-01-02 or RFC 3339) or date math (now-2d, now/d), and
+// ranges [from TO to] in which * leaves an end open. field, old_value and new_value match
+// the changes of data-change entries. A word or quoted phrase without a field is searched
+// for in msg, error and activity_data. Conditions can be combined with AND, OR, NOT (or a
+// leading -) and parentheses; AND binds tighter than OR.
+//
+// Errors are returned as *QuerySyntaxError.
+func ParseQuery(query string) (*types.Query, error) {
+	p := &queryParser{input: query}
+	p.skipSpace()
+	if p.eof() {
+		return nil, p.errorAt(p.pos, "", "empty query")
+	}
+	q, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if !p.eof() {
+		return nil, p.errorAt(p.pos, p.peekToken(), "unexpected token")
+	}
+	return &q, nil
+}
+
+// queryParser is a recursive descent parser of the query language.
+type queryParser struct {
+	input string
+	pos   int // byte offset of the next character
+}
+
+func (p *queryParser) eof() bool {
+	return p.pos >= len(p.input)
+}
+
+func (p *queryParser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.input[p.pos]
+}
+
+func (p *queryParser) skipSpace() {
+	for !p.eof() && isQuerySpace(p.input[p.pos]) {
+		p.pos++
+	}
+}
+
+func isQuerySpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// peekToken returns the text from the current position up to the next space, for errors.
+func (p *queryParser) peekToken() string {
+	end := p.pos
+	for end < len(p.input) && !isQuerySpace(p.input[end]) {
+		end++
+	}
+	return p.input[p.pos:end]
+}
+
+func (p *queryParser) errorAt(pos int, token, format string, args ...any) error {
+	return &QuerySyntaxError{Pos: pos + 1, Token: token, Msg: fmt.Sprintf(format, args...)}
+}
+
+// keyword consumes the operator keyword kw (AND, OR, NOT) if it comes next.
+func (p *queryParser) keyword(kw string) bool {
+	if !p.atKeyword(kw) {
+		return false
+	}
+	p.pos += len(kw)
+	return true
+}
+
+func (p *queryParser) atKeyword(kw string) bool {
+	if !strings.HasPrefix(p.input[p.pos:], kw) {
+		return false
+	}
+	end := p.pos + len(kw)
+	return end == len(p.input) || isQuerySpace(p.input[end]) || p.input[end] == '('
+}
+
+// parseOr parses conditions separated by OR.
+func (p *queryParser) parseOr() (types.Query, error) {
+	var alternatives []types.Query
+	for {
+		q, err := p.parseAnd()
+		if err != nil {
+			return types.Query{}, err
+		}
+		alternatives = append(alternatives, q)
+		p.skipSpace()
+		if !p.keyword("OR") {
+			break
+		}
+	}
+	if len(alternatives) == 1 {
+		return alternatives[0], nil
+	}
+	return types.Query{Bool: &types.BoolQuery{Should: alternatives, MinimumShouldMatch: 1}}, nil
+}
+
+// parseAnd parses conditions separated by spaces or AND.
+func (p *queryParser) parseAnd() (types.Query, error) {
+	var all []types.Query
+	for {
+		p.skipSpace()
+		if p.eof() || p.peek() == ')' || p.atKeyword("OR") {
+			break
+		}
+		if p.keyword("AND") {
+			p.skipSpace()
+		}
+		q, err := p.parseUnary()
+		if err != nil {
+			return types.Query{}, err
+		}
+		all = append(all, q)
+	}
+	switch len(all) {
+	case 0:
+		return types.Query{}, p.errorAt(p.pos, p.peekToken(), "expected a condition")
+	case 1:
+		return all[0], nil
+	}
+	return types.Query{Bool: &types.BoolQuery{Must: all}}, nil
+}
+
+// parseUnary parses a condition, possibly negated with NOT or -.
+func (p *queryParser) parseUnary() (types.Query, error) {
+	if p.peek() == '-' {
+		p.pos++
+	} else if !p.keyword("NOT") {
+		return p.parsePrimary()
+	}
+	p.skipSpace()
+	q, err := p.parseUnary()
+	if err != nil {
+		return types.Query{}, err
+	}
+	return types.Query{Bool: &types.BoolQuery{MustNot: []types.Query{q}}}, nil
+}
+
+// parsePrimary parses a parenthesized query, a field condition or free text.
+func (p *queryParser) parsePrimary() (types.Query, error) {
+	start := p.pos
+	switch p.peek() {
+	case 0:
+		return types.Query{}, p.errorAt(p.pos, "", "expected a condition at the end of the query")
+	case '(':
+		p.pos++
+		q, err := p.parseOr()
+		if err != nil {
+			return types.Query{}, err
+		}
+		p.skipSpace()
+		if p.peek() != ')' {
+			return types.Query{}, p.errorAt(start, "(", "missing closing parenthesis")
+		}
+		p.pos++
+		return q, nil
+	case '"':
+		phrase, err := p.parseString()
+		if err != nil {
+			return types.Query{}, err
+		}
+		return phraseQuery(phrase, textSearchFields...), nil
+	}
+
+	// A field name is followed by : or a comparison
+	for !p.eof() && (p.peek() == '_' || p.peek() >= 'a' && p.peek() <= 'z') {
+		p.pos++
+	}
+	if name := p.input[start:p.pos]; name != "" && (p.peek() == ':' || p.peek() == '<' || p.peek() == '>') {
+		return p.parseCondition(start, name)
+	}
+
+	p.pos = start
+	word := p.readValue()
+	if word == "" {
+		return types.Query{}, p.errorAt(p.pos, p.peekToken(), "expected a condition")
+	}
+	return textQuery(word, textSearchFields...), nil
+}
+
+// readValue reads an unquoted value, which ends at a space or a closing parenthesis.
+func (p *queryParser) readValue() string {
+	start := p.pos
+	for !p.eof() && !isQuerySpace(p.peek()) && p.peek() != ')' {
+		p.pos++
+	}
+	return p.input[start:p.pos]
+}
+
+// parseString parses a quoted string, in which \" stands for a quote and \\ for a backslash.
+func (p *queryParser) parseString() (string, error) {
+	start := p.pos
+	p.pos++ // opening quote
+	var sb strings.Builder
+	for !p.eof() {
+		c := p.input[p.pos]
+		p.pos++
+		switch {
+		case c == '"':
+			return sb.String(), nil
+		case c == '\\' && !p.eof():
+			sb.WriteByte(p.input[p.pos])
+			p.pos++
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return "", p.errorAt(start, p.input[start:], "unterminated quoted string")
+}
+
+// parseCondition parses the operator and value of a condition on the field name, which
+// starts at start.
+func (p *queryParser) parseCondition(start int, name string) (types.Query, error) {
+	f, ok := queryFields[name]
+	if !ok {
+		return types.Query{}, p.errorAt(start, name, "unknown field")
+	}
+	opStart := p.pos
+	operator := ":"
+	if p.peek() != ':' {
+		operator = string(p.peek())
+		p.pos++
+		if p.peek() == '=' {
+			operator += "="
+			p.pos++
+		}
+	} else {
+		p.pos++
+	}
+	if operator != ":" && f.kind != priQueryField && f.kind != whenQueryField {
+		return types.Query{}, p.errorAt(opStart, operator, "field %s cannot be compared, use %s:value", name, name)
+	}
+
+	valueStart := p.pos
+	var value string
+	quoted := false
+	switch p.peek() {
+	case '"':
+		s, err := p.parseString()
+		if err != nil {
+			return types.Query{}, err
+		}
+		value, quoted = s, true
+	case '[', '{':
+		if f.kind != whenQueryField || operator != ":" {
+			return types.Query{}, p.errorAt(valueStart, p.peekToken(), "ranges are only supported as when:[from TO to]")
+		}
+		return p.parseWhenRange()
+	default:
+		value = p.readValue()
+	}
+	if value == "" && !quoted {
+		return types.Query{}, p.errorAt(start, p.input[start:p.pos], "missing value")
+	}
+
+	q, err := fieldQuery(f, operator, value, quoted)
+	if err != nil {
+		return types.Query{}, p.errorAt(valueStart, p.input[valueStart:p.pos], "%v", err)
+	}
+	if f.nested {
+		return types.Query{Nested: &types.NestedQuery{Path: changesPath, Query: &q}}, nil
+	}
+	return q, nil
+}
+
+// parseWhenRange parses a range of dates [from TO to], in which * leaves an end open. The
+// range includes its ends if given in square brackets, and excludes them in curly ones.
+func (p *queryParser) parseWhenRange() (types.Query, error) {
+	start := p.pos
+	open := p.input[p.pos]
+	p.pos++
+	readBound := func() (string, int, error) {
+		p.skipSpace()
+		boundStart := p.pos
+		for !p.eof() && !isQuerySpace(p.peek()) && p.peek() != ']' && p.peek() != '}' {
+			p.pos++
+		}
+		bound := p.input[boundStart:p.pos]
+		if bound == "" {
+			return "", boundStart, p.errorAt(boundStart, p.peekToken(), "missing date in range")
+		}
+		if bound != "*" && !isQueryDate(bound) {
+			return "", boundStart, p.errorAt(boundStart, bound, "invalid date")
+		}
+		return bound, boundStart, nil
+	}
+
+	from, _, err := readBound()
+	if err != nil {
+		return types.Query{}, err
+	}
+	p.skipSpace()
+	if !p.keyword("TO") {
+		return types.Query{}, p.errorAt(p.pos, p.peekToken(), "expected TO in range")
+	}
+	to, _, err := readBound()
+	if err != nil {
+		return types.Query{}, err
+	}
+	p.skipSpace()
+	closing := p.peek()
+	if closing != ']' && closing != '}' {
+		return types.Query{}, p.errorAt(start, p.input[start:p.pos], "missing ] or } at the end of the range")
+	}
+	p.pos++
+
+	var r types.DateRangeQuery
+	if from != "*" {
+		if open == '[' {
+			r.Gte = &from
+		} else {
+			r.Gt = &from
+		}
+	}
+	if to != "*" {
+		if closing == ']' {
+			r.Lte = &to
+		} else {
+			r.Lt = &to
+		}
+	}
+	return types.Query{Range: map[string]types.RangeQuery{when: r}}, nil
+}
+
+// isQueryDate reports whether s is a date the query language accepts.
+func isQueryDate(s string) bool {
+	if dateMathPattern.MatchString(s) {
+		return true
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02"} {
+		if _, err := time.Parse(layout, s); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// fieldQuery returns the query for a condition on a field.
+func fieldQuery(f queryField, operator, value string, quoted bool) (types.Query, error) {
+	switch f.kind {
+	case textQueryField:
+		if quoted {
+			return phraseQuery(value, f.path), nil
+		}
+		return textQuery(value, f.path), nil
+
+	case priQueryField:
+		p, err := ParseLogPriority(value)
+		if err != nil {
+			return types.Query{}, fmt.Errorf("unknown priority, expected one of %s", strings.Join(Priority, ", "))
+		}
+		names := priorityNames(operator, p)
+		if len(names) == 0 {
+			return types.Query{}, fmt.Errorf("no priority is %s %s", operator, p)
+		}
+		_, q := termQueryForField(pri, nil, names...)
+		return q, nil
+
+	case typeQueryField:
+		t, ok := parseQueryLogType(value)
+		if !ok {
+			return types.Query{}, fmt.Errorf("unknown log type, expected activity, change or debug")
+		}
+		_, q := termQueryForField(typeConst, &t)
+		return q, nil
+
+	case statusQueryField:
+		var s Status
+		switch strings.ToLower(value) {
+		case "success", strconv.Itoa(int(Success)):
+			s = Success
+		case "failure", strconv.Itoa(int(Failure)):
+			s = Failure
+		default:
+			return types.Query{}, fmt.Errorf("unknown status, expected success or failure")
+		}
+		return types.Query{Term: map[string]types.TermQuery{status: {Value: int(s)}}}, nil
+
+	case whenQueryField:
+		if operator == ":" {
+			return types.Query{}, fmt.Errorf("use when:[from TO to] or a comparison such as when>=now-1d")
+		}
+		if !isQueryDate(value) {
+			return types.Query{}, fmt.Errorf("invalid date")
+		}
+		var r types.DateRangeQuery
+		switch operator {
+		case ">=":
+			r.Gte = &value
+		case ">":
+			r.Gt = &value
+		case "<=":
+			r.Lte = &value
+		case "<":
+			r.Lt = &value
+		}
+		return types.Query{Range: map[string]types.RangeQuery{when: r}}, nil
+
+	case ipQueryField:
+		if net.ParseIP(value) == nil {
+			if _, _, err := net.ParseCIDR(value); err != nil {
+				return types.Query{}, fmt.Errorf("invalid IP address or CIDR range")
+			}
+		}
+		_, q := termQueryForField(f.path, &value)
+		return q, nil
+	}
+
+	if !quoted && strings.ContainsAny(value, "*?") {
+		return types.Query{Wildcard: map[string]types.WildcardQuery{f.path: {Value: &value}}}, nil
+	}
+	_, q := termQueryForField(f.path, &value)
+	return q, nil
+}
+
+// priorityNames returns the names of the priorities which compare to p with operator.
+func priorityNames(operator string, p LogPriority) []string {
+	i := slices.Index(Priority, p.String())
+	switch operator {
+	case ">=":
+		return Priority[i:]
+	case ">":
+		return Priority[i+1:]
+	case "<=":
+		return Priority[:i+1]
+	case "<":
+		return Priority[:i]
+	}
+	return Priority[i : i+1]
+}
+
+// parseQueryLogType returns the type field value of a log type given by name or letter.
+func parseQueryLogType(s string) (string, bool) {
+	switch strings.ToLower(s) {
+	case "a", "activity":
+		return LogTypeActivity, true
+	case "c", "change":
+		return LogTypeChange, true
+	case "d", "debug":
+		return LogTypeDebug, true
+	}
+	return "", false
+}
+
+// phraseQuery returns a query for a phrase in fields.
+func phraseQuery(phrase string, fields ...string) types.Query {
+	if len(fields) == 1 {
+		return types.Query{MatchPhrase: map[string]types.MatchPhraseQuery{fields[0]: {Query: phrase}}}
+	}
+	return types.Query{
+		MultiMatch: &types.MultiMatchQuery{
+			Query:  phrase,
+			Fields: fields,
+			Type:   &textquerytype.Phrase,
+		},
+	}
+}
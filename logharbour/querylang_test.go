@@ -0,0 +1,88 @@
+package logharbour
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{`app:billing`, `{"term":{"app":{"value":"billing"}}}`},
+		{`app:billing pri>=Warn who:alice when:[now-2d TO now] msg:"timeout"`,
+			`{"bool":{"must":[{"term":{"app":{"value":"billing"}}},{"terms":{"pri":["Warn","Err","Crit","Sec"]}},` +
+				`{"term":{"who":{"value":"alice"}}},{"range":{"when":{"gte":"now-2d","lte":"now"}}},` +
+				`{"match_phrase":{"msg":{"query":"timeout"}}}]}}`},
+		{`pri<info`, `{"terms":{"pri":["Debug2","Debug1","Debug0"]}}`},
+		{`pri:err`, `{"terms":{"pri":["Err"]}}`},
+		{`when:{2026-01-01 TO *]`, `{"range":{"when":{"gt":"2026-01-01"}}}`},
+		{`when<2026-01-02T10:00:00Z`, `{"range":{"when":{"lt":"2026-01-02T10:00:00Z"}}}`},
+		{`type:change status:failure`,
+			`{"bool":{"must":[{"term":{"type":{"value":"C"}}},{"term":{"status":{"value":1}}}]}}`},
+		{`op:pay* OR NOT who:bob`,
+			`{"bool":{"minimum_should_match":1,"should":[{"wildcard":{"op":{"value":"pay*"}}},` +
+				`{"bool":{"must_not":[{"term":{"who":{"value":"bob"}}}]}}]}}`},
+		{`-(app:a AND module:m)`,
+			`{"bool":{"must_not":[{"bool":{"must":[{"term":{"app":{"value":"a"}}},{"term":{"module":{"value":"m"}}}]}}]}}`},
+		{`remote_ip:10.0.0.0/8`, `{"term":{"remote_ip":{"value":"10.0.0.0/8"}}}`},
+		{`field:amount new_value:500`,
+			`{"bool":{"must":[{"nested":{"path":"data.change_data.changes","query":{"term":{"data.change_data.changes.field":{"value":"amount"}}}}},` +
+				`{"nested":{"path":"data.change_data.changes","query":{"simple_query_string":{"default_operator":"and","fields":["data.change_data.changes.new_value"],"query":"500"}}}}]}}`},
+		{`"payment failed" timeout`,
+			`{"bool":{"must":[{"multi_match":{"fields":["msg","error","data.activity_data"],"query":"payment failed","type":"phrase"}},` +
+				`{"simple_query_string":{"default_operator":"and","fields":["msg","error","data.activity_data"],"query":"timeout"}}]}}`},
+		{`who:"Alice \"A\" Smith"`, `{"term":{"who":{"value":"Alice \"A\" Smith"}}}`},
+	}
+	for _, tt := range tests {
+		q, err := ParseQuery(tt.query)
+		if err != nil {
+			t.Errorf("ParseQuery(%q) error: %v", tt.query, err)
+			continue
+		}
+		got, err := json.Marshal(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("ParseQuery(%q) =\n%s\nwant\n%s", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestParseQuery_Errors(t *testing.T) {
+	tests := []struct {
+		query string
+		pos   int
+		token string
+	}{
+		{``, 1, ""},
+		{`app:billing colour:red`, 13, "colour"},
+		{`app>billing`, 4, ">"},
+		{`pri>=Loud`, 6, "Loud"},
+		{`pri>Sec`, 5, "Sec"},
+		{`who:`, 1, "who:"},
+		{`when:yesterday`, 6, "yesterday"},
+		{`when:[now-1d now]`, 14, "now]"},
+		{`when:[now-1d TO now`, 6, "[now-1d TO now"},
+		{`(app:a OR app:b`, 1, "("},
+		{`app:a )`, 7, ")"},
+		{`remote_ip:300.1.1.1`, 11, "300.1.1.1"},
+		{`msg:"open`, 5, `"open`},
+		{`app:a OR`, 9, ""},
+	}
+	for _, tt := range tests {
+		_, err := ParseQuery(tt.query)
+		var syntaxErr *QuerySyntaxError
+		if !errors.As(err, &syntaxErr) {
+			t.Errorf("ParseQuery(%q) error = %v, want a QuerySyntaxError", tt.query, err)
+			continue
+		}
+		if syntaxErr.Pos != tt.pos || syntaxErr.Token != tt.token {
+			t.Errorf("ParseQuery(%q) error at %d near %q, want %d near %q: %v",
+				tt.query, syntaxErr.Pos, syntaxErr.Token, tt.pos, tt.token, err)
+		}
+	}
+}
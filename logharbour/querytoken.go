@@ -0,0 +1,86 @@
+package logharbour
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/elastic/go-elasticsearch/v8"
+)
+
+// QueryTarget is what a query token gives access to: the realm's log index, and the
+// Elasticsearch client to search it with.
+type QueryTarget struct {
+	Realm  string
+	Index  string
+	Client *elasticsearch.TypedClient
+}
+
+// QueryTokenResolver resolves query tokens, as described on the wiki's Architecture page.
+// Query tokens are opaque random strings, looked up by their QueryTokenHash in a realm
+// registry. They carry no Elasticsearch credentials: the realm's index is searched with the
+// client given to Resolve, whose credentials stay with the caller, e.g. the server.
+//
+// A resolver without a registry refuses every token.
+// A QueryTokenResolver is safe for concurrent use.
+type QueryTokenResolver struct {
+	registry *RealmRegistry
+}
+
+// QueryTokenResolverOption configures a QueryTokenResolver.
+type QueryTokenResolverOption func(*QueryTokenResolver)
+
+// WithQueryTokenRegistry makes the resolver accept the query tokens of the realms in
+// registry, refusing revoked and unknown tokens. Tokens revoked after the resolver was
+// created are refused once the registry is reloaded.
+func WithQueryTokenRegistry(registry *RealmRegistry) QueryTokenResolverOption {
+	return func(r *QueryTokenResolver) {
+		r.registry = registry
+	}
+}
+
+// NewQueryTokenResolver creates a QueryTokenResolver.
+func NewQueryTokenResolver(opts ...QueryTokenResolverOption) *QueryTokenResolver {
+	r := &QueryTokenResolver{}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+var defaultQueryTokenResolver atomic.Pointer[QueryTokenResolver]
+
+func init() {
+	defaultQueryTokenResolver.Store(NewQueryTokenResolver())
+}
+
+// SetDefaultQueryTokenResolver sets the resolver used by GetLogs, GetChanges, GetSet and the
+// other query functions. The default resolver has no registry, so it refuses every token.
+func SetDefaultQueryTokenResolver(r *QueryTokenResolver) {
+	defaultQueryTokenResolver.Store(r)
+}
+
+// DefaultQueryTokenResolver returns the resolver used by the query functions.
+func DefaultQueryTokenResolver() *QueryTokenResolver {
+	return defaultQueryTokenResolver.Load()
+}
+
+// Resolve returns the index a query token gives access to, to be searched with client.
+// It returns ErrMissingQueryToken for an empty token, and ErrUnknownQueryToken or
+// ErrRevokedQueryToken if the registry does not accept the token. Without a registry, it
+// returns ErrUnknownQueryToken.
+func (r *QueryTokenResolver) Resolve(token string, client *elasticsearch.TypedClient) (*QueryTarget, error) {
+	if token == "" {
+		return nil, ErrMissingQueryToken
+	}
+	if r.registry == nil {
+		return nil, fmt.Errorf("%w: no realm registry to check it against", ErrUnknownQueryToken)
+	}
+	realm, err := r.registry.LookupQueryToken(token)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		return nil, fmt.Errorf("no Elasticsearch client was given to query realm %s", realm.ShortName)
+	}
+	return &QueryTarget{Realm: realm.ShortName, Index: realm.Index, Client: client}, nil
+}
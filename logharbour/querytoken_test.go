@@ -0,0 +1,60 @@
+package logharbour
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v8"
+)
+
+func TestQueryTokenResolver_Resolve(t *testing.T) {
+	registry, err := NewRealmRegistry(Realm{ShortName: "acme", Index: "logharbour_acme",
+		QueryTokenHashes: []string{QueryTokenHash("q1"), QueryTokenHash("q2")},
+		RevokedTokens:    []string{QueryTokenHash("q0")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := elasticsearch.NewTypedClient(elasticsearch.Config{Addresses: []string{"http://localhost:9200"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewQueryTokenResolver(WithQueryTokenRegistry(registry))
+
+	target, err := r.Resolve("q1", client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target.Realm != "acme" || target.Index != "logharbour_acme" || target.Client != client {
+		t.Errorf("unexpected target %+v", target)
+	}
+	if _, err := r.Resolve("q1", nil); err == nil {
+		t.Error("expected an error without a client")
+	}
+
+	tests := map[string]error{
+		"":                   ErrMissingQueryToken,
+		"q0":                 ErrRevokedQueryToken,
+		"q3":                 ErrUnknownQueryToken,
+		QueryTokenHash("q1"): ErrUnknownQueryToken, // The stored hash is not a token
+	}
+	for token, want := range tests {
+		if _, err := r.Resolve(token, client); !errors.Is(err, want) {
+			t.Errorf("Resolve(%q) error = %v, want %v", token, err, want)
+		}
+	}
+
+	// Without a registry, every token is refused
+	if _, err := NewQueryTokenResolver().Resolve("q1", client); !errors.Is(err, ErrUnknownQueryToken) {
+		t.Errorf("Resolve without a registry error = %v, want ErrUnknownQueryToken", err)
+	}
+
+	// A token revoked after the resolver was created is refused once the registry is replaced
+	if err := registry.Replace([]Realm{{ShortName: "acme", Index: "logharbour_acme",
+		QueryTokenHashes: []string{QueryTokenHash("q2")},
+		RevokedTokens:    []string{QueryTokenHash("q0"), QueryTokenHash("q1")}}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Resolve("q1", client); !errors.Is(err, ErrRevokedQueryToken) {
+		t.Errorf("Resolve after revocation error = %v, want ErrRevokedQueryToken", err)
+	}
+}
@@ -0,0 +1,194 @@
+package logharbour
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// WriteTokenHeader is the Kafka message header which carries the write token of the realm
+// a log entry belongs to. See WithWriteToken.
+const WriteTokenHeader = "lh_write_token"
+
+var (
+	// ErrMissingWriteToken is returned when a message carries no write token.
+	ErrMissingWriteToken = errors.New("missing write token")
+	// ErrUnknownWriteToken is returned for a write token which belongs to no realm.
+	ErrUnknownWriteToken = errors.New("unknown write token")
+	// ErrRevokedWriteToken is returned for a write token which has been revoked.
+	ErrRevokedWriteToken = errors.New("revoked write token")
+	// ErrMissingQueryToken is returned when a query is made without a query token.
+	ErrMissingQueryToken = errors.New("missing query token")
+	// ErrUnknownQueryToken is returned for a query token which belongs to no realm.
+	ErrUnknownQueryToken = errors.New("unknown query token")
+	// ErrRevokedQueryToken is returned for a query token which has been revoked.
+	ErrRevokedQueryToken = errors.New("revoked query token")
+)
+
+// Realm is the master data of a realm, as described on the wiki's Access control page.
+// Each realm has its own log repository, the Elasticsearch index Index, and one or more
+// equivalent write tokens and query tokens. Query tokens are kept only as their
+// QueryTokenHash, so that the metadata and registry files do not give query access.
+// Revoked tokens are kept in RevokedTokens, query tokens by their hash, so that their use
+// can be told apart from that of a token which never existed.
+type Realm struct {
+	Id               int            `json:"id"`
+	ShortName        string         `json:"shortname"`
+	LongName         string         `json:"longname"`
+	CreatedAt        time.Time      `json:"createdat"`
+	Index            string         `json:"index"`
+	WriteTokens      []string       `json:"writetokens"`
+	QueryTokenHashes []string       `json:"querytokenhashes"`
+	RevokedTokens    []string       `json:"revokedtokens,omitempty"`
+	Payload          map[string]any `json:"payload,omitempty"`
+}
+
+// QueryTokenHash returns the hash by which a query token is stored.
+func QueryTokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// RealmRegistry maps write and query tokens to the realms they belong to. It is safe for
+// concurrent use, and its realms can be replaced while it is in use, e.g. when a token is revoked.
+type RealmRegistry struct {
+	mu      sync.RWMutex
+	realms  []Realm
+	writers map[string]*Realm
+	queries map[string]*Realm
+	revoked map[string]*Realm
+}
+
+// NewRealmRegistry creates a RealmRegistry holding the given realms.
+func NewRealmRegistry(realms ...Realm) (*RealmRegistry, error) {
+	r := &RealmRegistry{}
+	if err := r.Replace(realms); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// LoadRealmRegistry creates a RealmRegistry from a JSON file holding an array of realms.
+func LoadRealmRegistry(path string) (*RealmRegistry, error) {
+	realms, err := loadRealms(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewRealmRegistry(realms...)
+}
+
+// Reload replaces the realms of the registry with those in a JSON file. If the file cannot
+// be read or is invalid, the registry is left unchanged.
+func (r *RealmRegistry) Reload(path string) error {
+	realms, err := loadRealms(path)
+	if err != nil {
+		return err
+	}
+	return r.Replace(realms)
+}
+
+func loadRealms(path string) ([]Realm, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read realm registry: %w", err)
+	}
+	var realms []Realm
+	if err := json.Unmarshal(data, &realms); err != nil {
+		return nil, fmt.Errorf("failed to parse realm registry %s: %w", path, err)
+	}
+	return realms, nil
+}
+
+// Replace replaces the realms of the registry. The realms are validated first: each must
+// have a short name and an index, and no token may belong to two realms.
+func (r *RealmRegistry) Replace(realms []Realm) error {
+	realms = append([]Realm(nil), realms...)
+	writers := make(map[string]*Realm)
+	queries := make(map[string]*Realm)
+	revoked := make(map[string]*Realm)
+	for i := range realms {
+		realm := &realms[i]
+		if realm.ShortName == "" || realm.Index == "" {
+			return fmt.Errorf("realm %d: shortname and index are required", i)
+		}
+		for _, token := range realm.WriteTokens {
+			if other, ok := writers[token]; ok && other != realm {
+				return fmt.Errorf("write token of realm %s is also used by realm %s", realm.ShortName, other.ShortName)
+			}
+			writers[token] = realm
+		}
+		for _, hash := range realm.QueryTokenHashes {
+			if other, ok := queries[hash]; ok && other != realm {
+				return fmt.Errorf("query token of realm %s is also used by realm %s", realm.ShortName, other.ShortName)
+			}
+			queries[hash] = realm
+		}
+		for _, token := range realm.RevokedTokens {
+			revoked[token] = realm
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.realms, r.writers, r.queries, r.revoked = realms, writers, queries, revoked
+	return nil
+}
+
+// LookupWriteToken returns the realm a write token belongs to. It returns ErrMissingWriteToken
+// for an empty token, ErrRevokedWriteToken for a revoked token and ErrUnknownWriteToken for
+// any other token which belongs to no realm.
+func (r *RealmRegistry) LookupWriteToken(token string) (*Realm, error) {
+	if token == "" {
+		return nil, ErrMissingWriteToken
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if realm, ok := r.writers[token]; ok {
+		return realm, nil
+	}
+	if _, ok := r.revoked[token]; ok {
+		return nil, ErrRevokedWriteToken
+	}
+	return nil, ErrUnknownWriteToken
+}
+
+// LookupQueryToken returns the realm a query token belongs to. It returns ErrMissingQueryToken
+// for an empty token, ErrRevokedQueryToken for a revoked token and ErrUnknownQueryToken for
+// any other token which belongs to no realm.
+func (r *RealmRegistry) LookupQueryToken(token string) (*Realm, error) {
+	if token == "" {
+		return nil, ErrMissingQueryToken
+	}
+	hash := QueryTokenHash(token)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if realm, ok := r.queries[hash]; ok {
+		return realm, nil
+	}
+	if _, ok := r.revoked[hash]; ok {
+		return nil, ErrRevokedQueryToken
+	}
+	return nil, ErrUnknownQueryToken
+}
+
+// Indices returns the indices of all realms in the registry, sorted.
+func (r *RealmRegistry) Indices() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	seen := make(map[string]bool)
+	var indices []string
+	for _, realm := range r.realms {
+		if !seen[realm.Index] {
+			seen[realm.Index] = true
+			indices = append(indices, realm.Index)
+		}
+	}
+	sort.Strings(indices)
+	return indices
+}
@@ -0,0 +1,105 @@
+package logharbour
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRealmRegistry_LookupWriteToken(t *testing.T) {
+	r, err := NewRealmRegistry(
+		Realm{ShortName: "acme", Index: "logs_acme", WriteTokens: []string{"w1", "w2"}, RevokedTokens: []string{"old"}},
+		Realm{ShortName: "globex", Index: "logs_globex", WriteTokens: []string{"w3"}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		token     string
+		wantIndex string
+		wantErr   error
+	}{
+		{"w1", "logs_acme", nil},
+		{"w2", "logs_acme", nil},
+		{"w3", "logs_globex", nil},
+		{"old", "", ErrRevokedWriteToken},
+		{"nobody", "", ErrUnknownWriteToken},
+		{"", "", ErrMissingWriteToken},
+	}
+	for _, tt := range tests {
+		realm, err := r.LookupWriteToken(tt.token)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("LookupWriteToken(%q) error = %v, want %v", tt.token, err, tt.wantErr)
+		}
+		if err == nil && realm.Index != tt.wantIndex {
+			t.Errorf("LookupWriteToken(%q) index = %s, want %s", tt.token, realm.Index, tt.wantIndex)
+		}
+	}
+	if got := r.Indices(); !reflect.DeepEqual(got, []string{"logs_acme", "logs_globex"}) {
+		t.Errorf("Indices() = %v", got)
+	}
+}
+
+func TestRealmRegistry_Invalid(t *testing.T) {
+	if _, err := NewRealmRegistry(Realm{ShortName: "acme"}); err == nil {
+		t.Error("expected an error for a realm without an index")
+	}
+	_, err := NewRealmRegistry(
+		Realm{ShortName: "acme", Index: "a", WriteTokens: []string{"w"}},
+		Realm{ShortName: "globex", Index: "g", WriteTokens: []string{"w"}},
+	)
+	if err == nil {
+		t.Error("expected an error for a write token shared by two realms")
+	}
+}
+
+func TestRealmRegistry_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "realms.json")
+	write := func(content string) {
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(`[{"shortname": "acme", "index": "logs_acme", "writetokens": ["w1"]}]`)
+	r, err := LoadRealmRegistry(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	write(`[{"shortname": "acme", "index": "logs_acme", "writetokens": ["w2"], "revokedtokens": ["w1"]}]`)
+	if err := r.Reload(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.LookupWriteToken("w1"); !errors.Is(err, ErrRevokedWriteToken) {
+		t.Errorf("expected w1 to be revoked after reload, got %v", err)
+	}
+
+	write(`not json`)
+	if err := r.Reload(path); err == nil {
+		t.Error("expected an error for an invalid registry")
+	}
+	if _, err := r.LookupWriteToken("w2"); err != nil {
+		t.Errorf("expected a failed reload to keep the previous realms, got %v", err)
+	}
+}
+
+func TestRealmRegistry_LookupQueryToken(t *testing.T) {
+	r, err := NewRealmRegistry(
+		Realm{ShortName: "acme", Index: "logs_acme", QueryTokenHashes: []string{QueryTokenHash("q1")},
+			RevokedTokens: []string{QueryTokenHash("q0")}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if realm, err := r.LookupQueryToken("q1"); err != nil || realm.Index != "logs_acme" {
+		t.Errorf("LookupQueryToken(q1) = %v, %v", realm, err)
+	}
+	for token, want := range map[string]error{"q0": ErrRevokedQueryToken, "w1": ErrUnknownQueryToken, "": ErrMissingQueryToken} {
+		if _, err := r.LookupQueryToken(token); !errors.Is(err, want) {
+			t.Errorf("LookupQueryToken(%q) error = %v, want %v", token, err, want)
+		}
+	}
+}
@@ -0,0 +1,529 @@
+package logharbour
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/core/search"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/refresh"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/sortorder"
+)
+
+const (
+	// DefaultRealmMetadataIndex is the private index in which RealmAdmin keeps realm metadata.
+	DefaultRealmMetadataIndex = "logharbour_realms"
+	// RealmIndexPrefix is prepended to a realm's short name to name its log index.
+	RealmIndexPrefix = "logharbour_"
+
+	tokenBytes         = 32
+	realmAdminModule   = "lhadmin"
+	realmAdminEntity   = "Realm"
+	realmMaxListResult = 10000
+
+	// The realm id counter is a document of the metadata index with no short name.
+	realmIdCounterDoc     = "_realm_id_counter"
+	realmIdCounterField   = "lastid"
+	realmIdCounterRetries = 10
+)
+
+// RealmMetadataMapping defines the Elasticsearch index mapping for realm metadata.
+const RealmMetadataMapping = `{
+  "mappings": {
+    "properties": {
+      "id": {
+        "type": "integer"
+      },
+      "shortname": {
+        "type": "keyword"
+      },
+      "longname": {
+        "type": "text"
+      },
+      "createdat": {
+        "type": "date"
+      },
+      "index": {
+        "type": "keyword"
+      },
+      "writetokens": {
+        "type": "keyword"
+      },
+      "querytokenhashes": {
+        "type": "keyword"
+      },
+      "revokedtokens": {
+        "type": "keyword"
+      },
+      "payload": {
+        "type": "object",
+        "enabled": false
+      }
+    }
+  }
+}`
+
+var (
+	ErrInvalidRealmName = errors.New("realm short name must be a lower-case identifier")
+	ErrRealmExists      = errors.New("realm already exists")
+	ErrRealmNotFound    = errors.New("realm not found")
+	ErrTokenNotFound    = errors.New("token does not belong to the realm")
+)
+
+// realmNamePattern follows the wiki: one word, lower case, with the syntax of an identifier.
+var realmNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// TokenKind is the kind of a realm access token.
+type TokenKind string
+
+const (
+	TokenWrite TokenKind = "write" // Write tokens let applications insert log entries.
+	TokenQuery TokenKind = "query" // Query tokens let applications query the log repository.
+)
+
+// TokenFingerprint returns a short digest identifying a token, for logging it without
+// disclosing it.
+func TokenFingerprint(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:8])
+}
+
+// randomString returns n random bytes, base64-encoded.
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+// RealmAdmin implements the administration of realms described on the wiki's Architecture
+// page: creating a realm's log index, and issuing, rotating and revoking its tokens. Realm
+// metadata is kept in a private index, one document per realm with the short name as id.
+// Tokens are random strings; query tokens are stored only as their QueryTokenHash, so they
+// are shown once, when issued.
+//
+// Every operation is logged as a Change entry through the logger set with
+// WithRealmAdminLogger. Tokens are logged only by their TokenFingerprint.
+type RealmAdmin struct {
+	client    *elasticsearch.TypedClient
+	metaIndex string
+	logger    *Logger
+}
+
+// RealmAdminOption configures a RealmAdmin.
+type RealmAdminOption func(*RealmAdmin)
+
+// WithRealmMetadataIndex sets the metadata index. The default is DefaultRealmMetadataIndex.
+func WithRealmMetadataIndex(index string) RealmAdminOption {
+	return func(a *RealmAdmin) {
+		a.metaIndex = index
+	}
+}
+
+// WithRealmAdminLogger sets the logger to which operations are logged as Change entries.
+func WithRealmAdminLogger(logger *Logger) RealmAdminOption {
+	return func(a *RealmAdmin) {
+		a.logger = logger
+	}
+}
+
+// NewRealmAdmin creates a RealmAdmin working on the cluster of client.
+func NewRealmAdmin(client *elasticsearch.TypedClient, opts ...RealmAdminOption) *RealmAdmin {
+	a := &RealmAdmin{client: client, metaIndex: DefaultRealmMetadataIndex}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// EnsureMetadataIndex creates the metadata index with RealmMetadataMapping if it does not exist.
+func (a *RealmAdmin) EnsureMetadataIndex(ctx context.Context) error {
+	_, err := a.ensureIndex(ctx, a.metaIndex, RealmMetadataMapping)
+	return err
+}
+
+// ensureIndex creates index with mapping if it does not exist, and reports whether it did.
+func (a *RealmAdmin) ensureIndex(ctx context.Context, index, mapping string) (bool, error) {
+	exists, err := a.client.Indices.Exists(index).Do(ctx)
+	if err != nil {
+		return false, fmt.Errorf("error checking if index %s exists: %w", index, err)
+	}
+	if exists {
+		return false, nil
+	}
+	if _, err := a.client.Indices.Create(index).Raw(strings.NewReader(mapping)).Do(ctx); err != nil {
+		return false, fmt.Errorf("error creating index %s: %w", index, err)
+	}
+	return true, nil
+}
+
+// CreateRealm creates a realm: its log index with ESLogsMapping, its metadata, and one write
+// token and one query token. The index is named RealmIndexPrefix followed by shortName.
+// The query token is returned along with the realm, since the realm holds only its hash.
+//
+// The metadata document is created first, with a create-only write, so that of concurrent
+// creations of the same realm only one goes on. If a later step fails, what was created is
+// removed again.
+func (a *RealmAdmin) CreateRealm(ctx context.Context, shortName, longName string, payload map[string]any) (*Realm, string, error) {
+	if !realmNamePattern.MatchString(shortName) {
+		return nil, "", ErrInvalidRealmName
+	}
+	if longName == "" {
+		return nil, "", errors.New("realm long name is required")
+	}
+	if err := a.EnsureMetadataIndex(ctx); err != nil {
+		return nil, "", err
+	}
+	if _, _, err := a.getRealm(ctx, shortName); err == nil {
+		return nil, "", ErrRealmExists
+	} else if !errors.Is(err, ErrRealmNotFound) {
+		return nil, "", err
+	}
+
+	id, err := a.nextRealmId(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	if payload == nil {
+		payload = map[string]any{}
+	}
+	realm := &Realm{
+		Id:               id,
+		ShortName:        shortName,
+		LongName:         longName,
+		CreatedAt:        time.Now().UTC(),
+		Index:            RealmIndexPrefix + shortName,
+		WriteTokens:      []string{},
+		QueryTokenHashes: []string{},
+		Payload:          payload,
+	}
+
+	res, err := a.client.Create(a.metaIndex, shortName).Request(realm).Refresh(refresh.True).Do(ctx)
+	if err != nil {
+		var esErr *types.ElasticsearchError
+		if errors.As(err, &esErr) && esErr.Status == 409 {
+			return nil, "", ErrRealmExists
+		}
+		return nil, "", fmt.Errorf("error storing realm metadata: %w", err)
+	}
+	version := realmVersion{seqNo: res.SeqNo_, primaryTerm: res.PrimaryTerm_}
+
+	var indexCreated bool
+	queryToken, err := a.setupRealm(ctx, realm, version, &indexCreated)
+	if err != nil {
+		a.rollbackRealm(ctx, realm, indexCreated)
+		return nil, "", err
+	}
+
+	a.logChange("Realm created", "Create", shortName,
+		NewChangeDetail("shortname", nil, realm.ShortName),
+		NewChangeDetail("longname", nil, realm.LongName),
+		NewChangeDetail("index", nil, realm.Index),
+		NewChangeDetail("writetokens", nil, TokenFingerprint(realm.WriteTokens[0])),
+		NewChangeDetail("querytokenhashes", nil, TokenFingerprint(queryToken)))
+	return realm, queryToken, nil
+}
+
+// setupRealm creates the index and tokens of a realm whose metadata document has just been
+// created with version, stores the tokens in it and returns the query token. indexCreated
+// is set if the index did not exist before.
+func (a *RealmAdmin) setupRealm(ctx context.Context, realm *Realm, version realmVersion, indexCreated *bool) (string, error) {
+	var err error
+	if *indexCreated, err = a.ensureIndex(ctx, realm.Index, ESLogsMapping); err != nil {
+		return "", err
+	}
+	writeToken, err := newToken()
+	if err != nil {
+		return "", err
+	}
+	queryToken, err := newToken()
+	if err != nil {
+		return "", err
+	}
+	addToken(realm, TokenWrite, writeToken)
+	addToken(realm, TokenQuery, queryToken)
+
+	_, err = a.client.Index(a.metaIndex).Id(realm.ShortName).Request(realm).
+		IfSeqNo(strconv.FormatInt(version.seqNo, 10)).
+		IfPrimaryTerm(strconv.FormatInt(version.primaryTerm, 10)).
+		Refresh(refresh.True).Do(ctx)
+	if err != nil {
+		return "", fmt.Errorf("error storing realm metadata: %w", err)
+	}
+	return queryToken, nil
+}
+
+// rollbackRealm removes what a failed CreateRealm created: its index if indexCreated, and
+// its metadata document. Failures are logged, since the creation has already failed.
+func (a *RealmAdmin) rollbackRealm(ctx context.Context, realm *Realm, indexCreated bool) {
+	if indexCreated {
+		if _, err := a.client.Indices.Delete(realm.Index).Do(ctx); err != nil {
+			a.logRollbackError("DeleteIndex", realm, err)
+		}
+	}
+	if _, err := a.client.Delete(a.metaIndex, realm.ShortName).Refresh(refresh.True).Do(ctx); err != nil {
+		a.logRollbackError("DeleteRealm", realm, err)
+	}
+}
+
+func (a *RealmAdmin) logRollbackError(op string, realm *Realm, err error) {
+	if a.logger != nil {
+		a.logger.WithModule(realmAdminModule).WithOp(op).WithClass(realmAdminEntity).
+			WithInstanceId(realm.ShortName).Error(err).LogActivity("Failed to roll back realm creation", realm.Index)
+	}
+}
+
+// nextRealmId allocates a realm id from a counter document in the metadata index. The counter
+// is incremented by a scripted update, which Elasticsearch applies atomically, so concurrent
+// creations get distinct ids. The counter is started after the highest id in use.
+func (a *RealmAdmin) nextRealmId(ctx context.Context) (int, error) {
+	last, err := a.lastRealmId(ctx)
+	if err != nil {
+		return 0, err
+	}
+	res, err := a.client.Update(a.metaIndex, realmIdCounterDoc).
+		Script(types.InlineScript{Source: "ctx._source." + realmIdCounterField + " += 1"}).
+		Upsert(map[string]int{realmIdCounterField: last + 1}).
+		Source_(true).
+		RetryOnConflict(realmIdCounterRetries).
+		Refresh(refresh.True).Do(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error allocating realm id: %w", err)
+	}
+	if res.Get == nil {
+		return 0, errors.New("error allocating realm id: counter not returned")
+	}
+	var counter map[string]int
+	if err := json.Unmarshal(res.Get.Source_, &counter); err != nil {
+		return 0, fmt.Errorf("error allocating realm id: %w", err)
+	}
+	return counter[realmIdCounterField], nil
+}
+
+// lastRealmId returns the highest id of the realms in the metadata index, or 0.
+func (a *RealmAdmin) lastRealmId(ctx context.Context) (int, error) {
+	size := 1
+	res, err := a.client.Search().Index(a.metaIndex).Request(&search.Request{
+		Size:  &size,
+		Query: realmDocsQuery(),
+		Sort: []types.SortCombinations{types.SortOptions{
+			SortOptions: map[string]types.FieldSort{"id": {Order: &sortorder.Desc}},
+		}},
+	}).Do(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error reading realm ids: %w", err)
+	}
+	if len(res.Hits.Hits) == 0 {
+		return 0, nil
+	}
+	var realm Realm
+	if err := json.Unmarshal(res.Hits.Hits[0].Source_, &realm); err != nil {
+		return 0, fmt.Errorf("error while unmarshalling realm metadata: %w", err)
+	}
+	return realm.Id, nil
+}
+
+// realmDocsQuery matches the realm documents of the metadata index, leaving out the id counter.
+func realmDocsQuery() *types.Query {
+	return &types.Query{Exists: &types.ExistsQuery{Field: "shortname"}}
+}
+
+// GetRealm returns the metadata of a realm, or ErrRealmNotFound.
+func (a *RealmAdmin) GetRealm(ctx context.Context, shortName string) (*Realm, error) {
+	realm, _, err := a.getRealm(ctx, shortName)
+	return realm, err
+}
+
+// realmVersion identifies the version of a realm's metadata document, for optimistic
+// concurrency control of updates.
+type realmVersion struct {
+	seqNo       int64
+	primaryTerm int64
+}
+
+func (a *RealmAdmin) getRealm(ctx context.Context, shortName string) (*Realm, realmVersion, error) {
+	res, err := a.client.Get(a.metaIndex, shortName).Do(ctx)
+	if err != nil {
+		var esErr *types.ElasticsearchError
+		if errors.As(err, &esErr) && esErr.Status == 404 {
+			return nil, realmVersion{}, ErrRealmNotFound
+		}
+		return nil, realmVersion{}, fmt.Errorf("error reading realm metadata: %w", err)
+	}
+	if !res.Found {
+		return nil, realmVersion{}, ErrRealmNotFound
+	}
+	var realm Realm
+	if err := json.Unmarshal(res.Source_, &realm); err != nil {
+		return nil, realmVersion{}, fmt.Errorf("error while unmarshalling realm metadata: %w", err)
+	}
+	var version realmVersion
+	if res.SeqNo_ != nil && res.PrimaryTerm_ != nil {
+		version = realmVersion{seqNo: *res.SeqNo_, primaryTerm: *res.PrimaryTerm_}
+	}
+	return &realm, version, nil
+}
+
+// ListRealms returns the metadata of all realms, ordered by id.
+func (a *RealmAdmin) ListRealms(ctx context.Context) ([]Realm, error) {
+	if err := a.EnsureMetadataIndex(ctx); err != nil {
+		return nil, err
+	}
+	size := realmMaxListResult
+	res, err := a.client.Search().Index(a.metaIndex).Request(&search.Request{
+		Size:  &size,
+		Query: realmDocsQuery(),
+		Sort: []types.SortCombinations{types.SortOptions{
+			SortOptions: map[string]types.FieldSort{"id": {Order: &sortorder.Asc}},
+		}},
+	}).Do(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error listing realms: %w", err)
+	}
+	realms := make([]Realm, 0, len(res.Hits.Hits))
+	for _, hit := range res.Hits.Hits {
+		var realm Realm
+		if err := json.Unmarshal(hit.Source_, &realm); err != nil {
+			return nil, fmt.Errorf("error while unmarshalling realm metadata: %w", err)
+		}
+		realms = append(realms, realm)
+	}
+	return realms, nil
+}
+
+// IssueToken adds a new token of the given kind to a realm and returns it.
+func (a *RealmAdmin) IssueToken(ctx context.Context, shortName string, kind TokenKind) (string, error) {
+	if kind != TokenWrite && kind != TokenQuery {
+		return "", fmt.Errorf("unknown token kind %q", kind)
+	}
+	token, err := newToken()
+	if err != nil {
+		return "", err
+	}
+	err = a.updateRealm(ctx, shortName, func(realm *Realm) error {
+		addToken(realm, kind, token)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	a.logChange("Realm token issued", "IssueToken", shortName,
+		NewChangeDetail(string(kind)+"tokens", nil, TokenFingerprint(token)))
+	return token, nil
+}
+
+// RotateToken replaces a token of a realm with a new token of the same kind, which it returns
+// with the kind. The old token is revoked.
+func (a *RealmAdmin) RotateToken(ctx context.Context, shortName, oldToken string) (string, TokenKind, error) {
+	token, err := newToken()
+	if err != nil {
+		return "", "", err
+	}
+	var kind TokenKind
+	err = a.updateRealm(ctx, shortName, func(realm *Realm) error {
+		var err error
+		if kind, err = removeToken(realm, oldToken); err != nil {
+			return err
+		}
+		addToken(realm, kind, token)
+		return nil
+	})
+	if err != nil {
+		return "", "", err
+	}
+	a.logChange("Realm token rotated", "RotateToken", shortName,
+		NewChangeDetail(string(kind)+"tokens", TokenFingerprint(oldToken), TokenFingerprint(token)))
+	return token, kind, nil
+}
+
+// RevokeToken removes a token from a realm and records it as revoked, so that the consumer
+// and the query service can report its use.
+func (a *RealmAdmin) RevokeToken(ctx context.Context, shortName, token string) error {
+	var kind TokenKind
+	err := a.updateRealm(ctx, shortName, func(realm *Realm) error {
+		var err error
+		kind, err = removeToken(realm, token)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	a.logChange("Realm token revoked", "RevokeToken", shortName,
+		NewChangeDetail(string(kind)+"tokens", TokenFingerprint(token), nil))
+	return nil
+}
+
+// updateRealm reads a realm, applies update and writes it back, failing if the realm was
+// changed concurrently.
+func (a *RealmAdmin) updateRealm(ctx context.Context, shortName string, update func(*Realm) error) error {
+	realm, version, err := a.getRealm(ctx, shortName)
+	if err != nil {
+		return err
+	}
+	if err := update(realm); err != nil {
+		return err
+	}
+	_, err = a.client.Index(a.metaIndex).Id(shortName).Request(realm).
+		IfSeqNo(strconv.FormatInt(version.seqNo, 10)).
+		IfPrimaryTerm(strconv.FormatInt(version.primaryTerm, 10)).
+		Refresh(refresh.True).Do(ctx)
+	if err != nil {
+		return fmt.Errorf("error updating realm metadata: %w", err)
+	}
+	return nil
+}
+
+// addToken adds token to the active tokens of realm; a query token by its hash.
+func addToken(realm *Realm, kind TokenKind, token string) {
+	if kind == TokenWrite {
+		realm.WriteTokens = append(realm.WriteTokens, token)
+	} else {
+		realm.QueryTokenHashes = append(realm.QueryTokenHashes, QueryTokenHash(token))
+	}
+}
+
+// removeToken removes token from the active tokens of realm, adds it to the revoked tokens
+// and returns its kind. A query token is looked up and revoked by its hash.
+func removeToken(realm *Realm, token string) (TokenKind, error) {
+	hash := QueryTokenHash(token)
+	if i := slices.Index(realm.WriteTokens, token); i >= 0 {
+		realm.WriteTokens = slices.Delete(realm.WriteTokens, i, i+1)
+		realm.RevokedTokens = append(realm.RevokedTokens, token)
+		return TokenWrite, nil
+	}
+	if i := slices.Index(realm.QueryTokenHashes, hash); i >= 0 {
+		realm.QueryTokenHashes = slices.Delete(realm.QueryTokenHashes, i, i+1)
+		realm.RevokedTokens = append(realm.RevokedTokens, hash)
+		return TokenQuery, nil
+	}
+	return "", ErrTokenNotFound
+}
+
+// newToken generates a token, of either kind.
+func newToken() (string, error) {
+	return randomString(tokenBytes)
+}
+
+// logChange logs an admin operation on a realm as a Change entry.
+func (a *RealmAdmin) logChange(message, op, shortName string, changes ...ChangeDetail) {
+	if a.logger == nil {
+		return
+	}
+	change := NewChangeInfo(realmAdminEntity, op)
+	change.Changes = append(change.Changes, changes...)
+	a.logger.WithModule(realmAdminModule).WithOp(op).WithClass(realmAdminEntity).WithInstanceId(shortName).
+		LogDataChange(message, *change)
+}
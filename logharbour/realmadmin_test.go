@@ -0,0 +1,138 @@
+package logharbour
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v8"
+)
+
+func TestAddToken(t *testing.T) {
+	realm := &Realm{}
+	addToken(realm, TokenWrite, "w1")
+	addToken(realm, TokenQuery, "q1")
+	want := &Realm{WriteTokens: []string{"w1"}, QueryTokenHashes: []string{QueryTokenHash("q1")}}
+	if !reflect.DeepEqual(realm, want) {
+		t.Errorf("got %+v, want %+v", realm, want)
+	}
+}
+
+func TestRemoveToken(t *testing.T) {
+	realm := &Realm{WriteTokens: []string{"w1", "w2"}, QueryTokenHashes: []string{QueryTokenHash("q1")}}
+
+	if kind, err := removeToken(realm, "w1"); err != nil || kind != TokenWrite {
+		t.Errorf("removeToken(w1) = %v, %v", kind, err)
+	}
+	if kind, err := removeToken(realm, "q1"); err != nil || kind != TokenQuery {
+		t.Errorf("removeToken(q1) = %v, %v", kind, err)
+	}
+	for _, token := range []string{"w1", QueryTokenHash("q1")} {
+		if _, err := removeToken(realm, token); !errors.Is(err, ErrTokenNotFound) {
+			t.Errorf("removeToken(%q) error = %v, want ErrTokenNotFound", token, err)
+		}
+	}
+	want := &Realm{WriteTokens: []string{"w2"}, QueryTokenHashes: []string{}, RevokedTokens: []string{"w1", QueryTokenHash("q1")}}
+	if !reflect.DeepEqual(realm, want) {
+		t.Errorf("got %+v, want %+v", realm, want)
+	}
+}
+
+func TestTokenFingerprint(t *testing.T) {
+	a, b := TokenFingerprint("token-a"), TokenFingerprint("token-b")
+	if a == b || len(a) != 16 || a != TokenFingerprint("token-a") {
+		t.Errorf("unexpected fingerprints %q and %q", a, b)
+	}
+}
+
+// fakeRealmCluster answers the requests RealmAdmin.CreateRealm makes for the realm acme, with
+// the metadata index already present and the realm's index missing. Requests are recorded as
+// "METHOD path", and storing the realm's tokens fails with a version conflict.
+func fakeRealmCluster(t *testing.T) (*[]string, *elasticsearch.TypedClient) {
+	t.Helper()
+	var mu sync.Mutex
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		mu.Unlock()
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		w.Header().Set("Content-Type", "application/json")
+		written := `{"_index": "realms", "_id": "acme", "_version": 1, "_seq_no": 7, "_primary_term": 1, "result": "%s",
+			"_shards": {"total": 1, "successful": 1, "failed": 0}}`
+		switch key := r.Method + " " + r.URL.Path; key {
+		case "HEAD /realms":
+		case "HEAD /logharbour_acme":
+			w.WriteHeader(http.StatusNotFound)
+		case "GET /realms/_doc/acme":
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `{"_index": "realms", "_id": "acme", "found": false}`)
+		case "POST /realms/_search":
+			io.WriteString(w, `{"took": 1, "timed_out": false, "_shards": {"total": 1, "successful": 1, "skipped": 0, "failed": 0},
+				"hits": {"total": {"value": 1, "relation": "eq"}, "hits": [{"_index": "realms", "_id": "old", "_source": {"id": 4, "shortname": "old"}}]}}`)
+		case "POST /realms/_update/_realm_id_counter":
+			if !strings.Contains(string(body), `"upsert":{"lastid":5}`) {
+				t.Errorf("counter update %s does not start after the highest id", body)
+			}
+			io.WriteString(w, `{"_index": "realms", "_id": "_realm_id_counter", "_version": 3, "_seq_no": 6, "_primary_term": 1,
+				"result": "updated", "_shards": {"total": 1, "successful": 1, "failed": 0},
+				"get": {"found": true, "_source": {"lastid": 9}}}`)
+		case "PUT /realms/_create/acme":
+			if !strings.Contains(string(body), `"id":9,`) {
+				t.Errorf("created realm %s without the allocated id", body)
+			}
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprintf(w, written, "created")
+		case "PUT /logharbour_acme":
+			io.WriteString(w, `{"acknowledged": true, "shards_acknowledged": true, "index": "logharbour_acme"}`)
+		case "PUT /realms/_doc/acme":
+			w.WriteHeader(http.StatusConflict)
+			io.WriteString(w, `{"error": {"type": "version_conflict_engine_exception", "reason": "conflict"}, "status": 409}`)
+		case "DELETE /logharbour_acme":
+			io.WriteString(w, `{"acknowledged": true}`)
+		case "DELETE /realms/_doc/acme":
+			fmt.Fprintf(w, written, "deleted")
+		default:
+			t.Errorf("unexpected request %s", key)
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	t.Cleanup(server.Close)
+	client, err := elasticsearch.NewTypedClient(elasticsearch.Config{Addresses: []string{server.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &requests, client
+}
+
+func TestRealmAdmin_CreateRealmRollback(t *testing.T) {
+	requests, client := fakeRealmCluster(t)
+	admin := NewRealmAdmin(client, WithRealmMetadataIndex("realms"))
+
+	if _, _, err := admin.CreateRealm(context.Background(), "acme", "Acme Corp", nil); err == nil {
+		t.Fatal("creation succeeded although storing the tokens failed")
+	}
+	want := []string{
+		"HEAD /realms",
+		"GET /realms/_doc/acme",
+		"POST /realms/_search",
+		"POST /realms/_update/_realm_id_counter",
+		"PUT /realms/_create/acme",
+		"HEAD /logharbour_acme",
+		"PUT /logharbour_acme",
+		"PUT /realms/_doc/acme",
+		"DELETE /logharbour_acme",
+		"DELETE /realms/_doc/acme",
+	}
+	if !reflect.DeepEqual(*requests, want) {
+		t.Errorf("requests:\n%s\nwant:\n%s", strings.Join(*requests, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,509 @@
+package logharbour
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultRedactMarker replaces redacted values when no hash key is configured.
+const DefaultRedactMarker = "[REDACTED]"
+
+// redactTagName is the struct tag honoured by convertToString, e.g. `logharbour:"redact"`.
+const redactTagName = "logharbour"
+
+// Patterns for common kinds of sensitive data, for use with WithRedactPatterns.
+var (
+	// RedactCardNumberPattern matches payment card numbers (PANs) of 13 to 19 digits,
+	// optionally grouped with spaces or dashes. A Redactor only redacts the matches which
+	// pass the Luhn check, so that other long numbers, such as ids and timestamps, are kept.
+	RedactCardNumberPattern = regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`)
+	// RedactAadhaarPattern matches 12-digit Aadhaar numbers, optionally grouped in fours. A
+	// Redactor only redacts the matches which pass the Verhoeff check.
+	RedactAadhaarPattern = regexp.MustCompile(`\b\d{4}[ -]?\d{4}[ -]?\d{4}\b`)
+	// RedactBearerTokenPattern matches bearer tokens as found in Authorization headers.
+	RedactBearerTokenPattern = regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9\-._~+/]+=*`)
+)
+
+// redactPatternChecks holds the checksums which matches of the predefined patterns must pass
+// to be redacted.
+var redactPatternChecks = map[*regexp.Regexp]func(digits string) bool{
+	RedactCardNumberPattern: luhnValid,
+	RedactAadhaarPattern:    verhoeffValid,
+}
+
+// Redactor removes sensitive data from log entries before they are written.
+//
+// It replaces the old and new values of changes whose field is in a deny list, and the parts
+// of the message, error, activity data and debug data which match any of a set of regular
+// expressions. Redacted values are replaced with a marker, or, if a hash key is configured, with
+// a keyed hash of the value, so that entries can still be compared for equality without
+// revealing the value.
+//
+// A Redactor takes effect once it is set on a LoggerContext with SetRedactor.
+//
+// Independently of any Redactor, `logharbour` struct tags are honoured on the values logged
+// as change values, activity data and debug data. Tagged fields are redacted as the Redactor
+// of the logger would redact them, or replaced with DefaultRedactMarker if it has none:
+//
+//	type Customer struct {
+//		Name     string `json:"name"`
+//		Password string `json:"password" logharbour:"redact"`     // redacted
+//		Card     string `json:"card" logharbour:"mask=last4"`      // "************1234"
+//		PAN      string `json:"pan" logharbour:"mask=first2"`      // "AB********"
+//	}
+//
+// Example:
+//
+//	lctx.SetRedactor(logharbour.NewRedactor(
+//		logharbour.WithRedactFields("password", "pin", "aadhaar"),
+//		logharbour.WithRedactPatterns(logharbour.RedactCardNumberPattern, logharbour.RedactBearerTokenPattern),
+//		logharbour.WithRedactHashKey(key)))
+type Redactor struct {
+	fields   map[string]bool
+	patterns []*regexp.Regexp
+	hashKey  []byte
+	marker   string
+}
+
+// RedactorOption configures a Redactor.
+type RedactorOption func(*Redactor)
+
+// WithRedactFields adds field names whose change values are redacted. Names are matched
+// case-insensitively against ChangeDetail.Field, and also against the last element of a
+// dotted field name, so that "password" matches "user.password".
+func WithRedactFields(names ...string) RedactorOption {
+	return func(r *Redactor) {
+		for _, name := range names {
+			r.fields[strings.ToLower(name)] = true
+		}
+	}
+}
+
+// WithRedactPatterns adds regular expressions whose matches in the message, error, activity
+// data and debug data are redacted.
+func WithRedactPatterns(patterns ...*regexp.Regexp) RedactorOption {
+	return func(r *Redactor) {
+		r.patterns = append(r.patterns, patterns...)
+	}
+}
+
+// WithRedactMarker sets the marker which replaces redacted values. The default is DefaultRedactMarker.
+func WithRedactMarker(marker string) RedactorOption {
+	return func(r *Redactor) {
+		r.marker = marker
+	}
+}
+
+// WithRedactHashKey makes the Redactor replace redacted values with "hmac:" followed by a
+// truncated HMAC-SHA256 of the value under key, instead of the marker.
+func WithRedactHashKey(key []byte) RedactorOption {
+	return func(r *Redactor) {
+		r.hashKey = key
+	}
+}
+
+// NewRedactor creates a Redactor with the given options.
+func NewRedactor(opts ...RedactorOption) *Redactor {
+	r := &Redactor{
+		fields: make(map[string]bool),
+		marker: DefaultRedactMarker,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// SetRedactor sets the Redactor applied to the entries of all loggers sharing this context.
+// Passing nil disables redaction.
+func (lc *LoggerContext) SetRedactor(r *Redactor) {
+	lc.redactor.Store(r)
+}
+
+// redactFunc returns the value which replaces the sensitive value s.
+type redactFunc func(s string) string
+
+// markRedacted is the redactFunc used when no Redactor is set.
+func markRedacted(string) string {
+	return DefaultRedactMarker
+}
+
+// redactFunc returns the redactFunc of the context's Redactor, or markRedacted if it has none.
+func (lc *LoggerContext) redactFunc() redactFunc {
+	if r := lc.redactor.Load(); r != nil {
+		return r.replacement
+	}
+	return markRedacted
+}
+
+// replacement returns the value which replaces the sensitive value s.
+func (r *Redactor) replacement(s string) string {
+	if len(r.hashKey) == 0 {
+		return r.marker
+	}
+	mac := hmac.New(sha256.New, r.hashKey)
+	mac.Write([]byte(s))
+	return "hmac:" + hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// isDeniedField reports whether the values of the field must be redacted.
+func (r *Redactor) isDeniedField(field string) bool {
+	field = strings.ToLower(field)
+	if r.fields[field] {
+		return true
+	}
+	if i := strings.LastIndexByte(field, '.'); i >= 0 {
+		return r.fields[field[i+1:]]
+	}
+	return false
+}
+
+// redactString replaces every match of the Redactor's patterns in s. Matches of the predefined
+// patterns are only replaced if they pass the pattern's checksum.
+func (r *Redactor) redactString(s string) string {
+	for _, re := range r.patterns {
+		check := redactPatternChecks[re]
+		s = re.ReplaceAllStringFunc(s, func(match string) string {
+			if check != nil && !check(digitsOf(match)) {
+				return match
+			}
+			return r.replacement(match)
+		})
+	}
+	return s
+}
+
+// digitsOf returns the decimal digits of s.
+func digitsOf(s string) string {
+	return strings.Map(func(c rune) rune {
+		if c >= '0' && c <= '9' {
+			return c
+		}
+		return -1
+	}, s)
+}
+
+// luhnValid reports whether digits, a payment card number, has a valid Luhn check digit.
+func luhnValid(digits string) bool {
+	sum := 0
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if (len(digits)-1-i)%2 == 1 {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return len(digits) > 0 && sum%10 == 0
+}
+
+// verhoeffD and verhoeffP are the multiplication and permutation tables of the Verhoeff
+// check digit algorithm, which Aadhaar numbers use.
+var (
+	verhoeffD = [10][10]int{
+		{0, 1, 2, 3, 4, 5, 6, 7, 8, 9},
+		{1, 2, 3, 4, 0, 6, 7, 8, 9, 5},
+		{2, 3, 4, 0, 1, 7, 8, 9, 5, 6},
+		{3, 4, 0, 1, 2, 8, 9, 5, 6, 7},
+		{4, 0, 1, 2, 3, 9, 5, 6, 7, 8},
+		{5, 9, 8, 7, 6, 0, 4, 3, 2, 1},
+		{6, 5, 9, 8, 7, 1, 0, 4, 3, 2},
+		{7, 6, 5, 9, 8, 2, 1, 0, 4, 3},
+		{8, 7, 6, 5, 9, 3, 2, 1, 0, 4},
+		{9, 8, 7, 6, 5, 4, 3, 2, 1, 0},
+	}
+	verhoeffP = [8][10]int{
+		{0, 1, 2, 3, 4, 5, 6, 7, 8, 9},
+		{1, 5, 7, 6, 2, 8, 3, 0, 9, 4},
+		{5, 8, 0, 3, 7, 9, 6, 1, 4, 2},
+		{8, 9, 1, 6, 0, 4, 3, 5, 2, 7},
+		{9, 4, 5, 3, 1, 2, 6, 8, 7, 0},
+		{4, 2, 8, 6, 5, 7, 3, 9, 0, 1},
+		{2, 7, 9, 3, 8, 0, 6, 4, 1, 5},
+		{7, 0, 4, 6, 9, 1, 3, 2, 5, 8},
+	}
+)
+
+// verhoeffValid reports whether digits, an Aadhaar number, has a valid Verhoeff check digit.
+func verhoeffValid(digits string) bool {
+	c := 0
+	for i := len(digits) - 1; i >= 0; i-- {
+		c = verhoeffD[c][verhoeffP[(len(digits)-1-i)%8][digits[i]-'0']]
+	}
+	return len(digits) > 0 && c == 0
+}
+
+// apply redacts the entry in place. Change details are copied first, since their slice is
+// shared with the caller of LogDataChange.
+func (r *Redactor) apply(entry *LogEntry) {
+	entry.Msg = r.redactString(entry.Msg)
+	entry.Error = r.redactString(entry.Error)
+	if entry.Data == nil {
+		return
+	}
+	entry.Data.ActivityData = r.redactString(entry.Data.ActivityData)
+	if entry.Data.DebugData != nil {
+		debugData := *entry.Data.DebugData
+		if data, ok := debugData.Data.(string); ok {
+			debugData.Data = r.redactString(data)
+		}
+		entry.Data.DebugData = &debugData
+	}
+	if entry.Data.ChangeData != nil && len(r.fields) > 0 {
+		changeData := *entry.Data.ChangeData
+		changeData.Changes = make([]ChangeDetail, len(entry.Data.ChangeData.Changes))
+		for i, change := range entry.Data.ChangeData.Changes {
+			if r.isDeniedField(change.Field) {
+				change.OldVal = r.replacement(fmt.Sprint(change.OldVal))
+				change.NewVal = r.replacement(fmt.Sprint(change.NewVal))
+			}
+			changeData.Changes[i] = change
+		}
+		entry.Data.ChangeData = &changeData
+	}
+}
+
+// redactTagCache caches, per type, whether values of the type contain fields with a
+// logharbour struct tag.
+var redactTagCache sync.Map // map[reflect.Type]bool
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// hasRedactTags reports whether values of type t contain fields with a logharbour struct tag.
+func hasRedactTags(t reflect.Type) bool {
+	if v, ok := redactTagCache.Load(t); ok {
+		return v.(bool)
+	}
+	has := findRedactTags(t, make(map[reflect.Type]bool))
+	redactTagCache.Store(t, has)
+	return has
+}
+
+// findRedactTags does the work of hasRedactTags. Types being inspected further up the
+// recursion are in visiting, so that recursive types terminate.
+func findRedactTags(t reflect.Type, visiting map[reflect.Type]bool) bool {
+	if v, ok := redactTagCache.Load(t); ok {
+		return v.(bool)
+	}
+	if visiting[t] {
+		return false
+	}
+	visiting[t] = true
+	defer delete(visiting, t)
+
+	switch t.Kind() {
+	case reflect.Pointer, reflect.Slice, reflect.Array, reflect.Map:
+		return findRedactTags(t.Elem(), visiting)
+	case reflect.Struct:
+		// Types with their own JSON encoding are left alone.
+		if t.Implements(jsonMarshalerType) || reflect.PointerTo(t).Implements(jsonMarshalerType) {
+			return false
+		}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() && !f.Anonymous {
+				continue
+			}
+			if _, ok := f.Tag.Lookup(redactTagName); ok || findRedactTags(f.Type, visiting) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// applyRedactTags returns value unchanged if it has no fields with a logharbour struct tag.
+// Otherwise it returns a copy, made of maps and slices which encode to the same JSON as value,
+// in which the tagged fields are masked or replaced by redact.
+func applyRedactTags(value any, redact redactFunc) any {
+	if value == nil || !hasRedactTags(reflect.TypeOf(value)) {
+		return value
+	}
+	return redactTaggedValue(reflect.ValueOf(value), redact)
+}
+
+// taggedValue holds a change value with logharbour struct tags from NewChangeDetail until it
+// is logged, so that its tagged fields are redacted by the Redactor of the logger. Encoded in
+// any other way, the tagged fields are replaced with DefaultRedactMarker.
+type taggedValue struct {
+	value any
+}
+
+// MarshalJSON implements json.Marshaler.
+func (t taggedValue) MarshalJSON() ([]byte, error) {
+	return json.Marshal(applyRedactTags(t.value, markRedacted))
+}
+
+// String implements fmt.Stringer.
+func (t taggedValue) String() string {
+	return convertToString(t.value)
+}
+
+func redactTaggedValue(v reflect.Value, redact redactFunc) any {
+	if !v.IsValid() {
+		return nil
+	}
+	if !hasRedactTags(v.Type()) {
+		if v.CanInterface() {
+			return v.Interface()
+		}
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return redactTaggedValue(v.Elem(), redact)
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil
+		}
+		out := make([]any, v.Len())
+		for i := range out {
+			out[i] = redactTaggedValue(v.Index(i), redact)
+		}
+		return out
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		out := make(map[string]any, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			out[mapKeyString(iter.Key())] = redactTaggedValue(iter.Value(), redact)
+		}
+		return out
+	case reflect.Struct:
+		out := make(map[string]any)
+		redactStructFields(v, out, redact)
+		return out
+	}
+	return v.Interface()
+}
+
+// redactStructFields adds the JSON fields of struct v to out, with tagged fields redacted.
+// Fields of embedded structs without a JSON name are promoted, as encoding/json does.
+func redactStructFields(v reflect.Value, out map[string]any, redact redactFunc) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" && opts == "" {
+			continue
+		}
+		fv := v.Field(i)
+		if f.Anonymous && name == "" {
+			for fv.Kind() == reflect.Pointer {
+				if fv.IsNil() {
+					break
+				}
+				fv = fv.Elem()
+			}
+			if fv.Kind() == reflect.Struct {
+				redactStructFields(fv, out, redact)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if strings.Contains(opts, "omitempty") && fv.IsZero() {
+			continue
+		}
+		if tag, ok := f.Tag.Lookup(redactTagName); ok && tag != diffIgnoreTag {
+			out[name] = redactByTag(tag, fv, redact)
+			continue
+		}
+		out[name] = redactTaggedValue(fv, redact)
+	}
+}
+
+// redactByTag applies a logharbour struct tag to a field value. Supported tags are "redact",
+// which replaces the value with redact's result, and "mask=lastN" or "mask=firstN", which keep
+// the last or first N characters of the value. Unknown tags redact the value, so that a typo
+// never leaks data.
+func redactByTag(tag string, v reflect.Value, redact redactFunc) any {
+	mask, ok := strings.CutPrefix(tag, "mask=")
+	if !ok {
+		return redact(valueString(v))
+	}
+	keepLast := true
+	count, ok := strings.CutPrefix(mask, "last")
+	if !ok {
+		keepLast = false
+		if count, ok = strings.CutPrefix(mask, "first"); !ok {
+			return redact(valueString(v))
+		}
+	}
+	n, err := strconv.Atoi(count)
+	if err != nil || n < 0 {
+		return redact(valueString(v))
+	}
+	return maskString(valueString(v), n, keepLast)
+}
+
+// valueString formats a field value for masking.
+func valueString(v reflect.Value) string {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	if v.Kind() == reflect.String {
+		return v.String()
+	}
+	if v.CanInterface() {
+		return fmt.Sprint(v.Interface())
+	}
+	return ""
+}
+
+// maskString replaces all but the last (or first) n characters of s with '*'.
+func maskString(s string, n int, keepLast bool) string {
+	runes := []rune(s)
+	if n >= len(runes) {
+		n = len(runes)
+	}
+	masked := make([]rune, len(runes))
+	for i, c := range runes {
+		keep := (keepLast && i >= len(runes)-n) || (!keepLast && i < n)
+		if keep {
+			masked[i] = c
+		} else {
+			masked[i] = '*'
+		}
+	}
+	return string(masked)
+}
+
+// mapKeyString formats a map key as encoding/json does for string, integer and
+// encoding.TextMarshaler keys.
+func mapKeyString(k reflect.Value) string {
+	if k.Kind() == reflect.String {
+		return k.String()
+	}
+	if k.Type().Implements(textMarshalerType) {
+		if b, err := k.Interface().(encoding.TextMarshaler).MarshalText(); err == nil {
+			return string(b)
+		}
+	}
+	return fmt.Sprint(k.Interface())
+}
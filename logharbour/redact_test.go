@@ -0,0 +1,230 @@
+package logharbour
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+type redactAddress struct {
+	City string `json:"city"`
+	Pin  string `json:"pin" logharbour:"redact"`
+}
+
+type redactCustomer struct {
+	Name     string            `json:"name"`
+	Password string            `json:"password" logharbour:"redact"`
+	Card     string            `json:"card" logharbour:"mask=last4"`
+	PAN      string            `json:"pan,omitempty" logharbour:"mask=first2"`
+	Secret   string            `json:"-"`
+	Created  time.Time         `json:"created"`
+	Address  *redactAddress    `json:"address"`
+	Previous []redactAddress   `json:"previous"`
+	Tags     map[string]string `json:"tags"`
+}
+
+func TestConvertToString_RedactTags(t *testing.T) {
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	got := convertToString(redactCustomer{
+		Name:     "Alice",
+		Password: "hunter2",
+		Card:     "4111111111111111",
+		Secret:   "hidden",
+		Created:  created,
+		Address:  &redactAddress{City: "Pune", Pin: "411001"},
+		Previous: []redactAddress{{City: "Mumbai", Pin: "400001"}},
+		Tags:     map[string]string{"tier": "gold"},
+	})
+
+	var decoded map[string]any
+	if err := json.Unmarshal([]byte(got), &decoded); err != nil {
+		t.Fatalf("Failed to unmarshal %s: %v", got, err)
+	}
+	checks := map[string]any{
+		"name":     "Alice",
+		"password": DefaultRedactMarker,
+		"card":     "************1111",
+		"created":  created.Format(time.RFC3339),
+	}
+	for key, want := range checks {
+		if decoded[key] != want {
+			t.Errorf("%s = %v, want %v", key, decoded[key], want)
+		}
+	}
+	if _, ok := decoded["pan"]; ok {
+		t.Error("expected omitempty field to be omitted")
+	}
+	if strings.Contains(got, "hidden") || strings.Contains(got, "411001") || strings.Contains(got, "400001") || strings.Contains(got, "hunter2") {
+		t.Errorf("sensitive value leaked: %s", got)
+	}
+	if !strings.Contains(got, `"city":"Pune"`) || !strings.Contains(got, `"tier":"gold"`) {
+		t.Errorf("untagged values missing: %s", got)
+	}
+}
+
+func TestConvertToString_NoTagsUnchanged(t *testing.T) {
+	type plain struct {
+		A string `json:"a"`
+		B int    `json:"b"`
+	}
+	if got := convertToString(plain{A: "x", B: 1}); got != `{"a":"x","b":1}` {
+		t.Errorf("got %s", got)
+	}
+}
+
+func TestMaskString(t *testing.T) {
+	tests := []struct {
+		s        string
+		n        int
+		keepLast bool
+		want     string
+	}{
+		{"4111111111111111", 4, true, "************1111"},
+		{"ABCDE1234F", 2, false, "AB********"},
+		{"abc", 4, true, "abc"},
+	}
+	for _, tt := range tests {
+		if got := maskString(tt.s, tt.n, tt.keepLast); got != tt.want {
+			t.Errorf("maskString(%q, %d, %v) = %q, want %q", tt.s, tt.n, tt.keepLast, got, tt.want)
+		}
+	}
+}
+
+func TestRedactor(t *testing.T) {
+	var buf bytes.Buffer
+	lctx := NewLoggerContext(Info)
+	lctx.SetDebugMode(true)
+	lctx.SetRedactor(NewRedactor(
+		WithRedactFields("password", "aadhaar"),
+		WithRedactPatterns(RedactCardNumberPattern, RedactBearerTokenPattern)))
+	logger := NewLogger(lctx, "TestApp", &buf)
+
+	change := NewChangeInfo("User", "Update").
+		AddChange("user.password", "old-secret", "new-secret").
+		AddChange("Aadhaar", "1234 5678 9012", "2345 6789 0123").
+		AddChange("email", "a@example.com", "b@example.com")
+	logger.LogDataChange("card 4111 1111 1111 1111 updated", *change)
+	logger.LogActivity("login", map[string]string{"auth": "Bearer abc.def.ghi"})
+	logger.LogDebug("debug", "card=4111111111111111")
+
+	if change.Changes[0].NewVal != "new-secret" {
+		t.Error("redaction must not modify the caller's ChangeInfo")
+	}
+
+	out := buf.String()
+	for _, leaked := range []string{"old-secret", "new-secret", "5678", "4111", "abc.def.ghi"} {
+		if strings.Contains(out, leaked) {
+			t.Errorf("sensitive value %q leaked: %s", leaked, out)
+		}
+	}
+	entries := decodeEntries(t, &buf)
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(entries))
+	}
+	changes := entries[0].Data.ChangeData.Changes
+	if changes[0].NewVal != DefaultRedactMarker || changes[2].NewVal != "b@example.com" {
+		t.Errorf("unexpected changes: %+v", changes)
+	}
+	if entries[0].Msg != "card "+DefaultRedactMarker+" updated" {
+		t.Errorf("unexpected message: %q", entries[0].Msg)
+	}
+	if !json.Valid([]byte(entries[1].Data.ActivityData)) {
+		t.Errorf("redacted activity data is not valid JSON: %s", entries[1].Data.ActivityData)
+	}
+}
+
+func TestRedactor_HashKey(t *testing.T) {
+	r := NewRedactor(WithRedactHashKey([]byte("key")))
+	a, b, c := r.replacement("secret"), r.replacement("secret"), r.replacement("other")
+	if a != b || a == c || !strings.HasPrefix(a, "hmac:") {
+		t.Errorf("expected equal values to hash equally and different ones differently: %q %q %q", a, b, c)
+	}
+	if other := NewRedactor(WithRedactHashKey([]byte("other key"))).replacement("secret"); other == a {
+		t.Error("expected the hash to depend on the key")
+	}
+}
+
+func TestRedactor_Tags(t *testing.T) {
+	customer := redactCustomer{Name: "Alice", Password: "hunter2", Card: "4111111111111111"}
+	hashed := NewRedactor(WithRedactHashKey([]byte("key")))
+	tests := []struct {
+		name     string
+		redactor *Redactor
+		want     string
+	}{
+		{"marker", NewRedactor(WithRedactMarker("<hidden>")), "<hidden>"},
+		{"hash key", hashed, hashed.replacement("hunter2")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			lctx := NewLoggerContext(Info)
+			lctx.SetRedactor(tt.redactor)
+			logger := NewLogger(lctx, "TestApp", &buf)
+
+			logger.LogActivity("login", customer)
+			logger.LogDataChange("updated", *NewChangeInfo("Customer", "Update").AddChange("customer", nil, customer))
+			logger.LogDataChangeDiff("updated", "Customer", "Update", redactCustomer{Password: "old"}, customer)
+
+			if strings.Contains(buf.String(), "hunter2") {
+				t.Fatalf("sensitive value leaked: %s", buf.String())
+			}
+			entries := decodeEntries(t, &buf)
+			if len(entries) != 3 {
+				t.Fatalf("expected 3 entries, got %d", len(entries))
+			}
+			for _, data := range []string{entries[0].Data.ActivityData, entries[1].Data.ChangeData.Changes[0].NewVal.(string)} {
+				var decoded map[string]any
+				if err := json.Unmarshal([]byte(data), &decoded); err != nil {
+					t.Fatalf("Failed to unmarshal %s: %v", data, err)
+				}
+				if decoded["password"] != tt.want || decoded["card"] != "************1111" {
+					t.Errorf("got %s, want password %q", data, tt.want)
+				}
+			}
+			diffed := false
+			for _, change := range entries[2].Data.ChangeData.Changes {
+				if change.Field == "password" {
+					diffed = true
+					if change.NewVal != tt.want {
+						t.Errorf("diff password = %v, want %q", change.NewVal, tt.want)
+					}
+				}
+			}
+			if !diffed {
+				t.Errorf("password missing from diff: %+v", entries[2].Data.ChangeData.Changes)
+			}
+		})
+	}
+
+	// Change values not logged through a Logger fall back to DefaultRedactMarker
+	encoded, err := json.Marshal(NewChangeDetail("customer", nil, customer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(encoded), "hunter2") || !strings.Contains(string(encoded), DefaultRedactMarker) {
+		t.Errorf("unexpected encoding: %s", encoded)
+	}
+}
+
+func TestRedactor_PatternChecksums(t *testing.T) {
+	r := NewRedactor(WithRedactPatterns(RedactCardNumberPattern, RedactAadhaarPattern))
+	got := r.redactString("card 4111 1111 1111 1111 order 4111111111111112 aadhaar 4991 8136 5293 id 499181365290")
+	want := "card [REDACTED] order 4111111111111112 aadhaar [REDACTED] id 499181365290"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	for digits, valid := range map[string]bool{"2363": true, "2364": false, "499181365293": true} {
+		if verhoeffValid(digits) != valid {
+			t.Errorf("verhoeffValid(%q) = %v, want %v", digits, !valid, valid)
+		}
+	}
+	for digits, valid := range map[string]bool{"4111111111111111": true, "79927398713": true, "79927398710": false} {
+		if luhnValid(digits) != valid {
+			t.Errorf("luhnValid(%q) = %v, want %v", digits, !valid, valid)
+		}
+	}
+}
@@ -0,0 +1,303 @@
+package logharbour
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSamplerInterval   = time.Second
+	defaultSamplerFirst      = 100
+	defaultSamplerThereafter = 100
+
+	// samplerSummaryOp is the op of the summary entries written by a Sampler.
+	samplerSummaryOp = "log_sampler_summary"
+	// maxSummaryKeys limits the number of keys listed in a summary entry.
+	maxSummaryKeys = 50
+	// samplerOverflowMsg is the message of the key under which the entries of the keys beyond
+	// maxSamplerKeys are sampled and counted together.
+	samplerOverflowMsg = "(other messages)"
+)
+
+// maxSamplerKeys limits the number of keys a Sampler keeps counters and suppressed counts for,
+// so that messages with unbounded cardinality cannot make it grow without bound.
+var maxSamplerKeys = 10000
+
+// samplerKey identifies the entries which are sampled together.
+type samplerKey struct {
+	module string
+	op     string
+	msg    string
+}
+
+// samplerCounter holds the state of one key.
+type samplerCounter struct {
+	windowStart time.Time
+	count       int     // Entries seen in the current window.
+	tokens      float64 // Token bucket level, if rate limiting is enabled.
+	lastRefill  time.Time
+}
+
+// SuppressedCount is the number of entries with a given module, op and message which were
+// suppressed by a Sampler. A list of them is the activity data of the summary entries.
+type SuppressedCount struct {
+	Module string `json:"module,omitempty"`
+	Op     string `json:"op,omitempty"`
+	Msg    string `json:"msg"`
+	Count  uint64 `json:"count"`
+}
+
+// SamplerSummary is the activity data of the summary entries written by a Sampler.
+type SamplerSummary struct {
+	Since      time.Time         `json:"since"`
+	Total      uint64            `json:"total"`
+	Suppressed []SuppressedCount `json:"suppressed"`
+}
+
+// Sampler limits the number of log entries written for each (module, op, msg) key.
+// Within each interval, the first N entries of a key are written, and after that every Mth
+// entry. Optionally, each key can also be rate limited with a token bucket. Entries of priority
+// Err, Crit and Sec are never suppressed.
+//
+// The Sampler periodically writes a Warn summary entry, with op "log_sampler_summary", listing
+// how many entries of each key were suppressed since the previous summary. Summary entries
+// are never sampled.
+//
+// Keys idle for a whole interval are forgotten. At most 10000 keys are tracked at a time;
+// the entries of further keys are sampled together, as one key with message
+// "(other messages)".
+//
+// A Sampler takes effect once it is set on a LoggerContext with SetSampler.
+//
+// Example:
+//
+//	sampler := logharbour.NewSampler(logger,
+//		logharbour.WithSamplerInterval(time.Second),
+//		logharbour.WithSamplerFirst(10),
+//		logharbour.WithSamplerThereafter(1000))
+//	defer sampler.Stop()
+//	lctx.SetSampler(sampler)
+type Sampler struct {
+	interval        time.Duration
+	first           int
+	thereafter      int
+	rate            float64 // Tokens per second; 0 disables rate limiting.
+	burst           float64
+	summaryInterval time.Duration
+	now             func() time.Time
+
+	mu         sync.Mutex
+	counters   map[samplerKey]*samplerCounter
+	suppressed map[samplerKey]uint64
+	since      time.Time
+	lastPrune  time.Time
+
+	logger   *Logger
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// SamplerOption configures a Sampler.
+type SamplerOption func(*Sampler)
+
+// WithSamplerInterval sets the interval over which the first and thereafter counts apply.
+func WithSamplerInterval(interval time.Duration) SamplerOption {
+	return func(s *Sampler) {
+		if interval > 0 {
+			s.interval = interval
+		}
+	}
+}
+
+// WithSamplerFirst sets the number of entries of each key written in each interval before
+// sampling starts.
+func WithSamplerFirst(n int) SamplerOption {
+	return func(s *Sampler) {
+		if n >= 0 {
+			s.first = n
+		}
+	}
+}
+
+// WithSamplerThereafter sets M, so that every Mth entry of a key is written after the first N
+// in each interval. Zero suppresses all entries after the first N.
+func WithSamplerThereafter(m int) SamplerOption {
+	return func(s *Sampler) {
+		if m >= 0 {
+			s.thereafter = m
+		}
+	}
+}
+
+// WithSamplerRateLimit rate limits each key with a token bucket which holds up to burst
+// tokens and is refilled at rate tokens per second. An entry is written only if it passes
+// both the first/thereafter sampling and the token bucket.
+func WithSamplerRateLimit(rate float64, burst int) SamplerOption {
+	return func(s *Sampler) {
+		if rate > 0 && burst > 0 {
+			s.rate = rate
+			s.burst = float64(burst)
+		}
+	}
+}
+
+// WithSamplerSummaryInterval sets how often the summary entry is written. A zero or negative
+// interval disables summaries.
+func WithSamplerSummaryInterval(interval time.Duration) SamplerOption {
+	return func(s *Sampler) {
+		s.summaryInterval = interval
+	}
+}
+
+// NewSampler creates a Sampler which writes its summary entries with logger, and starts the
+// summary goroutine. By default, in each one-second interval, the first 100 entries of a key
+// are written and then every 100th, without rate limiting, and summaries are written every minute.
+func NewSampler(logger *Logger, opts ...SamplerOption) *Sampler {
+	s := &Sampler{
+		interval:        defaultSamplerInterval,
+		first:           defaultSamplerFirst,
+		thereafter:      defaultSamplerThereafter,
+		summaryInterval: time.Minute,
+		now:             time.Now,
+		counters:        make(map[samplerKey]*samplerCounter),
+		suppressed:      make(map[samplerKey]uint64),
+		stop:            make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.since = s.now()
+	s.logger = logger.WithModule("logharbour").WithOp(samplerSummaryOp).Warn()
+	s.logger.skipSampling = true
+
+	if s.summaryInterval > 0 {
+		s.wg.Add(1)
+		go s.summaryLoop()
+	}
+	return s
+}
+
+// allow reports whether an entry with the given priority and key should be written,
+// and counts it as suppressed if not.
+func (s *Sampler) allow(pri LogPriority, module, op, msg string) bool {
+	if pri >= Err {
+		return true
+	}
+	key := samplerKey{module: module, op: op, msg: msg}
+	now := s.now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.Sub(s.lastPrune) >= s.interval {
+		s.pruneCounters(now)
+		s.lastPrune = now
+	}
+	c, ok := s.counters[key]
+	if !ok && len(s.counters) >= maxSamplerKeys {
+		key = samplerKey{msg: samplerOverflowMsg}
+		c, ok = s.counters[key]
+	}
+	if !ok {
+		c = &samplerCounter{windowStart: now, tokens: s.burst, lastRefill: now}
+		s.counters[key] = c
+	}
+	if now.Sub(c.windowStart) >= s.interval {
+		c.windowStart = now
+		c.count = 0
+	}
+	c.count++
+
+	allowed := c.count <= s.first ||
+		(s.thereafter > 0 && (c.count-s.first)%s.thereafter == 0)
+	if allowed && s.rate > 0 {
+		c.tokens += now.Sub(c.lastRefill).Seconds() * s.rate
+		if c.tokens > s.burst {
+			c.tokens = s.burst
+		}
+		c.lastRefill = now
+		if c.tokens >= 1 {
+			c.tokens--
+		} else {
+			allowed = false
+		}
+	}
+	if !allowed {
+		if _, ok := s.suppressed[key]; !ok && len(s.suppressed) >= maxSamplerKeys {
+			key = samplerKey{msg: samplerOverflowMsg}
+		}
+		s.suppressed[key]++
+	}
+	return allowed
+}
+
+// pruneCounters forgets the keys which have been idle for a whole interval. The caller
+// must hold s.mu.
+func (s *Sampler) pruneCounters(now time.Time) {
+	for key, c := range s.counters {
+		// With rate limiting, an idle key must also have a full bucket, or forgetting it
+		// would let it burst early.
+		idle := now.Sub(c.windowStart) >= s.interval &&
+			(s.rate == 0 || c.tokens+now.Sub(c.lastRefill).Seconds()*s.rate >= s.burst)
+		if idle {
+			delete(s.counters, key)
+		}
+	}
+}
+
+// summaryLoop writes a summary entry every summary interval until Stop is called.
+func (s *Sampler) summaryLoop() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(s.summaryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.writeSummary()
+		}
+	}
+}
+
+// writeSummary writes a summary entry if any entries were suppressed since the previous one.
+func (s *Sampler) writeSummary() {
+	now := s.now()
+
+	s.mu.Lock()
+	summary := SamplerSummary{Since: s.since.UTC()}
+	for key, count := range s.suppressed {
+		summary.Total += count
+		summary.Suppressed = append(summary.Suppressed, SuppressedCount{Module: key.module, Op: key.op, Msg: key.msg, Count: count})
+	}
+	s.suppressed = make(map[samplerKey]uint64)
+	s.since = now
+	s.mu.Unlock()
+
+	if summary.Total == 0 {
+		return
+	}
+	sort.Slice(summary.Suppressed, func(i, j int) bool { return summary.Suppressed[i].Count > summary.Suppressed[j].Count })
+	if len(summary.Suppressed) > maxSummaryKeys {
+		summary.Suppressed = summary.Suppressed[:maxSummaryKeys]
+	}
+	s.logger.LogActivity("Log entries suppressed by sampler", summary)
+}
+
+// Stop writes a final summary entry and stops the summary goroutine.
+func (s *Sampler) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+		s.wg.Wait()
+		if s.summaryInterval > 0 {
+			s.writeSummary()
+		}
+	})
+}
+
+// SetSampler sets the Sampler applied to the entries of all loggers sharing this context,
+// after the priority and filter rule checks. Passing nil disables sampling.
+func (lc *LoggerContext) SetSampler(s *Sampler) {
+	lc.sampler.Store(s)
+}
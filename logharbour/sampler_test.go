@@ -0,0 +1,158 @@
+package logharbour
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// fakeClock is a settable time source for Sampler tests.
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time          { return c.t }
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestSampler(clock *fakeClock, logger *Logger, opts ...SamplerOption) *Sampler {
+	s := NewSampler(logger, append(opts, WithSamplerSummaryInterval(0))...)
+	s.now = clock.now
+	s.since = clock.now()
+	return s
+}
+
+func TestSampler_FirstThenEveryMth(t *testing.T) {
+	clock := &fakeClock{t: time.Now()}
+	s := newTestSampler(clock, NewLogger(NewLoggerContext(Info), "TestApp", &bytes.Buffer{}),
+		WithSamplerInterval(time.Second), WithSamplerFirst(3), WithSamplerThereafter(5))
+
+	passed := 0
+	for i := 0; i < 23; i++ {
+		if s.allow(Info, "mod", "op", "hot loop") {
+			passed++
+		}
+	}
+	// 3 first, then the 5th, 10th, 15th and 20th of the remaining 20.
+	if passed != 7 {
+		t.Errorf("expected 7 entries to pass, got %d", passed)
+	}
+
+	if !s.allow(Info, "mod", "op", "other message") {
+		t.Error("expected a different key to have its own counter")
+	}
+	if !s.allow(Err, "mod", "op", "hot loop") {
+		t.Error("expected Err entries to always pass")
+	}
+
+	clock.advance(time.Second)
+	if !s.allow(Info, "mod", "op", "hot loop") {
+		t.Error("expected the counter to reset in a new interval")
+	}
+}
+
+func TestSampler_RateLimit(t *testing.T) {
+	clock := &fakeClock{t: time.Now()}
+	s := newTestSampler(clock, NewLogger(NewLoggerContext(Info), "TestApp", &bytes.Buffer{}),
+		WithSamplerFirst(1000), WithSamplerRateLimit(2, 3))
+
+	passed := 0
+	for i := 0; i < 10; i++ {
+		if s.allow(Info, "", "", "msg") {
+			passed++
+		}
+	}
+	if passed != 3 {
+		t.Errorf("expected the burst of 3 to pass, got %d", passed)
+	}
+
+	clock.advance(time.Second)
+	passed = 0
+	for i := 0; i < 10; i++ {
+		if s.allow(Info, "", "", "msg") {
+			passed++
+		}
+	}
+	if passed != 2 {
+		t.Errorf("expected 2 refilled tokens to pass, got %d", passed)
+	}
+	if !s.allow(Crit, "", "", "msg") {
+		t.Error("expected Crit entries to bypass the rate limit")
+	}
+}
+
+func TestSampler_LoggerAndSummary(t *testing.T) {
+	var buf bytes.Buffer
+	lctx := NewLoggerContext(Info)
+	logger := NewLogger(lctx, "TestApp", &buf).WithModule("worker").WithOp("process")
+	clock := &fakeClock{t: time.Now()}
+	s := newTestSampler(clock, logger, WithSamplerFirst(2), WithSamplerThereafter(0))
+	lctx.SetSampler(s)
+
+	for i := 0; i < 10; i++ {
+		logger.LogActivity("item processed", nil)
+	}
+	logger.Err().LogActivity("item failed", nil)
+
+	entries := decodeEntries(t, &buf)
+	if len(entries) != 3 {
+		t.Fatalf("expected 2 sampled entries and 1 error, got %d", len(entries))
+	}
+
+	s.writeSummary()
+	entries = decodeEntries(t, &buf)
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 summary entry, got %d", len(entries))
+	}
+	summaryEntry := entries[0]
+	if summaryEntry.Op != samplerSummaryOp || summaryEntry.Pri != Warn {
+		t.Errorf("unexpected summary entry: %+v", summaryEntry)
+	}
+	var summary SamplerSummary
+	if err := json.Unmarshal([]byte(summaryEntry.Data.ActivityData), &summary); err != nil {
+		t.Fatalf("Failed to unmarshal summary: %v", err)
+	}
+	want := SuppressedCount{Module: "worker", Op: "process", Msg: "item processed", Count: 8}
+	if summary.Total != 8 || len(summary.Suppressed) != 1 || summary.Suppressed[0] != want {
+		t.Errorf("unexpected summary: %+v", summary)
+	}
+
+	// Nothing suppressed since the last summary, so no new summary is written.
+	s.writeSummary()
+	if buf.Len() != 0 {
+		t.Errorf("expected no summary, got %s", buf.String())
+	}
+
+	lctx.SetSampler(nil)
+	for i := 0; i < 5; i++ {
+		logger.LogActivity("item processed", nil)
+	}
+	if entries := decodeEntries(t, &buf); len(entries) != 5 {
+		t.Errorf("expected all entries after removing the sampler, got %d", len(entries))
+	}
+}
+
+func TestSampler_KeyLimit(t *testing.T) {
+	defer func(n int) { maxSamplerKeys = n }(maxSamplerKeys)
+	maxSamplerKeys = 3
+	clock := &fakeClock{t: time.Now()}
+	s := newTestSampler(clock, NewLogger(NewLoggerContext(Info), "TestApp", &bytes.Buffer{}),
+		WithSamplerFirst(1), WithSamplerThereafter(0))
+
+	for _, msg := range []string{"a", "b", "c", "d", "e"} {
+		s.allow(Info, "", "", msg)
+		s.allow(Info, "", "", msg)
+	}
+	overflow := samplerKey{msg: samplerOverflowMsg}
+	if len(s.counters) != 4 || s.counters[overflow] == nil || s.counters[overflow].count != 4 {
+		t.Errorf("expected keys d and e to be sampled together, got %d counters", len(s.counters))
+	}
+	if len(s.suppressed) != 4 || s.suppressed[overflow] != 3 {
+		t.Errorf("unexpected suppressed counts: %v", s.suppressed)
+	}
+
+	// Idle keys are forgotten without summaries
+	clock.advance(time.Second)
+	s.allow(Info, "", "", "f")
+	if len(s.counters) != 1 || s.counters[samplerKey{msg: "f"}] == nil {
+		t.Errorf("expected only key f to be left, got %d counters", len(s.counters))
+	}
+}
@@ -0,0 +1,120 @@
+package logharbour
+
+import (
+	"strings"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/some"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/operator"
+)
+
+const (
+	changesPath      = "data.change_data.changes" // path of the nested changes of a data-change entry
+	changesInnerHits = "changes"                  // name of the inner hits of a ChangeSearch
+	oldValueField    = changesPath + ".old_value"
+	newValueField    = changesPath + ".new_value"
+)
+
+// textSearchFields are the text fields searched by GetLogsParam.Text.
+var textSearchFields = []string{"msg", "error", "data.activity_data"}
+
+// ChangeSearch selects data-change log entries by one of their changes: the entry matches if
+// a single change satisfies all the conditions which are set. OldValue and NewValue are
+// searched with the same syntax as GetLogsParam.Text.
+type ChangeSearch struct {
+	Field    *string // Name of the changed field
+	OldValue *string // Text searched in the value before the change
+	NewValue *string // Text searched in the value after the change
+}
+
+// textQuery returns a query for the text of a search box in fields. Words are searched with
+// AND by default; the syntax of Elasticsearch's simple query string supports "phrases",
+// prefix*, | for OR, - for NOT and parentheses. The syntax never causes an error: what
+// cannot be parsed is searched for as words.
+func textQuery(text string, fields ...string) types.Query {
+	return types.Query{
+		SimpleQueryString: &types.SimpleQueryStringQuery{
+			Query:           text,
+			Fields:          fields,
+			DefaultOperator: &operator.And,
+		},
+	}
+}
+
+// searchQueries returns the full-text queries of logParam: its Query parsed with ParseQuery,
+// its Text, and its ChangeSearch as a nested query on the changes of an entry.
+func searchQueries(logParam GetLogsParam) ([]types.Query, error) {
+	var queries []types.Query
+	if logParam.Query != nil && strings.TrimSpace(*logParam.Query) != "" {
+		q, err := ParseQuery(*logParam.Query)
+		if err != nil {
+			return nil, err
+		}
+		queries = append(queries, *q)
+	}
+	if logParam.Text != nil && strings.TrimSpace(*logParam.Text) != "" {
+		queries = append(queries, textQuery(*logParam.Text, textSearchFields...))
+	}
+
+	cs := logParam.Changes
+	if cs == nil {
+		return queries, nil
+	}
+	var changeQueries []types.Query
+	if ok, fieldQuery := termQueryForField(field, cs.Field); ok {
+		changeQueries = append(changeQueries, fieldQuery)
+	}
+	if cs.OldValue != nil {
+		changeQueries = append(changeQueries, textQuery(*cs.OldValue, oldValueField))
+	}
+	if cs.NewValue != nil {
+		changeQueries = append(changeQueries, textQuery(*cs.NewValue, newValueField))
+	}
+	if len(changeQueries) == 0 {
+		return queries, nil
+	}
+	nested := &types.NestedQuery{
+		Path:  changesPath,
+		Query: &types.Query{Bool: &types.BoolQuery{Must: changeQueries}},
+	}
+	if logParam.Highlight {
+		// Values of nested changes can only be highlighted in the inner hits
+		nested.InnerHits = &types.InnerHits{
+			Name: some.String(changesInnerHits),
+			Highlight: &types.Highlight{
+				Fields: map[string]types.HighlightField{oldValueField: {}, newValueField: {}},
+			},
+		}
+	}
+	return append(queries, types.Query{Nested: nested}), nil
+}
+
+// highlightRequest asks for the matches of Text to be highlighted.
+func highlightRequest() *types.Highlight {
+	fields := make(map[string]types.HighlightField, len(textSearchFields))
+	for _, f := range textSearchFields {
+		fields[f] = types.HighlightField{}
+	}
+	return &types.Highlight{Fields: fields}
+}
+
+// hitHighlights returns the highlighted snippets of a hit by field, including those of the
+// changes matched by a ChangeSearch. It returns nil if nothing was highlighted.
+func hitHighlights(hit types.Hit) map[string][]string {
+	var snippets map[string][]string
+	add := func(highlight map[string][]string) {
+		for f, s := range highlight {
+			if snippets == nil {
+				snippets = make(map[string][]string)
+			}
+			snippets[f] = append(snippets[f], s...)
+		}
+	}
+	add(hit.Highlight)
+	if inner, ok := hit.InnerHits[changesInnerHits]; ok && inner.Hits != nil {
+		for _, change := range inner.Hits.Hits {
+			add(change.Highlight)
+		}
+	}
+	return snippets
+}
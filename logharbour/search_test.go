@@ -0,0 +1,67 @@
+package logharbour
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestSearchQueries(t *testing.T) {
+	text, fieldName, newValue := `"payment failed" | timeout*`, "amount", "500"
+	queries, err := searchQueries(GetLogsParam{
+		Text:      &text,
+		Changes:   &ChangeSearch{Field: &fieldName, NewValue: &newValue},
+		Highlight: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := json.Marshal(queries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[{"simple_query_string":{"default_operator":"and","fields":["msg","error","data.activity_data"],"query":"\"payment failed\" | timeout*"}},` +
+		`{"nested":{"inner_hits":{"highlight":{"fields":{"data.change_data.changes.new_value":{},"data.change_data.changes.old_value":{}}},"name":"changes"},` +
+		`"path":"data.change_data.changes","query":{"bool":{"must":[{"term":{"data.change_data.changes.field":{"value":"amount"}}},` +
+		`{"simple_query_string":{"default_operator":"and","fields":["data.change_data.changes.new_value"],"query":"500"}}]}}}}]`
+	if string(got) != want {
+		t.Errorf("searchQueries() =\n%s\nwant\n%s", got, want)
+	}
+
+	blank := "  "
+	if queries, _ := searchQueries(GetLogsParam{Text: &blank, Query: &blank, Changes: &ChangeSearch{}}); len(queries) != 0 {
+		t.Errorf("expected no queries for empty searches, got %v", queries)
+	}
+}
+
+func TestQueryClient_GetLogsPage_Highlight(t *testing.T) {
+	f, client := newFakeSearchServer(t, `{"took": 1, "timed_out": false, "_shards": {"total": 1, "successful": 1, "skipped": 0, "failed": 0},
+		"hits": {"total": {"value": 1, "relation": "eq"}, "hits": [
+			{"_index": "logharbour_acme", "_id": "a", "_source": {"id": "a", "msg": "payment timeout"}, "sort": [1, "a"],
+			 "highlight": {"msg": ["payment <em>timeout</em>"]},
+			 "inner_hits": {"changes": {"hits": {"total": {"value": 1, "relation": "eq"}, "hits": [
+				{"_index": "logharbour_acme", "_id": "a", "_nested": {"field": "data.change_data.changes", "offset": 0},
+				 "_source": {"field": "amount", "new_value": "500"},
+				 "highlight": {"data.change_data.changes.new_value": ["<em>500</em>"]}}]}}}}]}}`)
+	qc := NewQueryClient(client, "logharbour_acme")
+	text, newValue := "timeout", "500"
+
+	page, err := qc.GetLogsPage(context.Background(), GetLogsParam{Text: &text, Changes: &ChangeSearch{NewValue: &newValue}, Highlight: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]map[string][]string{"a": {
+		"msg":                                {"payment <em>timeout</em>"},
+		"data.change_data.changes.new_value": {"<em>500</em>"},
+	}}
+	if !reflect.DeepEqual(page.Highlights, want) {
+		t.Errorf("Highlights = %v, want %v", page.Highlights, want)
+	}
+	if _, ok := f.requests[0]["highlight"]; !ok {
+		t.Error("expected a highlight request")
+	}
+	if _, ok := f.requests[0]["query"].(map[string]any)["bool"].(map[string]any)["must"]; !ok {
+		t.Error("expected the searches in the must clause")
+	}
+}
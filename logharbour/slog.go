@@ -0,0 +1,259 @@
+package logharbour
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"runtime"
+	"slices"
+)
+
+// slog levels corresponding to each LogPriority. LevelDebug0, LevelInfo, LevelWarn and
+// LevelErr are equal to slog.LevelDebug, slog.LevelInfo, slog.LevelWarn and slog.LevelError,
+// so records logged through the standard slog.Logger methods land on the expected priority.
+// The remaining levels extend the slog scale in steps of 4 as suggested by the slog docs.
+const (
+	LevelDebug2 slog.Level = slog.LevelDebug - 8
+	LevelDebug1 slog.Level = slog.LevelDebug - 4
+	LevelDebug0 slog.Level = slog.LevelDebug
+	LevelInfo   slog.Level = slog.LevelInfo
+	LevelWarn   slog.Level = slog.LevelWarn
+	LevelErr    slog.Level = slog.LevelError
+	LevelCrit   slog.Level = slog.LevelError + 4
+	LevelSec    slog.Level = slog.LevelError + 8
+)
+
+// Attribute keys which SlogHandler maps onto LogEntry fields instead of activity data.
+const (
+	SlogKeyWho      = "who"
+	SlogKeyOp       = "op"
+	SlogKeyClass    = "class"
+	SlogKeyInstance = "instance"
+	SlogKeyRemoteIP = "remote_ip"
+	SlogKeyTraceID  = "trace_id"
+	SlogKeyModule   = "module"
+)
+
+// SlogHandler is a slog.Handler which writes records as LogHarbour log entries
+// through a Logger.
+//
+// Records at LevelInfo and above are written as Activity entries. Records below
+// LevelInfo are written as Debug entries and, like LogDebug, only when debug mode
+// is set on the LoggerContext. The minimum log priority of the LoggerContext applies
+// to all records.
+//
+// Top-level attributes whose keys are one of the SlogKey* constants set the
+// corresponding LogEntry field. All other attributes, including those inside groups,
+// are collected into a JSON object which becomes the activity data (or the debug data
+// for Debug entries).
+//
+// Example:
+//
+//	logger := logharbour.NewLogger(lctx, "billing", writer)
+//	slog.SetDefault(slog.New(logharbour.NewSlogHandler(logger)))
+//	slog.Info("invoice created", "who", "alice", "invoice_id", 42)
+type SlogHandler struct {
+	logger *Logger
+	attrs  []groupedAttr // attributes added by WithAttrs which are not mapped to LogEntry fields
+	groups []string      // groups opened by WithGroup, applied to attributes added later
+}
+
+// groupedAttr is an attribute together with the groups that were open when it was added.
+type groupedAttr struct {
+	groups []string
+	attr   slog.Attr
+}
+
+// NewSlogHandler creates a new SlogHandler which writes log entries through the given Logger.
+func NewSlogHandler(logger *Logger) *SlogHandler {
+	return &SlogHandler{logger: logger}
+}
+
+// Enabled reports whether a record at the given level would be written, based on the
+// minimum log priority and debug mode of the Logger's context.
+func (h *SlogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	pri := SlogLevelToPriority(level)
+	if pri < Info && !h.logger.context.IsDebugModeSet() {
+		return false
+	}
+	return h.logger.shouldLog(pri)
+}
+
+// Handle converts the record into a LogEntry and writes it.
+func (h *SlogHandler) Handle(ctx context.Context, r slog.Record) error {
+	pri := SlogLevelToPriority(r.Level)
+	if !h.Enabled(ctx, r.Level) {
+		return nil
+	}
+
+	l := h.logger.WithPriority(pri)
+	data := make(map[string]any)
+	for _, ga := range h.attrs {
+		addToGroup(data, ga.groups, ga.attr)
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		if len(h.groups) > 0 || !l.setWellKnownAttr(a) {
+			addToGroup(data, h.groups, a)
+		}
+		return true
+	})
+
+	var entry LogEntry
+	if pri < Info {
+		debugInfo := DebugInfo{
+			Pid:     os.Getpid(),
+			Runtime: runtime.Version(),
+		}
+		if r.PC != 0 {
+			frame, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
+			debugInfo.FileName = frame.File
+			debugInfo.LineNumber = frame.Line
+			debugInfo.FunctionName = frame.Function
+		}
+		if len(data) > 0 {
+			debugInfo.Data = convertRedacted(data, l.context.redactFunc())
+		}
+		entry = l.newLogEntry(r.Message, &LogData{DebugData: &debugInfo})
+		entry.Type = Debug
+	} else {
+		if len(data) > 0 {
+			entry = l.newLogEntry(r.Message, &LogData{ActivityData: convertRedacted(data, l.context.redactFunc())})
+		} else {
+			entry = l.newLogEntry(r.Message, nil)
+		}
+		entry.Type = Activity
+	}
+	if !r.Time.IsZero() {
+		entry.When = r.Time.UTC()
+	}
+	l.log(entry)
+	return nil
+}
+
+// WithAttrs returns a new SlogHandler whose Logger is a clone of the current one with
+// the well-known attributes applied. The remaining attributes are added to every record.
+func (h *SlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	newHandler := &SlogHandler{
+		logger: h.logger.clone(),
+		attrs:  slices.Clip(h.attrs),
+		groups: h.groups,
+	}
+	for _, a := range attrs {
+		if len(h.groups) == 0 && newHandler.logger.setWellKnownAttr(a) {
+			continue
+		}
+		newHandler.attrs = append(newHandler.attrs, groupedAttr{groups: h.groups, attr: a})
+	}
+	return newHandler
+}
+
+// WithGroup returns a new SlogHandler which nests all attributes added later under the given group.
+func (h *SlogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &SlogHandler{
+		logger: h.logger.clone(),
+		attrs:  h.attrs,
+		groups: append(slices.Clip(h.groups), name),
+	}
+}
+
+// SlogLevelToPriority maps a slog level onto the LogPriority with the highest
+// corresponding level not above it. Levels below LevelDebug2 map to Debug2.
+func SlogLevelToPriority(level slog.Level) LogPriority {
+	switch {
+	case level >= LevelSec:
+		return Sec
+	case level >= LevelCrit:
+		return Crit
+	case level >= LevelErr:
+		return Err
+	case level >= LevelWarn:
+		return Warn
+	case level >= LevelInfo:
+		return Info
+	case level >= LevelDebug0:
+		return Debug0
+	case level >= LevelDebug1:
+		return Debug1
+	default:
+		return Debug2
+	}
+}
+
+// setWellKnownAttr sets the Logger field corresponding to the attribute key.
+// It returns false if the key is not one of the SlogKey* constants.
+// It must only be called on a Logger which has not been shared yet.
+func (l *Logger) setWellKnownAttr(a slog.Attr) bool {
+	value := a.Value.Resolve().String()
+	switch a.Key {
+	case SlogKeyWho:
+		l.who = value
+	case SlogKeyOp:
+		l.op = value
+	case SlogKeyClass:
+		l.class = value
+	case SlogKeyInstance:
+		l.instanceId = value
+	case SlogKeyRemoteIP:
+		l.remoteIP = value
+	case SlogKeyTraceID:
+		l.traceId = value
+	case SlogKeyModule:
+		l.module = value
+	default:
+		return false
+	}
+	return true
+}
+
+// addToGroup adds the attribute to data, nested under the given groups.
+func addToGroup(data map[string]any, groups []string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	for _, g := range groups {
+		sub, ok := data[g].(map[string]any)
+		if !ok {
+			sub = make(map[string]any)
+			data[g] = sub
+		}
+		data = sub
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		groupAttrs := a.Value.Group()
+		if len(groupAttrs) == 0 {
+			return
+		}
+		if a.Key == "" {
+			// Attributes of a group with an empty key are inlined, as slog requires.
+			for _, ga := range groupAttrs {
+				addToGroup(data, nil, ga)
+			}
+			return
+		}
+		for _, ga := range groupAttrs {
+			addToGroup(data, []string{a.Key}, ga)
+		}
+		return
+	}
+	data[a.Key] = slogValueToAny(a.Value)
+}
+
+// slogValueToAny converts a resolved slog.Value into a value suitable for JSON marshalling.
+func slogValueToAny(v slog.Value) any {
+	if v.Kind() == slog.KindAny {
+		if err, ok := v.Any().(error); ok {
+			return err.Error()
+		}
+	}
+	if v.Kind() == slog.KindDuration {
+		return v.Duration().String()
+	}
+	return v.Any()
+}
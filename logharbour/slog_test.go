@@ -0,0 +1,142 @@
+package logharbour
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestSlogLevelToPriority(t *testing.T) {
+	tests := []struct {
+		level slog.Level
+		want  LogPriority
+	}{
+		{LevelDebug2 - 4, Debug2},
+		{LevelDebug2, Debug2},
+		{LevelDebug1, Debug1},
+		{slog.LevelDebug, Debug0},
+		{slog.LevelDebug + 1, Debug0},
+		{slog.LevelInfo, Info},
+		{slog.LevelWarn, Warn},
+		{slog.LevelError, Err},
+		{LevelCrit, Crit},
+		{LevelSec, Sec},
+		{LevelSec + 10, Sec},
+	}
+	for _, tt := range tests {
+		if got := SlogLevelToPriority(tt.level); got != tt.want {
+			t.Errorf("SlogLevelToPriority(%v) = %v, want %v", tt.level, got, tt.want)
+		}
+	}
+}
+
+func TestSlogHandler_WellKnownAttrs(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(NewLoggerContext(Info), "TestApp", &buf)
+	sl := slog.New(NewSlogHandler(logger))
+
+	sl.With("who", "alice", "module", "billing").
+		Warn("invoice failed", "op", "create", "class", "invoice", "instance", "inv-1",
+			"remote_ip", "10.0.0.1", "trace_id", "trace-1", "amount", 42, "err", errors.New("boom"))
+
+	var entry LogEntry
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("Failed to unmarshal logged message: %v", err)
+	}
+	if entry.Pri != Warn || entry.Type != Activity || entry.Msg != "invoice failed" {
+		t.Errorf("unexpected pri/type/msg: %v %v %q", entry.Pri, entry.Type, entry.Msg)
+	}
+	if entry.Who != "alice" || entry.Module != "billing" || entry.Op != "create" ||
+		entry.Class != "invoice" || entry.InstanceId != "inv-1" ||
+		entry.RemoteIP != "10.0.0.1" || entry.TraceId != "trace-1" {
+		t.Errorf("well-known attributes not mapped: %+v", entry)
+	}
+
+	var data map[string]any
+	if err := json.Unmarshal([]byte(entry.Data.ActivityData), &data); err != nil {
+		t.Fatalf("Failed to unmarshal activity data: %v", err)
+	}
+	if data["amount"] != float64(42) || data["err"] != "boom" {
+		t.Errorf("unexpected activity data: %v", data)
+	}
+	if _, ok := data["who"]; ok {
+		t.Errorf("well-known attribute leaked into activity data: %v", data)
+	}
+}
+
+func TestSlogHandler_DoesNotModifyParentLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(NewLoggerContext(Info), "TestApp", &buf)
+	h := NewSlogHandler(logger)
+
+	h.WithAttrs([]slog.Attr{slog.String("who", "alice")})
+	slog.New(h).Info("hello", "who", "bob")
+
+	if logger.who != "" {
+		t.Errorf("expected parent logger who to be empty, got %q", logger.who)
+	}
+	var entry LogEntry
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("Failed to unmarshal logged message: %v", err)
+	}
+	if entry.Who != "bob" {
+		t.Errorf("expected who to be bob, got %q", entry.Who)
+	}
+}
+
+func TestSlogHandler_Groups(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(NewLoggerContext(Info), "TestApp", &buf)
+	sl := slog.New(NewSlogHandler(logger)).With("a", 1).WithGroup("req").With("who", "nested")
+
+	sl.Info("grouped", "b", 2)
+
+	var entry LogEntry
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("Failed to unmarshal logged message: %v", err)
+	}
+	if entry.Who != "" {
+		t.Errorf("attribute inside a group must not set who, got %q", entry.Who)
+	}
+	want := `{"a":1,"req":{"b":2,"who":"nested"}}`
+	if entry.Data.ActivityData != want {
+		t.Errorf("expected activity data %s, got %s", want, entry.Data.ActivityData)
+	}
+}
+
+func TestSlogHandler_Filtering(t *testing.T) {
+	var buf bytes.Buffer
+	lctx := NewLoggerContext(Warn)
+	sl := slog.New(NewSlogHandler(NewLogger(lctx, "TestApp", &buf)))
+
+	sl.Info("filtered by priority")
+	if buf.Len() != 0 {
+		t.Fatalf("expected no output below min priority, got %s", buf.String())
+	}
+
+	lctx.ChangeMinLogPriority(Debug2)
+	sl.Debug("filtered by debug mode")
+	if buf.Len() != 0 {
+		t.Fatalf("expected no debug output without debug mode, got %s", buf.String())
+	}
+
+	lctx.SetDebugMode(true)
+	sl.Debug("debug message", "k", "v")
+
+	var entry LogEntry
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("Failed to unmarshal logged message: %v", err)
+	}
+	if entry.Type != Debug || entry.Pri != Debug0 {
+		t.Errorf("expected Debug entry at Debug0, got %v at %v", entry.Type, entry.Pri)
+	}
+	if entry.Data.DebugData.Data != `{"k":"v"}` {
+		t.Errorf("unexpected debug data: %v", entry.Data.DebugData.Data)
+	}
+	if !strings.HasSuffix(entry.Data.DebugData.FileName, "slog_test.go") {
+		t.Errorf("expected caller file slog_test.go, got %q", entry.Data.DebugData.FileName)
+	}
+}
@@ -0,0 +1,493 @@
+package logharbour
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultSpoolSegmentSize    = 16 << 20 // 16 MiB
+	defaultSpoolMaxSize        = 1 << 30  // 1 GiB
+	defaultSpoolReplayInterval = 5 * time.Second
+	spoolSegmentExt            = ".spool"
+	spoolRecordHeaderSize      = 8 // 4 bytes length + 4 bytes CRC-32
+)
+
+var (
+	// ErrSpoolFull is returned by SpoolWriter.Write when the primary writer fails and the
+	// spool directory has reached its size cap.
+	ErrSpoolFull = errors.New("spool is full")
+	// ErrSpoolWriterClosed is returned by SpoolWriter.Write after Close has been called.
+	ErrSpoolWriterClosed = errors.New("spool writer is closed")
+)
+
+// SpoolSyncPolicy decides when SpoolWriter calls fsync on its segment files.
+type SpoolSyncPolicy int
+
+const (
+	// SpoolSyncOnRotate syncs a segment file when it is sealed, i.e. when it is full,
+	// when the replayer starts sending it, and on Close.
+	SpoolSyncOnRotate SpoolSyncPolicy = iota
+	// SpoolSyncEveryWrite syncs the segment file after every spooled entry. This is the
+	// safest and slowest option.
+	SpoolSyncEveryWrite
+	// SpoolSyncNever leaves syncing to the operating system.
+	SpoolSyncNever
+)
+
+// SpoolWriterStats holds the counters of a SpoolWriter.
+type SpoolWriterStats struct {
+	Spooled      uint64 // Entries appended to the spool.
+	Replayed     uint64 // Spooled entries successfully re-sent to the primary writer.
+	Dropped      uint64 // Entries lost because the spool was full or a segment was corrupt.
+	PendingBytes int64  // Bytes held in segment files on disk.
+}
+
+// SpoolWriter is an io.Writer which writes log entries to a primary writer (typically a
+// KafkaWriter) and, when the primary writer fails, appends them to segment files in a local
+// directory instead, as the wiki's log_insert spec requires when Kafka is down.
+//
+// A background replayer periodically re-sends the spooled entries to the primary writer in
+// the order they were written, and deletes each segment file once all of its entries have
+// been accepted by the primary writer. While entries are waiting in the spool, new entries
+// are appended to the spool as well, so that ordering is preserved.
+//
+// Segment files are named by sequence number and survive restarts: NewSpoolWriter picks up
+// the segments left behind by a previous process and replays them. Delivery is at least once;
+// an entry which was being replayed when the process stopped may be sent again. The log
+// consumer indexes entries by id, so such duplicates overwrite each other in Elasticsearch.
+//
+// When the spool reaches its size cap, Write returns ErrSpoolFull. Wrap the SpoolWriter in a
+// FallbackWriter to send those entries to stdout rather than lose them.
+//
+// Example:
+//
+//	kw, _ := logharbour.NewKafkaWriter(kafkaConfig)
+//	sw, err := logharbour.NewSpoolWriter(kw, "/var/spool/logharbour",
+//		logharbour.WithSpoolMaxSize(512<<20),
+//		logharbour.WithSpoolSync(logharbour.SpoolSyncEveryWrite))
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	defer sw.Close()
+//	logger := logharbour.NewLoggerWithFallback(lctx, "billing", logharbour.NewFallbackWriter(sw, os.Stdout))
+type SpoolWriter struct {
+	primary        io.Writer
+	dir            string
+	segmentSize    int64
+	maxSize        int64
+	syncPolicy     SpoolSyncPolicy
+	replayInterval time.Duration
+	errorHandler   func(err error)
+
+	mu        sync.Mutex // Guards the fields below, and serializes writes to the primary writer from Write.
+	closed    bool
+	sealed    []spoolSegment // Segments no longer written to, oldest first.
+	current   *os.File       // Segment being appended to, or nil.
+	curSeq    uint64
+	curSize   int64
+	curCount  int64 // Records in the current segment.
+	nextSeq   uint64
+	diskBytes int64
+
+	replayMu     sync.Mutex // Held while replaying, so that only one replay runs at a time.
+	replayOffset int64      // Offset reached in sealed[0] by a replay which stopped on an error.
+	replayCount  int64      // Records of sealed[0] replayed by a replay which stopped on an error.
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+
+	spooled  uint64 // atomic
+	replayed uint64 // atomic
+	dropped  uint64 // atomic
+}
+
+// spoolSegment is a sealed segment file.
+type spoolSegment struct {
+	seq   uint64
+	size  int64
+	count int64 // Number of records, or -1 for a segment left behind by a previous process.
+}
+
+// SpoolWriterOption configures a SpoolWriter.
+type SpoolWriterOption func(*SpoolWriter)
+
+// WithSpoolSegmentSize sets the size in bytes at which a segment file is sealed and a new
+// one is started.
+func WithSpoolSegmentSize(size int64) SpoolWriterOption {
+	return func(sw *SpoolWriter) {
+		if size > 0 {
+			sw.segmentSize = size
+		}
+	}
+}
+
+// WithSpoolMaxSize sets the maximum number of bytes held in the spool directory.
+func WithSpoolMaxSize(size int64) SpoolWriterOption {
+	return func(sw *SpoolWriter) {
+		if size > 0 {
+			sw.maxSize = size
+		}
+	}
+}
+
+// WithSpoolSync sets the fsync policy for segment files.
+func WithSpoolSync(policy SpoolSyncPolicy) SpoolWriterOption {
+	return func(sw *SpoolWriter) {
+		sw.syncPolicy = policy
+	}
+}
+
+// WithSpoolReplayInterval sets how often the background replayer tries to re-send spooled
+// entries. A zero or negative interval disables the background replayer; call Replay instead.
+func WithSpoolReplayInterval(interval time.Duration) SpoolWriterOption {
+	return func(sw *SpoolWriter) {
+		sw.replayInterval = interval
+	}
+}
+
+// WithSpoolErrorHandler sets the function called for errors which cannot be returned to
+// the caller of Write, such as a failed replay or a corrupt segment file.
+func WithSpoolErrorHandler(handler func(err error)) SpoolWriterOption {
+	return func(sw *SpoolWriter) {
+		sw.errorHandler = handler
+	}
+}
+
+// NewSpoolWriter creates a SpoolWriter writing to primary and spooling to dir, which is
+// created if it does not exist, and starts its background replayer. Segments left in dir
+// by a previous process are queued for replay.
+// By default segments are sealed at 16 MiB, the spool holds at most 1 GiB, segments are
+// synced when sealed and the replayer runs every 5 seconds.
+func NewSpoolWriter(primary io.Writer, dir string, opts ...SpoolWriterOption) (*SpoolWriter, error) {
+	sw := &SpoolWriter{
+		primary:        primary,
+		dir:            dir,
+		segmentSize:    defaultSpoolSegmentSize,
+		maxSize:        defaultSpoolMaxSize,
+		syncPolicy:     SpoolSyncOnRotate,
+		replayInterval: defaultSpoolReplayInterval,
+		stop:           make(chan struct{}),
+		errorHandler: func(err error) {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		},
+	}
+	for _, opt := range opts {
+		opt(sw)
+	}
+
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create spool directory: %w", err)
+	}
+	if err := sw.loadSegments(); err != nil {
+		return nil, err
+	}
+
+	if sw.replayInterval > 0 {
+		sw.wg.Add(1)
+		go sw.replayLoop()
+	}
+	return sw, nil
+}
+
+// loadSegments queues the segment files found in the spool directory for replay.
+func (sw *SpoolWriter) loadSegments() error {
+	entries, err := os.ReadDir(sw.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read spool directory: %w", err)
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, spoolSegmentExt) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, spoolSegmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return fmt.Errorf("failed to stat spool segment %s: %w", name, err)
+		}
+		sw.sealed = append(sw.sealed, spoolSegment{seq: seq, size: info.Size(), count: -1})
+		sw.diskBytes += info.Size()
+		if seq >= sw.nextSeq {
+			sw.nextSeq = seq + 1
+		}
+	}
+	sort.Slice(sw.sealed, func(i, j int) bool { return sw.sealed[i].seq < sw.sealed[j].seq })
+	return nil
+}
+
+// segmentPath returns the path of the segment file with the given sequence number.
+func (sw *SpoolWriter) segmentPath(seq uint64) string {
+	return filepath.Join(sw.dir, fmt.Sprintf("%020d%s", seq, spoolSegmentExt))
+}
+
+// Write writes p to the primary writer, or appends it to the spool if the primary writer
+// fails or earlier entries are still waiting to be replayed. It implements io.Writer.
+// Write returns an error only if p could be written neither to the primary writer nor
+// to the spool.
+func (sw *SpoolWriter) Write(p []byte) (n int, err error) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	if sw.closed {
+		return 0, ErrSpoolWriterClosed
+	}
+
+	if !sw.spooling() {
+		if n, err = sw.primary.Write(p); err == nil {
+			return n, nil
+		}
+	}
+
+	if err := sw.appendToSpool(p); err != nil {
+		atomic.AddUint64(&sw.dropped, 1)
+		return 0, err
+	}
+	atomic.AddUint64(&sw.spooled, 1)
+	return len(p), nil
+}
+
+// spooling reports whether entries are waiting in the spool. Must be called with sw.mu held.
+func (sw *SpoolWriter) spooling() bool {
+	return len(sw.sealed) > 0 || sw.current != nil
+}
+
+// appendToSpool appends p as one record to the current segment, starting a new segment
+// if needed. Must be called with sw.mu held.
+func (sw *SpoolWriter) appendToSpool(p []byte) error {
+	recordSize := int64(spoolRecordHeaderSize + len(p))
+	if sw.diskBytes+recordSize > sw.maxSize {
+		return ErrSpoolFull
+	}
+	if sw.current != nil && sw.curSize > 0 && sw.curSize+recordSize > sw.segmentSize {
+		if err := sw.sealCurrent(); err != nil {
+			return err
+		}
+	}
+	if sw.current == nil {
+		seq := sw.nextSeq
+		f, err := os.OpenFile(sw.segmentPath(seq), os.O_CREATE|os.O_WRONLY|os.O_APPEND|os.O_EXCL, 0o640)
+		if err != nil {
+			return fmt.Errorf("failed to create spool segment: %w", err)
+		}
+		sw.nextSeq++
+		sw.current, sw.curSeq, sw.curSize, sw.curCount = f, seq, 0, 0
+	}
+
+	record := make([]byte, recordSize)
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(p)))
+	binary.BigEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(p))
+	copy(record[spoolRecordHeaderSize:], p)
+	n, err := sw.current.Write(record)
+	sw.curSize += int64(n)
+	sw.diskBytes += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed to write spool segment: %w", err)
+	}
+	sw.curCount++
+	if sw.syncPolicy == SpoolSyncEveryWrite {
+		if err := sw.current.Sync(); err != nil {
+			return fmt.Errorf("failed to sync spool segment: %w", err)
+		}
+	}
+	return nil
+}
+
+// sealCurrent closes the current segment and queues it for replay. Must be called with sw.mu held.
+func (sw *SpoolWriter) sealCurrent() error {
+	if sw.current == nil {
+		return nil
+	}
+	var err error
+	if sw.syncPolicy != SpoolSyncNever {
+		err = sw.current.Sync()
+	}
+	if closeErr := sw.current.Close(); err == nil {
+		err = closeErr
+	}
+	sw.sealed = append(sw.sealed, spoolSegment{seq: sw.curSeq, size: sw.curSize, count: sw.curCount})
+	sw.current = nil
+	if err != nil {
+		return fmt.Errorf("failed to seal spool segment: %w", err)
+	}
+	return nil
+}
+
+// replayLoop runs Replay every replay interval until Close is called.
+func (sw *SpoolWriter) replayLoop() {
+	defer sw.wg.Done()
+	ticker := time.NewTicker(sw.replayInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-sw.stop:
+			return
+		case <-ticker.C:
+			if err := sw.Replay(); err != nil && sw.errorHandler != nil {
+				sw.errorHandler(err)
+			}
+		}
+	}
+}
+
+// Replay re-sends spooled entries to the primary writer, oldest first, deleting each segment
+// once all of its entries have been written. It stops at the first error from the primary
+// writer and returns it; the next call resumes from the entry that failed.
+// The background replayer calls Replay periodically, but it may also be called directly,
+// e.g. after the application learns that Kafka is reachable again.
+func (sw *SpoolWriter) Replay() error {
+	sw.replayMu.Lock()
+	defer sw.replayMu.Unlock()
+	for {
+		sw.mu.Lock()
+		if sw.closed {
+			sw.mu.Unlock()
+			return ErrSpoolWriterClosed
+		}
+		if len(sw.sealed) == 0 {
+			if sw.current == nil {
+				sw.mu.Unlock()
+				return nil
+			}
+			// Seal the current segment so that it can be replayed while new entries
+			// go to a new segment.
+			if err := sw.sealCurrent(); err != nil {
+				sw.mu.Unlock()
+				return err
+			}
+		}
+		seg := sw.sealed[0]
+		sw.mu.Unlock()
+
+		if err := sw.replaySegment(seg); err != nil {
+			return err
+		}
+
+		sw.mu.Lock()
+		if err := os.Remove(sw.segmentPath(seg.seq)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			sw.mu.Unlock()
+			return fmt.Errorf("failed to remove replayed spool segment: %w", err)
+		}
+		sw.sealed = sw.sealed[1:]
+		sw.diskBytes -= seg.size
+		sw.replayOffset, sw.replayCount = 0, 0
+		sw.mu.Unlock()
+	}
+}
+
+// replaySegment writes the records of a sealed segment to the primary writer, starting at
+// sw.replayOffset. Must be called with sw.replayMu held.
+func (sw *SpoolWriter) replaySegment(seg spoolSegment) error {
+	f, err := os.Open(sw.segmentPath(seg.seq))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open spool segment: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Seek(sw.replayOffset, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek spool segment: %w", err)
+	}
+
+	r := bufio.NewReader(f)
+	header := make([]byte, spoolRecordHeaderSize)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			if err != io.EOF {
+				sw.reportCorruptSegment(seg, err)
+			}
+			return nil
+		}
+		// A corrupt length must not be trusted to allocate the record
+		length := int64(binary.BigEndian.Uint32(header[0:4]))
+		if length > seg.size-sw.replayOffset-spoolRecordHeaderSize {
+			sw.reportCorruptSegment(seg, fmt.Errorf("record length %d exceeds the rest of the segment", length))
+			return nil
+		}
+		record := make([]byte, length)
+		if _, err := io.ReadFull(r, record); err != nil {
+			sw.reportCorruptSegment(seg, err)
+			return nil
+		}
+		if crc32.ChecksumIEEE(record) != binary.BigEndian.Uint32(header[4:8]) {
+			// The length cannot be trusted either, so the rest of the segment is unreadable.
+			sw.reportCorruptSegment(seg, errors.New("checksum mismatch"))
+			return nil
+		}
+		if _, err := sw.primary.Write(record); err != nil {
+			return fmt.Errorf("failed to replay spooled entry: %w", err)
+		}
+		sw.replayOffset += int64(spoolRecordHeaderSize + len(record))
+		sw.replayCount++
+		atomic.AddUint64(&sw.replayed, 1)
+	}
+}
+
+// reportCorruptSegment reports a segment whose remaining records cannot be read, typically
+// because the process stopped in the middle of a write, and counts them as dropped. The
+// number of records of a segment left behind by a previous process is not known, so its
+// loss is counted as one entry, which is exact when only the last record was cut short.
+func (sw *SpoolWriter) reportCorruptSegment(seg spoolSegment, err error) {
+	lost, what := int64(1), "at least 1 entry lost"
+	if seg.count >= 0 {
+		lost = max(seg.count-sw.replayCount, 1)
+		what = fmt.Sprintf("%d entries lost", lost)
+	}
+	atomic.AddUint64(&sw.dropped, uint64(lost))
+	if sw.errorHandler != nil {
+		sw.errorHandler(fmt.Errorf("spool segment %s is truncated or corrupt at offset %d, skipping the rest (%s): %v",
+			sw.segmentPath(seg.seq), sw.replayOffset, what, err))
+	}
+}
+
+// Close stops the background replayer and closes the current segment file. Spooled entries
+// which have not been replayed stay on disk and are replayed by the next SpoolWriter created
+// on the same directory. If the primary writer implements io.Closer, it is closed as well.
+func (sw *SpoolWriter) Close() error {
+	sw.mu.Lock()
+	if sw.closed {
+		sw.mu.Unlock()
+		return nil
+	}
+	sw.closed = true
+	close(sw.stop)
+	err := sw.sealCurrent()
+	sw.mu.Unlock()
+
+	sw.wg.Wait()
+
+	if closer, ok := sw.primary.(io.Closer); ok {
+		if closeErr := closer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// Stats returns a snapshot of the SpoolWriter's counters.
+func (sw *SpoolWriter) Stats() SpoolWriterStats {
+	sw.mu.Lock()
+	pending := sw.diskBytes
+	sw.mu.Unlock()
+	return SpoolWriterStats{
+		Spooled:      atomic.LoadUint64(&sw.spooled),
+		Replayed:     atomic.LoadUint64(&sw.replayed),
+		Dropped:      atomic.LoadUint64(&sw.dropped),
+		PendingBytes: pending,
+	}
+}
@@ -0,0 +1,237 @@
+package logharbour
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// toggleWriter records the entries written to it, and fails while down is set.
+type toggleWriter struct {
+	mu      sync.Mutex
+	down    bool
+	entries []string
+}
+
+func (tw *toggleWriter) Write(p []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.down {
+		return 0, errors.New("primary is down")
+	}
+	tw.entries = append(tw.entries, string(p))
+	return len(p), nil
+}
+
+func (tw *toggleWriter) setDown(down bool) {
+	tw.mu.Lock()
+	tw.down = down
+	tw.mu.Unlock()
+}
+
+func (tw *toggleWriter) written() []string {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	return append([]string(nil), tw.entries...)
+}
+
+func spoolFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(dir, "*"+spoolSegmentExt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestSpoolWriter_SpoolsAndReplaysInOrder(t *testing.T) {
+	dir := t.TempDir()
+	primary := &toggleWriter{}
+	sw, err := NewSpoolWriter(primary, dir, WithSpoolReplayInterval(0), WithSpoolSegmentSize(64))
+	if err != nil {
+		t.Fatalf("NewSpoolWriter failed: %v", err)
+	}
+	defer sw.Close()
+
+	var want []string
+	write := func(i int) {
+		entry := fmt.Sprintf("entry-%02d\n", i)
+		want = append(want, entry)
+		if _, err := sw.Write([]byte(entry)); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+
+	write(0)
+	primary.setDown(true)
+	for i := 1; i <= 10; i++ {
+		write(i)
+	}
+	if len(spoolFiles(t, dir)) < 2 {
+		t.Errorf("expected segments to rotate, got %v", spoolFiles(t, dir))
+	}
+
+	// The primary is back, but earlier entries are still spooled, so new ones must wait.
+	primary.setDown(false)
+	write(11)
+	if got := primary.written(); len(got) != 1 {
+		t.Fatalf("expected only the first entry before replay, got %q", got)
+	}
+
+	if err := sw.Replay(); err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	if got := primary.written(); !reflect.DeepEqual(got, want) {
+		t.Errorf("entries out of order:\n got %q\nwant %q", got, want)
+	}
+	if files := spoolFiles(t, dir); len(files) != 0 {
+		t.Errorf("expected replayed segments to be deleted, got %v", files)
+	}
+
+	stats := sw.Stats()
+	if stats.Spooled != 11 || stats.Replayed != 11 || stats.PendingBytes != 0 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+
+	// With the spool empty, entries go straight to the primary again.
+	write(12)
+	if got := primary.written(); len(got) != len(want) {
+		t.Errorf("expected direct write after replay, got %d entries", len(got))
+	}
+}
+
+func TestSpoolWriter_ReplayResumesAfterFailure(t *testing.T) {
+	primary := &toggleWriter{down: true}
+	sw, err := NewSpoolWriter(primary, t.TempDir(), WithSpoolReplayInterval(0))
+	if err != nil {
+		t.Fatalf("NewSpoolWriter failed: %v", err)
+	}
+	defer sw.Close()
+
+	sw.Write([]byte("a"))
+	sw.Write([]byte("b"))
+	if err := sw.Replay(); err == nil {
+		t.Fatal("expected Replay to fail while the primary is down")
+	}
+
+	primary.setDown(false)
+	if err := sw.Replay(); err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	if got := primary.written(); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("unexpected entries: %q", got)
+	}
+}
+
+func TestSpoolWriter_Full(t *testing.T) {
+	sw, err := NewSpoolWriter(&FailWriter{}, t.TempDir(), WithSpoolReplayInterval(0), WithSpoolMaxSize(20))
+	if err != nil {
+		t.Fatalf("NewSpoolWriter failed: %v", err)
+	}
+	defer sw.Close()
+
+	if _, err := sw.Write([]byte("0123456789")); err != nil {
+		t.Fatalf("first Write failed: %v", err)
+	}
+	if _, err := sw.Write([]byte("0123456789")); !errors.Is(err, ErrSpoolFull) {
+		t.Errorf("expected ErrSpoolFull, got %v", err)
+	}
+	if stats := sw.Stats(); stats.Dropped != 1 {
+		t.Errorf("expected 1 dropped entry, got %+v", stats)
+	}
+}
+
+func TestSpoolWriter_RecoversSegmentsAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+	sw, err := NewSpoolWriter(&FailWriter{}, dir, WithSpoolReplayInterval(0))
+	if err != nil {
+		t.Fatalf("NewSpoolWriter failed: %v", err)
+	}
+	sw.Write([]byte("first"))
+	sw.Write([]byte("second"))
+	if err := sw.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	// Simulate a crash in the middle of appending a record.
+	files := spoolFiles(t, dir)
+	if len(files) != 1 {
+		t.Fatalf("expected 1 segment, got %v", files)
+	}
+	f, err := os.OpenFile(files[0], os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{0, 0, 0, 9, 1, 2})
+	f.Close()
+
+	primary := &toggleWriter{}
+	var handled []error
+	sw, err = NewSpoolWriter(primary, dir, WithSpoolReplayInterval(0),
+		WithSpoolErrorHandler(func(err error) { handled = append(handled, err) }))
+	if err != nil {
+		t.Fatalf("NewSpoolWriter failed: %v", err)
+	}
+	defer sw.Close()
+
+	if _, err := sw.Write([]byte("third")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if err := sw.Replay(); err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	if got := primary.written(); !reflect.DeepEqual(got, []string{"first", "second", "third"}) {
+		t.Errorf("unexpected entries: %q", got)
+	}
+	if len(handled) != 1 {
+		t.Errorf("expected the truncated record to be reported once, got %v", handled)
+	}
+	if files := spoolFiles(t, dir); len(files) != 0 {
+		t.Errorf("expected spool to be empty, got %v", files)
+	}
+}
+
+func TestSpoolWriter_CorruptLength(t *testing.T) {
+	dir := t.TempDir()
+	primary := &toggleWriter{down: true}
+	var handled []error
+	sw, err := NewSpoolWriter(primary, dir, WithSpoolReplayInterval(0),
+		WithSpoolErrorHandler(func(err error) { handled = append(handled, err) }))
+	if err != nil {
+		t.Fatalf("NewSpoolWriter failed: %v", err)
+	}
+	defer sw.Close()
+	for _, entry := range []string{"first", "second", "third", "fourth"} {
+		sw.Write([]byte(entry))
+	}
+
+	// Corrupt the length of the second record so that it claims 4 GiB
+	files := spoolFiles(t, dir)
+	if len(files) != 1 {
+		t.Fatalf("expected 1 segment, got %v", files)
+	}
+	f, err := os.OpenFile(files[0], os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteAt([]byte{0xff, 0xff, 0xff, 0xff}, spoolRecordHeaderSize+int64(len("first")))
+	f.Close()
+
+	primary.setDown(false)
+	if err := sw.Replay(); err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	if got := primary.written(); !reflect.DeepEqual(got, []string{"first"}) {
+		t.Errorf("unexpected entries: %q", got)
+	}
+	if stats := sw.Stats(); stats.Dropped != 3 || stats.Replayed != 1 {
+		t.Errorf("expected the 3 records after the corrupt length to be dropped, got %+v", stats)
+	}
+	if len(handled) != 1 {
+		t.Errorf("expected the corrupt segment to be reported once, got %v", handled)
+	}
+}
@@ -0,0 +1,416 @@
+package logharbour
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/core/search"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/sortorder"
+)
+
+const (
+	// DefaultTailBuffer is the capacity of the channel of a tail.
+	DefaultTailBuffer = 100
+	// DefaultTailPollInterval is how often QueryClient.Tail searches for new entries.
+	DefaultTailPollInterval = 2 * time.Second
+	// DefaultTailOverlap is how far back before the latest entry seen QueryClient.Tail searches,
+	// for entries which are indexed after later ones.
+	DefaultTailOverlap = 30 * time.Second
+
+	tailBatchSize    = 100
+	tailBatchTimeout = 200 * time.Millisecond
+)
+
+// ErrTailFilterUnsupported is returned by TailConsumer for GetLogsParam fields which cannot be
+// checked in memory.
+var ErrTailFilterUnsupported = errors.New("filter not supported by tail")
+
+// TailOption configures TailConsumer and QueryClient.Tail.
+type TailOption func(*tailOptions)
+
+type tailOptions struct {
+	buffer       int
+	pollInterval time.Duration
+	overlap      time.Duration
+	registry     *RealmRegistry
+	realm        string
+	onError      func(error)
+}
+
+// WithTailBuffer sets the capacity of the channel of a tail (DefaultTailBuffer by default).
+func WithTailBuffer(n int) TailOption {
+	return func(o *tailOptions) {
+		o.buffer = n
+	}
+}
+
+// WithTailPollInterval sets how often QueryClient.Tail searches for new entries
+// (DefaultTailPollInterval by default), and how far back it searches (DefaultTailOverlap).
+func WithTailPollInterval(interval, overlap time.Duration) TailOption {
+	return func(o *tailOptions) {
+		o.pollInterval = interval
+		o.overlap = overlap
+	}
+}
+
+// WithTailRealm makes TailConsumer pass on only the entries of one realm: those of messages
+// whose write token belongs to realm in registry. Without it, the entries of all realms on
+// the topic are passed on.
+func WithTailRealm(registry *RealmRegistry, realm string) TailOption {
+	return func(o *tailOptions) {
+		o.registry = registry
+		o.realm = realm
+	}
+}
+
+// WithTailErrors sets a function which is called with the errors met by a tail which do not
+// end it, such as messages which cannot be decoded. They are ignored by default.
+func WithTailErrors(fn func(error)) TailOption {
+	return func(o *tailOptions) {
+		o.onError = fn
+	}
+}
+
+func newTailOptions(opts []TailOption) *tailOptions {
+	o := &tailOptions{
+		buffer:       DefaultTailBuffer,
+		pollInterval: DefaultTailPollInterval,
+		overlap:      DefaultTailOverlap,
+		onError:      func(error) {},
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// tailSink is the channel of a tail, which may be closed while entries are being sent.
+type tailSink struct {
+	ctx    context.Context
+	mu     sync.RWMutex
+	closed bool
+	ch     chan LogEntry
+}
+
+// send sends entry, waiting for the reader unless the tail has ended. It reports whether the
+// tail goes on.
+func (s *tailSink) send(entry LogEntry) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return false
+	}
+	select {
+	case s.ch <- entry:
+		return true
+	case <-s.ctx.Done():
+		return false
+	}
+}
+
+func (s *tailSink) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.ch)
+	}
+}
+
+// TailConsumer streams the log entries received by a Kafka consumer which match the filters of
+// logParam, in the order they are received, until ctx is done; the channel is then closed.
+// newConsumer creates the consumer with the handler it is given, usually with NewConsumer and
+// OffsetLatest, so that only entries logged from now on are streamed.
+//
+// The filters are checked in memory, see MatchLogParam; Query is not supported. The reader of
+// the channel holds back the consumer, which waits for each entry to be read.
+func TailConsumer(ctx context.Context, newConsumer func(MessageHandler) (Consumer, error), logParam GetLogsParam, opts ...TailOption) (<-chan LogEntry, error) {
+	o := newTailOptions(opts)
+	match, err := MatchLogParam(logParam)
+	if err != nil {
+		return nil, err
+	}
+	sink := &tailSink{ctx: ctx, ch: make(chan LogEntry, o.buffer)}
+
+	handler := func(messages []*sarama.ConsumerMessage) error {
+		for _, message := range messages {
+			if o.registry != nil {
+				realm, err := o.registry.LookupWriteToken(messageWriteToken(message))
+				if err != nil || realm.ShortName != o.realm {
+					continue
+				}
+			}
+			var entry LogEntry
+			if err := json.Unmarshal(message.Value, &entry); err != nil {
+				o.onError(fmt.Errorf("error decoding message at offset %d of partition %d: %w", message.Offset, message.Partition, err))
+				continue
+			}
+			if match(&entry) && !sink.send(entry) {
+				return nil
+			}
+		}
+		return nil
+	}
+
+	consumer, err := newConsumer(handler)
+	if err != nil {
+		return nil, err
+	}
+	errs, err := consumer.Start(tailBatchSize, tailBatchTimeout)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		for {
+			select {
+			case err, ok := <-errs:
+				if !ok {
+					errs = nil
+					continue
+				}
+				o.onError(err)
+			case <-ctx.Done():
+				if err := consumer.Stop(); err != nil {
+					o.onError(err)
+				}
+				sink.close()
+				return
+			}
+		}
+	}()
+	return sink.ch, nil
+}
+
+// messageWriteToken returns the write token carried by a message, or "" if there is none.
+func messageWriteToken(message *sarama.ConsumerMessage) string {
+	for _, h := range message.Headers {
+		if h != nil && string(h.Key) == WriteTokenHeader {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+// Tail streams the log entries matching the filters of logParam as they are indexed, oldest
+// first, until ctx is done; the channel is then closed. It searches for new entries every
+// poll interval, starting with those logged from FromTS, or from now if FromTS is nil.
+//
+// Each search goes back a little before the latest entry seen (see WithTailPollInterval),
+// so that entries indexed after later ones are not missed; entries delayed by more than that
+// are. Errors of a search are passed to the function set with WithTailErrors, and the search
+// is retried at the next poll, except for query token errors, which end the tail.
+func (qc *QueryClient) Tail(ctx context.Context, logParam GetLogsParam, opts ...TailOption) (<-chan LogEntry, error) {
+	o := newTailOptions(opts)
+	start := time.Now().UTC()
+	if logParam.FromTS != nil {
+		start = logParam.FromTS.UTC()
+	}
+	// The time range is that of the tail, and entries are sorted oldest first
+	logParam.FromTS, logParam.NDays = nil, nil
+	logParam.Cursor, logParam.SearchAfterTS, logParam.SearchAfterDocID = nil, nil, nil
+	filters, err := getLogsQuery(logParam)
+	if err != nil && !errors.Is(err, errNoFilter) {
+		return nil, err
+	}
+
+	t := &tailPoller{qc: qc, filters: filters, toTS: logParam.ToTS, start: start, latest: start, overlap: o.overlap, seen: make(map[string]time.Time)}
+	sink := &tailSink{ctx: ctx, ch: make(chan LogEntry, o.buffer)}
+	go func() {
+		defer sink.close()
+		ticker := time.NewTicker(o.pollInterval)
+		defer ticker.Stop()
+		for {
+			if err := t.poll(ctx, sink); err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				o.onError(err)
+				if isQueryTokenError(err) {
+					return
+				}
+			}
+			// Entries logged up to ToTS are given the overlap to be indexed
+			if t.toTS != nil && time.Now().After(t.toTS.Add(t.overlap)) {
+				return
+			}
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return sink.ch, nil
+}
+
+// isQueryTokenError reports whether err is due to the query token, which retrying won't fix.
+func isQueryTokenError(err error) bool {
+	return errors.Is(err, ErrRevokedQueryToken) || errors.Is(err, ErrUnknownQueryToken)
+}
+
+// tailPoller holds the state of QueryClient.Tail between searches.
+type tailPoller struct {
+	qc      *QueryClient
+	filters *types.Query // nil if every entry matches
+	toTS    *time.Time
+	start   time.Time
+	latest  time.Time // when of the latest entry seen, or the start of the tail
+	overlap time.Duration
+	seen    map[string]time.Time // entries sent within the overlap, by id
+}
+
+// poll sends the entries indexed since the last search.
+func (t *tailPoller) poll(ctx context.Context, sink *tailSink) error {
+	fromTS := t.latest.Add(-t.overlap)
+	if fromTS.Before(t.start) {
+		fromTS = t.start
+	}
+	from := fromTS.Format(time.RFC3339Nano)
+	timeRange := types.DateRangeQuery{Gte: &from}
+	if t.toTS != nil {
+		to := t.toTS.Format(layout)
+		timeRange.Lte = &to
+	}
+	query := &types.Query{Bool: &types.BoolQuery{
+		Filter: []types.Query{{Range: map[string]types.RangeQuery{when: timeRange}}},
+	}}
+	if t.filters != nil {
+		query.Bool.Must = []types.Query{*t.filters}
+	}
+	size := tailBatchSize
+	req := &search.Request{
+		Size:  &size,
+		Query: query,
+		Sort: []types.SortCombinations{
+			types.SortOptions{SortOptions: map[string]types.FieldSort{when: {Order: &sortorder.Asc}}},
+			types.SortOptions{SortOptions: map[string]types.FieldSort{id: {Order: &sortorder.Asc}}},
+		},
+	}
+
+	for {
+		res, err := t.qc.search(ctx, req)
+		if err != nil {
+			return fmt.Errorf("error polling for new entries: %w", err)
+		}
+		for _, hit := range res.Hits.Hits {
+			var entry LogEntry
+			if err := json.Unmarshal(hit.Source_, &entry); err != nil {
+				return fmt.Errorf("error while unmarshalling response:%v", err)
+			}
+			if _, ok := t.seen[entry.Id]; ok {
+				continue
+			}
+			if !sink.send(entry) {
+				return ctx.Err()
+			}
+			t.seen[entry.Id] = entry.When
+			if entry.When.After(t.latest) {
+				t.latest = entry.When
+			}
+		}
+		if len(res.Hits.Hits) < size {
+			break
+		}
+		req.SearchAfter = res.Hits.Hits[len(res.Hits.Hits)-1].Sort
+	}
+
+	// Entries before the overlap will not be searched again
+	for id, when := range t.seen {
+		if when.Before(t.latest.Add(-t.overlap)) {
+			delete(t.seen, id)
+		}
+	}
+	return nil
+}
+
+// MatchLogParam returns a function which reports whether a log entry matches the filters of
+// logParam, for entries which are not searched in Elasticsearch, such as those of TailConsumer.
+//
+// Filters have the same meaning as for GetLogs, except that Text, and OldValue and NewValue
+// of Changes, match if all their words are found in the text, ignoring case. Query is not
+// supported, and the paging fields are ignored.
+func MatchLogParam(logParam GetLogsParam) (func(*LogEntry) bool, error) {
+	if logParam.Query != nil && strings.TrimSpace(*logParam.Query) != "" {
+		return nil, fmt.Errorf("%w: Query", ErrTailFilterUnsupported)
+	}
+	var from time.Time
+	if logParam.FromTS != nil {
+		from = *logParam.FromTS
+	} else if logParam.NDays != nil && *logParam.NDays > 0 {
+		y, m, d := time.Now().UTC().Date()
+		from = time.Date(y, m, d-*logParam.NDays, 0, 0, 0, 0, time.UTC)
+	}
+
+	equal := func(want *string, value string) bool {
+		return want == nil || *want == value
+	}
+	return func(e *LogEntry) bool {
+		if !equal(logParam.App, e.App) || !equal(logParam.Module, e.Module) || !equal(logParam.Who, e.Who) ||
+			!equal(logParam.Class, e.Class) || !equal(logParam.Instance, e.InstanceId) || !equal(logParam.Operation, e.Op) ||
+			!equal(logParam.RemoteIP, e.RemoteIP) || !equal(logParam.TraceID, e.TraceId) {
+			return false
+		}
+		if logParam.Type != nil && e.Type != *logParam.Type {
+			return false
+		}
+		if logParam.Priority != nil && e.Pri < *logParam.Priority {
+			return false
+		}
+		if e.When.Before(from) || logParam.ToTS != nil && e.When.After(*logParam.ToTS) {
+			return false
+		}
+		var changes []ChangeDetail
+		var activityData string
+		if e.Data != nil {
+			activityData = e.Data.ActivityData
+			if e.Data.ChangeData != nil {
+				changes = e.Data.ChangeData.Changes
+			}
+		}
+		if logParam.Text != nil && !containsWords(*logParam.Text, e.Msg, e.Error, activityData) {
+			return false
+		}
+		if logParam.Field != nil && !matchesChange(changes, &ChangeSearch{Field: logParam.Field}) {
+			return false
+		}
+		if logParam.Changes != nil && !matchesChange(changes, logParam.Changes) {
+			return false
+		}
+		return true
+	}, nil
+}
+
+// matchesChange reports whether a single change satisfies all the conditions of cs.
+func matchesChange(changes []ChangeDetail, cs *ChangeSearch) bool {
+	for _, change := range changes {
+		if cs.Field != nil && change.Field != *cs.Field {
+			continue
+		}
+		if cs.OldValue != nil && !containsWords(*cs.OldValue, fmt.Sprint(change.OldVal)) {
+			continue
+		}
+		if cs.NewValue != nil && !containsWords(*cs.NewValue, fmt.Sprint(change.NewVal)) {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// containsWords reports whether every word of text is found in one of values, ignoring case.
+func containsWords(text string, values ...string) bool {
+	haystack := strings.ToLower(strings.Join(values, "\n"))
+	for _, word := range strings.Fields(strings.ToLower(text)) {
+		if !strings.Contains(haystack, word) {
+			return false
+		}
+	}
+	return true
+}
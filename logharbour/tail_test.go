@@ -0,0 +1,168 @@
+package logharbour
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+func TestMatchLogParam(t *testing.T) {
+	entry := LogEntry{
+		App: "billing", Module: "payments", Type: Change, Pri: Warn, When: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+		Who: "alice", Class: "invoice", InstanceId: "42", Op: "update", Msg: "Payment Timeout at gateway",
+		Data: &LogData{ChangeData: &ChangeInfo{Entity: "invoice", Changes: []ChangeDetail{
+			{Field: "amount", OldVal: 100.0, NewVal: 250.0},
+			{Field: "status", OldVal: "open", NewVal: "paid"},
+		}}},
+	}
+	s := func(v string) *string { return &v }
+	pri, info := Err, Info
+	activity := Activity
+	from := time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		param GetLogsParam
+		want  bool
+	}{
+		{"no filter", GetLogsParam{}, true},
+		{"fields", GetLogsParam{App: s("billing"), Module: s("payments"), Who: s("alice"), Class: s("invoice"), Instance: s("42"), Operation: s("update")}, true},
+		{"other app", GetLogsParam{App: s("crux")}, false},
+		{"priority at least", GetLogsParam{Priority: &info}, true},
+		{"priority too low", GetLogsParam{Priority: &pri}, false},
+		{"type", GetLogsParam{Type: &activity}, false},
+		{"before from", GetLogsParam{FromTS: &from}, false},
+		{"text", GetLogsParam{Text: s("timeout payment")}, true},
+		{"text missing a word", GetLogsParam{Text: s("timeout refund")}, false},
+		{"field", GetLogsParam{Field: s("status")}, true},
+		{"change", GetLogsParam{Changes: &ChangeSearch{Field: s("status"), NewValue: s("paid")}}, true},
+		{"change values of different changes", GetLogsParam{Changes: &ChangeSearch{Field: s("amount"), NewValue: s("paid")}}, false},
+	}
+	for _, tt := range tests {
+		match, err := MatchLogParam(tt.param)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := match(&entry); got != tt.want {
+			t.Errorf("%s: match = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := MatchLogParam(GetLogsParam{Query: s("app:billing")}); !errors.Is(err, ErrTailFilterUnsupported) {
+		t.Errorf("expected ErrTailFilterUnsupported for Query, got %v", err)
+	}
+}
+
+// fakeConsumer is a Consumer whose messages are passed to its handler by the test.
+type fakeConsumer struct {
+	handler MessageHandler
+	stopped chan struct{}
+}
+
+func (c *fakeConsumer) Start(batchSize int, batchTimeout time.Duration) (<-chan error, error) {
+	return make(chan error), nil
+}
+
+func (c *fakeConsumer) Stop() error {
+	close(c.stopped)
+	return nil
+}
+
+func TestTailConsumer(t *testing.T) {
+	registry, err := NewRealmRegistry(
+		Realm{ShortName: "acme", Index: "logharbour_acme", WriteTokens: []string{"w-acme"}},
+		Realm{ShortName: "other", Index: "logharbour_other", WriteTokens: []string{"w-other"}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	consumer := &fakeConsumer{stopped: make(chan struct{})}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	appName := "billing"
+	var errs []error
+
+	entries, err := TailConsumer(ctx, func(h MessageHandler) (Consumer, error) {
+		consumer.handler = h
+		return consumer, nil
+	}, GetLogsParam{App: &appName}, WithTailRealm(registry, "acme"), WithTailErrors(func(err error) { errs = append(errs, err) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	message := func(token, value string) *sarama.ConsumerMessage {
+		return &sarama.ConsumerMessage{
+			Value:   []byte(value),
+			Headers: []*sarama.RecordHeader{{Key: []byte(WriteTokenHeader), Value: []byte(token)}},
+		}
+	}
+	if err := consumer.handler([]*sarama.ConsumerMessage{
+		message("w-other", `{"id": "1", "app": "billing"}`),
+		message("w-acme", `{"id": "2", "app": "crux"}`),
+		message("w-acme", `not json`),
+		message("w-acme", `{"id": "3", "app": "billing"}`),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if entry := <-entries; entry.Id != "3" {
+		t.Errorf("got entry %q, want 3", entry.Id)
+	}
+	if len(errs) != 1 {
+		t.Errorf("expected one decoding error, got %v", errs)
+	}
+
+	cancel()
+	<-consumer.stopped
+	if _, ok := <-entries; ok {
+		t.Error("expected the channel to be closed")
+	}
+}
+
+func TestQueryClient_Tail(t *testing.T) {
+	f, client := newFakeSearchServer(t, fakeExportPage2)
+	qc := NewQueryClient(client, "logharbour_acme")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	appName := "billing"
+	from := time.Date(2025, 12, 31, 0, 0, 0, 0, time.UTC)
+
+	entries, err := qc.Tail(ctx, GetLogsParam{App: &appName, FromTS: &from}, WithTailPollInterval(5*time.Millisecond, time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry := <-entries; entry.Id != "a0" {
+		t.Errorf("got entry %q, want a0", entry.Id)
+	}
+
+	// Later searches find the same entry again, which is not sent twice
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		f.mu.Lock()
+		searches := f.searches
+		f.mu.Unlock()
+		if searches >= 3 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the tail stopped searching")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	select {
+	case entry := <-entries:
+		t.Errorf("entry %q sent twice", entry.Id)
+	default:
+	}
+
+	f.mu.Lock()
+	query := f.requests[0]["query"].(map[string]any)["bool"].(map[string]any)
+	f.mu.Unlock()
+	if gte := query["filter"].([]any)[0].(map[string]any)["range"].(map[string]any)["when"].(map[string]any)["gte"]; gte != "2025-12-31T00:00:00Z" {
+		t.Errorf("first search from %v, want the start of the tail", gte)
+	}
+
+	cancel()
+	for range entries {
+	}
+}
@@ -73,8 +73,7 @@ func TestGetLogs(t *testing.T) {
 				}
 
 			}
-			logharbour.Index = "logharbour"
-			tc.ActualLogEntries, tc.ActualRecords, err = logharbour.GetLogs("", typedClient, tc.LogsParam)
+			tc.ActualLogEntries, tc.ActualRecords, err = logharbour.GetLogs(queryToken, typedClient, tc.LogsParam)
 
 			if tc.ExpectError {
 				if err == nil {
@@ -175,8 +174,7 @@ func TestGetSet(t *testing.T) {
 	testCases := getSetTestCase()
 	for _, tc := range testCases {
 		t.Run(tc.Name, func(t *testing.T) {
-			logharbour.Index = "logharbour"
-			tc.ActualResponse, err = logharbour.GetSet("", typedClient, tc.SetAttribute, tc.GetSetParam)
+			tc.ActualResponse, err = logharbour.GetSet(queryToken, typedClient, tc.SetAttribute, tc.GetSetParam)
 
 			if tc.ExpectedError {
 				if err == nil {
@@ -264,8 +262,7 @@ func TestGetApps(t *testing.T) {
 	for _, tc := range testCases {
 		t.Run(tc.Name, func(t *testing.T) {
 
-			logharbour.Index = "logharbour"
-			tc.ActualResponse, err = logharbour.GetApps("", typedClient)
+			tc.ActualResponse, err = logharbour.GetApps(queryToken, typedClient)
 			if tc.ExpectedError {
 				if err == nil {
 					t.Error("expected error but got nil")
@@ -298,8 +295,7 @@ func TestGetUnusualIP(t *testing.T) {
 	for _, tc := range testCases {
 		t.Run(tc.Name, func(t *testing.T) {
 
-			logharbour.Index = "logharbour"
-			tc.ActualIps, err = logharbour.GetUnusualIP("", typedClient, tc.unusualPercent, tc.GetUnusualIPParam)
+			tc.ActualIps, err = logharbour.GetUnusualIP(queryToken, typedClient, tc.unusualPercent, tc.GetUnusualIPParam)
 
 			if tc.ExpectError {
 				if err == nil {
@@ -358,8 +354,7 @@ func TestUnusualIPList(t *testing.T) {
 			}
 			defer geoLiteCityDb.Close()
 
-			logharbour.Index = "logharbour"
-			tc.ActualIps, err = logharbour.ListUnusualIPs("", typedClient, geoLiteCityDb, tc.unusualPercent, tc.GetUnusualIPParam)
+			tc.ActualIps, err = logharbour.ListUnusualIPs(queryToken, typedClient, geoLiteCityDb, tc.unusualPercent, tc.GetUnusualIPParam)
 
 			if tc.ExpectError {
 				if err == nil {
@@ -21,7 +21,10 @@ var (
 	indexBody   = logharbour.ESLogsMapping
 	typedClient *es.TypedClient
 	filepath  = "../test/testData/testData.json"
-	indexName = "logharbour"
+	indexName = logharbour.RealmIndexPrefix + "test"
+	// queryToken is issued to the test realm in TestMain. It names no addresses, so queries
+	// are made with typedClient
+	queryToken string
 	timeout   = 500 * time.Second
 )
 
@@ -96,6 +99,9 @@ func TestMain(m *testing.M) {
 	if err := fillElasticWithData(esClient, indexName, indexBody, filepath); err != nil {
 		log.Fatalf("error while creating elastic search index: %v", err)
 	}
+	if queryToken, err = setupTestRealm(ctx, typedClient); err != nil {
+		log.Fatalf("error while creating the test realm: %v", err)
+	}
 
 	exitVal := m.Run()
 	os.Exit(exitVal)
@@ -119,3 +125,19 @@ func fillElasticWithData(esClient *es.Client, indexName, indexBody, filepath str
 	return nil
 
 }
+
+// setupTestRealm creates the realm of indexName with RealmAdmin, and makes the query
+// functions check tokens against a registry holding it. It returns the realm's query token.
+func setupTestRealm(ctx context.Context, client *es.TypedClient) (string, error) {
+	admin := logharbour.NewRealmAdmin(client, logharbour.WithRealmMetadataIndex("test_query_realms"))
+	realm, queryToken, err := admin.CreateRealm(ctx, "test", "Test realm", nil)
+	if err != nil {
+		return "", err
+	}
+	registry, err := logharbour.NewRealmRegistry(*realm)
+	if err != nil {
+		return "", err
+	}
+	logharbour.SetDefaultQueryTokenResolver(logharbour.NewQueryTokenResolver(logharbour.WithQueryTokenRegistry(registry)))
+	return queryToken, nil
+}
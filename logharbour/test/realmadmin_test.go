@@ -0,0 +1,80 @@
+package logharbour_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/remiges-tech/logharbour/logharbour"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRealmAdmin(t *testing.T) {
+	ctx := context.Background()
+	var audit bytes.Buffer
+	logger := logharbour.NewLogger(logharbour.NewLoggerContext(logharbour.Info), "lhadmin", &audit).WithWho("ops")
+	admin := logharbour.NewRealmAdmin(typedClient,
+		logharbour.WithRealmMetadataIndex("test_realms"),
+		logharbour.WithRealmAdminLogger(logger))
+
+	_, _, err := admin.CreateRealm(ctx, "Bad-Name", "Bad", nil)
+	assert.ErrorIs(t, err, logharbour.ErrInvalidRealmName)
+
+	realm, queryToken, err := admin.CreateRealm(ctx, "acme", "Acme Corporation", map[string]any{"plan": "gold"})
+	require.NoError(t, err)
+	assert.Equal(t, "logharbour_acme", realm.Index)
+	require.Len(t, realm.WriteTokens, 1)
+	assert.Equal(t, []string{logharbour.QueryTokenHash(queryToken)}, realm.QueryTokenHashes)
+
+	exists, err := typedClient.Indices.Exists(realm.Index).Do(ctx)
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	_, _, err = admin.CreateRealm(ctx, "acme", "Acme again", nil)
+	assert.ErrorIs(t, err, logharbour.ErrRealmExists)
+
+	oldWrite := realm.WriteTokens[0]
+	newWrite, kind, err := admin.RotateToken(ctx, "acme", oldWrite)
+	require.NoError(t, err)
+	assert.Equal(t, logharbour.TokenWrite, kind)
+	query2, err := admin.IssueToken(ctx, "acme", logharbour.TokenQuery)
+	require.NoError(t, err)
+	require.NoError(t, admin.RevokeToken(ctx, "acme", query2))
+	assert.ErrorIs(t, admin.RevokeToken(ctx, "acme", query2), logharbour.ErrTokenNotFound)
+	_, err = admin.IssueToken(ctx, "nosuchrealm", logharbour.TokenWrite)
+	assert.True(t, errors.Is(err, logharbour.ErrRealmNotFound))
+
+	realms, err := admin.ListRealms(ctx)
+	require.NoError(t, err)
+	require.Len(t, realms, 1)
+	assert.Equal(t, []string{newWrite}, realms[0].WriteTokens)
+	assert.Equal(t, []string{logharbour.QueryTokenHash(queryToken)}, realms[0].QueryTokenHashes)
+	assert.ElementsMatch(t, []string{oldWrite, logharbour.QueryTokenHash(query2)}, realms[0].RevokedTokens)
+
+	registry, err := logharbour.NewRealmRegistry(realms...)
+	require.NoError(t, err)
+	_, err = registry.LookupWriteToken(oldWrite)
+	assert.ErrorIs(t, err, logharbour.ErrRevokedWriteToken)
+	_, err = registry.LookupQueryToken(query2)
+	assert.ErrorIs(t, err, logharbour.ErrRevokedQueryToken)
+	found, err := registry.LookupQueryToken(queryToken)
+	require.NoError(t, err)
+	assert.Equal(t, "acme", found.ShortName)
+
+	// Every operation is audited as a Change entry, without the tokens themselves
+	ops := []string{}
+	for _, line := range strings.Split(strings.TrimSpace(audit.String()), "\n") {
+		var entry logharbour.LogEntry
+		require.NoError(t, json.Unmarshal([]byte(line), &entry))
+		assert.Equal(t, logharbour.Change, entry.Type)
+		assert.Equal(t, "ops", entry.Who)
+		ops = append(ops, entry.Op)
+	}
+	assert.Equal(t, []string{"Create", "RotateToken", "IssueToken", "RevokeToken"}, ops)
+	assert.NotContains(t, audit.String(), newWrite)
+	assert.NotContains(t, audit.String(), queryToken)
+}
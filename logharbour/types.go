@@ -7,6 +7,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"strings"
 	"sync"
 	"time"
 )
@@ -73,25 +74,42 @@ func (lp *LogPriority) UnmarshalJSON(data []byte) error {
 		return err
 	}
 
-	value, ok := map[string]LogPriority{
-		"Debug2": Debug2,
-		"Debug1": Debug1,
-		"Debug0": Debug0,
-		"Info":   Info,
-		"Warn":   Warn,
-		"Err":    Err,
-		"Crit":   Crit,
-		// Add other LogPriority values here
-	}[s]
+	value, err := ParseLogPriority(s)
+	if err != nil {
+		return err
+	}
 
-	if !ok {
-		return fmt.Errorf("invalid LogPriority %q", s)
+	*lp = value
+	return nil
+}
+
+// UnmarshalYAML decodes a priority written by name in a YAML configuration file, see LoadLogConfig.
+func (lp *LogPriority) UnmarshalYAML(unmarshal func(any) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+
+	value, err := ParseLogPriority(s)
+	if err != nil {
+		return err
 	}
 
 	*lp = value
 	return nil
 }
 
+// ParseLogPriority returns the LogPriority with the given name, e.g. "Info" or "Err".
+// Names are matched case-insensitively, so that configuration files may use "info" or "err".
+func ParseLogPriority(s string) (LogPriority, error) {
+	for pri := Debug2; pri <= Sec; pri++ {
+		if strings.EqualFold(s, pri.String()) {
+			return pri, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid LogPriority %q", s)
+}
+
 // LogType defines the category of a log message.
 type LogType int
 
@@ -181,6 +199,9 @@ type LogEntry struct {
 	Data       *LogData    `json:"data,omitempty"`      // The payload of the log entry, can be any type.
 	SpanId     string      `json:"span_id,omitempty"`   // Span ID of the tracing system
 	TraceId    string      `json:"trace_id,omitempty"`  // Trace ID of the tracing system
+	Seq        uint64      `json:"seq,omitempty"`       // Sequence number in the integrity chain of the app and system
+	PrevHash   string      `json:"prev_hash,omitempty"` // Hash of the previous entry in the integrity chain
+	Hash       string      `json:"hash,omitempty"`      // Hash or HMAC of this entry, see IntegrityChain
 }
 
 type LogData struct {
@@ -15,7 +15,15 @@ import (
 // and a placeholder error message is returned. This approach was chosen to avoid complicating the API
 // with error handling for what is expected to be a rare event. It allows the calling code to proceed,
 // potentially logging the conversion error alongside the intended log message.
+//
+// Struct fields with logharbour tags are replaced with DefaultRedactMarker; loggers use
+// convertRedacted with the redactFunc of their Redactor instead.
 func convertToString(value any) string {
+	return convertRedacted(value, markRedacted)
+}
+
+// convertRedacted is convertToString with the fields tagged `logharbour:"redact"` replaced by redact.
+func convertRedacted(value any, redact redactFunc) string {
 	// If the value is simple string no need to marshal it
 	// Marshalling string would result in double encoding
 	// where simple string like "hello" becomes "\"hello\""
@@ -23,6 +31,11 @@ func convertToString(value any) string {
 	if str, ok := value.(string); ok {
 		return str
 	}
+	// Redact struct fields tagged with `logharbour:"..."`, see Redactor
+	if tagged, ok := value.(taggedValue); ok {
+		value = tagged.value
+	}
+	value = applyRedactTags(value, redact)
 	bytes, err := json.Marshal(value)
 	if err != nil {
 		// Write the error to os.Stderr
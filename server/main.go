@@ -4,7 +4,10 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
+	"time"
 
 	"github.com/elastic/elastic-transport-go/v8/elastictransport"
 	"github.com/elastic/go-elasticsearch/v8"
@@ -119,6 +122,23 @@ func main() {
 		return
 	}
 
+	// Query tokens are checked against the realm registry exported by lhadmin, which maps
+	// their hashes to realm indices. The indices are searched with the server's own client,
+	// so the read credentials stay here and a token gives no access to Elasticsearch itself.
+	if appConfig.RealmRegistryFile == "" {
+		log.Fatalf("realm_registry_file is required to check query tokens")
+	}
+	realms, err := logharbour.LoadRealmRegistry(appConfig.RealmRegistryFile)
+	if err != nil {
+		log.Fatalf("Failed to load realm registry: %v", err)
+	}
+	reloadInterval := defaultRealmRegistryReloadInterval
+	if appConfig.RealmRegistryReloadInterval > 0 {
+		reloadInterval = time.Duration(appConfig.RealmRegistryReloadInterval) * time.Second
+	}
+	watchRealmRegistry(realms, appConfig.RealmRegistryFile, reloadInterval)
+	logharbour.SetDefaultQueryTokenResolver(logharbour.NewQueryTokenResolver(logharbour.WithQueryTokenRegistry(realms)))
+
 	// GeoLite2-City database
 	geoLiteCityDb, err := geoip2.Open(appConfig.GeoLiteDbPath)
 	if err != nil {
@@ -138,23 +158,27 @@ func main() {
 	// services
 	s := service.NewService(r).
 		WithLogHarbour(l).
-		WithDependency("client", client).
-		WithDependency("index", "logharbour")
+		WithDependency("client", client)
 
 	s.RegisterRouteWithGroup(apiV1Group, http.MethodPost, "/highprilog", wsc.GetHighprilog)
 	s.RegisterRouteWithGroup(apiV1Group, http.MethodPost, "/activitylog", wsc.ShowActivityLog)
 	s.RegisterRouteWithGroup(apiV1Group, http.MethodPost, "/debuglog", wsc.GetDebugLog)
 	s.RegisterRouteWithGroup(apiV1Group, http.MethodPost, "/datachange", wsc.ShowDataChange)
 	s.RegisterRouteWithGroup(apiV1Group, http.MethodPost, "/getset", wsc.GetSet)
+	s.RegisterRouteWithGroup(apiV1Group, http.MethodPost, "/gethistogram", wsc.GetHistogram)
 	s.RegisterRouteWithGroup(apiV1Group, http.MethodGet, "/getapps", wsc.GetApps)
+	s.RegisterRouteWithGroup(apiV1Group, http.MethodPost, "/searchlogs", wsc.SearchLogs)
+	s.RegisterRouteWithGroup(apiV1Group, http.MethodGet, "/tail", wsc.TailLogs)
 
-	// creating a seprate service for getting list of unusualIPS with geoLiteCityDb dependency
+	// creating a seprate service for the IP web services (unusual IPs, anomalies, logs for an IP) with geoLiteCityDb dependency
 	unusualIPServ := service.NewService(r).
 		WithLogHarbour(l).
 		WithDependency("client", client).
-		WithDependency("index", "logharbour").WithDependency("geoLiteCityDb", geoLiteCityDb)
+		WithDependency("geoLiteCityDb", geoLiteCityDb)
 
 	unusualIPServ.RegisterRouteWithGroup(apiV1Group, http.MethodPost, "/getunusualips", wsc.GetUnusualIPs)
+	unusualIPServ.RegisterRouteWithGroup(apiV1Group, http.MethodPost, "/getanomalies", wsc.GetAnomalies)
+	unusualIPServ.RegisterRouteWithGroup(apiV1Group, http.MethodPost, "/getlogsforip", wsc.GetLogsForIP)
 
 	err = r.Run(":" + appConfig.AppServerPort)
 	if err != nil {
@@ -164,6 +188,47 @@ func main() {
 
 }
 
+// defaultRealmRegistryReloadInterval is how often the realm registry file is checked for
+// changes if realm_registry_reload_interval is not set.
+const defaultRealmRegistryReloadInterval = 30 * time.Second
+
+// watchRealmRegistry reloads the realm registry from path when the process receives SIGHUP,
+// and when the file's size or modification time changes, checked every interval, so that
+// new realms and revoked tokens take effect without a restart. A registry which fails to
+// load is logged and the previous one is kept.
+func watchRealmRegistry(realms *logharbour.RealmRegistry, path string, interval time.Duration) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	tick := time.NewTicker(interval).C
+
+	var modTime time.Time
+	var size int64
+	stat := func() {
+		if info, err := os.Stat(path); err == nil {
+			modTime, size = info.ModTime(), info.Size()
+		}
+	}
+	stat()
+	go func() {
+		for {
+			select {
+			case <-signals:
+			case <-tick:
+				info, err := os.Stat(path)
+				if err != nil || info.ModTime().Equal(modTime) && info.Size() == size {
+					continue
+				}
+			}
+			stat()
+			if err := realms.Reload(path); err != nil {
+				log.Printf("Failed to reload realm registry %s, keeping the previous one: %v", path, err)
+				continue
+			}
+			log.Printf("Realm registry %s reloaded", path)
+		}
+	}()
+}
+
 func errorCodeSetup() {
 	// Define a custom validation tag-to-message ID map
 	customValidationMap := map[string]int{
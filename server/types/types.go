@@ -15,6 +15,10 @@ type AppConfig struct {
 	KeycloakClientID       string `json:"keycloak_client_id"`
 	CertificateFingerprint string `json:"certificate_fingerprint"`
 	GeoLiteDbPath          string  `json:"geolite_db_path"`
+	RealmRegistryFile      string  `json:"realm_registry_file"`
+	// RealmRegistryReloadInterval is the number of seconds between checks of the realm
+	// registry file for changes (default 30)
+	RealmRegistryReloadInterval int `json:"realm_registry_reload_interval"`
 }
 
 
@@ -8,18 +8,27 @@ const (
 )
 
 const (
-	MsgId_InternalErr     = 1001
-	MsgId_Invalid_Request = 1006
+	MsgId_InternalErr       = 1001
+	MsgId_Invalid_Request   = 1006
+	MsgId_InvalidQueryToken = 1007
+	MsgId_InvalidQuery      = 1008
+	MsgId_InvalidIP         = 1009
 )
 
 const (
-	ErrCode_Internal       = "internal_err"
-	ErrCode_InvalidRequest = "invalid_request"
-	ErrCode_InvalidJson    = "invalid_json"
-	ErrCode_DatabaseError  = "database_error"
-	App                    = "app"
+	ErrCode_Internal          = "internal_err"
+	ErrCode_InvalidRequest    = "invalid_request"
+	ErrCode_InvalidJson       = "invalid_json"
+	ErrCode_DatabaseError     = "database_error"
+	ErrCode_InvalidQueryToken = "invalid_query_token"
+	ErrCode_InvalidQuery      = "invalid_query"
+	ErrCode_InvalidIP         = "invalid_ip"
+	App                       = "app"
 )
 
+// QueryTokenHeader is the request header carrying the query token of the realm to query.
+const QueryTokenHeader = "X-Query-Token"
+
 var (
 	APP, PRI, DAYS, SEARCHAFTERTIMESTAMP, SEARCHAFTERDOCID, CLASS, INSTANCE string = "App", "Pri", "Days", "SearchAfterTimestamp", "SearchAfterDocId", "Class", "Instance"
 	Priority                                                                       = []string{"Debug2", "Debug1", "Debug0", "Info", "Warn", "Err", "Crit", "Sec"}
@@ -54,7 +54,7 @@ func ShowDataChange(c *gin.Context, s *service.Service) {
 	}
 
 	// response := logharbour.Change
-	searchQuery, recordCount, err = logharbour.GetChanges("", esClient, logharbour.GetLogsParam{
+	searchQuery, recordCount, err = logharbour.GetChanges(getQueryToken(c), esClient, logharbour.GetLogsParam{
 		App:              &request.App,
 		Who:              request.Who,
 		Class:            request.Class,
@@ -58,7 +58,7 @@ func GetDebugLog(c *gin.Context, s *service.Service) {
 	}
 
 	// call GetLogs()
-	debuglogs, count, err := logharbour.GetLogs("", client, logharbour.GetLogsParam{
+	debuglogs, count, err := logharbour.GetLogs(getQueryToken(c), client, logharbour.GetLogsParam{
 		App:              &request.App,
 		Module:           &request.Module,
 		Type:             &LogType,
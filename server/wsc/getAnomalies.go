@@ -0,0 +1,74 @@
+package wsc
+
+import (
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/oschwald/geoip2-golang"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+type GetAnomaliesReq struct {
+	App         string  `json:"app" validate:"required,alpha,lt=15"`
+	Who         *string `json:"who" validate:"omitempty,lt=20"`
+	Days        *int    `json:"days" validate:"omitempty,number,lt=500"`
+	RecentHours *int    `json:"recentHours" validate:"omitempty,number,lt=720"`
+	LoginOp     *string `json:"loginOp" validate:"omitempty,lt=25"`
+	TimeZone    *string `json:"timeZone" validate:"omitempty,lt=40"`
+}
+
+type GetAnomaliesResponse struct {
+	Users     []logharbour.UserAnomalies `json:"users"`
+	Truncated bool                       `json:"truncated"` // The history was cut short by the maximum number of entries read
+}
+
+// GetAnomalies returns the users of an app whose recent entries depart from their baseline:
+// logins from a new country, impossible travel, unusual hours and spikes of data changes, each
+// with a score and the evidence entries. Without a GeoLite database, locations are not checked.
+func GetAnomalies(c *gin.Context, s *service.Service) {
+	l := s.LogHarbour
+	l.Debug0().Log("starting execution of GetAnomalies()")
+	var req GetAnomaliesReq
+
+	err := wscutils.BindJSON(c, &req)
+	if err != nil {
+		l.Debug0().Error(err).Log("error unmarshalling request payload to struct")
+		return
+	}
+
+	// Validate request
+	validationErrors := wscutils.WscValidate(req, func(err validator.FieldError) []string { return []string{} })
+	if len(validationErrors) > 0 {
+		l.Debug0().LogDebug("standard validation errors", validationErrors)
+		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, validationErrors))
+		return
+	}
+
+	es, ok := s.Dependencies["client"].(*elasticsearch.TypedClient)
+	if !ok {
+		l.Debug0().Log("error while getting elasticsearch instance from service Dependencies")
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(MsgId_InternalErr, ErrCode_DatabaseError))
+		return
+	}
+	geoLiteDb, _ := s.Dependencies["geoLiteCityDb"].(*geoip2.Reader)
+
+	report, err := logharbour.GetAnomalies(getQueryToken(c), es, geoLiteDb, logharbour.GetAnomaliesParam{
+		App:         &req.App,
+		Who:         req.Who,
+		NDays:       req.Days,
+		RecentHours: req.RecentHours,
+		LoginOp:     req.LoginOp,
+		TimeZone:    req.TimeZone,
+	})
+	if err != nil {
+		errmsg := errorHandler(err)
+		l.Debug0().Error(err).Log("error in GetAnomalies web service call")
+		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{errmsg}))
+		return
+	}
+
+	l.Debug0().Log("finished execution of GetAnomalies()")
+	wscutils.SendSuccessResponse(c, wscutils.NewSuccessResponse(GetAnomaliesResponse{Users: report.Users, Truncated: report.Truncated}))
+}
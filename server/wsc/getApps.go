@@ -18,7 +18,7 @@ func GetApps(c *gin.Context, s *service.Service) {
 		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(MsgId_InternalErr, ErrCode_DatabaseError))
 		return
 	}
-	apps, err := logharbour.GetApps(queryToken, es)
+	apps, err := logharbour.GetApps(getQueryToken(c), es)
 	if err != nil {
 		errmsg := errorHandler(err)
 		l.Debug0().Error(err).Log("error in AppList")
@@ -0,0 +1,96 @@
+package wsc
+
+import (
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+type GetHistogramReq struct {
+	App      *string                 `json:"app" validate:"omitempty,alpha,lt=50"`
+	Interval string                  `json:"interval" validate:"required,lt=10"`
+	SplitBy  *string                 `json:"splitBy" validate:"omitempty,oneof=pri app module op status"`
+	TimeZone *string                 `json:"timeZone" validate:"omitempty,lt=40"`
+	Type     *logharbour.LogType     `json:"type" validate:"omitempty,oneof=1 2 3 4"`
+	Who      *string                 `json:"who" validate:"omitempty,alpha,lt=20"`
+	Class    *string                 `json:"class" validate:"omitempty,alpha,lt=30"`
+	Instance *string                 `json:"instance" validate:"omitempty,alpha,lt=30"`
+	Op       *string                 `json:"op" validate:"omitempty,alpha,lt=25"`
+	Fromts   *time.Time              `json:"fromts" validate:"omitempty"`
+	Tots     *time.Time              `json:"tots" validate:"omitempty"`
+	Ndays    *int                    `json:"ndays" validate:"omitempty,number,lt=100"`
+	RemoteIP *string                 `json:"remoteIP" validate:"omitempty"`
+	Pri      *logharbour.LogPriority `json:"pri" validate:"omitempty,oneof=1 2 3 4 5 6 7 8"`
+}
+
+type HistogramBucket struct {
+	Start time.Time        `json:"start"`
+	Count int64            `json:"count"`
+	Split map[string]int64 `json:"split,omitempty"`
+}
+
+// GetHistogram returns the number of log entries in each interval of time, optionally split
+// by the values of an attribute.
+func GetHistogram(c *gin.Context, s *service.Service) {
+	l := s.LogHarbour
+	l.Debug0().Log("starting execution of GetHistogram()")
+	var req GetHistogramReq
+
+	err := wscutils.BindJSON(c, &req)
+	if err != nil {
+		l.Debug0().Error(err).Log("error unmarshalling request payload to struct")
+		return
+	}
+
+	// Validate request
+	validationErrors := wscutils.WscValidate(req, func(err validator.FieldError) []string { return []string{} })
+	if len(validationErrors) > 0 {
+		l.Debug0().LogDebug("standard validation errors", validationErrors)
+		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, validationErrors))
+		return
+	}
+
+	es, ok := s.Dependencies["client"].(*elasticsearch.TypedClient)
+	if !ok {
+		l.Debug0().Log("error while getting elasticsearch instance from service Dependencies")
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(MsgId_InternalErr, ErrCode_DatabaseError))
+		return
+	}
+
+	histParam := logharbour.HistogramParam{
+		Interval: req.Interval,
+		SplitBy:  req.SplitBy,
+		TimeZone: req.TimeZone,
+	}
+	setParam := logharbour.GetSetParam{
+		App:      req.App,
+		Type:     req.Type,
+		Who:      req.Who,
+		Class:    req.Class,
+		Instance: req.Instance,
+		Op:       req.Op,
+		Fromts:   req.Fromts,
+		Tots:     req.Tots,
+		Ndays:    req.Ndays,
+		RemoteIP: req.RemoteIP,
+		Pri:      req.Pri,
+	}
+	buckets, err := logharbour.GetHistogram(getQueryToken(c), es, histParam, setParam)
+	if err != nil {
+		errmsg := errorHandler(err)
+		l.Debug0().Error(err).Log("error in GetHistogram web service call")
+		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{errmsg}))
+		return
+	}
+
+	res := make([]HistogramBucket, 0, len(buckets))
+	for _, b := range buckets {
+		res = append(res, HistogramBucket{Start: b.Start, Count: b.Count, Split: b.Split})
+	}
+	wscutils.SendSuccessResponse(c, wscutils.NewSuccessResponse(res))
+}
@@ -0,0 +1,81 @@
+package wsc
+
+import (
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/oschwald/geoip2-golang"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// GetLogsForIPReq is the request of GetLogsForIP. IP is an IPv4 or IPv6 address or a CIDR
+// range, e.g. 203.0.113.0/24.
+type GetLogsForIPReq struct {
+	App      string  `json:"app" validate:"required,alpha,lt=15"`
+	IP       string  `json:"ip" validate:"required,lt=50"`
+	Days     *int    `json:"days" validate:"omitempty,number,lt=500"`
+	Cursor   *string `json:"cursor" validate:"omitempty"`
+	PageSize *int    `json:"page_size" validate:"omitempty,number,gt=0,lte=1000"`
+}
+
+type GetLogsForIPResponse struct {
+	LogEntery  []logharbour.LogEntry            `json:"entries"`
+	Nrec       int                              `json:"nrec"`
+	NextCursor string                           `json:"next_cursor,omitempty"`
+	Locations  map[string]logharbour.IPLocation `json:"locations"`
+}
+
+// GetLogsForIP returns a page of the log entries of an app from an IP address or range, with
+// the GeoLite location of each IP. Pass the next_cursor of a response back as cursor to get
+// the next page.
+func GetLogsForIP(c *gin.Context, s *service.Service) {
+	l := s.LogHarbour
+	l.Debug0().Log("starting execution of GetLogsForIP()")
+	var req GetLogsForIPReq
+
+	err := wscutils.BindJSON(c, &req)
+	if err != nil {
+		l.Debug0().Error(err).Log("error unmarshalling request payload to struct")
+		return
+	}
+
+	// Validate request
+	validationErrors := wscutils.WscValidate(req, func(err validator.FieldError) []string { return []string{} })
+	if len(validationErrors) > 0 {
+		l.Debug0().LogDebug("standard validation errors", validationErrors)
+		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, validationErrors))
+		return
+	}
+
+	es, ok := s.Dependencies["client"].(*elasticsearch.TypedClient)
+	if !ok {
+		l.Debug0().Log("error while getting elasticsearch instance from service Dependencies")
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(MsgId_InternalErr, ErrCode_DatabaseError))
+		return
+	}
+	geoLiteDb, _ := s.Dependencies["geoLiteCityDb"].(*geoip2.Reader)
+
+	page, err := logharbour.GetLogsForIP(getQueryToken(c), es, geoLiteDb, logharbour.GetLogsForIPParam{
+		App:      &req.App,
+		IP:       req.IP,
+		NDays:    req.Days,
+		PageSize: req.PageSize,
+		Cursor:   req.Cursor,
+	})
+	if err != nil {
+		errmsg := errorHandler(err)
+		l.Debug0().Error(err).Log("error in GetLogsForIP web service call")
+		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{errmsg}))
+		return
+	}
+
+	l.Debug0().Log("finished execution of GetLogsForIP()")
+	wscutils.SendSuccessResponse(c, wscutils.NewSuccessResponse(GetLogsForIPResponse{
+		LogEntery:  page.Entries,
+		Nrec:       page.Total,
+		NextCursor: page.NextCursor,
+		Locations:  page.Locations,
+	}))
+}
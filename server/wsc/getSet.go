@@ -68,7 +68,7 @@ func GetSet(c *gin.Context, s *service.Service) {
 	if getSetReq.SetAttr == "field" {
 		getSetReq.SetAttr = "data.change_data.changes.field"
 	}
-	res, err := logharbour.GetSet(queryToken, es, getSetReq.SetAttr, getsetParam)
+	res, err := logharbour.GetSet(getQueryToken(c), es, getSetReq.SetAttr, getsetParam)
 	if err != nil {
 		errmsg := errorHandler(err)
 		l.Debug0().Error(err).Log("error in GetSet web service call")
@@ -57,7 +57,7 @@ func GetUnusualIPs(c *gin.Context, s *service.Service) {
 		return
 	}
 
-	unusualIPs, err = logharbour.ListUnusualIPs("", es, geoLiteDb, req.UnusualPercent, logharbour.GetUnusualIPParam{
+	unusualIPs, err = logharbour.ListUnusualIPs(getQueryToken(c), es, geoLiteDb, req.UnusualPercent, logharbour.GetUnusualIPParam{
 		App:   &req.App,
 		NDays: &req.Days,
 	})
@@ -51,7 +51,7 @@ func GetHighprilog(c *gin.Context, s *service.Service) {
 		return
 	}
 
-	searchQuery, recordCount, err = logharbour.GetLogs("", esClient, logharbour.GetLogsParam{
+	searchQuery, recordCount, err = logharbour.GetLogs(getQueryToken(c), esClient, logharbour.GetLogsParam{
 		App:              &request.App,
 		Priority:         &request.Pri,
 		NDays:            &request.Days,
@@ -0,0 +1,74 @@
+package wsc
+
+import (
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// SearchLogsRequest is the request of SearchLogs. Query is in the query language of
+// logharbour.ParseQuery, e.g. app:billing pri>=Warn when:[now-2d TO now].
+type SearchLogsRequest struct {
+	Query     string  `json:"query" validate:"required"`
+	Cursor    *string `json:"cursor" validate:"omitempty"`
+	PageSize  *int    `json:"page_size" validate:"omitempty,number,gt=0,lte=1000"`
+	Highlight bool    `json:"highlight"`
+}
+
+type SearchLogsResponse struct {
+	LogEntery  []logharbour.LogEntry          `json:"entries"`
+	Nrec       int                            `json:"nrec"`
+	NextCursor string                         `json:"next_cursor,omitempty"`
+	Highlights map[string]map[string][]string `json:"highlights,omitempty"`
+}
+
+// SearchLogs returns a page of the log entries matching a query. Pass the next_cursor of a
+// response back as cursor to get the next page.
+func SearchLogs(c *gin.Context, s *service.Service) {
+	l := s.LogHarbour
+	l.Debug0().Log("starting execution of SearchLogs()")
+
+	var req SearchLogsRequest
+
+	err := wscutils.BindJSON(c, &req)
+	if err != nil {
+		l.Debug0().Error(err).Log("error unmarshalling request payload to struct")
+		return
+	}
+
+	validationErrors := wscutils.WscValidate(req, func(err validator.FieldError) []string { return []string{} })
+	if len(validationErrors) > 0 {
+		l.Debug0().LogDebug("standard validation errors", validationErrors)
+		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, validationErrors))
+		return
+	}
+
+	es, ok := s.Dependencies["client"].(*elasticsearch.TypedClient)
+	if !ok {
+		l.Debug0().Log("Error while getting elasticsearch instance from service Dependencies")
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(MsgId_InternalErr, ErrCode_DatabaseError))
+		return
+	}
+
+	page, err := logharbour.GetLogsPage(getQueryToken(c), es, logharbour.GetLogsParam{
+		Query:     &req.Query,
+		Cursor:    req.Cursor,
+		PageSize:  req.PageSize,
+		Highlight: req.Highlight,
+	})
+	if err != nil {
+		errmsg := errorHandler(err)
+		l.Debug0().Error(err).Log("error in GetLogsPage")
+		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{errmsg}))
+		return
+	}
+	wscutils.SendSuccessResponse(c, wscutils.NewSuccessResponse(SearchLogsResponse{
+		LogEntery:  page.Entries,
+		Nrec:       page.Total,
+		NextCursor: page.NextCursor,
+		Highlights: page.Highlights,
+	}))
+}
@@ -1,7 +1,9 @@
 package wsc
 
 import (
+	"errors"
 	"fmt"
+	"strconv"
 
 	"github.com/elastic/go-elasticsearch/v8"
 	"github.com/gin-gonic/gin"
@@ -12,7 +14,6 @@ import (
 )
 
 var LogType = logharbour.Activity
-var queryToken string
 
 // var fromTs = time.Date(2024, 02, 01, 00, 00, 00, 00, time.UTC)
 // var toTs = time.Date(2024, 03, 01, 00, 00, 00, 00, time.UTC)
@@ -65,7 +66,7 @@ func ShowActivityLog(c *gin.Context, s *service.Service) {
 		return
 	}
 
-	res.LogEntery, res.Nrec, err = logharbour.GetLogs(queryToken, es, logharbour.GetLogsParam{
+	res.LogEntery, res.Nrec, err = logharbour.GetLogs(getQueryToken(c), es, logharbour.GetLogsParam{
 		App:       &req.App,
 		Type:      &LogType,
 		Who:       req.Who,
@@ -90,7 +91,36 @@ func ShowActivityLog(c *gin.Context, s *service.Service) {
 	wscutils.SendSuccessResponse(c, wscutils.NewSuccessResponse(res))
 }
 
+// getQueryToken returns the query token sent with the request.
+func getQueryToken(c *gin.Context) string {
+	return c.GetHeader(QueryTokenHeader)
+}
+
 func errorHandler(err error) wscutils.ErrorMessage {
+	if errors.Is(err, logharbour.ErrMissingQueryToken) || errors.Is(err, logharbour.ErrUnknownQueryToken) ||
+		errors.Is(err, logharbour.ErrRevokedQueryToken) {
+		return wscutils.BuildErrorMessage(MsgId_InvalidQueryToken, ErrCode_InvalidQueryToken, nil)
+	}
+	var syntaxErr *logharbour.QuerySyntaxError
+	if errors.As(err, &syntaxErr) {
+		field := "query"
+		return wscutils.BuildErrorMessage(MsgId_InvalidQuery, ErrCode_InvalidQuery, &field,
+			strconv.Itoa(syntaxErr.Pos), syntaxErr.Token, syntaxErr.Msg)
+	}
+	if errors.Is(err, logharbour.ErrInvalidIP) {
+		field := "ip"
+		return wscutils.BuildErrorMessage(MsgId_InvalidIP, ErrCode_InvalidIP, &field)
+	}
+	if errors.Is(err, logharbour.ErrInvalidCursor) {
+		return wscutils.BuildErrorMessage(MsgId_Invalid_Request, ErrCode_InvalidRequest, nil)
+	}
+	if errors.Is(err, logharbour.ErrInvalidAnomalyParam) {
+		return wscutils.BuildErrorMessage(MsgId_Invalid_Request, ErrCode_InvalidRequest, nil)
+	}
+	if errors.Is(err, logharbour.ErrInvalidInterval) {
+		field := "interval"
+		return wscutils.BuildErrorMessage(MsgId_Invalid_Request, ErrCode_InvalidRequest, &field)
+	}
 	switch err.Error() {
 	case "tots must be after fromts":
 		return wscutils.BuildErrorMessage(MsgId_Invalid_Request, ErrCode_InvalidRequest, nil)
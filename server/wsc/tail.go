@@ -0,0 +1,112 @@
+package wsc
+
+import (
+	"io"
+	"strings"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/gin-gonic/gin"
+	"github.com/remiges-tech/alya/service"
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/logharbour/logharbour"
+)
+
+// tailHeartbeat is how often TailLogs sends a ping event while no entry is logged, so that
+// proxies do not close the connection.
+const tailHeartbeat = 15 * time.Second
+
+// tailParam returns the filters of a TailLogs request, given as URL query parameters.
+func tailParam(c *gin.Context) (logharbour.GetLogsParam, *wscutils.ErrorMessage) {
+	var param logharbour.GetLogsParam
+	optional := func(key string) *string {
+		if v, ok := c.GetQuery(key); ok && v != "" {
+			return &v
+		}
+		return nil
+	}
+	param.App = optional("app")
+	param.Module = optional("module")
+	param.Who = optional("who")
+	param.Class = optional("class")
+	param.Instance = optional("instance")
+	param.Operation = optional("op")
+	param.RemoteIP = optional("remote_ip")
+	param.TraceID = optional("trace_id")
+	param.Text = optional("text")
+	param.Query = optional("query")
+
+	if pri := optional("pri"); pri != nil {
+		p, err := logharbour.ParseLogPriority(*pri)
+		if err != nil {
+			field := "pri"
+			errmsg := wscutils.BuildErrorMessage(MsgId_Invalid_Request, INVALID_PRIORITY, &field)
+			return param, &errmsg
+		}
+		param.Priority = &p
+	}
+	if t := optional("type"); t != nil {
+		logType, ok := map[string]logharbour.LogType{A: logharbour.Activity, C: logharbour.Change, D: logharbour.Debug}[strings.ToUpper(*t)]
+		if !ok {
+			field := "type"
+			errmsg := wscutils.BuildErrorMessage(MsgId_Invalid_Request, ErrCode_InvalidRequest, &field)
+			return param, &errmsg
+		}
+		param.Type = &logType
+	}
+	return param, nil
+}
+
+// TailLogs streams the log entries matching the filters of the request as Server-Sent Events
+// while they are logged, like tail -f. Each entry is sent as an "entry" event holding the
+// JSON of the LogEntry; "ping" events are sent while no entry is logged. The stream ends when
+// the client disconnects.
+func TailLogs(c *gin.Context, s *service.Service) {
+	l := s.LogHarbour
+	l.Debug0().Log("starting execution of TailLogs()")
+
+	param, errmsg := tailParam(c)
+	if errmsg != nil {
+		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{*errmsg}))
+		return
+	}
+
+	es, ok := s.Dependencies["client"].(*elasticsearch.TypedClient)
+	if !ok {
+		l.Debug0().Log("Error while getting elasticsearch instance from service Dependencies")
+		wscutils.SendErrorResponse(c, wscutils.NewErrorResponse(MsgId_InternalErr, ErrCode_DatabaseError))
+		return
+	}
+
+	// Errors in the query token and filters are found before the stream starts
+	qc, err := logharbour.NewQueryClientForToken(getQueryToken(c), es)
+	var entries <-chan logharbour.LogEntry
+	if err == nil {
+		entries, err = qc.Tail(c.Request.Context(), param, logharbour.WithTailErrors(func(err error) {
+			l.Debug0().Error(err).Log("error in TailLogs")
+		}))
+	}
+	if err != nil {
+		errmsg := errorHandler(err)
+		l.Debug0().Error(err).Log("error in TailLogs")
+		wscutils.SendErrorResponse(c, wscutils.NewResponse(wscutils.ErrorStatus, nil, []wscutils.ErrorMessage{errmsg}))
+		return
+	}
+
+	heartbeat := time.NewTicker(tailHeartbeat)
+	defer heartbeat.Stop()
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case entry, ok := <-entries:
+			if !ok {
+				return false
+			}
+			c.SSEvent("entry", entry)
+		case <-heartbeat.C:
+			c.SSEvent("ping", time.Now().UTC().Format(time.RFC3339))
+		}
+		return true
+	})
+}
@@ -0,0 +1,59 @@
+package wsc_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/logharbour/logharbour"
+	"github.com/remiges-tech/logharbour/server/wsc"
+	"github.com/remiges-tech/logharbour/server/wsc/test/testUtils"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetAnomalies(t *testing.T) {
+	testCases := getAnomaliesTestCase()
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			payload := bytes.NewBuffer(testUtils.MarshalJson(tc.RequestPayload))
+
+			res := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodPost, "/getanomalies", payload)
+			require.NoError(t, err)
+
+			r.ServeHTTP(res, req)
+
+			require.Equal(t, tc.ExpectedHttpCode, res.Code)
+			jsonData := testUtils.MarshalJson(tc.ExpectedResult)
+			require.JSONEq(t, string(jsonData), res.Body.String())
+		})
+	}
+}
+
+func getAnomaliesTestCase() []testUtils.TestCasesStruct {
+	zone := "Mars/Olympus"
+	return []testUtils.TestCasesStruct{{
+		Name:             "ERROR : invalid time zone",
+		RequestPayload:   wscutils.Request{Data: wsc.GetAnomaliesReq{App: "starmf", TimeZone: &zone}},
+		ExpectedHttpCode: http.StatusBadRequest,
+		ExpectedResult: &wscutils.Response{
+			Status: wscutils.ErrorStatus,
+			Data:   nil,
+			Messages: []wscutils.ErrorMessage{{
+				MsgID:   wsc.MsgId_Invalid_Request,
+				ErrCode: wsc.ErrCode_InvalidRequest,
+			}},
+		},
+	}, {
+		Name:             "SUCCESS : no anomalies",
+		RequestPayload:   wscutils.Request{Data: wsc.GetAnomaliesReq{App: "nosuchapp"}},
+		ExpectedHttpCode: http.StatusOK,
+		ExpectedResult: &wscutils.Response{
+			Status:   wscutils.SuccessStatus,
+			Data:     wsc.GetAnomaliesResponse{Users: []logharbour.UserAnomalies{}},
+			Messages: nil,
+		},
+	}}
+}
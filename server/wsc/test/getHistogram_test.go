@@ -0,0 +1,51 @@
+package wsc_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/logharbour/server/wsc"
+	"github.com/remiges-tech/logharbour/server/wsc/test/testUtils"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetHistogram(t *testing.T) {
+	testCases := getHistogramTestCase()
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			payload := bytes.NewBuffer(testUtils.MarshalJson(tc.RequestPayload))
+
+			res := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodPost, "/gethistogram", payload)
+			require.NoError(t, err)
+
+			r.ServeHTTP(res, req)
+
+			require.Equal(t, tc.ExpectedHttpCode, res.Code)
+			jsonData := testUtils.MarshalJson(tc.ExpectedResult)
+			require.JSONEq(t, string(jsonData), res.Body.String())
+		})
+	}
+}
+
+func getHistogramTestCase() []testUtils.TestCasesStruct {
+	app := "starmf"
+	interval := "interval"
+	return []testUtils.TestCasesStruct{{
+		Name:             "ERROR : invalid interval",
+		RequestPayload:   wscutils.Request{Data: wsc.GetHistogramReq{App: &app, Interval: "fortnight"}},
+		ExpectedHttpCode: http.StatusBadRequest,
+		ExpectedResult: &wscutils.Response{
+			Status: wscutils.ErrorStatus,
+			Data:   nil,
+			Messages: []wscutils.ErrorMessage{{
+				MsgID:   wsc.MsgId_Invalid_Request,
+				ErrCode: wsc.ErrCode_InvalidRequest,
+				Field:   &interval,
+			}},
+		},
+	}}
+}
@@ -0,0 +1,60 @@
+package wsc_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/logharbour/logharbour"
+	"github.com/remiges-tech/logharbour/server/wsc"
+	"github.com/remiges-tech/logharbour/server/wsc/test/testUtils"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetLogsForIP(t *testing.T) {
+	testCases := getLogsForIPTestCase()
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			payload := bytes.NewBuffer(testUtils.MarshalJson(tc.RequestPayload))
+
+			res := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodPost, "/getlogsforip", payload)
+			require.NoError(t, err)
+
+			r.ServeHTTP(res, req)
+
+			require.Equal(t, tc.ExpectedHttpCode, res.Code)
+			jsonData := testUtils.MarshalJson(tc.ExpectedResult)
+			require.JSONEq(t, string(jsonData), res.Body.String())
+		})
+	}
+}
+
+func getLogsForIPTestCase() []testUtils.TestCasesStruct {
+	ip := "ip"
+	return []testUtils.TestCasesStruct{{
+		Name:             "ERROR : invalid ip",
+		RequestPayload:   wscutils.Request{Data: wsc.GetLogsForIPReq{App: "starmf", IP: "10.0.0.0/33"}},
+		ExpectedHttpCode: http.StatusBadRequest,
+		ExpectedResult: &wscutils.Response{
+			Status: wscutils.ErrorStatus,
+			Data:   nil,
+			Messages: []wscutils.ErrorMessage{{
+				MsgID:   wsc.MsgId_InvalidIP,
+				ErrCode: wsc.ErrCode_InvalidIP,
+				Field:   &ip,
+			}},
+		},
+	}, {
+		Name:             "SUCCESS : no entries in range",
+		RequestPayload:   wscutils.Request{Data: wsc.GetLogsForIPReq{App: "starmf", IP: "192.0.2.0/24"}},
+		ExpectedHttpCode: http.StatusOK,
+		ExpectedResult: &wscutils.Response{
+			Status:   wscutils.SuccessStatus,
+			Data:     wsc.GetLogsForIPResponse{Locations: map[string]logharbour.IPLocation{}},
+			Messages: nil,
+		},
+	}}
+}
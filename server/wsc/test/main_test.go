@@ -27,7 +27,7 @@ var (
 	typedClient      *es.TypedClient
 	r                *gin.Engine
 	seedDataFilePath = "../../../logharbour/test/testData/testData.json"
-	indexName        = "logharbour"
+	indexName        = logharbour.RealmIndexPrefix + "test"
 	timeout          = 1000 * time.Second
 )
 
@@ -149,6 +149,25 @@ func registerRoutes(typedClient *es.TypedClient) (*gin.Engine, error) {
 	gin.SetMode(gin.TestMode)
 	r := gin.Default()
 
+	// Every request is made with the query token of the test realm, unless it carries its own.
+	// The realm is created with RealmAdmin on the index of the test data, and the server
+	// checks tokens against a registry holding it, as it does with realm_registry_file
+	admin := logharbour.NewRealmAdmin(typedClient, logharbour.WithRealmMetadataIndex("test_query_realms"))
+	realm, queryToken, err := admin.CreateRealm(context.Background(), "test", "Test realm", nil)
+	if err != nil {
+		return nil, err
+	}
+	registry, err := logharbour.NewRealmRegistry(*realm)
+	if err != nil {
+		return nil, err
+	}
+	logharbour.SetDefaultQueryTokenResolver(logharbour.NewQueryTokenResolver(logharbour.WithQueryTokenRegistry(registry)))
+	r.Use(func(c *gin.Context) {
+		if c.GetHeader(wsc.QueryTokenHeader) == "" {
+			c.Request.Header.Set(wsc.QueryTokenHeader, queryToken)
+		}
+	})
+
 	// logger setup
 	fallbackWriter := logharbour.NewFallbackWriter(os.Stdout, os.Stdout)
 	lctx := logharbour.NewLoggerContext(logharbour.Info)
@@ -187,12 +206,17 @@ func registerRoutes(typedClient *es.TypedClient) (*gin.Engine, error) {
 	s.RegisterRoute(http.MethodPost, "/datachange", wsc.ShowDataChange)
 	s.RegisterRoute(http.MethodGet, "/getapps", wsc.GetApps)
 	s.RegisterRoute(http.MethodPost, "/getset", wsc.GetSet)
+	s.RegisterRoute(http.MethodPost, "/gethistogram", wsc.GetHistogram)
+	s.RegisterRoute(http.MethodPost, "/searchlogs", wsc.SearchLogs)
+	s.RegisterRoute(http.MethodGet, "/tail", wsc.TailLogs)
 	// creating a seprate service for getting list of unusualIPS with geoLiteCityDb dependency
 	unusualIPServ := service.NewService(r).
 		WithLogHarbour(l).
 		WithDependency("client", typedClient).
-		WithDependency("index", "logharbour").WithDependency("geoLiteCityDb", geoLiteCityDb)
+		WithDependency("geoLiteCityDb", geoLiteCityDb)
 
 	unusualIPServ.RegisterRoute(http.MethodPost, "/getunusualips", wsc.GetUnusualIPs)
+	unusualIPServ.RegisterRoute(http.MethodPost, "/getanomalies", wsc.GetAnomalies)
+	unusualIPServ.RegisterRoute(http.MethodPost, "/getlogsforip", wsc.GetLogsForIP)
 	return r, nil
 }
@@ -0,0 +1,65 @@
+package wsc_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/logharbour/server/wsc"
+	"github.com/remiges-tech/logharbour/server/wsc/test/testUtils"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearchLogs(t *testing.T) {
+	testCases := searchLogsTestCase()
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			payload := bytes.NewBuffer(testUtils.MarshalJson(tc.RequestPayload))
+
+			res := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodPost, "/searchlogs", payload)
+			require.NoError(t, err)
+
+			r.ServeHTTP(res, req)
+
+			require.Equal(t, tc.ExpectedHttpCode, res.Code)
+			jsonData := testUtils.MarshalJson(tc.ExpectedResult)
+			require.JSONEq(t, string(jsonData), res.Body.String())
+		})
+	}
+}
+
+func searchLogsTestCase() []testUtils.TestCasesStruct {
+	query := "query"
+	return []testUtils.TestCasesStruct{{
+		Name:             "ERROR : unknown field",
+		RequestPayload:   wscutils.Request{Data: wsc.SearchLogsRequest{Query: "app:starmf colour:red"}},
+		ExpectedHttpCode: http.StatusBadRequest,
+		ExpectedResult: &wscutils.Response{
+			Status: wscutils.ErrorStatus,
+			Data:   nil,
+			Messages: []wscutils.ErrorMessage{{
+				MsgID:   wsc.MsgId_InvalidQuery,
+				ErrCode: wsc.ErrCode_InvalidQuery,
+				Field:   &query,
+				Vals:    []string{"12", "colour", "unknown field"},
+			}},
+		},
+	}, {
+		Name:             "ERROR : unclosed range",
+		RequestPayload:   wscutils.Request{Data: wsc.SearchLogsRequest{Query: "when:[now-2d TO now"}},
+		ExpectedHttpCode: http.StatusBadRequest,
+		ExpectedResult: &wscutils.Response{
+			Status: wscutils.ErrorStatus,
+			Data:   nil,
+			Messages: []wscutils.ErrorMessage{{
+				MsgID:   wsc.MsgId_InvalidQuery,
+				ErrCode: wsc.ErrCode_InvalidQuery,
+				Field:   &query,
+				Vals:    []string{"6", "[now-2d TO now", "missing ] or } at the end of the range"},
+			}},
+		},
+	}}
+}
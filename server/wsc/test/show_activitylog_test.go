@@ -21,7 +21,6 @@ func TestShowActivityLog(t *testing.T) {
 			payload := bytes.NewBuffer(testUtils.MarshalJson(tc.RequestPayload))
 
 			res := httptest.NewRecorder()
-			logharbour.Index = "logharbour_unit_test1"
 			req, err := http.NewRequest(http.MethodPost, "/activitylog", payload)
 			require.NoError(t, err)
 
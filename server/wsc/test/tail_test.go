@@ -0,0 +1,48 @@
+package wsc_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/remiges-tech/alya/wscutils"
+	"github.com/remiges-tech/logharbour/server/wsc"
+	"github.com/remiges-tech/logharbour/server/wsc/test/testUtils"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTailLogs(t *testing.T) {
+	pri, query := "pri", "query"
+	testCases := []struct {
+		Name           string
+		URL            string
+		ExpectedResult *wscutils.Response
+	}{{
+		Name: "ERROR : invalid priority",
+		URL:  "/tail?app=starmf&pri=Loud",
+		ExpectedResult: &wscutils.Response{
+			Status:   wscutils.ErrorStatus,
+			Messages: []wscutils.ErrorMessage{{MsgID: wsc.MsgId_Invalid_Request, ErrCode: wsc.INVALID_PRIORITY, Field: &pri}},
+		},
+	}, {
+		Name: "ERROR : invalid query",
+		URL:  "/tail?query=colour:red",
+		ExpectedResult: &wscutils.Response{
+			Status: wscutils.ErrorStatus,
+			Messages: []wscutils.ErrorMessage{{MsgID: wsc.MsgId_InvalidQuery, ErrCode: wsc.ErrCode_InvalidQuery, Field: &query,
+				Vals: []string{"1", "colour", "unknown field"}}},
+		},
+	}}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			res := httptest.NewRecorder()
+			req, err := http.NewRequest(http.MethodGet, tc.URL, nil)
+			require.NoError(t, err)
+
+			r.ServeHTTP(res, req)
+
+			require.Equal(t, http.StatusBadRequest, res.Code)
+			require.JSONEq(t, string(testUtils.MarshalJson(tc.ExpectedResult)), res.Body.String())
+		})
+	}
+}